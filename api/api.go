@@ -23,6 +23,7 @@ import (
 const (
 	_RESPONSE_TIMEOUT   = 800 * time.Millisecond
 	_TRACK_READ_TIMEOUT = 1500 * time.Millisecond
+	_USER_AGENT         = "okhttp/4.12.0"
 )
 
 var mTLSConfig = &tls.Config{
@@ -47,11 +48,6 @@ var mTLSConfig = &tls.Config{
 	MaxVersion: tls.VersionTLS12,
 }
 
-var httpClient = http.Client{Transport: &http.Transport{
-	TLSClientConfig:       mTLSConfig,
-	ResponseHeaderTimeout: _RESPONSE_TIMEOUT,
-}}
-
 func (e ResultError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Name, e.Message)
 }
@@ -64,26 +60,53 @@ func nowTimestamp() string {
 	)
 }
 
-func proccessRequest[RetT any](req *http.Request) (result RetT, invInfo InvocInfo, err error) {
+func proccessRequest[RetT any](client *YaMusicClient, req *http.Request, idempotent bool) (result RetT, invInfo InvocInfo, err error) {
 	req.Header.Add("x-Yandex-Music-Client", "YandexMusicAndroid/24024312")
-	req.Header.Add("User-Agent", "okhttp/4.12.0")
+	req.Header.Add("User-Agent", client.userAgent)
+
+	policy := client.retryPolicy
+	if !idempotent {
+		policy.MaxRetries = 0
+	}
+
+	err = policy.retry(req.Context(), func() (err error) {
+		result, invInfo, err = sendRequest[RetT](client, req)
+		return
+	})
+	return
+}
 
-	resp, err := httpClient.Do(req)
+func sendRequest[RetT any](client *YaMusicClient, req *http.Request) (result RetT, invInfo InvocInfo, err error) {
+	if req.GetBody != nil {
+		// the body is consumed by the previous attempt
+		req.Body, err = req.GetBody()
+		if err != nil {
+			return
+		}
+	}
+
+	resp, err := client.httpClient.Do(req)
 	if err != nil {
+		err = &RequestError{Kind: ErrNetwork, Err: err}
 		return
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == 200 {
+	if resp.StatusCode == http.StatusOK {
 		var respBody struct {
 			InvocationInfo InvocInfo `json:"invocationInfo"`
 			Result         RetT      `json:"result"`
 		}
 
 		dec := json.NewDecoder(resp.Body)
-		dec.Decode(&respBody)
-
+		err = dec.Decode(&respBody)
 		invInfo = respBody.InvocationInfo
+		if err != nil && err != io.EOF {
+			err = &RequestError{Kind: ErrBadResponse, StatusCode: resp.StatusCode, ReqId: invInfo.ReqId, Err: err}
+			return
+		}
+
+		err = nil
 		result = respBody.Result
 	} else {
 		var respBody struct {
@@ -91,54 +114,60 @@ func proccessRequest[RetT any](req *http.Request) (result RetT, invInfo InvocInf
 			Error          ResultError `json:"error"`
 		}
 
+		reqErr := statusError(resp)
+
+		// the body isn't a JSON if the error comes from a proxy or a balancer
 		dec := json.NewDecoder(resp.Body)
-		dec.Decode(&respBody)
+		if dec.Decode(&respBody) == nil {
+			invInfo = respBody.InvocationInfo
+			reqErr.ReqId = invInfo.ReqId
+			reqErr.Result = respBody.Error
+		}
 
-		invInfo = respBody.InvocationInfo
-		err = respBody.Error
+		err = reqErr
 	}
 
 	return
 }
 
-func getRequest[RetT any](token, reqPath string, params url.Values) (result RetT, invInfo InvocInfo, err error) {
-	reqUrl, err := url.JoinPath(YaMusicServerURL, reqPath)
+func getRequest[RetT any](ctx context.Context, client *YaMusicClient, reqPath string, params url.Values) (result RetT, invInfo InvocInfo, err error) {
+	reqUrl, err := url.JoinPath(client.baseUrl, reqPath)
 	if err != nil {
 		return
 	}
 	if params != nil {
 		reqUrl += "?" + params.Encode()
 	}
-	req, err := http.NewRequest(http.MethodGet, reqUrl, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqUrl, nil)
 	if err != nil {
 		return
 	}
 
 	req.Header.Set("accept", "application/json")
-	req.Header.Set("Authorization", "OAuth "+token)
+	req.Header.Set("Authorization", "OAuth "+client.token)
 
-	return proccessRequest[RetT](req)
+	return proccessRequest[RetT](client, req, true)
 }
 
-func postRequest[RetT any](token, reqPath string, params url.Values) (result RetT, invInfo InvocInfo, err error) {
-	reqUrl, err := url.JoinPath(YaMusicServerURL, reqPath)
+func postRequest[RetT any](ctx context.Context, client *YaMusicClient, reqPath string, params url.Values) (result RetT, invInfo InvocInfo, err error) {
+	reqUrl, err := url.JoinPath(client.baseUrl, reqPath)
 	if err != nil {
 		return
 	}
-	req, err := http.NewRequest(http.MethodPost, reqUrl, strings.NewReader(params.Encode()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl, strings.NewReader(params.Encode()))
 	if err != nil {
 		return
 	}
 
 	req.Header.Set("accept", "application/json")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Authorization", "OAuth "+token)
+	req.Header.Set("Authorization", "OAuth "+client.token)
 
-	return proccessRequest[RetT](req)
+	return proccessRequest[RetT](client, req, false)
 }
 
-func postRequestJson[RetT any](token, reqPath string, params url.Values, body any) (result RetT, invInfo InvocInfo, err error) {
-	reqUrl, err := url.JoinPath(YaMusicServerURL, reqPath)
+func postRequestJson[RetT any](ctx context.Context, client *YaMusicClient, reqPath string, params url.Values, body any) (result RetT, invInfo InvocInfo, err error) {
+	reqUrl, err := url.JoinPath(client.baseUrl, reqPath)
 	if err != nil {
 		return
 	}
@@ -149,20 +178,34 @@ func postRequestJson[RetT any](token, reqPath string, params url.Values, body an
 	if err != nil {
 		return
 	}
-	req, err := http.NewRequest(http.MethodPost, reqUrl, bytes.NewReader(bodyData))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl, bytes.NewReader(bodyData))
 	if err != nil {
 		return
 	}
 
 	req.Header.Set("accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "OAuth "+token)
+	req.Header.Set("Authorization", "OAuth "+client.token)
+
+	return proccessRequest[RetT](client, req, false)
+}
+
+func downloadRequest(ctx context.Context, client *YaMusicClient, reqUrl, mimeType string) (body io.ReadCloser, contentLen int64, err error) {
+	return downloadRangeRequest(ctx, client, reqUrl, mimeType, 0)
+}
 
-	return proccessRequest[RetT](req)
+// downloadRangeRequest downloads the data from the offset to the end.
+// Returns the length of the downloaded part.
+func downloadRangeRequest(ctx context.Context, client *YaMusicClient, reqUrl, mimeType string, offset int64) (body io.ReadCloser, contentLen int64, err error) {
+	err = client.retryPolicy.retry(ctx, func() (err error) {
+		body, contentLen, err = startDownload(ctx, client, reqUrl, mimeType, offset)
+		return
+	})
+	return
 }
 
-func downloadRequest(token, reqUrl, mimeType string) (body io.ReadCloser, contentLen int64, err error) {
-	ctx, cancel := context.WithCancel(context.Background())
+func startDownload(ctx context.Context, client *YaMusicClient, reqUrl, mimeType string, offset int64) (body io.ReadCloser, contentLen int64, err error) {
+	ctx, cancel := context.WithCancel(ctx)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqUrl, nil)
 	if err != nil {
 		cancel()
@@ -170,19 +213,54 @@ func downloadRequest(token, reqUrl, mimeType string) (body io.ReadCloser, conten
 	}
 
 	req.Header.Set("accept", mimeType)
-	req.Header.Set("Authorization", "OAuth "+token)
+	req.Header.Set("User-Agent", client.userAgent)
+	req.Header.Set("Authorization", "OAuth "+client.token)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 
-	resp, err := httpClient.Do(req)
+	resp, err := client.httpClient.Do(req)
 	if err != nil {
+		err = &RequestError{Kind: ErrNetwork, Err: err}
 		cancel()
 		return
 	}
 
-	if resp.StatusCode == 200 {
-		body = NewTimeLimitedReader(resp.Body, ctx, cancel, _TRACK_READ_TIMEOUT)
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		var start, end int64
+		_, scanErr := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/", &start, &end)
+		if scanErr != nil || start != offset || end < start {
+			err = &RequestError{
+				Kind: ErrBadResponse,
+				Err:  fmt.Errorf("content range '%s' doesn't start at %d", resp.Header.Get("Content-Range"), offset),
+			}
+			resp.Body.Close()
+			cancel()
+			return
+		}
+		body = NewTimeLimitedReader(resp.Body, ctx, cancel, client.readTimeout)
+		contentLen = end - start + 1
+	case resp.StatusCode == http.StatusOK && resp.ContentLength < 0:
+		err = &RequestError{Kind: ErrBadResponse, Err: errors.New("content length is unknown")}
+		resp.Body.Close()
+		cancel()
+	case resp.StatusCode == http.StatusOK:
+		body = NewTimeLimitedReader(resp.Body, ctx, cancel, client.readTimeout)
 		contentLen = resp.ContentLength
-	} else {
-		err = fmt.Errorf("error code %d", resp.StatusCode)
+		if offset > 0 {
+			// the server ignored the range, so skip the beginning of the data
+			_, err = io.CopyN(io.Discard, body, offset)
+			if err != nil {
+				body.Close()
+				body = nil
+				err = &RequestError{Kind: ErrNetwork, Err: err}
+				return
+			}
+			contentLen -= offset
+		}
+	default:
+		err = statusError(resp)
 		resp.Body.Close()
 		cancel()
 	}
@@ -250,13 +328,23 @@ func TrackCoverLink(track *Track, size int) string {
 	return fmt.Sprintf("https://%s%dx%d", track.CoverUri[:len(track.CoverUri)-2], size, size)
 }
 
-func DownloadTrackCover(dst io.Writer, track *Track, size int) (string, error) {
+func (client *YaMusicClient) DownloadTrackCover(dst io.Writer, track *Track, size int) (string, error) {
+	return client.DownloadTrackCoverContext(context.Background(), dst, track, size)
+}
+
+func (client *YaMusicClient) DownloadTrackCoverContext(ctx context.Context, dst io.Writer, track *Track, size int) (string, error) {
 	url := TrackCoverLink(track, size)
 	if len(url) == 0 {
 		return "", errors.New("cover not presented")
 	}
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", client.userAgent)
+
+	resp, err := client.httpClient.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -267,29 +355,77 @@ func DownloadTrackCover(dst io.Writer, track *Track, size int) (string, error) {
 }
 
 func NewClient(token string) (client *YaMusicClient, err error) {
+	return NewClientWithOptions(token, ClientOptions{})
+}
+
+func NewClientWithOptions(token string, opts ClientOptions) (client *YaMusicClient, err error) {
+	return NewClientContext(context.Background(), token, opts)
+}
+
+func NewClientContext(ctx context.Context, token string, opts ClientOptions) (client *YaMusicClient, err error) {
+	if len(opts.BaseUrl) == 0 {
+		opts.BaseUrl = YaMusicServerURL
+	}
+	if len(opts.UserAgent) == 0 {
+		opts.UserAgent = _USER_AGENT
+	}
+	if opts.ResponseTimeout == 0 {
+		opts.ResponseTimeout = _RESPONSE_TIMEOUT
+	}
+	if opts.ReadTimeout == 0 {
+		opts.ReadTimeout = _TRACK_READ_TIMEOUT
+	}
+	if opts.Retry == nil {
+		opts.Retry = &DefaultRetryPolicy
+	}
+	if opts.Transport == nil {
+		// the custom transport is used as is, so the response timeout is applied only to the default one
+		opts.Transport = &http.Transport{
+			TLSClientConfig:       mTLSConfig,
+			ResponseHeaderTimeout: opts.ResponseTimeout,
+		}
+	}
+
 	client = &YaMusicClient{
-		token: token,
+		token:       token,
+		baseUrl:     opts.BaseUrl,
+		userAgent:   opts.UserAgent,
+		readTimeout: opts.ReadTimeout,
+		retryPolicy: *opts.Retry,
+		httpClient:  &http.Client{Transport: opts.Transport},
 	}
 
-	clientStatus, _, err := getRequest[UserStatus](token, "account/status", nil)
+	clientStatus, _, err := getRequest[UserStatus](ctx, client, "account/status", nil)
 	client.userid = clientStatus.Account.Uid
 
 	return
 }
 
 func (client *YaMusicClient) Tracks(trackIds []string) (tracks []Track, err error) {
-	tracks, _, err = postRequest[[]Track](client.token, "/tracks", url.Values{"track-ids": trackIds, "with-positions": {"false"}})
+	return client.TracksContext(context.Background(), trackIds)
+}
+
+func (client *YaMusicClient) TracksContext(ctx context.Context, trackIds []string) (tracks []Track, err error) {
+	// it's safe to retry this request despite of the POST method
+	err = client.retryPolicy.retry(ctx, func() (err error) {
+		tracks, _, err = postRequest[[]Track](ctx, client, "/tracks", url.Values{"track-ids": trackIds, "with-positions": {"false"}})
+		return
+	})
 	return
 }
 
 func (client *YaMusicClient) CreatePlaylist(name string, public bool) (playlist Playlist, err error) {
+	return client.CreatePlaylistContext(context.Background(), name, public)
+}
+
+func (client *YaMusicClient) CreatePlaylistContext(ctx context.Context, name string, public bool) (playlist Playlist, err error) {
 	var visibility string
 	if public {
 		visibility = "public"
 	} else {
 		visibility = "private"
 	}
-	playlist, _, err = postRequest[Playlist](client.token, fmt.Sprintf("/users/%d/playlists/create", client.userid), url.Values{
+	playlist, _, err = postRequest[Playlist](ctx, client, fmt.Sprintf("/users/%d/playlists/create", client.userid), url.Values{
 		"title":      {name},
 		"visibility": {visibility},
 	})
@@ -297,19 +433,31 @@ func (client *YaMusicClient) CreatePlaylist(name string, public bool) (playlist
 }
 
 func (client *YaMusicClient) RenamePlaylist(kind uint64, newName string) (playlist Playlist, err error) {
-	playlist, _, err = postRequest[Playlist](client.token, fmt.Sprintf("/users/%d/playlists/%d/name", client.userid, kind), url.Values{
+	return client.RenamePlaylistContext(context.Background(), kind, newName)
+}
+
+func (client *YaMusicClient) RenamePlaylistContext(ctx context.Context, kind uint64, newName string) (playlist Playlist, err error) {
+	playlist, _, err = postRequest[Playlist](ctx, client, fmt.Sprintf("/users/%d/playlists/%d/name", client.userid, kind), url.Values{
 		"value": {newName},
 	})
 	return
 }
 
 func (client *YaMusicClient) RemovePlaylist(kind uint64) error {
-	_, _, err := postRequest[string](client.token, fmt.Sprintf("/users/%d/playlists/%d/delete", client.userid, kind), nil)
+	return client.RemovePlaylistContext(context.Background(), kind)
+}
+
+func (client *YaMusicClient) RemovePlaylistContext(ctx context.Context, kind uint64) error {
+	_, _, err := postRequest[string](ctx, client, fmt.Sprintf("/users/%d/playlists/%d/delete", client.userid, kind), nil)
 	return err
 }
 
 func (client *YaMusicClient) AddToPlaylist(kind uint64, revision, pos int, trackId string) (playlist Playlist, err error) {
-	playlist, _, err = postRequest[Playlist](client.token, fmt.Sprintf("/users/%d/playlists/%d/change-relative", client.userid, kind), url.Values{
+	return client.AddToPlaylistContext(context.Background(), kind, revision, pos, trackId)
+}
+
+func (client *YaMusicClient) AddToPlaylistContext(ctx context.Context, kind uint64, revision, pos int, trackId string) (playlist Playlist, err error) {
+	playlist, _, err = postRequest[Playlist](ctx, client, fmt.Sprintf("/users/%d/playlists/%d/change-relative", client.userid, kind), url.Values{
 		"diff":     {fmt.Sprintf(`{"diff":{"op":"insert","at":%d,"tracks":[{"id":"%s"}]}}`, pos, trackId)},
 		"revision": {fmt.Sprint(revision)},
 	})
@@ -317,7 +465,11 @@ func (client *YaMusicClient) AddToPlaylist(kind uint64, revision, pos int, track
 }
 
 func (client *YaMusicClient) RemoveFromPlaylist(kind uint64, revision, pos int) (playlist Playlist, err error) {
-	playlist, _, err = postRequest[Playlist](client.token, fmt.Sprintf("/users/%d/playlists/%d/change-relative", client.userid, kind), url.Values{
+	return client.RemoveFromPlaylistContext(context.Background(), kind, revision, pos)
+}
+
+func (client *YaMusicClient) RemoveFromPlaylistContext(ctx context.Context, kind uint64, revision, pos int) (playlist Playlist, err error) {
+	playlist, _, err = postRequest[Playlist](ctx, client, fmt.Sprintf("/users/%d/playlists/%d/change-relative", client.userid, kind), url.Values{
 		"diff":     {fmt.Sprintf(`{"diff":{"op":"delete","from":%d,"to":%d}}`, pos, pos+1)},
 		"revision": {fmt.Sprint(revision)},
 	})
@@ -325,23 +477,35 @@ func (client *YaMusicClient) RemoveFromPlaylist(kind uint64, revision, pos int)
 }
 
 func (client *YaMusicClient) ListPlaylists() (playlists []Playlist, err error) {
-	playlists, _, err = getRequest[[]Playlist](client.token, fmt.Sprintf("/users/%d/playlists/list", client.userid), nil)
+	return client.ListPlaylistsContext(context.Background())
+}
+
+func (client *YaMusicClient) ListPlaylistsContext(ctx context.Context) (playlists []Playlist, err error) {
+	playlists, _, err = getRequest[[]Playlist](ctx, client, fmt.Sprintf("/users/%d/playlists/list", client.userid), nil)
 	return
 }
 
 func (client *YaMusicClient) Playlist(kind uint64) (playlist Playlist, err error) {
-	playlist, _, err = getRequest[Playlist](client.token, fmt.Sprintf("/users/%d/playlists/%d", client.userid, kind), nil)
+	return client.PlaylistContext(context.Background(), kind)
+}
+
+func (client *YaMusicClient) PlaylistContext(ctx context.Context, kind uint64) (playlist Playlist, err error) {
+	playlist, _, err = getRequest[Playlist](ctx, client, fmt.Sprintf("/users/%d/playlists/%d", client.userid, kind), nil)
 	return
 }
 
 func (client *YaMusicClient) PlaylistTracks(kind uint64, userId uint64, mixed bool) (tracks []Track, err error) {
+	return client.PlaylistTracksContext(context.Background(), kind, userId, mixed)
+}
+
+func (client *YaMusicClient) PlaylistTracksContext(ctx context.Context, kind uint64, userId uint64, mixed bool) (tracks []Track, err error) {
 	params := url.Values{
 		"kinds":       {fmt.Sprint(kind)},
 		"mixed":       {fmt.Sprint(mixed)},
 		"rich-tracks": {"true"},
 	}
 
-	playlists, _, err := getRequest[[]Playlist](client.token, fmt.Sprintf("/users/%d/playlists", userId), params)
+	playlists, _, err := getRequest[[]Playlist](ctx, client, fmt.Sprintf("/users/%d/playlists", userId), params)
 	if err != nil {
 		return
 	}
@@ -359,25 +523,104 @@ func (client *YaMusicClient) PlaylistTracks(kind uint64, userId uint64, mixed bo
 	return
 }
 
+// PlaylistTrackIds returns ids of the playlist tracks without loading the full tracks info
+func (client *YaMusicClient) PlaylistTrackIds(kind uint64, userId uint64) (trackIds []string, err error) {
+	return client.PlaylistTrackIdsContext(context.Background(), kind, userId)
+}
+
+func (client *YaMusicClient) PlaylistTrackIdsContext(ctx context.Context, kind uint64, userId uint64) (trackIds []string, err error) {
+	params := url.Values{
+		"kinds":       {fmt.Sprint(kind)},
+		"rich-tracks": {"false"},
+	}
+
+	playlists, _, err := getRequest[[]Playlist](ctx, client, fmt.Sprintf("/users/%d/playlists", userId), params)
+	if err != nil {
+		return
+	}
+
+	if len(playlists) != 1 {
+		err = fmt.Errorf("wrong playlists count")
+		return
+	}
+
+	trackIds = make([]string, 0, len(playlists[0].Tracks))
+	for _, t := range playlists[0].Tracks {
+		trackIds = append(trackIds, fmt.Sprint(t.Id))
+	}
+
+	return
+}
+
 func (client *YaMusicClient) Stations(language string) (stations []StationDesc, err error) {
-	stations, _, err = getRequest[[]StationDesc](client.token, "/rotor/stations/list", url.Values{
+	return client.StationsContext(context.Background(), language)
+}
+
+func (client *YaMusicClient) StationsContext(ctx context.Context, language string) (stations []StationDesc, err error) {
+	stations, _, err = getRequest[[]StationDesc](ctx, client, "/rotor/stations/list", url.Values{
 		"language": {language},
 	})
 	return
 }
 
 func (client *YaMusicClient) StationTracks(id StationId, lastTrack *Track) (tracks StationTracks, err error) {
+	return client.StationTracksContext(context.Background(), id, lastTrack)
+}
+
+func (client *YaMusicClient) StationTracksContext(ctx context.Context, id StationId, lastTrack *Track) (tracks StationTracks, err error) {
 	params := url.Values{
 		"settings2": {"true"},
 	}
 	if lastTrack != nil {
 		params.Add("queue", fmt.Sprint(lastTrack.Id))
 	}
-	tracks, _, err = getRequest[StationTracks](client.token, fmt.Sprintf("/rotor/station/%s:%s/tracks", id.Type, id.Tag), nil)
+	tracks, _, err = getRequest[StationTracks](ctx, client, fmt.Sprintf("/rotor/station/%s:%s/tracks", id.Type, id.Tag), params)
+	return
+}
+
+func (client *YaMusicClient) StationInfo(id StationId) (station StationDesc, err error) {
+	return client.StationInfoContext(context.Background(), id)
+}
+
+func (client *YaMusicClient) StationInfoContext(ctx context.Context, id StationId) (station StationDesc, err error) {
+	stations, _, err := getRequest[[]StationDesc](ctx, client, fmt.Sprintf("/rotor/station/%s:%s/info", id.Type, id.Tag), nil)
+	if err != nil {
+		return
+	}
+
+	if len(stations) != 1 {
+		err = fmt.Errorf("wrong stations count")
+		return
+	}
+
+	station = stations[0]
+	return
+}
+
+func (client *YaMusicClient) SetStationSettings(id StationId, settings StationSettings) (err error) {
+	return client.SetStationSettingsContext(context.Background(), id, settings)
+}
+
+func (client *YaMusicClient) SetStationSettingsContext(ctx context.Context, id StationId, settings StationSettings) (err error) {
+	body := map[string]interface{}{
+		"type":       "rotor",
+		"moodEnergy": settings.MoodEnergy,
+		"diversity":  settings.Diversity,
+		"language":   settings.Language,
+	}
+	_, _, err = postRequestJson[interface{}](ctx, client,
+		fmt.Sprintf("/rotor/station/%s:%s/settings3", id.Type, id.Tag),
+		nil,
+		body,
+	)
 	return
 }
 
 func (client *YaMusicClient) StationFeedback(feedType string, stationId StationId, batchId, trackId string, playedSeconds int) (err error) {
+	return client.StationFeedbackContext(context.Background(), feedType, stationId, batchId, trackId, playedSeconds)
+}
+
+func (client *YaMusicClient) StationFeedbackContext(ctx context.Context, feedType string, stationId StationId, batchId, trackId string, playedSeconds int) (err error) {
 	queryParams := url.Values{}
 	if len(batchId) > 0 {
 		queryParams.Add("batch-id", batchId)
@@ -390,7 +633,7 @@ func (client *YaMusicClient) StationFeedback(feedType string, stationId StationI
 		"trackId":            trackId,
 		"totalPlayedSeconds": playedSeconds,
 	}
-	_, _, err = postRequestJson[interface{}](client.token,
+	_, _, err = postRequestJson[interface{}](ctx, client,
 		fmt.Sprintf("/rotor/station/%s:%s/feedback", stationId.Type, stationId.Tag),
 		queryParams,
 		body,
@@ -399,6 +642,10 @@ func (client *YaMusicClient) StationFeedback(feedType string, stationId StationI
 }
 
 func (client *YaMusicClient) PlayTrack(track *Track, fromCache bool) (err error) {
+	return client.PlayTrackContext(context.Background(), track, fromCache)
+}
+
+func (client *YaMusicClient) PlayTrackContext(ctx context.Context, track *Track, fromCache bool) (err error) {
 	queryParams := url.Values{
 		"from":                 {"yamusic-tui"},
 		"uid":                  {fmt.Sprint(client.userid)},
@@ -408,12 +655,16 @@ func (client *YaMusicClient) PlayTrack(track *Track, fromCache bool) (err error)
 		"track-length-seconds": {fmt.Sprint(track.DurationMs + 1000)},
 		"total-played-seconds": {fmt.Sprint(track.DurationMs + 1000)},
 	}
-	_, _, err = postRequest[interface{}](client.token, "/play-audio", queryParams)
+	_, _, err = postRequest[interface{}](ctx, client, "/play-audio", queryParams)
 	return
 }
 
 func (client *YaMusicClient) LikedTracks() (tracks []LikeTrackInfo, err error) {
-	desc, _, err := getRequest[LikesDesc](client.token, fmt.Sprintf("/users/%d/likes/tracks", client.userid), nil)
+	return client.LikedTracksContext(context.Background())
+}
+
+func (client *YaMusicClient) LikedTracksContext(ctx context.Context) (tracks []LikeTrackInfo, err error) {
+	desc, _, err := getRequest[LikesDesc](ctx, client, fmt.Sprintf("/users/%d/likes/tracks", client.userid), nil)
 	if err != nil {
 		return
 	}
@@ -422,22 +673,152 @@ func (client *YaMusicClient) LikedTracks() (tracks []LikeTrackInfo, err error) {
 }
 
 func (client *YaMusicClient) LikeTrack(trackId string) (err error) {
-	_, _, err = postRequest[interface{}](client.token, fmt.Sprintf("/users/%d/likes/tracks/add-multiple", client.userid), url.Values{"track-ids": {trackId}})
+	return client.LikeTrackContext(context.Background(), trackId)
+}
+
+func (client *YaMusicClient) LikeTrackContext(ctx context.Context, trackId string) (err error) {
+	_, _, err = postRequest[interface{}](ctx, client, fmt.Sprintf("/users/%d/likes/tracks/add-multiple", client.userid), url.Values{"track-ids": {trackId}})
 	return
 }
 
 func (client *YaMusicClient) UnlikeTrack(trackId string) (err error) {
-	_, _, err = postRequest[interface{}](client.token, fmt.Sprintf("/users/%d/likes/tracks/remove", client.userid), url.Values{"track-ids": {trackId}})
+	return client.UnlikeTrackContext(context.Background(), trackId)
+}
+
+func (client *YaMusicClient) UnlikeTrackContext(ctx context.Context, trackId string) (err error) {
+	_, _, err = postRequest[interface{}](ctx, client, fmt.Sprintf("/users/%d/likes/tracks/remove", client.userid), url.Values{"track-ids": {trackId}})
+	return
+}
+
+func (client *YaMusicClient) LikedAlbums() (albums []Album, err error) {
+	return client.LikedAlbumsContext(context.Background())
+}
+
+func (client *YaMusicClient) LikedAlbumsContext(ctx context.Context) (albums []Album, err error) {
+	likes, _, err := getRequest[[]LikedAlbum](ctx, client, fmt.Sprintf("/users/%d/likes/albums", client.userid), url.Values{
+		"rich": {"true"},
+	})
+	if err != nil {
+		return
+	}
+
+	albums = make([]Album, 0, len(likes))
+	for _, like := range likes {
+		albums = append(albums, like.Album)
+	}
+	return
+}
+
+func (client *YaMusicClient) LikeAlbum(albumId uint64) (err error) {
+	return client.LikeAlbumContext(context.Background(), albumId)
+}
+
+func (client *YaMusicClient) LikeAlbumContext(ctx context.Context, albumId uint64) (err error) {
+	_, _, err = postRequest[interface{}](ctx, client, fmt.Sprintf("/users/%d/likes/albums/add-multiple", client.userid), url.Values{"album-ids": {fmt.Sprint(albumId)}})
+	return
+}
+
+func (client *YaMusicClient) UnlikeAlbum(albumId uint64) (err error) {
+	return client.UnlikeAlbumContext(context.Background(), albumId)
+}
+
+func (client *YaMusicClient) UnlikeAlbumContext(ctx context.Context, albumId uint64) (err error) {
+	_, _, err = postRequest[interface{}](ctx, client, fmt.Sprintf("/users/%d/likes/albums/remove", client.userid), url.Values{"album-ids": {fmt.Sprint(albumId)}})
+	return
+}
+
+func (client *YaMusicClient) LikedArtists() (artists []Artist, err error) {
+	return client.LikedArtistsContext(context.Background())
+}
+
+func (client *YaMusicClient) LikedArtistsContext(ctx context.Context) (artists []Artist, err error) {
+	artists, _, err = getRequest[[]Artist](ctx, client, fmt.Sprintf("/users/%d/likes/artists", client.userid), url.Values{
+		"with-timestamps": {"false"},
+	})
+	return
+}
+
+func (client *YaMusicClient) LikeArtist(artistId uint64) (err error) {
+	return client.LikeArtistContext(context.Background(), artistId)
+}
+
+func (client *YaMusicClient) LikeArtistContext(ctx context.Context, artistId uint64) (err error) {
+	_, _, err = postRequest[interface{}](ctx, client, fmt.Sprintf("/users/%d/likes/artists/add-multiple", client.userid), url.Values{"artist-ids": {fmt.Sprint(artistId)}})
+	return
+}
+
+func (client *YaMusicClient) UnlikeArtist(artistId uint64) (err error) {
+	return client.UnlikeArtistContext(context.Background(), artistId)
+}
+
+func (client *YaMusicClient) UnlikeArtistContext(ctx context.Context, artistId uint64) (err error) {
+	_, _, err = postRequest[interface{}](ctx, client, fmt.Sprintf("/users/%d/likes/artists/remove", client.userid), url.Values{"artist-ids": {fmt.Sprint(artistId)}})
+	return
+}
+
+func (client *YaMusicClient) LikedPlaylists() (playlists []Playlist, err error) {
+	return client.LikedPlaylistsContext(context.Background())
+}
+
+func (client *YaMusicClient) LikedPlaylistsContext(ctx context.Context) (playlists []Playlist, err error) {
+	likes, _, err := getRequest[[]LikedPlaylist](ctx, client, fmt.Sprintf("/users/%d/likes/playlists", client.userid), nil)
+	if err != nil {
+		return
+	}
+
+	playlists = make([]Playlist, 0, len(likes))
+	for _, like := range likes {
+		playlists = append(playlists, like.Playlist)
+	}
+	return
+}
+
+func (client *YaMusicClient) LikePlaylist(ownerUid, kind uint64) (err error) {
+	return client.LikePlaylistContext(context.Background(), ownerUid, kind)
+}
+
+func (client *YaMusicClient) LikePlaylistContext(ctx context.Context, ownerUid, kind uint64) (err error) {
+	_, _, err = postRequest[interface{}](ctx, client, fmt.Sprintf("/users/%d/likes/playlists/add-multiple", client.userid), url.Values{"playlist-ids": {fmt.Sprintf("%d:%d", ownerUid, kind)}})
+	return
+}
+
+func (client *YaMusicClient) UnlikePlaylist(ownerUid, kind uint64) (err error) {
+	return client.UnlikePlaylistContext(context.Background(), ownerUid, kind)
+}
+
+func (client *YaMusicClient) UnlikePlaylistContext(ctx context.Context, ownerUid, kind uint64) (err error) {
+	_, _, err = postRequest[interface{}](ctx, client, fmt.Sprintf("/users/%d/likes/playlists/remove", client.userid), url.Values{"playlist-ids": {fmt.Sprintf("%d:%d", ownerUid, kind)}})
 	return
 }
 
 func (client *YaMusicClient) TrackDownloadInfo(trackId string) (dowInfos []TrackDownloadInfo, err error) {
-	dowInfos, _, err = getRequest[[]TrackDownloadInfo](client.token, fmt.Sprintf("/tracks/%s/download-info", trackId), nil)
+	return client.TrackDownloadInfoContext(context.Background(), trackId)
+}
+
+func (client *YaMusicClient) TrackDownloadInfoContext(ctx context.Context, trackId string) (dowInfos []TrackDownloadInfo, err error) {
+	dowInfos, _, err = getRequest[[]TrackDownloadInfo](ctx, client, fmt.Sprintf("/tracks/%s/download-info", trackId), nil)
 	return
 }
 
 func (client *YaMusicClient) DownloadTrack(dowInfo TrackDownloadInfo) (track io.ReadCloser, fileSize int64, err error) {
-	fullInfoBody, _, err := downloadRequest(client.token, dowInfo.DownloadInfoUrl+"&format=json", "application/json")
+	return client.DownloadTrackContext(context.Background(), dowInfo)
+}
+
+func (client *YaMusicClient) DownloadTrackContext(ctx context.Context, dowInfo TrackDownloadInfo) (track io.ReadCloser, fileSize int64, err error) {
+	trackUrl, err := client.TrackUrlContext(ctx, dowInfo)
+	if err != nil {
+		return
+	}
+	return client.DownloadTrackRangeContext(ctx, dowInfo, trackUrl, 0)
+}
+
+func (client *YaMusicClient) TrackUrl(dowInfo TrackDownloadInfo) (trackUrl string, err error) {
+	return client.TrackUrlContext(context.Background(), dowInfo)
+}
+
+// TrackUrlContext resolves the direct link to the track file of the download variant
+func (client *YaMusicClient) TrackUrlContext(ctx context.Context, dowInfo TrackDownloadInfo) (trackUrl string, err error) {
+	fullInfoBody, _, err := downloadRequest(ctx, client, dowInfo.DownloadInfoUrl+"&format=json", "application/json")
 	if err != nil {
 		return
 	}
@@ -450,47 +831,109 @@ func (client *YaMusicClient) DownloadTrack(dowInfo TrackDownloadInfo) (track io.
 		return
 	}
 
+	trackUrl = createTrackUrl(info, dowInfo.Codec)
+	return
+}
+
+func (client *YaMusicClient) DownloadTrackRange(dowInfo TrackDownloadInfo, trackUrl string, offset int64) (track io.ReadCloser, partSize int64, err error) {
+	return client.DownloadTrackRangeContext(context.Background(), dowInfo, trackUrl, offset)
+}
+
+// DownloadTrackRangeContext downloads the track file by the direct link from the offset to the end
+func (client *YaMusicClient) DownloadTrackRangeContext(ctx context.Context, dowInfo TrackDownloadInfo, trackUrl string, offset int64) (track io.ReadCloser, partSize int64, err error) {
 	var mimeType string
 	switch dowInfo.Codec {
 	case "aac":
 		mimeType = "audio/aac"
 	case "mp3":
 		mimeType = "audio/mpeg"
+	case "flac":
+		mimeType = "audio/flac"
 	default:
 		err = fmt.Errorf("unknown codec type '%s'", dowInfo.Codec)
 		return
 	}
 
-	trackUrl := createTrackUrl(info, dowInfo.Codec)
-	trackReader, fileSize, err := downloadRequest(client.token, trackUrl, mimeType)
-	track = trackReader
-	return
+	return downloadRangeRequest(ctx, client, trackUrl, mimeType, offset)
+}
+
+func (client *YaMusicClient) ArtistTracks(artistId uint64, page, pageSize int) (tracks ArtistTracksPage, err error) {
+	return client.ArtistTracksContext(context.Background(), artistId, page, pageSize)
 }
 
-func (client *YaMusicClient) ArtistTracks(artistId uint64, page, pageSize int) (tracks ArtistTracks, err error) {
-	tracks, _, err = getRequest[ArtistTracks](client.token,
+func (client *YaMusicClient) ArtistTracksContext(ctx context.Context, artistId uint64, page, pageSize int) (tracks ArtistTracksPage, err error) {
+	tracks, _, err = getRequest[ArtistTracksPage](ctx, client,
 		fmt.Sprintf("/artists/%d/tracks", artistId),
 		url.Values{"page": {fmt.Sprint(page)}, "page-size": {fmt.Sprint(pageSize)}},
 	)
 	return
 }
 
+// ArtistAlbums returns albums and singles of the artist sorted by year
+func (client *YaMusicClient) ArtistAlbums(artistId uint64, page, pageSize int) (albums ArtistAlbumsPage, err error) {
+	return client.ArtistAlbumsContext(context.Background(), artistId, page, pageSize)
+}
+
+func (client *YaMusicClient) ArtistAlbumsContext(ctx context.Context, artistId uint64, page, pageSize int) (albums ArtistAlbumsPage, err error) {
+	albums, _, err = getRequest[ArtistAlbumsPage](ctx, client,
+		fmt.Sprintf("/artists/%d/direct-albums", artistId),
+		url.Values{"page": {fmt.Sprint(page)}, "page-size": {fmt.Sprint(pageSize)}, "sort-by": {"year"}},
+	)
+	return
+}
+
+// ArtistAlsoAlbums returns compilations and other albums where the artist appears
+func (client *YaMusicClient) ArtistAlsoAlbums(artistId uint64, page, pageSize int) (albums ArtistAlbumsPage, err error) {
+	return client.ArtistAlsoAlbumsContext(context.Background(), artistId, page, pageSize)
+}
+
+func (client *YaMusicClient) ArtistAlsoAlbumsContext(ctx context.Context, artistId uint64, page, pageSize int) (albums ArtistAlbumsPage, err error) {
+	albums, _, err = getRequest[ArtistAlbumsPage](ctx, client,
+		fmt.Sprintf("/artists/%d/also-albums", artistId),
+		url.Values{"page": {fmt.Sprint(page)}, "page-size": {fmt.Sprint(pageSize)}, "sort-by": {"year"}},
+	)
+	return
+}
+
 func (client *YaMusicClient) ArtistPopularTracks(artistId uint64) (tracks ArtistTracks, err error) {
-	tracks, _, err = getRequest[ArtistTracks](client.token, fmt.Sprintf("/artists/%d/track-ids-by-rating", artistId), nil)
+	return client.ArtistPopularTracksContext(context.Background(), artistId)
+}
+
+func (client *YaMusicClient) ArtistPopularTracksContext(ctx context.Context, artistId uint64) (tracks ArtistTracks, err error) {
+	tracks, _, err = getRequest[ArtistTracks](ctx, client, fmt.Sprintf("/artists/%d/track-ids-by-rating", artistId), nil)
 	return
 }
 
 func (client *YaMusicClient) Album(albumId uint64, withTracks bool) (album Album, err error) {
+	return client.AlbumContext(context.Background(), albumId, withTracks)
+}
+
+func (client *YaMusicClient) AlbumContext(ctx context.Context, albumId uint64, withTracks bool) (album Album, err error) {
 	path := fmt.Sprintf("/albums/%d", albumId)
 	if withTracks {
 		path += "/with-tracks"
 	}
-	album, _, err = getRequest[Album](client.token, path, nil)
+	album, _, err = getRequest[Album](ctx, client, path, nil)
+	return
+}
+
+func (client *YaMusicClient) Landing(blocks ...string) (landing Landing, err error) {
+	return client.LandingContext(context.Background(), blocks...)
+}
+
+func (client *YaMusicClient) LandingContext(ctx context.Context, blocks ...string) (landing Landing, err error) {
+	landing, _, err = getRequest[Landing](ctx, client, "/landing3", url.Values{
+		"blocks": {strings.Join(blocks, ",")},
+	})
 	return
 }
 
 func (client *YaMusicClient) Search(request string, searchType SearchType) (results SearchResult, err error) {
-	results, _, err = getRequest[SearchResult](client.token, "/search", url.Values{"text": {request}, "page": {"0"}, "type": {string(searchType)}})
+	return client.SearchContext(context.Background(), request, searchType)
+}
+
+func (client *YaMusicClient) SearchContext(ctx context.Context, request string, searchType SearchType) (results SearchResult, err error) {
+	results, _, err = getRequest[SearchResult](ctx, client, "/search", url.Values{"text": {request}, "page": {"0"}, "type": {string(searchType)}})
 	for i := range results.Tracks.Results {
 		results.Tracks.Results[i].Id = results.Tracks.Results[i].RealId
 	}
@@ -498,11 +941,19 @@ func (client *YaMusicClient) Search(request string, searchType SearchType) (resu
 }
 
 func (client *YaMusicClient) SearchSuggest(part string) (suggestions SearchSuggest, err error) {
-	suggestions, _, err = getRequest[SearchSuggest](client.token, "/search/suggest", url.Values{"part": {part}})
+	return client.SearchSuggestContext(context.Background(), part)
+}
+
+func (client *YaMusicClient) SearchSuggestContext(ctx context.Context, part string) (suggestions SearchSuggest, err error) {
+	suggestions, _, err = getRequest[SearchSuggest](ctx, client, "/search/suggest", url.Values{"part": {part}})
 	return
 }
 
 func (client *YaMusicClient) TrackLyricsRequest(trackId string) (LRCLyrics []LyricPair, err error) {
+	return client.TrackLyricsRequestContext(context.Background(), trackId)
+}
+
+func (client *YaMusicClient) TrackLyricsRequestContext(ctx context.Context, trackId string) (LRCLyrics []LyricPair, err error) {
 	timestamp := fmt.Sprintf("%d", time.Now().Unix())
 	// scary algorithm to sign the request (required for lyrics)
 	message := trackId + timestamp
@@ -510,14 +961,20 @@ func (client *YaMusicClient) TrackLyricsRequest(trackId string) (LRCLyrics []Lyr
 	h.Write([]byte(message))
 	hmacSign := h.Sum(nil)
 	sign := base64.StdEncoding.EncodeToString(hmacSign)
-	lyrics, _, err := getRequest[TrackLyrics](client.token, fmt.Sprintf("/tracks/%s/lyrics", trackId), url.Values{"sign": {sign}, "timeStamp": {timestamp}, "format": {"LRC"}})
+	lyrics, _, err := getRequest[TrackLyrics](ctx, client, fmt.Sprintf("/tracks/%s/lyrics", trackId), url.Values{"sign": {sign}, "timeStamp": {timestamp}, "format": {"LRC"}})
+	if err != nil {
+		return []LyricPair{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, lyrics.DownloadUrl, nil)
 	if err != nil {
 		return []LyricPair{}, err
 	}
-	LRCLyricsResponse, err := http.Get(lyrics.DownloadUrl)
+	req.Header.Set("User-Agent", client.userAgent)
+	LRCLyricsResponse, err := client.httpClient.Do(req)
 	if err != nil {
 		return []LyricPair{}, err
 	}
+	defer LRCLyricsResponse.Body.Close()
 	data, err := io.ReadAll(LRCLyricsResponse.Body)
 	if err != nil {
 		return []LyricPair{}, err
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStartDownload(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+
+	tests := []struct {
+		name    string
+		offset  int64
+		handler http.HandlerFunc
+		want    string
+		wantLen int64
+		wantErr error
+	}{
+		{
+			name:    "full",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.Write(content) },
+			want:    string(content),
+			wantLen: int64(len(content)),
+		},
+		{
+			name:   "range",
+			offset: 5,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.ServeContent(w, r, "track.mp3", time.Time{}, bytes.NewReader(content))
+			},
+			want:    string(content[5:]),
+			wantLen: int64(len(content) - 5),
+		},
+		{
+			name:   "range ignored",
+			offset: 5,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				w.Write(content)
+			},
+			want:    string(content[5:]),
+			wantLen: int64(len(content) - 5),
+		},
+		{
+			name:   "wrong range",
+			offset: 5,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Range", "bytes 0-19/20")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content)
+			},
+			wantErr: ErrBadResponse,
+		},
+		{
+			name:   "no content range",
+			offset: 5,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content[5:])
+			},
+			wantErr: ErrBadResponse,
+		},
+		{
+			name: "unknown length",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write(content[:5])
+				w.(http.Flusher).Flush()
+				w.Write(content[5:])
+			},
+			wantErr: ErrBadResponse,
+		},
+		{
+			name:    "not found",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) },
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			t.Cleanup(server.Close)
+
+			client := &YaMusicClient{httpClient: server.Client(), readTimeout: 5 * time.Second}
+			body, contentLen, err := startDownload(context.Background(), client, server.URL, "audio/mpeg", tt.offset)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("download returned %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+
+			data, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want || contentLen != tt.wantLen {
+				t.Errorf("downloaded %q of %d bytes, want %q of %d", data, contentLen, tt.want, tt.wantLen)
+			}
+		})
+	}
+}
@@ -12,6 +12,9 @@ const (
 	YaMusicServerURL = "https://api.music.yandex.net/"
 )
 
+// Scale of the track and album normalization peaks, the peak is the 16-bit sample value
+const NORMALIZATION_PEAK_SCALE = 32768
+
 // Rotor feedback types
 const (
 	ROTOR_RADIO_STARTED  = "radioStarted"
@@ -21,6 +24,56 @@ const (
 	ROTOR_SKIP           = "skip"
 )
 
+// Station types
+const (
+	STATION_GENRE    = "genre"
+	STATION_MOOD     = "mood"
+	STATION_EPOCH    = "epoch"
+	STATION_ACTIVITY = "activity"
+)
+
+// Station settings values
+const (
+	STATION_MOOD_ALL    = "all"
+	STATION_MOOD_ACTIVE = "active"
+	STATION_MOOD_FUN    = "fun"
+	STATION_MOOD_CALM   = "calm"
+	STATION_MOOD_SAD    = "sad"
+
+	STATION_DIVERSITY_DEFAULT  = "default"
+	STATION_DIVERSITY_FAVORITE = "favorite"
+	STATION_DIVERSITY_POPULAR  = "popular"
+	STATION_DIVERSITY_DISCOVER = "discover"
+
+	STATION_LANGUAGE_ANY         = "any"
+	STATION_LANGUAGE_RUSSIAN     = "russian"
+	STATION_LANGUAGE_NOT_RUSSIAN = "not-russian"
+)
+
+// Landing block types
+const (
+	LANDING_PERSONAL_PLAYLISTS = "personalplaylists"
+	LANDING_NEW_RELEASES       = "new-releases"
+	LANDING_NEW_PLAYLISTS      = "new-playlists"
+	LANDING_CHART              = "chart"
+	LANDING_ALBUMS             = "albums"
+	LANDING_PLAYLISTS          = "playlists"
+)
+
+// Landing entity types
+const (
+	ENTITY_PERSONAL_PLAYLIST = "personal-playlist"
+	ENTITY_PLAYLIST          = "playlist"
+	ENTITY_ALBUM             = "album"
+	ENTITY_CHART_ITEM        = "chart-item"
+)
+
+// Album types
+const (
+	ALBUM_SINGLE      = "single"
+	ALBUM_COMPILATION = "compilation"
+)
+
 var (
 	MyWaveId = StationId{
 		Type: "user",
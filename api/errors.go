@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error kinds, use errors.Is to check the kind of the RequestError
+var (
+	ErrNetwork     = errors.New("network error")
+	ErrAuthExpired = errors.New("authorization expired")
+	ErrRateLimited = errors.New("rate limited")
+	ErrNotFound    = errors.New("not found")
+	ErrBadRequest  = errors.New("bad request")
+	ErrServer      = errors.New("server error")
+	ErrBadResponse = errors.New("bad response")
+)
+
+type RequestError struct {
+	// One of the error kinds
+	Kind       error
+	StatusCode int
+	ReqId      string
+	Result     ResultError
+	// Underlying network or decoding error
+	Err error
+	// Server requested delay before the next attempt
+	retryAfter time.Duration
+}
+
+func (e *RequestError) Error() string {
+	msg := e.Kind.Error()
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (%d)", e.StatusCode)
+	}
+	if len(e.Result.Name) > 0 || len(e.Result.Message) > 0 {
+		msg += ": " + e.Result.Error()
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if len(e.ReqId) > 0 {
+		msg += " [req-id " + e.ReqId + "]"
+	}
+	return msg
+}
+
+func (e *RequestError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+func (e *RequestError) temporary() bool {
+	if errors.Is(e.Err, context.Canceled) || errors.Is(e.Err, context.DeadlineExceeded) {
+		return false
+	}
+	return e.Kind == ErrNetwork || e.Kind == ErrRateLimited || e.Kind == ErrServer
+}
+
+func statusError(resp *http.Response) *RequestError {
+	reqErr := &RequestError{StatusCode: resp.StatusCode}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		reqErr.Kind = ErrAuthExpired
+	case resp.StatusCode == http.StatusNotFound:
+		reqErr.Kind = ErrNotFound
+	case resp.StatusCode == http.StatusTooManyRequests:
+		reqErr.Kind = ErrRateLimited
+		if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			reqErr.retryAfter = time.Duration(sec) * time.Second
+		}
+	case resp.StatusCode >= 500:
+		reqErr.Kind = ErrServer
+	case resp.StatusCode >= 400:
+		reqErr.Kind = ErrBadRequest
+	default:
+		reqErr.Kind = ErrBadResponse
+	}
+
+	return reqErr
+}
+
+type RetryPolicy struct {
+	// Number of additional attempts, 0 disables retries
+	MaxRetries int
+	// Delay before the first retry, doubled on each next one
+	BaseDelay time.Duration
+	// Upper limit of the delay
+	MaxDelay time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  200 * time.Millisecond,
+	MaxDelay:   3 * time.Second,
+}
+
+// delay returns exponential backoff with jitter for the attempt number
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay << attempt
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	// use the upper half of the interval to keep the backoff growing
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// retry calls the request function until it succeeds, returns a permanent error
+// or the attempts are exhausted. Only idempotent requests should be retried.
+func (p RetryPolicy) retry(ctx context.Context, request func() error) error {
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		err = request()
+		if err == nil || attempt >= p.MaxRetries {
+			return err
+		}
+
+		var reqErr *RequestError
+		if !errors.As(err, &reqErr) || !reqErr.temporary() {
+			return err
+		}
+
+		delay := p.delay(attempt)
+		if reqErr.retryAfter > delay {
+			delay = reqErr.retryAfter
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
@@ -1,5 +1,12 @@
 package api
 
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
 type fullDownloadInfo struct {
 	Host string `json:"host"`
 	Path string `json:"path"`
@@ -8,8 +15,28 @@ type fullDownloadInfo struct {
 }
 
 type YaMusicClient struct {
-	token  string
-	userid uint64
+	token       string
+	userid      uint64
+	baseUrl     string
+	userAgent   string
+	readTimeout time.Duration
+	retryPolicy RetryPolicy
+	httpClient  *http.Client
+}
+
+type ClientOptions struct {
+	// API server URL, YaMusicServerURL if empty
+	BaseUrl string
+	// HTTP transport used for all requests, the default one with TLS 1.2 if nil
+	Transport http.RoundTripper
+	// User-Agent header value
+	UserAgent string
+	// Response headers awaiting timeout, applied to the default transport only
+	ResponseTimeout time.Duration
+	// Maximum idle time while reading the track body
+	ReadTimeout time.Duration
+	// Retry policy of the idempotent requests, DefaultRetryPolicy if nil
+	Retry *RetryPolicy
 }
 
 type ResultError struct {
@@ -84,6 +111,22 @@ type ArtistTracks struct {
 	Tracks []string `json:"tracks"`
 }
 
+type Pager struct {
+	Page    int `json:"page"`
+	PerPage int `json:"perPage"`
+	Total   int `json:"total"`
+}
+
+type ArtistTracksPage struct {
+	Pager  Pager   `json:"pager"`
+	Tracks []Track `json:"tracks"`
+}
+
+type ArtistAlbumsPage struct {
+	Pager  Pager   `json:"pager"`
+	Albums []Album `json:"albums"`
+}
+
 type Album struct {
 	Id          uint64    `json:"id"`
 	Title       string    `json:"title"`
@@ -117,8 +160,13 @@ type Track struct {
 		HasAvailableTextLyrics bool `json:"hasAvailableTextLyrics"`
 	} `json:"lyricsInfo"`
 	Normalization struct {
+		// Gain in dB
 		Gain float32 `json:"gain"`
-		Peak float32 `json:"Peak"`
+		// Sample peak on the NORMALIZATION_PEAK_SCALE, e.g. 32767
+		Peak float32 `json:"peak"`
+		// Gain and peak of the whole album, both are 0 if unknown
+		AlbumGain float32 `json:"albumGain"`
+		AlbumPeak float32 `json:"albumPeak"`
 	} `json:"normalization"`
 
 	Fade struct {
@@ -182,8 +230,9 @@ type StationId struct {
 }
 
 type Station struct {
-	Id   StationId `json:"id"`
-	Name string    `json:"name"`
+	Id       StationId `json:"id"`
+	ParentId StationId `json:"parentId"`
+	Name     string    `json:"name"`
 
 	Icon struct {
 		BackgroundColor string `json:"backgroundIcon"`
@@ -195,7 +244,7 @@ type Station struct {
 		Language struct {
 			Type           string `json:"type"`
 			Name           string `json:"name"`
-			PossibleValues struct {
+			PossibleValues []struct {
 				Name  string `json:"name"`
 				Value string `json:"value"`
 			} `json:"possibleValues"`
@@ -230,7 +279,7 @@ type Station struct {
 		Diversity struct {
 			Type           string `json:"type"`
 			Name           string `json:"name"`
-			PossibleValues struct {
+			PossibleValues []struct {
 				Name  string `json:"name"`
 				Value string `json:"value"`
 			} `json:"possibleValues"`
@@ -246,8 +295,15 @@ type StationDesc struct {
 		Mood      float32 `json:"mood"`
 		Energy    float32 `json:"energy"`
 	} `json:"settings"`
-	RupTitle       string `json:"rupTitle"`
-	RupDescription string `json:"rupDescription"`
+	Settings2      StationSettings `json:"settings2"`
+	RupTitle       string          `json:"rupTitle"`
+	RupDescription string          `json:"rupDescription"`
+}
+
+type StationSettings struct {
+	MoodEnergy string `json:"moodEnergy"`
+	Diversity  string `json:"diversity"`
+	Language   string `json:"language"`
 }
 
 type StationTracks struct {
@@ -275,6 +331,83 @@ type LikesDesc struct {
 	} `json:"library"`
 }
 
+type Landing struct {
+	Pumpkin   bool           `json:"pumpkin"`
+	ContentId string         `json:"contentId"`
+	Blocks    []LandingBlock `json:"blocks"`
+}
+
+type LandingBlock struct {
+	Id          string          `json:"id"`
+	Type        string          `json:"type"`
+	TypeForFrom string          `json:"typeForFrom"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Entities    []LandingEntity `json:"entities"`
+}
+
+// LandingEntity data depends on the entity type,
+// use the accessor methods to decode it.
+type LandingEntity struct {
+	Id   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Playlist decodes the playlist or the personal playlist entity data.
+func (e LandingEntity) Playlist() (pl Playlist, err error) {
+	switch e.Type {
+	case ENTITY_PLAYLIST:
+		err = json.Unmarshal(e.Data, &pl)
+	case ENTITY_PERSONAL_PLAYLIST:
+		var personal struct {
+			Type  string   `json:"type"`
+			Ready bool     `json:"ready"`
+			Data  Playlist `json:"data"`
+		}
+		err = json.Unmarshal(e.Data, &personal)
+		pl = personal.Data
+	default:
+		err = fmt.Errorf("entity %s is not a playlist", e.Type)
+	}
+	return
+}
+
+// Album decodes the album entity data.
+func (e LandingEntity) Album() (album Album, err error) {
+	if e.Type != ENTITY_ALBUM {
+		err = fmt.Errorf("entity %s is not an album", e.Type)
+		return
+	}
+	err = json.Unmarshal(e.Data, &album)
+	return
+}
+
+// Track decodes the chart item entity data.
+func (e LandingEntity) Track() (track Track, err error) {
+	if e.Type != ENTITY_CHART_ITEM {
+		err = fmt.Errorf("entity %s is not a chart item", e.Type)
+		return
+	}
+	var item struct {
+		Track Track `json:"track"`
+	}
+	err = json.Unmarshal(e.Data, &item)
+	track = item.Track
+	return
+}
+
+type LikedAlbum struct {
+	Id        uint64 `json:"id"`
+	Timestamp string `json:"timestamp"`
+	Album     Album  `json:"album"`
+}
+
+type LikedPlaylist struct {
+	Timestamp string   `json:"timestamp"`
+	Playlist  Playlist `json:"playlist"`
+}
+
 type TrackDownloadInfo struct {
 	Codec           string `json:"codec"`
 	Gain            bool   `json:"gain"`
@@ -1,10 +1,16 @@
 package cache
 
 import (
+	"fmt"
+	"hash"
+	"hash/crc32"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/dece2183/yamusic-tui/api"
 	"github.com/dece2183/yamusic-tui/config"
+	"github.com/dece2183/yamusic-tui/log"
 )
 
 func getCacheDir() (string, error) {
@@ -34,40 +40,137 @@ func getCacheDir() (string, error) {
 	return cacheDir, nil
 }
 
-func Read(trackId string) (*os.File, int64, error) {
-	dir, err := getCacheDir()
+// Extensions of the cached track files by the codec
+var codecExtensions = map[string]string{
+	"mp3":  ".mp3",
+	"aac":  ".aac",
+	"flac": ".flac",
+}
+
+// Read opens the cached track file and returns its size and codec.
+// The file checksum is verified in the background on the first read, the corrupted file is removed from the cache,
+// so the next read falls back to the download.
+func Read(trackId string) (*os.File, int64, string, error) {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err := index.load()
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, "", err
 	}
 
-	file, err := os.Open(filepath.Join(dir, trackId+".mp3"))
+	entry, ok := index.entries[trackId]
+	if !ok {
+		return nil, 0, "", os.ErrNotExist
+	}
+
+	file, err := os.Open(filepath.Join(index.dir, entry.fileName()))
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, "", err
+	}
+
+	if !index.verified[trackId] {
+		index.verified[trackId] = true
+		go func(entry Entry) {
+			err := index.verify(entry)
+			if err != nil {
+				log.Print(log.LVL_WARNIGN, "failed to verify the cached track: %s", err)
+			}
+		}(*entry)
 	}
 
-	stat, _ := file.Stat()
-	return file, stat.Size(), nil
+	return file, entry.Size, entry.Codec, nil
+}
+
+// Writer writes the track file to the cache, the track is added to the index on close.
+type Writer struct {
+	file  *os.File
+	hash  hash.Hash32
+	size  int64
+	track api.Track
+	codec string
 }
 
-func Write(trackId string) (*os.File, error) {
+func Write(track api.Track, codec string) (*Writer, error) {
 	dir, err := getCacheDir()
 	if err != nil {
 		return nil, err
 	}
 
-	file, err := os.OpenFile(filepath.Join(dir, trackId+".mp3"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	ext, ok := codecExtensions[codec]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec '%s'", codec)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, track.Id+ext), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
 	if err != nil {
 		return nil, err
 	}
 
-	return file, nil
+	return &Writer{file: file, hash: crc32.NewIEEE(), track: track, codec: codec}, nil
+}
+
+func (w *Writer) Write(data []byte) (int, error) {
+	n, err := w.file.Write(data)
+	w.hash.Write(data[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+// Close completes the cached file and adds the track to the index.
+func (w *Writer) Close() error {
+	err := w.file.Close()
+	if err != nil {
+		return err
+	}
+
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err = index.load()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	entry := &Entry{
+		Track:      w.track,
+		Size:       w.size,
+		Codec:      w.codec,
+		Added:      now,
+		LastPlayed: now,
+		Checksum:   w.hash.Sum32(),
+	}
+	entry.Track.FileSize = int(w.size)
+
+	if old, ok := index.entries[w.track.Id]; ok {
+		if old.Codec != w.codec {
+			os.Remove(filepath.Join(index.dir, old.fileName()))
+		}
+		entry.Added = old.Added
+	}
+	entry.Pinned = index.referenced(w.track.Id)
+
+	index.entries[w.track.Id] = entry
+	index.verified[w.track.Id] = true
+
+	return index.save()
+}
+
+// Discard removes the incomplete cached file.
+func (w *Writer) Discard() error {
+	w.file.Close()
+	return os.Remove(w.file.Name())
 }
 
 func Remove(trackId string) error {
-	dir, err := getCacheDir()
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err := index.load()
 	if err != nil {
 		return err
 	}
 
-	return os.Remove(filepath.Join(dir, trackId+".mp3"))
+	return index.remove(trackId)
 }
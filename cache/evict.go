@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dece2183/yamusic-tui/config"
+)
+
+// Evict removes the cached tracks that weren't played longer than the configured age,
+// then the least recently played ones until the cache fits the configured size.
+// The pinned and the kept tracks are never removed. Returns the ids of the removed tracks.
+func Evict(keep ...string) ([]string, error) {
+	maxSize := int64(config.Current.CacheMaxSize * 1024 * 1024)
+	maxAge := time.Duration(config.Current.CacheMaxAge * float64(24*time.Hour))
+	if maxSize <= 0 && maxAge <= 0 {
+		return nil, nil
+	}
+
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err := index.load()
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make(map[string]bool, len(keep))
+	for _, id := range keep {
+		kept[id] = true
+	}
+
+	var (
+		totalSize  int64
+		candidates []*Entry
+	)
+	for _, entry := range index.entries {
+		totalSize += entry.Size
+		if !entry.Pinned && !kept[entry.Track.Id] {
+			candidates = append(candidates, entry)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].LastPlayed.Before(candidates[j].LastPlayed)
+	})
+
+	var evicted []string
+	for _, entry := range candidates {
+		expired := maxAge > 0 && time.Since(entry.LastPlayed) > maxAge
+		oversized := maxSize > 0 && totalSize > maxSize
+		if !expired && !oversized {
+			break
+		}
+
+		err = index.remove(entry.Track.Id)
+		if err != nil {
+			return evicted, err
+		}
+		totalSize -= entry.Size
+		evicted = append(evicted, entry.Track.Id)
+	}
+
+	return evicted, nil
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/config"
+)
+
+const testFileSize = 100 * 1024
+
+// setupEvictCache writes the tracks of the same size played the durations ago and pins the tracks by the offline playlist.
+func setupEvictCache(t *testing.T, played map[string]time.Duration, pinned []string) string {
+	t.Helper()
+
+	dir := setupCache(t)
+	now := time.Now()
+	entries := make(map[string]*Entry)
+	for id, ago := range played {
+		err := os.WriteFile(filepath.Join(dir, id+".mp3"), make([]byte, testFileSize), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[id] = &Entry{
+			Track:      api.Track{Id: id},
+			Size:       testFileSize,
+			Codec:      "mp3",
+			Added:      now.Add(-ago),
+			LastPlayed: now.Add(-ago),
+		}
+	}
+	writeTestIndex(t, dir, entries)
+
+	if len(pinned) > 0 {
+		playlists := map[string]*OfflinePlaylist{"test": {Key: "test", TrackIds: pinned}}
+		if err := writeJSON(filepath.Join(dir, _OFFLINE_FILE), playlists); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestEvict(t *testing.T) {
+	const day = 24 * time.Hour
+
+	played := map[string]time.Duration{
+		"a": 10 * day,
+		"b": 5 * day,
+		"c": 2 * day,
+		"d": time.Hour,
+	}
+
+	tests := []struct {
+		name string
+		// in megabytes, each track is 0.1 MB
+		maxSize float64
+		// in days
+		maxAge float64
+		pinned []string
+		keep   []string
+		want   []string
+	}{
+		{"disabled", 0, 0, nil, nil, nil},
+		{"fits", 1, 0, nil, nil, nil},
+		{"least recently played", 0.25, 0, nil, nil, []string{"a", "b"}},
+		{"expired", 0, 3, nil, nil, []string{"a", "b"}},
+		{"nothing expired", 0, 30, nil, nil, nil},
+		{"expired and oversized", 0.1, 7, nil, nil, []string{"a", "b", "c"}},
+		{"pinned", 0.25, 0, []string{"b"}, nil, []string{"a", "c"}},
+		{"kept", 0.25, 0, nil, []string{"a"}, []string{"b", "c"}},
+		{"pinned expired", 0, 3, []string{"a"}, nil, []string{"b"}},
+		{"all protected", 0.1, 0, []string{"a", "b"}, []string{"c", "d"}, nil},
+	}
+
+	maxSize, maxAge := config.Current.CacheMaxSize, config.Current.CacheMaxAge
+	t.Cleanup(func() {
+		config.Current.CacheMaxSize = maxSize
+		config.Current.CacheMaxAge = maxAge
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := setupEvictCache(t, played, tt.pinned)
+			config.Current.CacheMaxSize = tt.maxSize
+			config.Current.CacheMaxAge = tt.maxAge
+
+			evicted, err := Evict(tt.keep...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(evicted, tt.want) {
+				t.Fatalf("evicted %v, want %v", evicted, tt.want)
+			}
+
+			removed := make(map[string]bool)
+			for _, id := range tt.want {
+				removed[id] = true
+			}
+
+			entries, err := Entries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(played)-len(tt.want) {
+				t.Errorf("%d entries are left, want %d", len(entries), len(played)-len(tt.want))
+			}
+			for id := range played {
+				_, err := os.Stat(filepath.Join(dir, id+".mp3"))
+				if removed[id] != os.IsNotExist(err) {
+					t.Errorf("track %s file removed %v, want %v", id, os.IsNotExist(err), removed[id])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dece2183/yamusic-tui/api"
+)
+
+const (
+	_INDEX_FILE  = "index.json"
+	_PLAYED_FILE = "played.json"
+)
+
+// Entry is the cached track record of the index
+type Entry struct {
+	Track      api.Track `json:"track"`
+	Size       int64     `json:"size"`
+	Codec      string    `json:"codec"`
+	Added      time.Time `json:"added"`
+	LastPlayed time.Time `json:"lastPlayed"`
+	// CRC-32 of the file, 0 if it's not calculated yet
+	Checksum uint32 `json:"checksum"`
+	// the track of the offline playlist is never evicted from the cache
+	Pinned bool `json:"pinned"`
+}
+
+func (e *Entry) fileName() string {
+	return e.Track.Id + codecExtensions[e.Codec]
+}
+
+// trackIndex keeps the cached tracks info, so the cache directory doesn't have to be parsed on every start
+type trackIndex struct {
+	mux     sync.Mutex
+	dir     string
+	entries map[string]*Entry
+	// tracks which files checksum is verified in this session
+	verified map[string]bool
+	// play times of the tracks played since the index was saved,
+	// they are written apart from the index, so it isn't rewritten on every play
+	played map[string]time.Time
+	// playlists which tracks are pinned in the cache
+	playlists map[string]*OfflinePlaylist
+	// the number of the offline playlists that refer to the track
+	references map[string]int
+}
+
+var index trackIndex
+
+// load reads the index file once and reconciles it with the cache directory.
+// The index is rebuilt from the track files if it's missing or corrupted.
+func (x *trackIndex) load() error {
+	if x.entries != nil {
+		return nil
+	}
+
+	dir, err := getCacheDir()
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]*Entry)
+	changed := false
+
+	data, err := os.ReadFile(filepath.Join(dir, _INDEX_FILE))
+	if err != nil || json.Unmarshal(data, &entries) != nil {
+		entries = make(map[string]*Entry)
+		changed = true
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	present := make(map[string]os.DirEntry, len(files))
+	for _, file := range files {
+		present[file.Name()] = file
+	}
+
+	for id, entry := range entries {
+		file, ok := present[entry.fileName()]
+		if ok {
+			info, err := file.Info()
+			ok = err == nil && info.Size() == entry.Size && entry.Track.Id == id
+		}
+		if !ok {
+			delete(entries, id)
+			changed = true
+		}
+	}
+
+	for name, file := range present {
+		ext := strings.ToLower(filepath.Ext(name))
+		codec, ok := extensionCodec(ext)
+		if file.IsDir() || !ok {
+			continue
+		}
+
+		id := name[:len(name)-len(ext)]
+		if _, ok := entries[id]; ok {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		track, err := readTrackTags(filepath.Join(dir, name), id, info.Size())
+		if err != nil {
+			continue
+		}
+
+		track.FileSize = int(info.Size())
+		entries[id] = &Entry{
+			Track:      track,
+			Size:       info.Size(),
+			Codec:      codec,
+			Added:      info.ModTime(),
+			LastPlayed: info.ModTime(),
+		}
+		changed = true
+	}
+
+	x.dir = dir
+	x.entries = entries
+	x.verified = make(map[string]bool)
+	x.played = make(map[string]time.Time)
+	x.playlists = loadOfflinePlaylists(dir)
+	x.references = make(map[string]int)
+	for _, pl := range x.playlists {
+		x.reference(pl.TrackIds, 1)
+	}
+
+	if x.readJSON(_PLAYED_FILE, &x.played) != nil {
+		x.played = make(map[string]time.Time)
+	}
+	for id, lastPlayed := range x.played {
+		if entry, ok := entries[id]; ok && lastPlayed.After(entry.LastPlayed) {
+			entry.LastPlayed = lastPlayed
+			changed = true
+		}
+	}
+
+	for id, entry := range entries {
+		if pinned := x.referenced(id); pinned != entry.Pinned {
+			entry.Pinned = pinned
+			changed = true
+		}
+	}
+
+	if changed {
+		return x.save()
+	}
+	return nil
+}
+
+func (x *trackIndex) save() error {
+	err := writeJSON(filepath.Join(x.dir, _INDEX_FILE), x.entries)
+	if err != nil {
+		return err
+	}
+
+	// the index keeps the play times now
+	x.played = make(map[string]time.Time)
+	err = os.Remove(filepath.Join(x.dir, _PLAYED_FILE))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// writeJSON writes the value to the temporary file and replaces the old one with it,
+// so the file isn't corrupted if the writing is interrupted.
+func writeJSON(path string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(path+".tmp", data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// verify checks the file checksum of the entry, the missing checksum is calculated.
+// The file is read without the lock, so it doesn't block the other cache calls.
+// The corrupted file is removed from the cache unless it's replaced while it's read.
+func (x *trackIndex) verify(entry Entry) error {
+	file, err := os.Open(filepath.Join(x.dir, entry.fileName()))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := crc32.NewIEEE()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+
+	x.mux.Lock()
+	defer x.mux.Unlock()
+
+	current, ok := x.entries[entry.Track.Id]
+	if !ok || current.Codec != entry.Codec || current.Size != entry.Size || current.Checksum != entry.Checksum {
+		return nil
+	}
+
+	if current.Checksum == 0 {
+		current.Checksum = hash.Sum32()
+		return x.save()
+	}
+	if current.Checksum != hash.Sum32() {
+		x.remove(entry.Track.Id)
+		return fmt.Errorf("cached track '%s' checksum mismatch", entry.Track.Id)
+	}
+
+	return nil
+}
+
+// remove deletes the track files of all codecs and its index entry.
+func (x *trackIndex) remove(trackId string) error {
+	err := os.ErrNotExist
+	for _, ext := range codecExtensions {
+		removeErr := os.Remove(filepath.Join(x.dir, trackId+ext))
+		if removeErr == nil || !os.IsNotExist(removeErr) {
+			err = removeErr
+		}
+	}
+
+	if _, ok := x.entries[trackId]; ok {
+		delete(x.entries, trackId)
+		delete(x.verified, trackId)
+		if saveErr := x.save(); saveErr != nil {
+			return saveErr
+		}
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+
+	return err
+}
+
+// Entries returns the copies of the cached tracks records ordered by the time they were added.
+func Entries() ([]Entry, error) {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err := index.load()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(index.entries))
+	for _, entry := range index.entries {
+		entries = append(entries, *entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Added.Equal(entries[j].Added) {
+			return entries[i].Track.Id < entries[j].Track.Id
+		}
+		return entries[i].Added.Before(entries[j].Added)
+	})
+
+	return entries, nil
+}
+
+// Touch marks the cached track as played now.
+func Touch(trackId string) error {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err := index.load()
+	if err != nil {
+		return err
+	}
+
+	entry, ok := index.entries[trackId]
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	entry.LastPlayed = time.Now()
+	index.played[trackId] = entry.LastPlayed
+	return writeJSON(filepath.Join(index.dir, _PLAYED_FILE), index.played)
+}
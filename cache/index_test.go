@@ -0,0 +1,277 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/config"
+)
+
+const (
+	testFrames = 100
+	// duration of the test frames at 1152 samples per frame and 44100 Hz
+	testDurationMs = testFrames * 1152 * 1000 / 44100
+)
+
+// setupCache points the cache to the temporary directory and resets the index.
+func setupCache(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	cacheDir := config.Current.CacheDir
+	config.Current.CacheDir = dir
+	index = trackIndex{}
+
+	t.Cleanup(func() {
+		config.Current.CacheDir = cacheDir
+		index = trackIndex{}
+	})
+	return dir
+}
+
+// writeTestTrack writes the tagged silent MPEG-1 Layer III 128 kbps 44100 Hz track, the TLEN frame is omitted if durationMs is 0.
+func writeTestTrack(t *testing.T, dir, id, title string, durationMs int) []byte {
+	t.Helper()
+
+	tag := id3v2.NewEmptyTag()
+	tag.SetTitle(title)
+	tag.SetArtist("artist")
+	if durationMs > 0 {
+		tag.AddTextFrame("TLEN", id3v2.EncodingUTF8, strconv.Itoa(durationMs))
+	}
+
+	var buf bytes.Buffer
+	if _, err := tag.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < testFrames; i++ {
+		frame := make([]byte, 417)
+		copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+		buf.Write(frame)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, id+".mp3"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeTestIndex writes the index file of the entries.
+func writeTestIndex(t *testing.T, dir string, entries map[string]*Entry) {
+	t.Helper()
+
+	if err := writeJSON(filepath.Join(dir, _INDEX_FILE), entries); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadRebuildsIndex(t *testing.T) {
+	tests := []struct {
+		name  string
+		index []byte
+	}{
+		{"missing", nil},
+		{"corrupted", []byte(`{"a": {"track": `)},
+		{"empty", []byte(`{}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := setupCache(t)
+			a := writeTestTrack(t, dir, "a", "first", 5000)
+			writeTestTrack(t, dir, "b", "second", 0)
+			os.WriteFile(filepath.Join(dir, "c.txt"), []byte("not a track"), 0644)
+			if tt.index != nil {
+				os.WriteFile(filepath.Join(dir, _INDEX_FILE), tt.index, 0644)
+			}
+
+			entries, err := Entries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 {
+				t.Fatalf("%d entries are loaded, want 2", len(entries))
+			}
+
+			got := make(map[string]Entry)
+			for _, entry := range entries {
+				got[entry.Track.Id] = entry
+			}
+			if e := got["a"]; e.Track.Title != "first" || e.Track.DurationMs != 5000 || e.Size != int64(len(a)) || e.Codec != "mp3" {
+				t.Errorf("entry a is %+v", e)
+			}
+			// the duration of the track without the TLEN frame is measured by its frames
+			if e := got["b"]; e.Track.Title != "second" || e.Track.DurationMs != testDurationMs {
+				t.Errorf("entry b is %q of %d ms, want \"second\" of %d ms", e.Track.Title, e.Track.DurationMs, testDurationMs)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, _INDEX_FILE))
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved := make(map[string]*Entry)
+			if err := json.Unmarshal(data, &saved); err != nil || len(saved) != 2 {
+				t.Errorf("saved index has %d entries, %v; want 2", len(saved), err)
+			}
+		})
+	}
+}
+
+func TestLoadReconcilesIndex(t *testing.T) {
+	dir := setupCache(t)
+	a := writeTestTrack(t, dir, "a", "first", 5000)
+	c := writeTestTrack(t, dir, "c", "third", 5000)
+
+	added := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeTestIndex(t, dir, map[string]*Entry{
+		"a": {Track: api.Track{Id: "a", Title: "indexed"}, Size: int64(len(a)), Codec: "mp3", Added: added},
+		// the file is missing
+		"b": {Track: api.Track{Id: "b"}, Size: 100, Codec: "mp3", Added: added},
+		// the file is rewritten
+		"c": {Track: api.Track{Id: "c", Title: "stale"}, Size: int64(len(c)) + 1, Codec: "mp3", Added: added},
+		// the entry is stored under the wrong id
+		"d": {Track: api.Track{Id: "a"}, Size: int64(len(a)), Codec: "mp3", Added: added},
+	})
+
+	entries, err := Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]Entry)
+	for _, entry := range entries {
+		got[entry.Track.Id] = entry
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d entries are loaded, want 2", len(entries))
+	}
+	if e := got["a"]; e.Track.Title != "indexed" || !e.Added.Equal(added) {
+		t.Errorf("entry a is %+v, want the indexed one", e)
+	}
+	if e := got["c"]; e.Track.Title != "third" || e.Size != int64(len(c)) {
+		t.Errorf("entry c is %+v, want the one rebuilt from the file", e)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		checksum func(sum uint32) uint32
+		// the entry is replaced while the file is read
+		replaced     bool
+		wantErr      bool
+		wantChecksum func(sum uint32) uint32
+	}{
+		{"calculated", func(uint32) uint32 { return 0 }, false, false, func(sum uint32) uint32 { return sum }},
+		{"matches", func(sum uint32) uint32 { return sum }, false, false, func(sum uint32) uint32 { return sum }},
+		{"mismatch", func(sum uint32) uint32 { return sum + 1 }, false, true, nil},
+		{"replaced", func(sum uint32) uint32 { return sum + 1 }, true, false, func(sum uint32) uint32 { return sum + 2 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := setupCache(t)
+			data := writeTestTrack(t, dir, "a", "first", 5000)
+			sum := crc32.ChecksumIEEE(data)
+
+			index.mux.Lock()
+			err := index.load()
+			entry := index.entries["a"]
+			entry.Checksum = tt.checksum(sum)
+			checked := *entry
+			if tt.replaced {
+				entry.Checksum = sum + 2
+			}
+			index.mux.Unlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = index.verify(checked)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verify returned %v, want error %v", err, tt.wantErr)
+			}
+
+			index.mux.Lock()
+			defer index.mux.Unlock()
+
+			entry, ok := index.entries["a"]
+			_, statErr := os.Stat(filepath.Join(dir, "a.mp3"))
+			if tt.wantChecksum == nil {
+				if ok || !os.IsNotExist(statErr) {
+					t.Errorf("corrupted track is kept in the cache")
+				}
+				return
+			}
+			if !ok || statErr != nil {
+				t.Fatalf("track is removed from the cache")
+			}
+			if want := tt.wantChecksum(sum); entry.Checksum != want {
+				t.Errorf("checksum is %x, want %x", entry.Checksum, want)
+			}
+		})
+	}
+}
+
+func TestTouch(t *testing.T) {
+	dir := setupCache(t)
+	writeTestTrack(t, dir, "a", "first", 5000)
+	writeTestTrack(t, dir, "b", "second", 5000)
+
+	if _, err := Entries(); err != nil {
+		t.Fatal(err)
+	}
+	index.mux.Lock()
+	loaded := index.entries["a"].LastPlayed
+	index.mux.Unlock()
+
+	indexInfo, err := os.Stat(filepath.Join(dir, _INDEX_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Touch("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Touch("x"); !os.IsNotExist(err) {
+		t.Errorf("touching the missing track returned %v, want %v", err, os.ErrNotExist)
+	}
+
+	// the play time is written apart from the index
+	if info, err := os.Stat(filepath.Join(dir, _INDEX_FILE)); err != nil || !info.ModTime().Equal(indexInfo.ModTime()) || info.Size() != indexInfo.Size() {
+		t.Error("index is rewritten on touch")
+	}
+	if _, err := os.Stat(filepath.Join(dir, _PLAYED_FILE)); err != nil {
+		t.Fatalf("play times aren't saved: %v", err)
+	}
+
+	index.mux.Lock()
+	played := index.entries["a"].LastPlayed
+	index.mux.Unlock()
+	if !played.After(loaded) {
+		t.Fatalf("last played time isn't updated")
+	}
+
+	// the play times are restored on the next start and merged into the index
+	index = trackIndex{}
+	entries, err := Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Track.Id == "a" && !entry.LastPlayed.Equal(played) {
+			t.Errorf("restored last played time is %v, want %v", entry.LastPlayed, played)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, _PLAYED_FILE)); !os.IsNotExist(err) {
+		t.Errorf("play times file is kept after the index is saved: %v", err)
+	}
+}
@@ -2,68 +2,131 @@ package cache
 
 import (
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/bogem/id3v2/v2"
 	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/stream"
 )
 
+// Descriptions of the user defined ID3 frames that keep the track normalization
+const (
+	TAG_TRACK_GAIN = "REPLAYGAIN_TRACK_GAIN"
+	TAG_TRACK_PEAK = "REPLAYGAIN_TRACK_PEAK"
+	TAG_ALBUM_GAIN = "REPLAYGAIN_ALBUM_GAIN"
+	TAG_ALBUM_PEAK = "REPLAYGAIN_ALBUM_PEAK"
+)
+
+// ListTracks returns the cached tracks ordered by the time they were added.
 func ListTracks() ([]api.Track, error) {
-	dir, err := getCacheDir()
+	entries, err := Entries()
 	if err != nil {
 		return nil, err
 	}
 
-	entries, err := os.ReadDir(dir)
+	tracks := make([]api.Track, len(entries))
+	for i := range entries {
+		tracks[i] = entries[i].Track
+	}
+
+	return tracks, nil
+}
+
+// readTrackTags restores the track info from the ID3 tag of the cached file.
+// It's used to rebuild the index, the track duration is measured by the file frames if the tag has no TLEN frame.
+func readTrackTags(path, trackId string, size int64) (api.Track, error) {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
 	if err != nil {
-		return nil, err
+		return api.Track{}, err
 	}
 
-	tracks := make([]api.Track, 0, len(entries))
-	for _, entry := range entries {
-		name := entry.Name()
-		ext := strings.ToLower(filepath.Ext(name))
-		if entry.IsDir() || ext != ".mp3" {
+	defer tag.Close()
+
+	artistNames := strings.Split(tag.Artist(), ",")
+	artists := make([]api.Artist, len(artistNames))
+	for i := range artistNames {
+		artists[i].Name = artistNames[i]
+	}
+
+	year, _ := strconv.Atoi(tag.Year())
+	durationMs, _ := strconv.Atoi(tag.GetTextFrame("TLEN").Text)
+	if durationMs <= 0 {
+		durationMs = fileDurationMs(path, size)
+	}
+
+	track := api.Track{
+		Id:         trackId,
+		Title:      tag.Title(),
+		Available:  true,
+		DurationMs: durationMs,
+		Artists:    artists,
+		Albums: []api.Album{
+			{
+				Title: tag.Album(),
+				Genre: tag.Genre(),
+				Year:  year,
+			},
+		},
+	}
+	readNormalization(tag, &track)
+
+	return track, nil
+}
+
+// fileDurationMs returns the duration of the mp3 file frames, 0 if the file can't be read.
+func fileDurationMs(path string, size int64) int {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+
+	s := stream.NewFileStream(file, size)
+	defer s.Close()
+
+	idx, err := stream.NewMP3Index(s)
+	if err != nil {
+		return 0
+	}
+
+	return int(idx.Duration().Milliseconds())
+}
+
+func readNormalization(tag *id3v2.Tag, track *api.Track) {
+	for _, frame := range tag.GetFrames(tag.CommonID("User defined text information frame")) {
+		udtf, ok := frame.(id3v2.UserDefinedTextFrame)
+		if !ok {
 			continue
 		}
 
-		tag, err := id3v2.Open(filepath.Join(dir, name), id3v2.Options{Parse: true})
+		value := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(udtf.Value), "dB"))
+		number, err := strconv.ParseFloat(value, 32)
 		if err != nil {
 			continue
 		}
 
-		artistNames := strings.Split(tag.Artist(), ",")
-		artists := make([]api.Artist, len(artistNames))
-		for i := range artistNames {
-			artists[i].Name = artistNames[i]
+		switch strings.ToUpper(udtf.Description) {
+		case TAG_TRACK_GAIN:
+			track.Normalization.Gain = float32(number)
+		case TAG_TRACK_PEAK:
+			// the tag keeps the linear peak, the older versions wrote the server value as is
+			if number <= 1 {
+				number *= api.NORMALIZATION_PEAK_SCALE
+			}
+			track.Normalization.Peak = float32(number)
+		case TAG_ALBUM_GAIN:
+			track.Normalization.AlbumGain = float32(number)
+		case TAG_ALBUM_PEAK:
+			track.Normalization.AlbumPeak = float32(number * api.NORMALIZATION_PEAK_SCALE)
 		}
+	}
+}
 
-		stat, _ := entry.Info()
-		year, _ := strconv.Atoi(tag.Year())
-		durationMs, _ := strconv.Atoi(tag.GetTextFrame("TLEN").Text)
-
-		if durationMs > 0 {
-			tracks = append(tracks, api.Track{
-				Id:         name[:len(name)-len(ext)],
-				Title:      tag.Title(),
-				Available:  true,
-				FileSize:   int(stat.Size()),
-				DurationMs: int(durationMs),
-				Artists:    artists,
-				Albums: []api.Album{
-					{
-						Title: tag.Album(),
-						Genre: tag.Genre(),
-						Year:  year,
-					},
-				},
-			})
+func extensionCodec(ext string) (string, bool) {
+	for codec, codecExt := range codecExtensions {
+		if ext == codecExt {
+			return codec, true
 		}
-
-		tag.Close()
 	}
-
-	return tracks, nil
+	return "", false
 }
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const _OFFLINE_FILE = "offline.json"
+
+// OfflinePlaylist is the playlist which tracks are kept in the cache for the offline playback
+type OfflinePlaylist struct {
+	// Key identifies the playlist regardless of its position in the side panel
+	Key      string   `json:"key"`
+	Name     string   `json:"name"`
+	TrackIds []string `json:"trackIds"`
+}
+
+func loadOfflinePlaylists(dir string) map[string]*OfflinePlaylist {
+	playlists := make(map[string]*OfflinePlaylist)
+
+	data, err := os.ReadFile(filepath.Join(dir, _OFFLINE_FILE))
+	if err != nil || json.Unmarshal(data, &playlists) != nil {
+		return make(map[string]*OfflinePlaylist)
+	}
+
+	return playlists
+}
+
+func (x *trackIndex) saveOfflinePlaylists() error {
+	return writeJSON(filepath.Join(x.dir, _OFFLINE_FILE), x.playlists)
+}
+
+// reference changes the number of the offline playlists that refer to the tracks by the delta.
+func (x *trackIndex) reference(trackIds []string, delta int) {
+	for _, id := range trackIds {
+		x.references[id] += delta
+		if x.references[id] <= 0 {
+			delete(x.references, id)
+		}
+	}
+}
+
+// referenced reports whether the track belongs to any offline playlist.
+func (x *trackIndex) referenced(trackId string) bool {
+	return x.references[trackId] > 0
+}
+
+// updatePins pins the cached tracks that belong to the offline playlists and releases the rest of them.
+func (x *trackIndex) updatePins(trackIds []string) error {
+	changed := false
+	for _, id := range trackIds {
+		entry, ok := x.entries[id]
+		if !ok {
+			continue
+		}
+		if pinned := x.referenced(id); pinned != entry.Pinned {
+			entry.Pinned = pinned
+			changed = true
+		}
+	}
+
+	if changed {
+		return x.save()
+	}
+	return nil
+}
+
+// OfflinePlaylists returns the playlists made available offline ordered by their names.
+func OfflinePlaylists() ([]OfflinePlaylist, error) {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err := index.load()
+	if err != nil {
+		return nil, err
+	}
+
+	playlists := make([]OfflinePlaylist, 0, len(index.playlists))
+	for _, pl := range index.playlists {
+		playlists = append(playlists, *pl)
+	}
+
+	sort.Slice(playlists, func(i, j int) bool {
+		return playlists[i].Name < playlists[j].Name
+	})
+
+	return playlists, nil
+}
+
+// SetOfflinePlaylist saves the offline playlist and pins its tracks that are already cached.
+// The tracks that are cached later are pinned on write.
+func SetOfflinePlaylist(pl OfflinePlaylist) error {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err := index.load()
+	if err != nil {
+		return err
+	}
+
+	var oldIds []string
+	if old, ok := index.playlists[pl.Key]; ok {
+		oldIds = old.TrackIds
+		index.reference(oldIds, -1)
+	}
+
+	index.playlists[pl.Key] = &pl
+	index.reference(pl.TrackIds, 1)
+	err = index.saveOfflinePlaylists()
+	if err != nil {
+		return err
+	}
+
+	return index.updatePins(append(oldIds, pl.TrackIds...))
+}
+
+// RemoveOfflinePlaylist forgets the offline playlist, its tracks stay in the cache
+// but can be evicted unless they belong to another offline playlist.
+func RemoveOfflinePlaylist(key string) error {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err := index.load()
+	if err != nil {
+		return err
+	}
+
+	pl, ok := index.playlists[key]
+	if !ok {
+		return nil
+	}
+
+	delete(index.playlists, key)
+	index.reference(pl.TrackIds, -1)
+	err = index.saveOfflinePlaylists()
+	if err != nil {
+		return err
+	}
+
+	return index.updatePins(pl.TrackIds)
+}
+
+// Pinned reports whether the cached track belongs to an offline playlist.
+func Pinned(trackId string) bool {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	if index.load() != nil {
+		return false
+	}
+
+	entry, ok := index.entries[trackId]
+	return ok && entry.Pinned
+}
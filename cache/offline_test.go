@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/config"
+)
+
+func checkPins(t *testing.T, want map[string]bool) {
+	t.Helper()
+
+	for id, pinned := range want {
+		if Pinned(id) != pinned {
+			t.Errorf("track %s pinned %v, want %v", id, !pinned, pinned)
+		}
+	}
+}
+
+func TestOfflinePlaylistPins(t *testing.T) {
+	const day = 24 * time.Hour
+
+	setupEvictCache(t, map[string]time.Duration{
+		"a": 10 * day,
+		"b": 5 * day,
+		"c": 2 * day,
+		"d": time.Hour,
+	}, nil)
+
+	maxSize := config.Current.CacheMaxSize
+	config.Current.CacheMaxSize = 0.1
+	t.Cleanup(func() { config.Current.CacheMaxSize = maxSize })
+
+	err := SetOfflinePlaylist(OfflinePlaylist{Key: "first", Name: "first", TrackIds: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SetOfflinePlaylist(OfflinePlaylist{Key: "second", Name: "second", TrackIds: []string{"b", "c", "e"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPins(t, map[string]bool{"a": true, "b": true, "c": true, "d": false})
+
+	// the track of the offline playlist is pinned when it's cached
+	w, err := Write(api.Track{Id: "e"}, "mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(make([]byte, testFileSize))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkPins(t, map[string]bool{"e": true})
+
+	evicted, err := Evict()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"d"}; !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("evicted %v, want %v", evicted, want)
+	}
+
+	// the track stays pinned while any offline playlist refers to it
+	if err := RemoveOfflinePlaylist("first"); err != nil {
+		t.Fatal(err)
+	}
+	checkPins(t, map[string]bool{"a": false, "b": true, "c": true, "e": true})
+
+	err = SetOfflinePlaylist(OfflinePlaylist{Key: "second", Name: "second", TrackIds: []string{"c", "e"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPins(t, map[string]bool{"a": false, "b": false, "c": true, "e": true})
+
+	// the pins are restored on the next start
+	index = trackIndex{}
+	checkPins(t, map[string]bool{"a": false, "b": false, "c": true, "e": true})
+
+	evicted, err = Evict()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("evicted %v, want %v", evicted, want)
+	}
+
+	if err := RemoveOfflinePlaylist("second"); err != nil {
+		t.Fatal(err)
+	}
+	checkPins(t, map[string]bool{"c": false, "e": false})
+
+	playlists, err := OfflinePlaylists()
+	if err != nil || len(playlists) != 0 {
+		t.Errorf("offline playlists are %v, %v; want none", playlists, err)
+	}
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+const (
+	_SNAPSHOTS_FILE = "snapshots.json"
+	_PENDING_FILE   = "pending.json"
+)
+
+// Snapshot is the track list of the user playlist or likes saved for the offline startup
+type Snapshot struct {
+	Name     string   `json:"name"`
+	Kind     uint64   `json:"kind"`
+	Revision int      `json:"revision"`
+	TrackIds []string `json:"trackIds"`
+}
+
+// Actions of the library changes made offline
+const (
+	ACTION_LIKE            = "like"
+	ACTION_UNLIKE          = "unlike"
+	ACTION_PLAYLIST_ADD    = "playlist-add"
+	ACTION_PLAYLIST_REMOVE = "playlist-remove"
+)
+
+// Mutation is the library change made offline which is sent to the server when the connection is restored
+type Mutation struct {
+	Action  string `json:"action"`
+	TrackId string `json:"trackId"`
+	// the user playlist kind of the playlist actions
+	PlaylistKind uint64 `json:"playlistKind,omitempty"`
+}
+
+// readJSON reads the cache directory file, the missing file leaves the value untouched.
+func (x *trackIndex) readJSON(name string, value any) error {
+	data, err := os.ReadFile(filepath.Join(x.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// SaveSnapshots replaces the user library snapshots.
+func SaveSnapshots(snapshots []Snapshot) error {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err := index.load()
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(filepath.Join(index.dir, _SNAPSHOTS_FILE), snapshots)
+}
+
+// Snapshots returns the user library snapshots saved by the last online session.
+func Snapshots() ([]Snapshot, error) {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err := index.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	err = index.readJSON(_SNAPSHOTS_FILE, &snapshots)
+	return snapshots, err
+}
+
+// AddPending queues the library change to be sent to the server later.
+func AddPending(mutation Mutation) error {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err := index.load()
+	if err != nil {
+		return err
+	}
+
+	var pending []Mutation
+	err = index.readJSON(_PENDING_FILE, &pending)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(filepath.Join(index.dir, _PENDING_FILE), append(pending, mutation))
+}
+
+// Pending returns the queued library changes in the order they were made.
+func Pending() ([]Mutation, error) {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err := index.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Mutation
+	err = index.readJSON(_PENDING_FILE, &pending)
+	return pending, err
+}
+
+// DropPending removes the first queued changes that are sent to the server.
+func DropPending(count int) error {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	err := index.load()
+	if err != nil {
+		return err
+	}
+
+	var pending []Mutation
+	err = index.readJSON(_PENDING_FILE, &pending)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(filepath.Join(index.dir, _PENDING_FILE), pending[min(count, len(pending)):])
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDropPending(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		want  []string
+	}{
+		{"none", 0, []string{"0", "1", "2"}},
+		{"first", 1, []string{"1", "2"}},
+		{"all", 3, nil},
+		{"more than queued", 5, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupCache(t)
+
+			for i := 0; i < 3; i++ {
+				err := AddPending(Mutation{Action: ACTION_LIKE, TrackId: fmt.Sprint(i)})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := DropPending(tt.count); err != nil {
+				t.Fatal(err)
+			}
+
+			pending, err := Pending()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, mutation := range pending {
+				ids = append(ids, mutation.TrackId)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("pending changes are %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
@@ -63,11 +63,36 @@ func load() (Config, error) {
 		newConfig.VolumeStep = defaultConfig.VolumeStep
 	}
 
+	// the older configs have no memory limit, the negative one keeps all the tracks in memory
+	if newConfig.StreamMemory == 0 {
+		newConfig.StreamMemory = defaultConfig.StreamMemory
+	}
+
+	if newConfig.Quality == nil {
+		quality := *defaultConfig.Quality
+		newConfig.Quality = &quality
+	}
+
 	if newConfig.Search == nil {
 		search := *defaultConfig.Search
 		newConfig.Search = &search
 	}
 
+	if newConfig.MyWave == nil {
+		myWave := *defaultConfig.MyWave
+		newConfig.MyWave = &myWave
+	} else {
+		if len(newConfig.MyWave.Mood) == 0 {
+			newConfig.MyWave.Mood = defaultConfig.MyWave.Mood
+		}
+		if len(newConfig.MyWave.Diversity) == 0 {
+			newConfig.MyWave.Diversity = defaultConfig.MyWave.Diversity
+		}
+		if len(newConfig.MyWave.Language) == 0 {
+			newConfig.MyWave.Language = defaultConfig.MyWave.Language
+		}
+	}
+
 	if newConfig.Controls == nil {
 		controls := *defaultConfig.Controls
 		newConfig.Controls = &controls
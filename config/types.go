@@ -38,6 +38,115 @@ func (t CacheType) MarshalYAML() (interface{}, error) {
 	return cacheEnumToValue[t], nil
 }
 
+type RepeatType uint
+
+const (
+	REPEAT_OFF RepeatType = iota
+	REPEAT_ALL
+	REPEAT_ONE
+)
+
+var repeatValueToEnum = map[string]RepeatType{
+	"off":   REPEAT_OFF,
+	"none":  REPEAT_OFF,
+	"false": REPEAT_OFF,
+	"all":   REPEAT_ALL,
+	"one":   REPEAT_ONE,
+	"track": REPEAT_ONE,
+}
+
+var repeatEnumToValue = map[RepeatType]string{
+	REPEAT_OFF: "off",
+	REPEAT_ALL: "all",
+	REPEAT_ONE: "one",
+}
+
+func (t *RepeatType) UnmarshalYAML(value *yaml.Node) error {
+	*t = repeatValueToEnum[value.Value]
+	return nil
+}
+
+func (t RepeatType) MarshalYAML() (interface{}, error) {
+	if t > REPEAT_ONE {
+		t = REPEAT_OFF
+	}
+	return repeatEnumToValue[t], nil
+}
+
+type NormalizationType uint
+
+const (
+	NORMALIZATION_OFF NormalizationType = iota
+	NORMALIZATION_TRACK
+	NORMALIZATION_ALBUM
+)
+
+var normalizationValueToEnum = map[string]NormalizationType{
+	"off":   NORMALIZATION_OFF,
+	"none":  NORMALIZATION_OFF,
+	"false": NORMALIZATION_OFF,
+	"track": NORMALIZATION_TRACK,
+	"album": NORMALIZATION_ALBUM,
+}
+
+var normalizationEnumToValue = map[NormalizationType]string{
+	NORMALIZATION_OFF:   "off",
+	NORMALIZATION_TRACK: "track",
+	NORMALIZATION_ALBUM: "album",
+}
+
+func (t *NormalizationType) UnmarshalYAML(value *yaml.Node) error {
+	*t = normalizationValueToEnum[value.Value]
+	return nil
+}
+
+func (t NormalizationType) MarshalYAML() (interface{}, error) {
+	if t > NORMALIZATION_ALBUM {
+		t = NORMALIZATION_OFF
+	}
+	return normalizationEnumToValue[t], nil
+}
+
+type QualityType uint
+
+const (
+	QUALITY_LOW QualityType = iota
+	QUALITY_NORMAL
+	QUALITY_HIGH
+	QUALITY_LOSSLESS
+)
+
+var qualityValueToEnum = map[string]QualityType{
+	"low":      QUALITY_LOW,
+	"normal":   QUALITY_NORMAL,
+	"high":     QUALITY_HIGH,
+	"lossless": QUALITY_LOSSLESS,
+}
+
+var qualityEnumToValue = map[QualityType]string{
+	QUALITY_LOW:      "low",
+	QUALITY_NORMAL:   "normal",
+	QUALITY_HIGH:     "high",
+	QUALITY_LOSSLESS: "lossless",
+}
+
+func (t *QualityType) UnmarshalYAML(value *yaml.Node) error {
+	q, ok := qualityValueToEnum[value.Value]
+	if !ok {
+		// the unknown level keeps the default one instead of the lowest
+		q = QUALITY_HIGH
+	}
+	*t = q
+	return nil
+}
+
+func (t QualityType) MarshalYAML() (interface{}, error) {
+	if t > QUALITY_LOSSLESS {
+		t = QUALITY_HIGH
+	}
+	return qualityEnumToValue[t], nil
+}
+
 type Controls struct {
 	// Main control
 	Quit        *Key `yaml:"quit"`
@@ -46,17 +155,29 @@ type Controls struct {
 	CursorUp    *Key `yaml:"cursor-up"`
 	CursorDown  *Key `yaml:"cursor-down"`
 	ShowAllKeys *Key `yaml:"show-all-kyes"`
+	Queue       *Key `yaml:"queue"`
 	// Playlists control
-	PlaylistsUp     *Key `yaml:"playlists-up"`
-	PlaylistsDown   *Key `yaml:"playlists-down"`
-	PlaylistsRename *Key `yaml:"playlists-rename"`
+	PlaylistsUp      *Key `yaml:"playlists-up"`
+	PlaylistsDown    *Key `yaml:"playlists-down"`
+	PlaylistsRename  *Key `yaml:"playlists-rename"`
+	PlaylistsChange  *Key `yaml:"playlists-change"`
+	PlaylistsOffline *Key `yaml:"playlists-offline"`
 	// Track list control
 	TracksLike               *Key `yaml:"tracks-like"`
+	TracksLikeAlbum          *Key `yaml:"tracks-like-album"`
 	TracksAddToPlaylist      *Key `yaml:"tracks-add-to-playlist"`
 	TracksRemoveFromPlaylist *Key `yaml:"tracks-remove-from-playlist"`
 	TracksShare              *Key `yaml:"tracks-share"`
 	TracksShuffle            *Key `yaml:"tracks-shuffle"`
 	TracksSearch             *Key `yaml:"tracks-search"`
+	TracksArtist             *Key `yaml:"tracks-artist"`
+	TracksAlbum              *Key `yaml:"tracks-album"`
+	TracksPlayNext           *Key `yaml:"tracks-play-next"`
+	TracksEnqueue            *Key `yaml:"tracks-enqueue"`
+	// Queue control
+	QueueMoveUp   *Key `yaml:"queue-move-up"`
+	QueueMoveDown *Key `yaml:"queue-move-down"`
+	QueueRemove   *Key `yaml:"queue-remove"`
 	// Player control
 	PlayerPause          *Key `yaml:"player-pause"`
 	PlayerNext           *Key `yaml:"player-next"`
@@ -68,6 +189,16 @@ type Controls struct {
 	PlayerVolUp          *Key `yaml:"player-vol-up"`
 	PlayerVolDown        *Key `yaml:"player-vol-down"`
 	PlayerToggleLyrics   *Key `yaml:"player-toggle-lyrics"`
+	PlayerRepeat         *Key `yaml:"player-repeat"`
+	PlayerStopAfter      *Key `yaml:"player-stop-after"`
+}
+
+type Quality struct {
+	Level QualityType `yaml:"level"`
+	// Preferred codec, the other ones are used if the track has no variant with it
+	Codec string `yaml:"codec"`
+	// Pick lower bitrates automatically when the downloads are slow
+	AutoMetered bool `yaml:"auto-metered"`
 }
 
 type Search struct {
@@ -76,34 +207,64 @@ type Search struct {
 	Playlists bool `yaml:"playlists"`
 }
 
+type MyWave struct {
+	Mood      string `yaml:"mood"`
+	Diversity string `yaml:"diversity"`
+	Language  string `yaml:"language"`
+}
+
 type Config struct {
-	Token          string    `yaml:"token"`
-	BufferSize     float64   `yaml:"buffer-size-ms"`
-	RewindDuration float64   `yaml:"rewind-duration-s"`
-	Volume         float64   `yaml:"volume"`
-	VolumeStep     float64   `yaml:"volume-step"`
-	ShowErrors     bool      `yaml:"show-errors"`
-	ShowLyrics     bool      `yaml:"show-lyrics"`
-	CacheTracks    CacheType `yaml:"cache-tracks"`
-	CacheDir       string    `yaml:"cache-dir"`
-	Search         *Search   `yaml:"search"`
-	Controls       *Controls `yaml:"controls"`
+	Token          string            `yaml:"token"`
+	BufferSize     float64           `yaml:"buffer-size-ms"`
+	StreamMemory   float64           `yaml:"stream-memory-mb"`
+	CrossfadeMs    float64           `yaml:"crossfade-ms"`
+	RewindDuration float64           `yaml:"rewind-duration-s"`
+	Volume         float64           `yaml:"volume"`
+	VolumeStep     float64           `yaml:"volume-step"`
+	ShowErrors     bool              `yaml:"show-errors"`
+	ShowLyrics     bool              `yaml:"show-lyrics"`
+	CacheTracks    CacheType         `yaml:"cache-tracks"`
+	Repeat         RepeatType        `yaml:"repeat"`
+	Shuffle        bool              `yaml:"shuffle"`
+	Normalization  NormalizationType `yaml:"normalization"`
+	CacheDir       string            `yaml:"cache-dir"`
+	CacheMaxSize   float64           `yaml:"cache-max-size"`
+	CacheMaxAge    float64           `yaml:"cache-max-age"`
+	Quality        *Quality          `yaml:"quality"`
+	Search         *Search           `yaml:"search"`
+	MyWave         *MyWave           `yaml:"my-wave"`
+	Controls       *Controls         `yaml:"controls"`
 }
 
 var defaultConfig = Config{
 	BufferSize:     80,
+	StreamMemory:   64,
+	CrossfadeMs:    0,
 	RewindDuration: 5,
 	Volume:         0.5,
 	VolumeStep:     0.05,
 	ShowLyrics:     false,
 	CacheTracks:    CACHE_LIKED_ONLY,
+	Normalization:  NORMALIZATION_OFF,
 	CacheDir:       "",
+	CacheMaxSize:   0,
+	CacheMaxAge:    0,
 	ShowErrors:     false,
+	Quality: &Quality{
+		Level:       QUALITY_HIGH,
+		Codec:       "",
+		AutoMetered: true,
+	},
 	Search: &Search{
 		Artists:   true,
 		Albums:    false,
 		Playlists: false,
 	},
+	MyWave: &MyWave{
+		Mood:      "all",
+		Diversity: "default",
+		Language:  "any",
+	},
 	Controls: &Controls{
 		Quit:                     NewKey("ctrl+q,ctrl+c"),
 		Apply:                    NewKey("enter"),
@@ -111,15 +272,26 @@ var defaultConfig = Config{
 		CursorUp:                 NewKey("up"),
 		CursorDown:               NewKey("down"),
 		ShowAllKeys:              NewKey("?"),
+		Queue:                    NewKey("ctrl+p"),
 		PlaylistsUp:              NewKey("ctrl+up"),
 		PlaylistsDown:            NewKey("ctrl+down"),
 		PlaylistsRename:          NewKey("ctrl+r"),
+		PlaylistsChange:          NewKey("ctrl+o"),
+		PlaylistsOffline:         NewKey("ctrl+d"),
 		TracksLike:               NewKey("l"),
+		TracksLikeAlbum:          NewKey("ctrl+l"),
 		TracksAddToPlaylist:      NewKey("a"),
 		TracksRemoveFromPlaylist: NewKey("ctrl+a"),
 		TracksSearch:             NewKey("ctrl+f"),
 		TracksShuffle:            NewKey("ctrl+x"),
 		TracksShare:              NewKey("ctrl+s"),
+		TracksArtist:             NewKey("ctrl+e"),
+		TracksAlbum:              NewKey("ctrl+b"),
+		TracksPlayNext:           NewKey("n"),
+		TracksEnqueue:            NewKey("q"),
+		QueueMoveUp:              NewKey("shift+up"),
+		QueueMoveDown:            NewKey("shift+down"),
+		QueueRemove:              NewKey("delete,backspace"),
 		PlayerPause:              NewKey("space"),
 		PlayerNext:               NewKey("right"),
 		PlayerPrevious:           NewKey("left"),
@@ -130,6 +302,8 @@ var defaultConfig = Config{
 		PlayerCache:              NewKey("S"),
 		PlayerVolUp:              NewKey("+,="),
 		PlayerVolDown:            NewKey("-"),
+		PlayerRepeat:             NewKey("r"),
+		PlayerStopAfter:          NewKey("s"),
 	},
 }
 
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestQualityTypeYAML(t *testing.T) {
+	tests := []struct {
+		value string
+		want  QualityType
+		saved string
+	}{
+		{"low", QUALITY_LOW, "low"},
+		{"normal", QUALITY_NORMAL, "normal"},
+		{"high", QUALITY_HIGH, "high"},
+		{"lossless", QUALITY_LOSSLESS, "lossless"},
+		{"unknown", QUALITY_HIGH, "high"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var quality Quality
+			if err := yaml.Unmarshal([]byte("level: "+tt.value), &quality); err != nil {
+				t.Fatal(err)
+			}
+			if quality.Level != tt.want {
+				t.Errorf("level '%s' is loaded as %d, want %d", tt.value, quality.Level, tt.want)
+			}
+
+			saved, err := yaml.Marshal(quality.Level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(saved) != tt.saved+"\n" {
+				t.Errorf("level '%s' is saved as '%s', want '%s'", tt.value, saved, tt.saved)
+			}
+		})
+	}
+}
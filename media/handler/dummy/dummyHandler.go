@@ -48,3 +48,6 @@ func (*DummyHandler) OnPlayPause() {
 
 func (*DummyHandler) OnSeek(position time.Duration) {
 }
+
+func (*DummyHandler) OnOptions() {
+}
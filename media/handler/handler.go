@@ -23,9 +23,11 @@ const (
 	MSG_GET_METADATA
 	MSG_GET_VOLUME
 	MSG_GET_POSITION
+	MSG_GET_LOOP
 
 	MSG_SET_SHUFFLE
 	MSG_SET_VOLUME
+	MSG_SET_LOOP
 )
 
 type Message struct {
@@ -53,6 +55,14 @@ const (
 	STATE_PLAYING
 )
 
+type LoopStatus int
+
+const (
+	LOOP_NONE LoopStatus = iota
+	LOOP_TRACK
+	LOOP_PLAYLIST
+)
+
 type MediaHandler interface {
 	Enable() error
 	Disable() error
@@ -64,4 +74,6 @@ type MediaHandler interface {
 	OnPlayback()
 	OnPlayPause()
 	OnSeek(position time.Duration)
+	// Called when the playback options like loop status are changed
+	OnOptions()
 }
@@ -74,3 +74,7 @@ func (mh *MprisHandler) OnPlayPause() {
 func (mh *MprisHandler) OnSeek(position time.Duration) {
 	mh.evHandler.Player.OnSeek(types.Microseconds(position.Microseconds()))
 }
+
+func (mh *MprisHandler) OnOptions() {
+	mh.evHandler.Player.OnOptions()
+}
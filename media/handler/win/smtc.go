@@ -76,6 +76,18 @@ func (wh *WinHandler) initSmtc() error {
 		return err
 	}
 
+	wh.repeatChangedEvent = makeEventHandler(wh.onRepeatChanged, media.SignatureSystemMediaTransportControls, media.SignatureAutoRepeatModeChangeRequestedEventArgs)
+	wh.repeatChangedToken, err = wh.smtc.AddAutoRepeatModeChangeRequested(wh.repeatChangedEvent)
+	if err != nil {
+		return err
+	}
+
+	wh.shuffleChangedEvent = makeEventHandler(wh.onShuffleChanged, media.SignatureSystemMediaTransportControls, media.SignatureShuffleEnabledChangeRequestedEventArgs)
+	wh.shuffleChangedToken, err = wh.smtc.AddShuffleEnabledChangeRequested(wh.shuffleChangedEvent)
+	if err != nil {
+		return err
+	}
+
 	wh.positionChangedEvent = makeEventHandler(wh.onPositionChanged, media.SignatureSystemMediaTransportControls, media.SignaturePlaybackPositionChangeRequestedEventArgs)
 	wh.positionChangedToken, err = wh.smtc.AddPlaybackPositionChangeRequested(wh.positionChangedEvent)
 	if err != nil {
@@ -88,6 +100,10 @@ func (wh *WinHandler) initSmtc() error {
 func (wh *WinHandler) smtcDispose() error {
 	wh.smtc.RemoveButtonPressed(wh.positionChangedToken)
 	wh.smtc.RemoveButtonPressed(wh.buttonPressedToken)
+	wh.smtc.RemoveAutoRepeatModeChangeRequested(wh.repeatChangedToken)
+	wh.smtc.RemoveShuffleEnabledChangeRequested(wh.shuffleChangedToken)
+	wh.repeatChangedEvent.Release()
+	wh.shuffleChangedEvent.Release()
 	wh.positionChangedEvent.Release()
 	wh.buttonPressedEvent.Release()
 	return wh.mediaPlayer.Close()
@@ -106,6 +122,17 @@ func (wh *WinHandler) setState(state PlayState) error {
 	}
 }
 
+func (wh *WinHandler) setRepeatMode(loop handler.LoopStatus) error {
+	switch loop {
+	case handler.LOOP_TRACK:
+		return wh.smtc.SetAutoRepeatMode(media.MediaPlaybackAutoRepeatModeTrack)
+	case handler.LOOP_PLAYLIST:
+		return wh.smtc.SetAutoRepeatMode(media.MediaPlaybackAutoRepeatModeList)
+	default:
+		return wh.smtc.SetAutoRepeatMode(media.MediaPlaybackAutoRepeatModeNone)
+	}
+}
+
 func (wh *WinHandler) setMetadata(path string) error {
 	updater, err := wh.smtc.GetDisplayUpdater()
 	if err != nil {
@@ -242,3 +269,49 @@ func (wh *WinHandler) onPositionChanged(instance *foundation.TypedEventHandler,
 
 	wh.msgMux.Unlock()
 }
+
+func (wh *WinHandler) onRepeatChanged(instance *foundation.TypedEventHandler, sender unsafe.Pointer, args unsafe.Pointer) {
+	repeatArgs := (*media.AutoRepeatModeChangeRequestedEventArgs)(args)
+
+	mode, err := repeatArgs.GetRequestedAutoRepeatMode()
+	if err != nil {
+		return
+	}
+
+	var loop handler.LoopStatus
+	switch mode {
+	case media.MediaPlaybackAutoRepeatModeTrack:
+		loop = handler.LOOP_TRACK
+	case media.MediaPlaybackAutoRepeatModeList:
+		loop = handler.LOOP_PLAYLIST
+	default:
+		loop = handler.LOOP_NONE
+	}
+
+	wh.msgMux.Lock()
+
+	wh.msgChan <- handler.Message{
+		Type: handler.MSG_SET_LOOP,
+		Arg:  loop,
+	}
+
+	wh.msgMux.Unlock()
+}
+
+func (wh *WinHandler) onShuffleChanged(instance *foundation.TypedEventHandler, sender unsafe.Pointer, args unsafe.Pointer) {
+	shuffleArgs := (*media.ShuffleEnabledChangeRequestedEventArgs)(args)
+
+	shuffle, err := shuffleArgs.GetRequestedShuffleEnabled()
+	if err != nil {
+		return
+	}
+
+	wh.msgMux.Lock()
+
+	wh.msgChan <- handler.Message{
+		Type: handler.MSG_SET_SHUFFLE,
+		Arg:  shuffle,
+	}
+
+	wh.msgMux.Unlock()
+}
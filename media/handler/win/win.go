@@ -32,6 +32,10 @@ type WinHandler struct {
 	buttonPressedToken   foundation.EventRegistrationToken
 	positionChangedEvent *foundation.TypedEventHandler
 	positionChangedToken foundation.EventRegistrationToken
+	repeatChangedEvent   *foundation.TypedEventHandler
+	repeatChangedToken   foundation.EventRegistrationToken
+	shuffleChangedEvent  *foundation.TypedEventHandler
+	shuffleChangedToken  foundation.EventRegistrationToken
 
 	trackDuration time.Duration
 	playState     PlayState
@@ -113,6 +117,26 @@ func (wh *WinHandler) OnSeek(position time.Duration) {
 	wh.updateTimeLineProperties(wh.trackDuration, position)
 }
 
+func (wh *WinHandler) OnOptions() {
+	wh.msgMux.Lock()
+	wh.msgChan <- handler.Message{
+		Type: handler.MSG_GET_LOOP,
+	}
+	loop, ok := (<-wh.ansChan).(handler.LoopStatus)
+	wh.msgChan <- handler.Message{
+		Type: handler.MSG_GET_SHUFFLE,
+	}
+	shuffle, shuffleOk := (<-wh.ansChan).(bool)
+	wh.msgMux.Unlock()
+
+	if ok {
+		wh.setRepeatMode(loop)
+	}
+	if shuffleOk {
+		wh.smtc.SetShuffleEnabled(shuffle)
+	}
+}
+
 func (wh *WinHandler) updateTimeline() {
 	periodTimer := time.NewTicker(_TIMELINE_POLL_PERIOD_MS * time.Millisecond)
 
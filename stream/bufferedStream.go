@@ -3,7 +3,7 @@ package stream
 import (
 	"errors"
 	"io"
-	"net/http"
+	"os"
 	"sync"
 	"time"
 )
@@ -11,29 +11,102 @@ import (
 const (
 	_BUFFERING_AMOUNT = 32 * 1024
 	_BUFFERING_PERIOD = 100 * time.Millisecond
+	// the reading position farther than this from the source position is requested by a separate range
+	_RANGE_REQUEST_DISTANCE = 256 * 1024
+	// the source is reopened after the network errors this many times in a row with the growing delay
+	_RECONNECT_ATTEMPTS = 5
+	_RECONNECT_DELAY    = time.Second
 )
 
-var errOutOfSize = errors.New("position is out of data size")
+// ErrClosed is returned when the data of the closed stream is requested, e.g. the track was stopped while it's cached
+var ErrClosed = errors.New("stream is closed")
 
+var (
+	errOutOfSize  = errors.New("position is out of data size")
+	errIncomplete = errors.New("stream is not buffered completely")
+	// the source of the unknown size, e.g. the chunked response, can't be buffered by the ranges
+	errUnknownSize = errors.New("stream size is unknown")
+)
+
+// RangeOpener opens the source data from the offset to the end.
+type RangeOpener func(offset int64) (io.ReadCloser, error)
+
+// BufferedStream downloads the source in the background and keeps the downloaded data,
+// so it can be read and seeked without waiting for the source.
+// If the source can be opened by ranges, the reading position that isn't downloaded yet
+// is requested right away and the rest of the data is downloaded later.
 type BufferedStream struct {
-	source      io.ReadCloser
-	bufferTimer *time.Ticker
-	closed      chan bool
-	lastError   error
-	readBuffer  []byte
-	readIndex   int64
-	totalSize   int64
-	buffered    bool
-	done        bool
-	mux         sync.Mutex
+	source io.ReadCloser
+	open   RangeOpener
+	// offset of the next byte received from the source
+	sourcePos int64
+	data      storage
+	segments  segments
+	readIndex int64
+	totalSize int64
+	lastError error
+	buffered  bool
+	done      bool
+	closed    bool
+	// number of the readers waiting for the data to be downloaded
+	waiters int
+	// number of the WriteTo copies of the data, the storage is released after them
+	copies int
+	// number of the failed attempts to resume the source since the last received data
+	reconnects     int
+	reconnectDelay time.Duration
+	onReconnect    func(reconnecting bool)
+	// the reading position is requested, so the buffering pause must be ended
+	requested bool
+
+	// guards all the fields above, the waiting for the data or the buffering pause
+	// is done by the condition that is broadcasted on every state change
+	mux  sync.Mutex
+	cond *sync.Cond
+
+	// amount of the bytes received from the source and the time spent on it
+	sourceBytes int64
+	sourceTime  time.Duration
 }
 
+// NewBufferedStream buffers the source that can be read only sequentially.
 func NewBufferedStream(source io.ReadCloser, totalSize int64) *BufferedStream {
+	return NewRangeStream(source, totalSize, nil)
+}
+
+// NewRangeStream buffers the source starting from its beginning.
+// The opener is used to request the data from the other positions, nil disables it.
+func NewRangeStream(source io.ReadCloser, totalSize int64, open RangeOpener) *BufferedStream {
+	return newRangeStream(source, totalSize, open, _RECONNECT_DELAY)
+}
+
+// NewFileStream reads the complete local file, e.g. the cached track, without copying its data.
+// The file is closed with the stream.
+func NewFileStream(file *os.File, totalSize int64) *BufferedStream {
+	rs := BufferedStream{
+		data:      file,
+		totalSize: totalSize,
+		sourcePos: totalSize,
+		buffered:  true,
+	}
+	rs.cond = sync.NewCond(&rs.mux)
+	rs.segments.add(0, totalSize)
+	return &rs
+}
+
+func newRangeStream(source io.ReadCloser, totalSize int64, open RangeOpener, reconnectDelay time.Duration) *BufferedStream {
 	rs := BufferedStream{
-		source:      source,
-		totalSize:   totalSize,
-		bufferTimer: time.NewTicker(_BUFFERING_PERIOD),
-		closed:      make(chan bool),
+		source:         source,
+		open:           open,
+		data:           newStorage(totalSize),
+		totalSize:      totalSize,
+		reconnectDelay: reconnectDelay,
+	}
+	rs.cond = sync.NewCond(&rs.mux)
+
+	if totalSize < 0 {
+		rs.fail(errUnknownSize)
+		return &rs
 	}
 
 	go rs.bufferFrames(_BUFFERING_AMOUNT)
@@ -50,12 +123,21 @@ func (h *BufferedStream) Close() error {
 	h.mux.Lock()
 	defer h.mux.Unlock()
 
-	h.readBuffer = nil
-	h.stopBuffering()
-
-	if !h.done {
+	if h.source != nil {
 		err = h.source.Close()
-		h.done = true
+		h.source = nil
+	}
+
+	wasClosed := h.closed
+	h.closed = true
+	h.done = true
+	h.cond.Broadcast()
+
+	if !wasClosed {
+		for h.copies > 0 {
+			h.cond.Wait()
+		}
+		h.data.Close()
 	}
 
 	return err
@@ -63,64 +145,46 @@ func (h *BufferedStream) Close() error {
 
 func (h *BufferedStream) Read(dest []byte) (n int, err error) {
 	h.mux.Lock()
+	defer h.mux.Unlock()
 
-	readBufLen := int64(len(h.readBuffer))
-	destLen := int64(len(dest))
-
-	if h.readIndex >= readBufLen {
-		newFrame := make([]byte, (h.readIndex-readBufLen)+destLen)
-		n, err = io.ReadFull(h.source, newFrame)
-		h.readBuffer = append(h.readBuffer, newFrame[:n]...)
-		if h.readIndex < int64(len(h.readBuffer)) {
-			copy(dest, h.readBuffer[h.readIndex:])
-		} else {
-			err = io.EOF
-		}
-		h.readIndex += int64(n) - (h.readIndex - readBufLen)
-	} else {
-		var unbufferedLen int
+	if h.totalSize < 0 {
+		return 0, h.lastError
+	}
 
-		endIndex := h.readIndex + destLen
-		if endIndex > readBufLen {
-			endIndex = readBufLen
+	for {
+		if h.closed || h.readIndex >= h.totalSize {
+			h.done = true
+			return 0, io.EOF
 		}
-		bufferedPart := h.readBuffer[h.readIndex:endIndex]
 
-		if destLen-int64(len(bufferedPart)) > 0 {
-			unbufferedPart := make([]byte, destLen-int64(len(bufferedPart)))
-			unbufferedLen, err = h.source.Read(unbufferedPart)
-			unbufferedPart = unbufferedPart[:unbufferedLen]
-			copy(dest, append(bufferedPart, unbufferedPart...))
-			n = len(bufferedPart) + unbufferedLen
-			h.readBuffer = append(h.readBuffer, unbufferedPart...)
-		} else {
-			copy(dest, bufferedPart)
-			n = len(bufferedPart)
+		end := h.segments.contiguousEnd(h.readIndex)
+		if end > h.readIndex {
+			n, err = h.data.ReadAt(dest[:min(int64(len(dest)), end-h.readIndex)], h.readIndex)
+			h.readIndex += int64(n)
+			if err != nil {
+				return
+			}
+			if h.readIndex >= h.totalSize {
+				h.done = true
+				err = io.EOF
+			}
+			return
 		}
 
-		h.readIndex += int64(n)
-		if h.readIndex >= h.totalSize {
-			err = io.EOF
+		if h.lastError != nil {
+			return 0, h.lastError
 		}
-	}
 
-	if err != nil {
-		if err == io.EOF && !h.done {
-			h.source.Close()
-			h.stopBuffering()
-			h.done = true
-		} else if err == http.ErrBodyReadAfterClose {
-			err = io.EOF
-		}
+		h.request(h.readIndex)
+		h.waiters++
+		h.cond.Wait()
+		h.waiters--
 	}
-
-	h.lastError = err
-	h.mux.Unlock()
-	return
 }
 
 func (h *BufferedStream) Seek(offset int64, whence int) (pos int64, err error) {
 	h.mux.Lock()
+	defer h.mux.Unlock()
 
 	switch whence {
 	case io.SeekStart:
@@ -132,25 +196,61 @@ func (h *BufferedStream) Seek(offset int64, whence int) (pos int64, err error) {
 	}
 
 	if pos < 0 || pos > h.totalSize {
-		pos = h.readIndex
-		err = errOutOfSize
-	} else {
-		if pos == h.totalSize {
-			h.done = true
-		} else {
-			h.done = false
-		}
-		h.readIndex = pos
+		return h.readIndex, errOutOfSize
+	}
+
+	h.done = pos == h.totalSize
+	h.readIndex = pos
+
+	// start downloading the new position before it's read
+	if !h.done && h.segments.contiguousEnd(pos) == pos {
+		h.request(pos)
 	}
 
-	h.mux.Unlock()
 	return
 }
 
+// ReadAt reads the already buffered data at the offset without moving the read position.
+// It doesn't wait for the data to be downloaded and returns io.EOF if it's not buffered yet.
+func (h *BufferedStream) ReadAt(dest []byte, offset int64) (n int, err error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if offset < 0 {
+		return 0, errOutOfSize
+	}
+	if end := h.segments.contiguousEnd(offset); end > offset && !h.closed {
+		n, err = h.data.ReadAt(dest[:min(int64(len(dest)), end-offset)], offset)
+		if err != nil {
+			return
+		}
+	}
+	if n < len(dest) {
+		err = io.EOF
+	}
+	return
+}
+
+// IsBufferedAhead reports whether the size bytes after the read position, or all the rest of the data,
+// are downloaded, so they can be read without waiting for the source.
+func (h *BufferedStream) IsBufferedAhead(size int64) bool {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.closed {
+		return false
+	}
+	end := h.segments.contiguousEnd(h.readIndex)
+	return end-h.readIndex >= size || end >= h.totalSize
+}
+
 func (h *BufferedStream) IsDone() bool {
 	if h == nil {
 		return false
 	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
 	return h.done
 }
 
@@ -158,6 +258,9 @@ func (h *BufferedStream) IsBuffered() bool {
 	if h == nil {
 		return false
 	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
 	return h.buffered
 }
 
@@ -165,6 +268,9 @@ func (h *BufferedStream) Progress() float64 {
 	if h == nil {
 		return 0
 	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
 	return float64(h.readIndex) / float64(h.totalSize)
 }
 
@@ -172,32 +278,83 @@ func (h *BufferedStream) BufferingProgress() float64 {
 	if h == nil {
 		return 0
 	}
-	return float64(len(h.readBuffer)) / float64(h.totalSize)
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return float64(h.segments.total()) / float64(h.totalSize)
 }
 
+// Throughput returns the speed of the source reading in bytes per second, 0 if it's not measured yet.
+func (h *BufferedStream) Throughput() float64 {
+	if h == nil {
+		return 0
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.sourceTime <= 0 {
+		return 0
+	}
+	return float64(h.sourceBytes) / h.sourceTime.Seconds()
+}
+
+// BufferAll waits until the whole data is downloaded without the buffering pauses.
 func (h *BufferedStream) BufferAll() {
 	h.mux.Lock()
 	defer h.mux.Unlock()
 
-	if h.buffered {
-		return
+	h.waiters++
+	h.cond.Broadcast()
+	for !h.buffered && !h.closed && h.lastError == nil {
+		h.cond.Wait()
+	}
+	h.waiters--
+}
+
+// WriteTo writes the whole data once it's downloaded. The downloaded data isn't changed anymore,
+// so it's copied without the lock and the slow writer doesn't block the reading.
+func (h *BufferedStream) WriteTo(dest io.Writer) (int64, error) {
+	h.mux.Lock()
+	if h.closed {
+		h.mux.Unlock()
+		return 0, ErrClosed
 	}
+	if !h.buffered {
+		h.mux.Unlock()
+		return 0, errIncomplete
+	}
+	h.copies++
+	data := h.data
+	h.mux.Unlock()
+
+	defer func() {
+		h.mux.Lock()
+		h.copies--
+		h.cond.Broadcast()
+		h.mux.Unlock()
+	}()
 
-	h.stopBuffering()
+	return io.Copy(dest, io.NewSectionReader(data, 0, h.totalSize))
+}
 
-	newFrame, err := io.ReadAll(h.source)
-	if err != nil {
-		h.lastError = err
-		return
+// IsReconnecting reports whether the source is being resumed after the network error.
+func (h *BufferedStream) IsReconnecting() bool {
+	if h == nil {
+		return false
 	}
 
-	h.readBuffer = append(h.readBuffer, newFrame...)
-	h.source.Close()
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return h.reconnects > 0
 }
 
-func (h *BufferedStream) WriteTo(dest io.Writer) (int64, error) {
-	n, err := dest.Write(h.readBuffer)
-	return int64(n), err
+// OnReconnect sets the function that is called when the stream starts reconnecting to the source
+// and when it receives the data again. It's called from the buffering goroutine.
+func (h *BufferedStream) OnReconnect(handler func(reconnecting bool)) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.onReconnect = handler
 }
 
 func (h *BufferedStream) Error() error {
@@ -206,44 +363,227 @@ func (h *BufferedStream) Error() error {
 	return h.lastError
 }
 
-func (h *BufferedStream) stopBuffering() {
-	h.buffered = true
-	if h.closed != nil {
-		h.bufferTimer.Stop()
-		close(h.closed)
-		h.closed = nil
+func (h *BufferedStream) measure(n int, start time.Time) {
+	h.sourceBytes += int64(n)
+	h.sourceTime += time.Since(start)
+}
+
+// request makes the source continue from the position if it's too far from the current one.
+func (h *BufferedStream) request(pos int64) {
+	if h.open != nil && (pos < h.sourcePos || pos > h.sourcePos+_RANGE_REQUEST_DISTANCE) {
+		if h.source != nil {
+			h.source.Close()
+			h.source = nil
+		}
+		h.sourcePos = pos
+	}
+	h.requested = true
+	h.cond.Broadcast()
+}
+
+// pause waits for the period or until the stream is closed. The interruptible pause also ends
+// when the data is requested by a reader. Must be called with the lock, reports false if the stream is closed.
+func (h *BufferedStream) pause(period time.Duration, interruptible bool) bool {
+	deadline := time.Now().Add(period)
+	timer := time.AfterFunc(period, func() {
+		h.mux.Lock()
+		h.cond.Broadcast()
+		h.mux.Unlock()
+	})
+	defer timer.Stop()
+
+	for !h.closed && time.Now().Before(deadline) {
+		if interruptible && (h.requested || h.waiters > 0) {
+			break
+		}
+		h.cond.Wait()
+	}
+	if interruptible {
+		h.requested = false
+	}
+	return !h.closed
+}
+
+// retry closes the failed source to resume it from the last received byte.
+// Reports false if the source can't be reopened or the attempts are over.
+func (h *BufferedStream) retry() bool {
+	if h.open == nil || h.closed || h.reconnects >= _RECONNECT_ATTEMPTS {
+		return false
+	}
+
+	h.reconnects++
+	if h.source != nil {
+		h.source.Close()
+		h.source = nil
+	}
+	return true
+}
+
+// notifyReconnect calls the reconnect handler if the reconnecting state has changed.
+// Must be called without the lock.
+func (h *BufferedStream) notifyReconnect(wasReconnecting bool) {
+	h.mux.Lock()
+	reconnecting := h.reconnects > 0
+	handler := h.onReconnect
+	h.mux.Unlock()
+
+	if handler != nil && reconnecting != wasReconnecting {
+		handler(reconnecting)
+	}
+}
+
+// fail stops the buffering because of the source error.
+func (h *BufferedStream) fail(err error) {
+	h.lastError = err
+	h.reconnects = 0
+	if h.source != nil {
+		h.source.Close()
+		h.source = nil
+	}
+	h.cond.Broadcast()
+}
+
+// nextRange returns the source and the range to download next.
+// The source is reopened from the first gap when it reaches the downloaded data.
+func (h *BufferedStream) nextRange() (source io.ReadCloser, start, end int64, ok bool) {
+	if h.closed || h.lastError != nil {
+		return nil, 0, 0, false
+	}
+
+	if h.segments.covers(h.totalSize) {
+		h.buffered = true
+		if h.source != nil {
+			h.source.Close()
+			h.source = nil
+		}
+		h.cond.Broadcast()
+		return nil, 0, 0, false
+	}
+
+	if h.source != nil && (h.sourcePos >= h.totalSize || h.segments.contiguousEnd(h.sourcePos) > h.sourcePos) {
+		if h.open == nil {
+			// the sequential source can't skip the downloaded data
+			h.sourcePos = h.segments.contiguousEnd(h.sourcePos)
+		} else {
+			h.source.Close()
+			h.source = nil
+		}
+	}
+	if h.source == nil {
+		h.sourcePos = h.segments.firstGap(h.sourcePos, h.totalSize)
 	}
+
+	start = h.sourcePos
+	end = min(start+_BUFFERING_AMOUNT, h.segments.nextStart(start, h.totalSize))
+	return h.source, start, end, true
 }
 
 func (h *BufferedStream) bufferFrames(size int64) {
+	buf := make([]byte, size)
+
 	for {
 		h.mux.Lock()
 
-		if h.buffered || h.totalSize <= int64(len(h.readBuffer)) {
-			h.stopBuffering()
+		source, start, end, ok := h.nextRange()
+		if !ok {
 			h.mux.Unlock()
 			return
 		}
 
-		buf := make([]byte, size)
-		n, err := io.ReadFull(h.source, buf)
-		if err == nil || err == io.EOF {
-			h.readBuffer = append(h.readBuffer, buf[:n]...)
+		reconnecting := h.reconnects > 0
+
+		var err error
+		if source == nil {
+			if h.open == nil {
+				h.fail(errIncomplete)
+				h.mux.Unlock()
+				return
+			}
+
+			if delay := time.Duration(h.reconnects) * h.reconnectDelay; delay > 0 && !h.pause(delay, false) {
+				h.mux.Unlock()
+				return
+			}
+			h.mux.Unlock()
+
+			source, err = h.open(start)
+
+			h.mux.Lock()
+			if err != nil {
+				if h.closed {
+					h.mux.Unlock()
+					return
+				}
+				if h.sourcePos == start && !h.retry() {
+					h.fail(err)
+					h.mux.Unlock()
+					return
+				}
+				h.mux.Unlock()
+				h.notifyReconnect(reconnecting)
+				continue
+			}
+			if h.closed || h.source != nil || h.sourcePos != start {
+				// the stream is closed or another position was requested while opening
+				source.Close()
+				h.mux.Unlock()
+				continue
+			}
+			h.source = source
+			h.mux.Unlock()
+		} else {
+			h.mux.Unlock()
+		}
+
+		// the source is read without the lock, so the buffered data is available meanwhile
+		readStart := time.Now()
+		n, err := io.ReadFull(source, buf[:end-start])
+
+		h.mux.Lock()
+
+		if h.source != source || h.closed {
+			// the source was replaced by the range request
+			h.mux.Unlock()
+			continue
+		}
+
+		h.measure(n, readStart)
+		if _, writeErr := h.data.WriteAt(buf[:n], start); writeErr != nil {
+			h.fail(writeErr)
+			h.mux.Unlock()
+			return
+		}
+		h.segments.add(start, start+int64(n))
+		h.sourcePos = start + int64(n)
+		if n > 0 {
+			h.reconnects = 0
+		}
+		h.cond.Broadcast()
+
+		if err != nil {
+			// the source ended before the expected size or the connection is lost
 			if err == io.EOF {
-				h.stopBuffering()
+				err = io.ErrUnexpectedEOF
+			}
+			if !h.retry() {
+				h.fail(err)
 				h.mux.Unlock()
+				h.notifyReconnect(reconnecting)
 				return
 			}
+			h.mux.Unlock()
+			h.notifyReconnect(reconnecting)
+			continue
 		}
 
-		h.lastError = err
 		h.mux.Unlock()
+		h.notifyReconnect(reconnecting)
 
-		// await next Read call or timer expiration
-		select {
-		case <-h.bufferTimer.C:
-			continue
-		case <-h.closed:
+		// the buffering is paused until the next reader request unless someone waits for the data
+		h.mux.Lock()
+		ok = h.waiters > 0 || h.pause(_BUFFERING_PERIOD, true)
+		h.mux.Unlock()
+		if !ok {
 			return
 		}
 	}
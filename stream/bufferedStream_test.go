@@ -0,0 +1,443 @@
+package stream
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testContentSize = 1024 * 1024
+	testChunkSize   = 16 * 1024
+	testTimeout     = 5 * time.Second
+)
+
+// testServer serves the content by ranges, the full response can be throttled to emulate a slow download
+// or dropped after some bytes to emulate the lost connection
+type testServer struct {
+	*httptest.Server
+	content []byte
+	slow    bool
+	dropAt  int
+	mux     sync.Mutex
+	ranges  []string
+}
+
+func newTestServer(t *testing.T, slow bool, dropAt int) *testServer {
+	content := make([]byte, testContentSize)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	ts := &testServer{content: content, slow: slow, dropAt: dropAt}
+	ts.Server = httptest.NewServer(http.HandlerFunc(ts.serve))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *testServer) serve(w http.ResponseWriter, r *http.Request) {
+	rangeHeader := r.Header.Get("Range")
+	if len(rangeHeader) > 0 {
+		ts.mux.Lock()
+		ts.ranges = append(ts.ranges, rangeHeader)
+		ts.mux.Unlock()
+	}
+
+	if len(rangeHeader) > 0 || (!ts.slow && ts.dropAt == 0) {
+		http.ServeContent(w, r, "track.mp3", time.Time{}, bytes.NewReader(ts.content))
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(ts.content)))
+	if ts.dropAt > 0 {
+		// the connection is closed because the declared length isn't reached
+		w.Write(ts.content[:ts.dropAt])
+		return
+	}
+
+	for offset := 0; offset < len(ts.content); offset += testChunkSize {
+		w.Write(ts.content[offset : offset+testChunkSize])
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (ts *testServer) rangeRequests() []string {
+	ts.mux.Lock()
+	defer ts.mux.Unlock()
+	return append([]string(nil), ts.ranges...)
+}
+
+func (ts *testServer) open(offset int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (ts *testServer) newStream(t *testing.T, ranged bool) *BufferedStream {
+	body, err := ts.open(0)
+	if err != nil {
+		t.Fatalf("failed to open the source: %s", err)
+	}
+
+	var s *BufferedStream
+	if ranged {
+		s = NewRangeStream(body, int64(len(ts.content)), ts.open)
+	} else {
+		s = NewBufferedStream(body, int64(len(ts.content)))
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// readWithin reads the data from the stream position failing the test if it takes too long.
+func readWithin(t *testing.T, s *BufferedStream, size int, timeout time.Duration) []byte {
+	t.Helper()
+
+	type result struct {
+		data []byte
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		data := make([]byte, size)
+		_, err := io.ReadFull(s, data)
+		done <- result{data, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatalf("failed to read the stream: %s", res.err)
+		}
+		return res.data
+	case <-time.After(timeout):
+		t.Fatalf("reading %d bytes took more than %s", size, timeout)
+		return nil
+	}
+}
+
+func TestBufferedStreamReadsWholeSource(t *testing.T) {
+	ts := newTestServer(t, false, 0)
+	s := ts.newStream(t, true)
+
+	data := readWithin(t, s, testContentSize, testTimeout)
+	if !bytes.Equal(data, ts.content) {
+		t.Fatal("the read data differs from the source")
+	}
+	if !s.IsDone() {
+		t.Error("the stream isn't done after reading to the end")
+	}
+	if n, err := s.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("read after the end returned %d, %v; want 0, EOF", n, err)
+	}
+	if ranges := ts.rangeRequests(); len(ranges) > 0 {
+		t.Errorf("unexpected range requests %v for the sequential reading", ranges)
+	}
+}
+
+func TestBufferedStreamSeeksBeyondBuffered(t *testing.T) {
+	ts := newTestServer(t, true, 0)
+	s := ts.newStream(t, true)
+
+	// the slow full download would take more than a second to reach the tail
+	const tailSize = 4096
+	offset := int64(testContentSize - tailSize)
+	if _, err := s.Seek(offset, io.SeekStart); err != nil {
+		t.Fatalf("failed to seek: %s", err)
+	}
+
+	data := readWithin(t, s, tailSize, 500*time.Millisecond)
+	if !bytes.Equal(data, ts.content[offset:]) {
+		t.Fatal("the tail data differs from the source")
+	}
+
+	want := fmt.Sprintf("bytes=%d-", offset)
+	ranges := ts.rangeRequests()
+	if len(ranges) == 0 || ranges[0] != want {
+		t.Errorf("range requests are %v, want the first one %q", ranges, want)
+	}
+}
+
+func TestBufferedStreamFillsGaps(t *testing.T) {
+	ts := newTestServer(t, true, 0)
+	s := ts.newStream(t, true)
+
+	for _, offset := range []int64{testContentSize / 2, testContentSize / 4, testContentSize - 100} {
+		if _, err := s.Seek(offset, io.SeekStart); err != nil {
+			t.Fatalf("failed to seek to %d: %s", offset, err)
+		}
+		size := min(testChunkSize, testContentSize-int(offset))
+		data := readWithin(t, s, size, testTimeout)
+		if !bytes.Equal(data, ts.content[offset:offset+int64(size)]) {
+			t.Fatalf("the data at %d differs from the source", offset)
+		}
+	}
+
+	done := make(chan bool)
+	go func() {
+		s.BufferAll()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatal("buffering of the whole stream took too long")
+	}
+
+	if !s.IsBuffered() || s.Error() != nil {
+		t.Fatalf("the stream isn't buffered: %v", s.Error())
+	}
+	if progress := s.BufferingProgress(); progress != 1 {
+		t.Errorf("buffering progress is %f, want 1", progress)
+	}
+
+	var written bytes.Buffer
+	if _, err := s.WriteTo(&written); err != nil {
+		t.Fatalf("failed to write the buffered data: %s", err)
+	}
+	if !bytes.Equal(written.Bytes(), ts.content) {
+		t.Fatal("the buffered data differs from the source")
+	}
+}
+
+func TestBufferedStreamSequentialSourceSeeks(t *testing.T) {
+	ts := newTestServer(t, false, 0)
+	s := ts.newStream(t, false)
+
+	offset := int64(testContentSize - testChunkSize)
+	if _, err := s.Seek(offset, io.SeekStart); err != nil {
+		t.Fatalf("failed to seek: %s", err)
+	}
+
+	data := readWithin(t, s, testChunkSize, testTimeout)
+	if !bytes.Equal(data, ts.content[offset:]) {
+		t.Fatal("the tail data differs from the source")
+	}
+	if ranges := ts.rangeRequests(); len(ranges) > 0 {
+		t.Errorf("unexpected range requests %v for the sequential source", ranges)
+	}
+}
+
+func TestBufferedStreamReadAtBufferedOnly(t *testing.T) {
+	ts := newTestServer(t, true, 0)
+	s := ts.newStream(t, true)
+
+	head := readWithin(t, s, testChunkSize, testTimeout)
+	if !bytes.Equal(head, ts.content[:testChunkSize]) {
+		t.Fatal("the head data differs from the source")
+	}
+
+	data := make([]byte, testChunkSize)
+	n, err := s.ReadAt(data, 0)
+	if n < testChunkSize || err != nil {
+		t.Fatalf("ReadAt of the buffered data returned %d, %v", n, err)
+	}
+	if !bytes.Equal(data, head) {
+		t.Fatal("ReadAt data differs from the read one")
+	}
+
+	n, err = s.ReadAt(data, testContentSize-testChunkSize)
+	if n != 0 || err != io.EOF {
+		t.Errorf("ReadAt of the data that isn't buffered returned %d, %v; want 0, EOF", n, err)
+	}
+}
+
+func TestBufferedStreamBufferedAhead(t *testing.T) {
+	ts := newTestServer(t, true, 0)
+	s := ts.newStream(t, true)
+
+	readWithin(t, s, testChunkSize, testTimeout)
+	if !s.IsBufferedAhead(0) {
+		t.Error("nothing ahead is reported as not buffered")
+	}
+	if s.IsBufferedAhead(testContentSize) {
+		t.Error("the slow source is reported as buffered ahead to the end")
+	}
+
+	s.Seek(0, io.SeekStart)
+	if !s.IsBufferedAhead(testChunkSize) {
+		t.Error("the read data isn't reported as buffered ahead")
+	}
+
+	s.Close()
+	if s.IsBufferedAhead(0) {
+		t.Error("the closed stream is reported as buffered ahead")
+	}
+}
+
+func TestBufferedStreamResumesAfterDrop(t *testing.T) {
+	const dropAt = testContentSize / 3
+	ts := newTestServer(t, false, dropAt)
+	s := ts.newStream(t, true)
+
+	reconnects := make(chan bool, 2)
+	s.OnReconnect(func(reconnecting bool) {
+		reconnects <- reconnecting
+	})
+
+	data := readWithin(t, s, testContentSize, testTimeout)
+	if !bytes.Equal(data, ts.content) {
+		t.Fatal("the read data differs from the source")
+	}
+	if s.Error() != nil || s.IsReconnecting() {
+		t.Errorf("the stream isn't resumed: %v", s.Error())
+	}
+
+	want := fmt.Sprintf("bytes=%d-", dropAt)
+	ranges := ts.rangeRequests()
+	if len(ranges) != 1 || ranges[0] != want {
+		t.Errorf("range requests are %v, want [%s]", ranges, want)
+	}
+
+	for _, want := range []bool{true, false} {
+		select {
+		case got := <-reconnects:
+			if got != want {
+				t.Errorf("reconnect handler got %t, want %t", got, want)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("reconnect handler wasn't called with %t", want)
+		}
+	}
+}
+
+func TestBufferedStreamSequentialSourceFails(t *testing.T) {
+	ts := newTestServer(t, false, testContentSize/3)
+	s := ts.newStream(t, false)
+
+	_, err := io.ReadAll(s)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("reading the dropped sequential source returned %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if s.Error() == nil {
+		t.Error("the stream error isn't recorded")
+	}
+}
+
+func TestBufferedStreamSpillsToDisk(t *testing.T) {
+	SetMemoryLimit(testContentSize / 2)
+	t.Cleanup(func() { SetMemoryLimit(0) })
+
+	ts := newTestServer(t, false, 0)
+	s := ts.newStream(t, true)
+
+	fs, ok := s.data.(*fileStorage)
+	if !ok {
+		t.Fatalf("the stream larger than the limit is stored in %T", s.data)
+	}
+
+	offset := int64(testContentSize / 2)
+	if _, err := s.Seek(offset, io.SeekStart); err != nil {
+		t.Fatalf("failed to seek: %s", err)
+	}
+	data := readWithin(t, s, testChunkSize, testTimeout)
+	if !bytes.Equal(data, ts.content[offset:offset+testChunkSize]) {
+		t.Fatal("the data read from the file differs from the source")
+	}
+
+	s.BufferAll()
+	var written bytes.Buffer
+	if _, err := s.WriteTo(&written); err != nil {
+		t.Fatalf("failed to write the buffered data: %s", err)
+	}
+	if !bytes.Equal(written.Bytes(), ts.content) {
+		t.Fatal("the buffered data differs from the source")
+	}
+
+	s.Close()
+	if _, err := os.Stat(fs.Name()); !os.IsNotExist(err) {
+		t.Errorf("the temporary file isn't removed after close: %v", err)
+	}
+}
+
+func TestBufferedStreamUnknownSize(t *testing.T) {
+	source := io.NopCloser(bytes.NewReader(make([]byte, testChunkSize)))
+	s := NewBufferedStream(source, -1)
+	t.Cleanup(func() { s.Close() })
+
+	if n, err := s.Read(make([]byte, testChunkSize)); n != 0 || err != errUnknownSize {
+		t.Errorf("read of the unknown size returned %d, %v; want 0, %v", n, err, errUnknownSize)
+	}
+	if s.Error() != errUnknownSize {
+		t.Errorf("stream error is %v, want %v", s.Error(), errUnknownSize)
+	}
+}
+
+func TestFileStreamReadsInPlace(t *testing.T) {
+	SetMemoryLimit(testChunkSize)
+	t.Cleanup(func() { SetMemoryLimit(0) })
+
+	content := make([]byte, testContentSize)
+	rand.New(rand.NewSource(1)).Read(content)
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewFileStream(file, int64(len(content)))
+	if s.data != file {
+		t.Fatalf("the file is stored in %T", s.data)
+	}
+	if !s.IsBuffered() || s.BufferingProgress() != 1 {
+		t.Error("the file stream isn't reported as buffered")
+	}
+
+	offset := int64(testContentSize / 2)
+	if _, err := s.Seek(offset, io.SeekStart); err != nil {
+		t.Fatalf("failed to seek: %s", err)
+	}
+	data := readWithin(t, s, testChunkSize, testTimeout)
+	if !bytes.Equal(data, content[offset:offset+testChunkSize]) {
+		t.Fatal("the data read from the file differs from it")
+	}
+
+	var written bytes.Buffer
+	if _, err := s.WriteTo(&written); err != nil {
+		t.Fatalf("failed to write the file data: %s", err)
+	}
+	if !bytes.Equal(written.Bytes(), content) {
+		t.Fatal("the written data differs from the file")
+	}
+
+	s.Close()
+	if _, err := file.Stat(); err == nil {
+		t.Error("the file isn't closed with the stream")
+	}
+	if _, err := s.WriteTo(&written); err != ErrClosed {
+		t.Errorf("writing the closed stream returned %v, want %v", err, ErrClosed)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("the file is removed with the stream: %s", err)
+	}
+}
@@ -0,0 +1,466 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+const memoryContentSize = 256 * 1024
+
+var (
+	errSourceFailed = errors.New("source failed")
+	errOpenFailed   = errors.New("open failed")
+)
+
+// memorySource serves the content from the offset. It returns the error when the failure offset is reached
+// or blocks there until it's closed if the error is nil.
+type memorySource struct {
+	content []byte
+	pos     int
+	failAt  int
+	err     error
+	closed  chan bool
+	once    sync.Once
+}
+
+func newMemorySource(content []byte, offset, failAt int, err error) *memorySource {
+	if failAt < 0 {
+		failAt = len(content)
+	}
+	return &memorySource{content: content, pos: offset, failAt: failAt, err: err, closed: make(chan bool)}
+}
+
+func (s *memorySource) Read(dest []byte) (int, error) {
+	if s.pos >= s.failAt {
+		if s.failAt == len(s.content) {
+			return 0, io.EOF
+		}
+		if s.err == nil {
+			<-s.closed
+			return 0, io.ErrClosedPipe
+		}
+		return 0, s.err
+	}
+
+	n := copy(dest, s.content[s.pos:s.failAt])
+	s.pos += n
+	return n, nil
+}
+
+func (s *memorySource) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+func (s *memorySource) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func memoryContent() []byte {
+	content := make([]byte, memoryContentSize)
+	rand.New(rand.NewSource(2)).Read(content)
+	return content
+}
+
+// memoryOpener opens the whole content from the offset or always fails if the error is set.
+func memoryOpener(content []byte, err error) RangeOpener {
+	return func(offset int64) (io.ReadCloser, error) {
+		if err != nil {
+			return nil, err
+		}
+		return newMemorySource(content, int(offset), -1, nil), nil
+	}
+}
+
+func newMemoryStream(t *testing.T, source io.ReadCloser, open RangeOpener) *BufferedStream {
+	s := newRangeStream(source, memoryContentSize, open, time.Millisecond)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// within fails the test if the function doesn't return in time.
+func within(t *testing.T, name string, fn func()) {
+	t.Helper()
+
+	done := make(chan bool)
+	go func() {
+		fn()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatalf("%s took more than %s", name, testTimeout)
+	}
+}
+
+func TestBufferedStreamReadChunks(t *testing.T) {
+	content := memoryContent()
+
+	tests := []struct {
+		name   string
+		chunk  int
+		ranged bool
+	}{
+		{"single bytes", 1, false},
+		{"odd chunks", 1531, true},
+		{"buffering chunks", _BUFFERING_AMOUNT, true},
+		{"larger than buffering", 3 * _BUFFERING_AMOUNT, false},
+		{"whole content", memoryContentSize, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var open RangeOpener
+			if tt.ranged {
+				open = memoryOpener(content, nil)
+			}
+			s := newMemoryStream(t, newMemorySource(content, 0, -1, nil), open)
+
+			var read bytes.Buffer
+			within(t, "reading", func() {
+				buf := make([]byte, tt.chunk)
+				for {
+					n, err := s.Read(buf)
+					read.Write(buf[:n])
+					if err == io.EOF {
+						return
+					}
+					if err != nil {
+						t.Errorf("failed to read: %s", err)
+						return
+					}
+				}
+			})
+
+			if !bytes.Equal(read.Bytes(), content) {
+				t.Fatal("the read data differs from the source")
+			}
+			if !s.IsDone() || s.Progress() != 1 {
+				t.Errorf("the stream is done %t with progress %f after reading to the end", s.IsDone(), s.Progress())
+			}
+			if n, err := s.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+				t.Errorf("read after the end returned %d, %v; want 0, EOF", n, err)
+			}
+		})
+	}
+}
+
+func TestBufferedStreamSeek(t *testing.T) {
+	content := memoryContent()
+
+	tests := []struct {
+		name    string
+		offset  int64
+		whence  int
+		want    int64
+		wantErr bool
+	}{
+		{"start", 0, io.SeekStart, 0, false},
+		{"middle", memoryContentSize / 2, io.SeekStart, memoryContentSize / 2, false},
+		{"current", 100, io.SeekCurrent, 100, false},
+		{"from end", -100, io.SeekEnd, memoryContentSize - 100, false},
+		{"end", 0, io.SeekEnd, memoryContentSize, false},
+		{"before start", -1, io.SeekStart, 0, true},
+		{"after end", 1, io.SeekEnd, 0, true},
+	}
+
+	for _, ranged := range []bool{false, true} {
+		for _, tt := range tests {
+			name := tt.name
+			if ranged {
+				name += " ranged"
+			}
+			t.Run(name, func(t *testing.T) {
+				var open RangeOpener
+				if ranged {
+					open = memoryOpener(content, nil)
+				}
+				s := newMemoryStream(t, newMemorySource(content, 0, -1, nil), open)
+
+				pos, err := s.Seek(tt.offset, tt.whence)
+				if tt.wantErr {
+					if err == nil {
+						t.Fatalf("seek returned %d without an error", pos)
+					}
+					if pos != 0 {
+						t.Errorf("failed seek moved the position to %d", pos)
+					}
+					return
+				}
+				if err != nil || pos != tt.want {
+					t.Fatalf("seek returned %d, %v; want %d", pos, err, tt.want)
+				}
+
+				var rest []byte
+				within(t, "reading after seek", func() {
+					rest, err = io.ReadAll(s)
+				})
+				if err != nil {
+					t.Fatalf("failed to read after seek: %s", err)
+				}
+				if !bytes.Equal(rest, content[pos:]) {
+					t.Errorf("the data after seek to %d differs from the source", pos)
+				}
+				if !s.IsDone() {
+					t.Error("the stream isn't done after reading to the end")
+				}
+			})
+		}
+	}
+}
+
+func TestBufferedStreamSourceErrors(t *testing.T) {
+	content := memoryContent()
+	const failAt = memoryContentSize / 2
+
+	tests := []struct {
+		name    string
+		source  io.ReadCloser
+		open    RangeOpener
+		wantErr error
+	}{
+		{"sequential fails", newMemorySource(content, 0, failAt, errSourceFailed), nil, errSourceFailed},
+		{"sequential ends early", newMemorySource(content[:failAt], 0, -1, nil), nil, io.ErrUnexpectedEOF},
+		{"reopen fails", newMemorySource(content, 0, failAt, errSourceFailed), memoryOpener(content, errOpenFailed), errOpenFailed},
+		{"open fails", nil, memoryOpener(content, errOpenFailed), errOpenFailed},
+		{"resumed", newMemorySource(content, 0, failAt, errSourceFailed), memoryOpener(content, nil), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newMemoryStream(t, tt.source, tt.open)
+
+			var (
+				read []byte
+				err  error
+			)
+			within(t, "reading", func() {
+				read, err = io.ReadAll(s)
+			})
+
+			if err != tt.wantErr {
+				t.Fatalf("reading returned %v, want %v", err, tt.wantErr)
+			}
+			if streamErr := s.Error(); streamErr != tt.wantErr {
+				t.Errorf("stream error is %v, want %v", streamErr, tt.wantErr)
+			}
+			if tt.wantErr == nil && !bytes.Equal(read, content) {
+				t.Error("the resumed data differs from the source")
+			}
+			if tt.wantErr != nil && !bytes.Equal(read, content[:len(read)]) {
+				t.Error("the data read before the error differs from the source")
+			}
+
+			within(t, "buffering", s.BufferAll)
+			if s.IsBuffered() != (tt.wantErr == nil) {
+				t.Errorf("the stream is buffered %t with the error %v", s.IsBuffered(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBufferedStreamCloseWhileBuffering(t *testing.T) {
+	content := memoryContent()
+
+	tests := []struct {
+		name string
+		wait func(s *BufferedStream)
+	}{
+		{"reading", func(s *BufferedStream) {
+			s.Seek(memoryContentSize/2, io.SeekStart)
+			io.ReadAll(s)
+		}},
+		{"buffering all", func(s *BufferedStream) {
+			s.BufferAll()
+		}},
+		{"nobody waits", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the source hangs in the middle until it's closed
+			source := newMemorySource(content, 0, memoryContentSize/4, nil)
+			s := newMemoryStream(t, source, nil)
+
+			var wg sync.WaitGroup
+			if tt.wait != nil {
+				for i := 0; i < 3; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						tt.wait(s)
+					}()
+				}
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			within(t, "closing", func() {
+				if err := s.Close(); err != nil {
+					t.Errorf("failed to close: %s", err)
+				}
+			})
+			within(t, "waking the waiters", wg.Wait)
+
+			if !source.isClosed() {
+				t.Error("the source isn't closed with the stream")
+			}
+			if n, err := s.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+				t.Errorf("read after close returned %d, %v; want 0, EOF", n, err)
+			}
+			if _, err := s.WriteTo(io.Discard); err != ErrClosed {
+				t.Errorf("write of the closed stream returned %v, want %v", err, ErrClosed)
+			}
+			if err := s.Close(); err != nil {
+				t.Errorf("repeated close failed: %s", err)
+			}
+		})
+	}
+}
+
+func TestBufferedStreamConcurrentAccess(t *testing.T) {
+	content := memoryContent()
+	s := newMemoryStream(t, newMemorySource(content, 0, -1, nil), memoryOpener(content, nil))
+
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+
+	// the state is polled the way the player view does it while the stream is read
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 512)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				s.IsDone()
+				s.IsBuffered()
+				s.IsReconnecting()
+				s.Progress()
+				s.BufferingProgress()
+				s.Throughput()
+				s.Error()
+				s.ReadAt(buf, memoryContentSize/3)
+			}
+		}()
+	}
+
+	within(t, "reading with seeks", func() {
+		buf := make([]byte, 4096)
+		for _, offset := range []int64{memoryContentSize / 2, 0, memoryContentSize - 4096, memoryContentSize / 4} {
+			if _, err := s.Seek(offset, io.SeekStart); err != nil {
+				t.Errorf("failed to seek to %d: %s", offset, err)
+				return
+			}
+			if _, err := io.ReadFull(s, buf); err != nil {
+				t.Errorf("failed to read at %d: %s", offset, err)
+				return
+			}
+			if !bytes.Equal(buf, content[offset:offset+4096]) {
+				t.Errorf("the data at %d differs from the source", offset)
+			}
+		}
+		s.BufferAll()
+	})
+
+	close(stop)
+	wg.Wait()
+
+	var written bytes.Buffer
+	if _, err := s.WriteTo(&written); err != nil {
+		t.Fatalf("failed to write the buffered data: %s", err)
+	}
+	if !bytes.Equal(written.Bytes(), content) {
+		t.Fatal("the buffered data differs from the source")
+	}
+}
+
+// blockingWriter blocks the first write until it's released
+type blockingWriter struct {
+	written  bytes.Buffer
+	started  chan bool
+	released chan bool
+	once     sync.Once
+}
+
+func (w *blockingWriter) Write(data []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.started)
+		<-w.released
+	})
+	return w.written.Write(data)
+}
+
+func TestBufferedStreamWriteToDoesntBlockReading(t *testing.T) {
+	content := memoryContent()
+	s := newMemoryStream(t, newMemorySource(content, 0, -1, nil), nil)
+	within(t, "buffering", s.BufferAll)
+
+	w := &blockingWriter{started: make(chan bool), released: make(chan bool)}
+	written := make(chan error, 1)
+	go func() {
+		_, err := s.WriteTo(w)
+		written <- err
+	}()
+	<-w.started
+
+	// the reading goes on while the data is being written
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(offset int64) {
+			defer wg.Done()
+			buf := make([]byte, 4096)
+			if n, err := s.ReadAt(buf, offset); err != nil || !bytes.Equal(buf[:n], content[offset:offset+int64(n)]) {
+				t.Errorf("failed to read at %d while writing: %v", offset, err)
+			}
+		}(int64(i) * memoryContentSize / 8)
+	}
+	within(t, "reading while writing", func() {
+		wg.Wait()
+		buf := make([]byte, 4096)
+		if _, err := io.ReadFull(s, buf); err != nil || !bytes.Equal(buf, content[:4096]) {
+			t.Errorf("failed to read while writing: %v", err)
+		}
+		s.Seek(memoryContentSize/2, io.SeekStart)
+		s.IsDone()
+		s.Progress()
+	})
+
+	// the storage isn't released until the copy is finished
+	closed := make(chan bool)
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("the stream is closed while its data is being written")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(w.released)
+	within(t, "writing", func() {
+		if err := <-written; err != nil {
+			t.Errorf("failed to write the buffered data: %s", err)
+		}
+		<-closed
+	})
+	if !bytes.Equal(w.written.Bytes(), content) {
+		t.Error("the written data differs from the source")
+	}
+}
@@ -0,0 +1,326 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	_MP3_SCAN_CHUNK   = 64 * 1024
+	_MP3_HEADER_SIZE  = 4
+	_ID3_HEADER_SIZE  = 10
+	_XING_TOC_SIZE    = 100
+	_VBRI_HEADER_SIZE = 26
+)
+
+var errNoMP3Frames = errors.New("no mp3 frames found in the stream")
+
+var (
+	mp3Bitrates = [2][16]int{
+		// MPEG-1 Layer III
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		// MPEG-2 and MPEG-2.5 Layer III
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	}
+	mp3SampleRates = map[uint32][3]int{
+		3: {44100, 48000, 32000}, // MPEG-1
+		2: {22050, 24000, 16000}, // MPEG-2
+		0: {11025, 12000, 8000},  // MPEG-2.5
+	}
+)
+
+type mp3Header struct {
+	size       int
+	samples    int
+	sampleRate int
+	sideInfo   int
+}
+
+// parseMP3Header decodes the Layer III frame header at the beginning of the data.
+func parseMP3Header(data []byte) (h mp3Header, ok bool) {
+	if len(data) < _MP3_HEADER_SIZE {
+		return
+	}
+
+	word := binary.BigEndian.Uint32(data)
+	version := (word >> 19) & 0b11
+	layer := (word >> 17) & 0b11
+	bitrateIndex := (word >> 12) & 0b1111
+	sampleRateIndex := (word >> 10) & 0b11
+	padding := int((word >> 9) & 0b1)
+	mono := (word>>6)&0b11 == 0b11
+
+	sampleRates, versionOk := mp3SampleRates[version]
+	if word&0xffe00000 != 0xffe00000 || !versionOk || layer != 0b01 || sampleRateIndex == 0b11 {
+		return
+	}
+
+	lsf := 0
+	if version != 3 {
+		lsf = 1
+	}
+
+	bitrate := mp3Bitrates[lsf][bitrateIndex]
+	if bitrate == 0 {
+		return
+	}
+
+	h.sampleRate = sampleRates[sampleRateIndex]
+	h.samples = 1152 >> lsf
+	h.size = (144*1000*bitrate/h.sampleRate)>>lsf + padding
+
+	switch {
+	case lsf == 0 && mono:
+		h.sideInfo = 17
+	case lsf == 0:
+		h.sideInfo = 32
+	case mono:
+		h.sideInfo = 9
+	default:
+		h.sideInfo = 17
+	}
+
+	return h, true
+}
+
+// seekPoint is the frame number and its approximate offset from the Xing or VBRI seek table
+type seekPoint struct {
+	frame  int64
+	offset int64
+}
+
+// MP3Index maps the positions of the MP3 track to the offsets of its frames in the stream.
+// The frames are indexed as the stream is buffered, the positions beyond the indexed ones
+// are estimated by the Xing or VBRI seek table, or by the average frame size if there is none.
+type MP3Index struct {
+	stream          *BufferedStream
+	sampleRate      int
+	samplesPerFrame int
+	// offsets of the indexed frames
+	frames     []int64
+	scanOffset int64
+	seekTable  []seekPoint
+	mux        sync.Mutex
+}
+
+// NewMP3Index reads the header of the MP3 stream and indexes its buffered frames.
+// The first frame of the stream must be already buffered.
+func NewMP3Index(stream *BufferedStream) (*MP3Index, error) {
+	idx := &MP3Index{stream: stream}
+
+	start := idx.dataStart()
+	first := make([]byte, _MP3_SCAN_CHUNK)
+	n, _ := stream.ReadAt(first, start)
+	first = first[:n]
+
+	for i := 0; i+_MP3_HEADER_SIZE <= len(first); i++ {
+		h, ok := parseMP3Header(first[i:])
+		if !ok {
+			continue
+		}
+
+		idx.sampleRate = h.sampleRate
+		idx.samplesPerFrame = h.samples
+		idx.scanOffset = start + int64(i)
+		idx.readSeekTable(first[i:], idx.scanOffset, h)
+		idx.scan()
+		return idx, nil
+	}
+
+	return nil, errNoMP3Frames
+}
+
+// SampleRate returns the sample rate of the first frame.
+func (idx *MP3Index) SampleRate() int {
+	return idx.sampleRate
+}
+
+// SamplesPerFrame returns the number of the PCM samples decoded from each frame.
+func (idx *MP3Index) SamplesPerFrame() int {
+	return idx.samplesPerFrame
+}
+
+// Duration returns the playback time of the indexed frames, it's the whole track duration once the stream is buffered.
+func (idx *MP3Index) Duration() time.Duration {
+	idx.mux.Lock()
+	defer idx.mux.Unlock()
+
+	idx.scan()
+
+	samples := int64(len(idx.frames)) * int64(idx.samplesPerFrame)
+	return time.Duration(samples) * time.Second / time.Duration(idx.sampleRate)
+}
+
+// FrameOffset returns the stream offset of the frame.
+// Reports whether the offset is exact, otherwise it's estimated and the frame has to be searched from it.
+func (idx *MP3Index) FrameOffset(frame int64) (int64, bool) {
+	idx.mux.Lock()
+	defer idx.mux.Unlock()
+
+	idx.scan()
+
+	if frame < 0 {
+		frame = 0
+	}
+	if frame < int64(len(idx.frames)) {
+		return idx.frames[frame], true
+	}
+
+	offset := idx.estimateOffset(frame)
+	if length := idx.stream.Length(); offset > length {
+		offset = length
+	}
+	return offset, false
+}
+
+func (idx *MP3Index) estimateOffset(frame int64) int64 {
+	indexed := int64(len(idx.frames))
+	last := idx.frames[indexed-1]
+
+	// use the seek table points around the frame if the table reaches beyond the indexed frames
+	for i := 1; i < len(idx.seekTable); i++ {
+		prev, next := idx.seekTable[i-1], idx.seekTable[i]
+		if next.frame < frame || next.frame == prev.frame {
+			continue
+		}
+		if prev.frame < indexed-1 {
+			prev = seekPoint{frame: indexed - 1, offset: last}
+		}
+		if next.offset < prev.offset {
+			break
+		}
+		return prev.offset + (next.offset-prev.offset)*(frame-prev.frame)/(next.frame-prev.frame)
+	}
+
+	// otherwise assume the average size of the indexed frames
+	if indexed < 2 {
+		return last
+	}
+	averageSize := float64(last-idx.frames[0]) / float64(indexed-1)
+	return last + int64(averageSize*float64(frame-indexed+1))
+}
+
+// dataStart returns the offset of the audio data that follows the ID3v2 tag.
+func (idx *MP3Index) dataStart() int64 {
+	header := make([]byte, _ID3_HEADER_SIZE)
+	n, _ := idx.stream.ReadAt(header, 0)
+	if n < _ID3_HEADER_SIZE || string(header[:3]) != "ID3" {
+		return 0
+	}
+
+	size := int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f)
+	size += _ID3_HEADER_SIZE
+	// the tag footer is present
+	if header[5]&0x10 != 0 {
+		size += _ID3_HEADER_SIZE
+	}
+	return size
+}
+
+// readSeekTable reads the Xing or VBRI seek table from the first frame.
+func (idx *MP3Index) readSeekTable(frame []byte, offset int64, h mp3Header) {
+	xing := _MP3_HEADER_SIZE + h.sideInfo
+	if len(frame) >= xing+8 && (string(frame[xing:xing+4]) == "Xing" || string(frame[xing:xing+4]) == "Info") {
+		idx.readXingTable(frame[xing:], offset)
+		return
+	}
+
+	vbri := _MP3_HEADER_SIZE + 32
+	if len(frame) >= vbri+_VBRI_HEADER_SIZE && string(frame[vbri:vbri+4]) == "VBRI" {
+		idx.readVBRITable(frame[vbri:], offset+int64(h.size))
+	}
+}
+
+// readXingTable reads the table of the stream offsets of each percent of the track.
+// The Xing frame contains no audio, so the table frames are counted from the next one.
+func (idx *MP3Index) readXingTable(xing []byte, offset int64) {
+	const (
+		flagFrames = 1 << iota
+		flagBytes
+		flagTOC
+	)
+
+	flags := binary.BigEndian.Uint32(xing[4:])
+	xing = xing[8:]
+
+	var frames, bytes int64
+	if flags&flagFrames != 0 && len(xing) >= 4 {
+		frames = int64(binary.BigEndian.Uint32(xing))
+		xing = xing[4:]
+	}
+	if flags&flagBytes != 0 && len(xing) >= 4 {
+		bytes = int64(binary.BigEndian.Uint32(xing))
+		xing = xing[4:]
+	}
+	if flags&flagTOC == 0 || len(xing) < _XING_TOC_SIZE || frames == 0 {
+		return
+	}
+	if bytes == 0 {
+		bytes = idx.stream.Length() - offset
+	}
+
+	idx.seekTable = make([]seekPoint, 0, _XING_TOC_SIZE+1)
+	for percent := int64(0); percent < _XING_TOC_SIZE; percent++ {
+		idx.seekTable = append(idx.seekTable, seekPoint{
+			frame:  1 + frames*percent/_XING_TOC_SIZE,
+			offset: offset + bytes*int64(xing[percent])/256,
+		})
+	}
+	idx.seekTable = append(idx.seekTable, seekPoint{frame: 1 + frames, offset: offset + bytes})
+}
+
+// readVBRITable reads the table of the sizes of the equal frame groups.
+// The VBRI frame contains no audio, so the table starts from the next one.
+func (idx *MP3Index) readVBRITable(vbri []byte, offset int64) {
+	entries := int(binary.BigEndian.Uint16(vbri[18:]))
+	scale := int64(binary.BigEndian.Uint16(vbri[20:]))
+	entrySize := int(binary.BigEndian.Uint16(vbri[22:]))
+	framesPerEntry := int64(binary.BigEndian.Uint16(vbri[24:]))
+	table := vbri[_VBRI_HEADER_SIZE:]
+
+	if entrySize < 1 || entrySize > 4 || len(table) < entries*entrySize || framesPerEntry == 0 {
+		return
+	}
+
+	idx.seekTable = make([]seekPoint, 0, entries+1)
+	idx.seekTable = append(idx.seekTable, seekPoint{frame: 1, offset: offset})
+	for i := 0; i < entries; i++ {
+		var size int64
+		for _, b := range table[i*entrySize : (i+1)*entrySize] {
+			size = size<<8 | int64(b)
+		}
+		offset += size * scale
+		idx.seekTable = append(idx.seekTable, seekPoint{frame: 1 + int64(i+1)*framesPerEntry, offset: offset})
+	}
+}
+
+// scan indexes the frames that were buffered since the last call.
+func (idx *MP3Index) scan() {
+	buf := make([]byte, _MP3_SCAN_CHUNK)
+
+	for {
+		n, err := idx.stream.ReadAt(buf, idx.scanOffset)
+		chunk := buf[:n]
+
+		i := 0
+		for i+_MP3_HEADER_SIZE <= len(chunk) {
+			h, ok := parseMP3Header(chunk[i:])
+			if !ok || h.sampleRate != idx.sampleRate {
+				// skip the garbage between the frames
+				i++
+				continue
+			}
+			idx.frames = append(idx.frames, idx.scanOffset+int64(i))
+			i += h.size
+		}
+
+		// the offset points to the frame beyond the chunk or to the header split by its end
+		idx.scanOffset += int64(i)
+		if err == io.EOF {
+			return
+		}
+	}
+}
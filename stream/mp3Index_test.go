@@ -0,0 +1,330 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+)
+
+const (
+	// frame sizes of the MPEG-1 Layer III 44100 Hz stereo frames without padding
+	testFrame128 = 417
+	testFrame320 = 1044
+	// bitrate indexes of the frame header
+	testBitrate128 = 9
+	testBitrate320 = 14
+)
+
+// testMP3 builds the MP3 stream and keeps the offsets of its frames
+type testMP3 struct {
+	data   []byte
+	frames []int64
+}
+
+// addFrame appends the frame of the MPEG-1 Layer III 44100 Hz stereo stream with the payload after the side info.
+func (s *testMP3) addFrame(bitrateIndex byte, size int, payload []byte) {
+	frame := make([]byte, size)
+	copy(frame, []byte{0xff, 0xfb, bitrateIndex << 4, 0x00})
+	copy(frame[_MP3_HEADER_SIZE+32:], payload)
+
+	s.frames = append(s.frames, int64(len(s.data)))
+	s.data = append(s.data, frame...)
+}
+
+// addID3 prepends the ID3v2 tag which content looks like the frame headers.
+func (s *testMP3) addID3(size int) {
+	tag := []byte{'I', 'D', '3', 4, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	tag = append(tag, bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x00}, size/4)...)
+	tag = append(tag, make([]byte, size%4)...)
+
+	s.data = append(tag, s.data...)
+	for i := range s.frames {
+		s.frames[i] += int64(len(tag))
+	}
+}
+
+// xingPayload builds the Xing header which table points to the frames of the stream that follow the first one.
+func xingPayload(s *testMP3, frames int) []byte {
+	offset := s.frames[0]
+	total := int64(len(s.data)) - offset
+
+	payload := []byte("Xing")
+	payload = binary.BigEndian.AppendUint32(payload, 0b111)
+	payload = binary.BigEndian.AppendUint32(payload, uint32(frames))
+	payload = binary.BigEndian.AppendUint32(payload, uint32(total))
+	for percent := 0; percent < _XING_TOC_SIZE; percent++ {
+		frame := 1 + frames*percent/_XING_TOC_SIZE
+		payload = append(payload, byte((s.frames[frame]-offset)*256/total))
+	}
+	return payload
+}
+
+// newTestMP3Stream buffers the head of the data and keeps the rest until the returned function is called.
+// The head is buffered by the whole buffering chunks.
+func newTestMP3Stream(t *testing.T, data []byte, head int) (*BufferedStream, func()) {
+	t.Helper()
+
+	reader, writer := io.Pipe()
+	s := NewBufferedStream(reader, int64(len(data)))
+	t.Cleanup(func() {
+		writer.Close()
+		s.Close()
+	})
+
+	go writer.Write(data[:head])
+	waitBuffered(t, s, int64(head))
+
+	rest := func() {
+		go func() {
+			writer.Write(data[head:])
+			writer.Close()
+		}()
+		waitBuffered(t, s, int64(len(data)))
+	}
+	return s, rest
+}
+
+func waitBuffered(t *testing.T, s *BufferedStream, size int64) {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for !s.IsBufferedAhead(size) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d bytes are not buffered in time", size)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// indexed returns the frames which headers are in the head of the stream.
+func (s *testMP3) indexed(head int) []int64 {
+	for i, offset := range s.frames {
+		if offset+_MP3_HEADER_SIZE > int64(head) {
+			return s.frames[:i]
+		}
+	}
+	return s.frames
+}
+
+func checkExact(t *testing.T, idx *MP3Index, frames []int64) {
+	t.Helper()
+
+	for frame, want := range frames {
+		offset, exact := idx.FrameOffset(int64(frame))
+		if offset != want || !exact {
+			t.Fatalf("frame %d offset is %d, exact %v; want %d, true", frame, offset, exact, want)
+		}
+	}
+}
+
+func TestMP3IndexCBR(t *testing.T) {
+	var mp3 testMP3
+	for i := 0; i < 100; i++ {
+		mp3.addFrame(testBitrate128, testFrame128, nil)
+	}
+
+	s, rest := newTestMP3Stream(t, mp3.data, _BUFFERING_AMOUNT)
+	idx, err := NewMP3Index(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if idx.SampleRate() != 44100 || idx.SamplesPerFrame() != 1152 {
+		t.Errorf("sample rate %d, samples per frame %d; want 44100, 1152", idx.SampleRate(), idx.SamplesPerFrame())
+	}
+
+	checkExact(t, idx, mp3.indexed(_BUFFERING_AMOUNT))
+
+	// the frames that aren't buffered are estimated by the average frame size
+	for _, frame := range []int64{85, 99} {
+		offset, exact := idx.FrameOffset(frame)
+		if offset != mp3.frames[frame] || exact {
+			t.Errorf("frame %d offset is %d, exact %v; want %d, false", frame, offset, exact, mp3.frames[frame])
+		}
+	}
+
+	if offset, exact := idx.FrameOffset(200); offset != int64(len(mp3.data)) || exact {
+		t.Errorf("offset beyond the end is %d, exact %v; want %d, false", offset, exact, len(mp3.data))
+	}
+
+	rest()
+	checkExact(t, idx, mp3.frames)
+
+	if d, want := idx.Duration(), 100*1152*time.Second/44100; d != want {
+		t.Errorf("duration is %v, want %v", d, want)
+	}
+}
+
+func TestMP3IndexID3(t *testing.T) {
+	var mp3 testMP3
+	for i := 0; i < 20; i++ {
+		mp3.addFrame(testBitrate128, testFrame128, nil)
+	}
+	mp3.addID3(1001)
+
+	s, _ := newTestMP3Stream(t, mp3.data, len(mp3.data))
+	idx, err := NewMP3Index(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if offset, _ := idx.FrameOffset(-1); offset != mp3.frames[0] {
+		t.Errorf("negative frame offset is %d, want %d", offset, mp3.frames[0])
+	}
+	checkExact(t, idx, mp3.frames)
+}
+
+func TestMP3IndexXing(t *testing.T) {
+	const frames = 200
+
+	// the small frames at the head make the average size estimate wrong
+	build := func(payload []byte) testMP3 {
+		var mp3 testMP3
+		mp3.addFrame(testBitrate128, testFrame128, payload)
+		for i := 0; i < frames; i++ {
+			if i < 20 {
+				mp3.addFrame(testBitrate128, testFrame128, nil)
+			} else {
+				mp3.addFrame(testBitrate320, testFrame320, nil)
+			}
+		}
+		return mp3
+	}
+	mp3 := build(nil)
+	mp3 = build(xingPayload(&mp3, frames))
+
+	s, rest := newTestMP3Stream(t, mp3.data, _BUFFERING_AMOUNT)
+	idx, err := NewMP3Index(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkExact(t, idx, mp3.indexed(_BUFFERING_AMOUNT))
+
+	// the table resolution is 1/256 of the stream and 1% of the frames
+	for _, frame := range []int64{50, 100, 150, 200} {
+		offset, exact := idx.FrameOffset(frame)
+		if diff := offset - mp3.frames[frame]; exact || diff < -testFrame320 || diff > testFrame320 {
+			t.Errorf("frame %d offset is %d, exact %v; want about %d", frame, offset, exact, mp3.frames[frame])
+		}
+	}
+
+	rest()
+	checkExact(t, idx, mp3.frames)
+}
+
+func TestMP3IndexVBRI(t *testing.T) {
+	const (
+		entries        = 10
+		framesPerEntry = 10
+	)
+
+	build := func(payload []byte) testMP3 {
+		var mp3 testMP3
+		mp3.addFrame(testBitrate128, testFrame128, payload)
+		for i := 0; i < entries*framesPerEntry; i++ {
+			if i%2 == 0 {
+				mp3.addFrame(testBitrate128, testFrame128, nil)
+			} else {
+				mp3.addFrame(testBitrate320, testFrame320, nil)
+			}
+		}
+		return mp3
+	}
+
+	// the group sizes are stored in the units of the scale
+	const scale = 1
+	payload := []byte("VBRI")
+	payload = binary.BigEndian.AppendUint16(payload, 1)
+	payload = append(payload, make([]byte, 12)...)
+	payload = binary.BigEndian.AppendUint16(payload, entries)
+	payload = binary.BigEndian.AppendUint16(payload, scale)
+	payload = binary.BigEndian.AppendUint16(payload, 2)
+	payload = binary.BigEndian.AppendUint16(payload, framesPerEntry)
+	for i := 0; i < entries; i++ {
+		payload = binary.BigEndian.AppendUint16(payload, framesPerEntry/2*(testFrame128+testFrame320)/scale)
+	}
+	mp3 := build(payload)
+
+	s, rest := newTestMP3Stream(t, mp3.data, _BUFFERING_AMOUNT)
+	idx, err := NewMP3Index(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkExact(t, idx, mp3.indexed(_BUFFERING_AMOUNT))
+
+	// the group boundaries are exact, the frames inside the groups are interpolated
+	for _, frame := range []int64{61, 71, 91} {
+		offset, exact := idx.FrameOffset(frame)
+		if offset != mp3.frames[frame] || exact {
+			t.Errorf("frame %d offset is %d, exact %v; want %d, false", frame, offset, exact, mp3.frames[frame])
+		}
+	}
+	for _, frame := range []int64{77, 84} {
+		offset, _ := idx.FrameOffset(frame)
+		if diff := offset - mp3.frames[frame]; diff < -testFrame320 || diff > testFrame320 {
+			t.Errorf("frame %d offset is %d, want about %d", frame, offset, mp3.frames[frame])
+		}
+	}
+
+	rest()
+	checkExact(t, idx, mp3.frames)
+}
+
+func TestMP3IndexSkipsGarbage(t *testing.T) {
+	var mp3 testMP3
+	for i := 0; i < 10; i++ {
+		mp3.addFrame(testBitrate128, testFrame128, nil)
+		if i == 4 {
+			// the broken bytes between the frames
+			mp3.data = append(mp3.data, 0xff, 0xfb, 0xf0, 0x00, 0x12, 0x34)
+		}
+	}
+
+	s, _ := newTestMP3Stream(t, mp3.data, len(mp3.data))
+	idx, err := NewMP3Index(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExact(t, idx, mp3.frames)
+}
+
+func TestMP3IndexNoFrames(t *testing.T) {
+	data := make([]byte, 4096)
+	s, _ := newTestMP3Stream(t, data, len(data))
+	if _, err := NewMP3Index(s); err != errNoMP3Frames {
+		t.Errorf("the stream without frames returned %v, want %v", err, errNoMP3Frames)
+	}
+}
+
+func TestParseMP3Header(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   mp3Header
+		ok     bool
+	}{
+		{"mpeg1 128k", []byte{0xff, 0xfb, 0x90, 0x00}, mp3Header{size: 417, samples: 1152, sampleRate: 44100, sideInfo: 32}, true},
+		{"mpeg1 padded", []byte{0xff, 0xfb, 0x92, 0x00}, mp3Header{size: 418, samples: 1152, sampleRate: 44100, sideInfo: 32}, true},
+		{"mpeg1 mono 48k", []byte{0xff, 0xfb, 0x94, 0xc0}, mp3Header{size: 384, samples: 1152, sampleRate: 48000, sideInfo: 17}, true},
+		{"mpeg2 64k", []byte{0xff, 0xf3, 0x80, 0x00}, mp3Header{size: 208, samples: 576, sampleRate: 22050, sideInfo: 17}, true},
+		{"free bitrate", []byte{0xff, 0xfb, 0x00, 0x00}, mp3Header{}, false},
+		{"bad bitrate", []byte{0xff, 0xfb, 0xf0, 0x00}, mp3Header{}, false},
+		{"bad sample rate", []byte{0xff, 0xfb, 0x9c, 0x00}, mp3Header{}, false},
+		{"layer II", []byte{0xff, 0xfd, 0x90, 0x00}, mp3Header{}, false},
+		{"no sync", []byte{0xff, 0x7b, 0x90, 0x00}, mp3Header{}, false},
+		{"short", []byte{0xff, 0xfb, 0x90}, mp3Header{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, ok := parseMP3Header(tt.header)
+			if h != tt.want || ok != tt.ok {
+				t.Errorf("header is %+v, %v; want %+v, %v", h, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
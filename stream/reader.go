@@ -0,0 +1,70 @@
+package stream
+
+import "io"
+
+// Reader reads the stream data from its own position and waits for it to be downloaded like BufferedStream.Read.
+// It doesn't move the read position of the stream, so the decoder that reads ahead of the playback
+// keeps the stream position at the played data by BufferedStream.Seek.
+type Reader struct {
+	stream *BufferedStream
+	pos    int64
+	// guarded by the stream lock
+	closed bool
+}
+
+// NewReader returns the reader of the stream data from the offset.
+func (h *BufferedStream) NewReader(offset int64) *Reader {
+	return &Reader{stream: h, pos: offset}
+}
+
+func (r *Reader) Read(dest []byte) (n int, err error) {
+	h := r.stream
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.totalSize < 0 {
+		return 0, h.lastError
+	}
+
+	for {
+		if r.closed || h.closed {
+			return 0, ErrClosed
+		}
+		if r.pos >= h.totalSize {
+			return 0, io.EOF
+		}
+
+		end := h.segments.contiguousEnd(r.pos)
+		if end > r.pos {
+			n, err = h.data.ReadAt(dest[:min(int64(len(dest)), end-r.pos)], r.pos)
+			r.pos += int64(n)
+			return
+		}
+
+		if h.lastError != nil {
+			return 0, h.lastError
+		}
+
+		h.request(r.pos)
+		h.waiters++
+		h.cond.Wait()
+		h.waiters--
+	}
+}
+
+// Offset returns the position of the next byte to read.
+func (r *Reader) Offset() int64 {
+	r.stream.mux.Lock()
+	defer r.stream.mux.Unlock()
+	return r.pos
+}
+
+// Close interrupts the waiting read, the following reads return ErrClosed. The stream stays open.
+func (r *Reader) Close() error {
+	r.stream.mux.Lock()
+	defer r.stream.mux.Unlock()
+
+	r.closed = true
+	r.stream.cond.Broadcast()
+	return nil
+}
@@ -0,0 +1,96 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReaderKeepsStreamPosition(t *testing.T) {
+	content := memoryContent()
+
+	tests := []struct {
+		name   string
+		offset int64
+		ranged bool
+	}{
+		{"start", 0, false},
+		{"middle", memoryContentSize / 2, false},
+		{"middle ranged", memoryContentSize / 2, true},
+		{"end", memoryContentSize, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var open RangeOpener
+			if tt.ranged {
+				open = memoryOpener(content, nil)
+			}
+			s := newMemoryStream(t, newMemorySource(content, 0, -1, nil), open)
+			r := s.NewReader(tt.offset)
+
+			var (
+				read []byte
+				err  error
+			)
+			within(t, "reading", func() {
+				read, err = io.ReadAll(r)
+			})
+			if err != nil {
+				t.Fatalf("failed to read: %s", err)
+			}
+			if !bytes.Equal(read, content[tt.offset:]) {
+				t.Errorf("the data read from %d differs from the source", tt.offset)
+			}
+			if r.Offset() != memoryContentSize {
+				t.Errorf("reader offset is %d after reading to the end", r.Offset())
+			}
+			if s.IsDone() || s.Progress() != 0 {
+				t.Errorf("the stream is done %t with progress %f after the reader", s.IsDone(), s.Progress())
+			}
+		})
+	}
+}
+
+func TestReaderClose(t *testing.T) {
+	content := memoryContent()
+
+	tests := []struct {
+		name  string
+		close func(s *BufferedStream, r *Reader)
+	}{
+		{"reader", func(s *BufferedStream, r *Reader) { r.Close() }},
+		{"stream", func(s *BufferedStream, r *Reader) { s.Close() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the source hangs in the middle until it's closed
+			source := newMemorySource(content, 0, memoryContentSize/4, nil)
+			s := newMemoryStream(t, source, nil)
+			r := s.NewReader(memoryContentSize / 2)
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := r.Read(make([]byte, 1))
+				done <- err
+			}()
+
+			time.Sleep(50 * time.Millisecond)
+			tt.close(s, r)
+
+			select {
+			case err := <-done:
+				if err != ErrClosed {
+					t.Errorf("interrupted read returned %v, want %v", err, ErrClosed)
+				}
+			case <-time.After(testTimeout):
+				t.Fatal("closing doesn't interrupt the waiting read")
+			}
+			if _, err := r.Read(make([]byte, 1)); err != ErrClosed {
+				t.Errorf("read after close returned %v, want %v", err, ErrClosed)
+			}
+		})
+	}
+}
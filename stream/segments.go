@@ -0,0 +1,85 @@
+package stream
+
+// segment is the downloaded range [start, end) of the stream
+type segment struct {
+	start, end int64
+}
+
+// segments are the sorted non-overlapping downloaded ranges of the stream
+type segments []segment
+
+// add marks the range as downloaded merging it with the adjacent ones.
+func (s *segments) add(start, end int64) {
+	if start >= end {
+		return
+	}
+
+	merged := make(segments, 0, len(*s)+1)
+	inserted := false
+	for _, seg := range *s {
+		switch {
+		case seg.end < start:
+			merged = append(merged, seg)
+		case seg.start > end:
+			if !inserted {
+				merged = append(merged, segment{start, end})
+				inserted = true
+			}
+			merged = append(merged, seg)
+		default:
+			start = min(start, seg.start)
+			end = max(end, seg.end)
+		}
+	}
+	if !inserted {
+		merged = append(merged, segment{start, end})
+	}
+
+	*s = merged
+}
+
+// contiguousEnd returns the end of the downloaded range that contains the offset,
+// or the offset itself if it's not downloaded.
+func (s segments) contiguousEnd(offset int64) int64 {
+	for _, seg := range s {
+		if seg.start <= offset && offset < seg.end {
+			return seg.end
+		}
+	}
+	return offset
+}
+
+// nextStart returns the start of the first downloaded range after the offset, or the limit if there is none.
+func (s segments) nextStart(offset, limit int64) int64 {
+	for _, seg := range s {
+		if seg.start > offset {
+			return min(seg.start, limit)
+		}
+	}
+	return limit
+}
+
+// firstGap returns the first offset that isn't downloaded starting from the given one
+// and wrapping around to the beginning. Returns the size if everything is downloaded.
+func (s segments) firstGap(offset, size int64) int64 {
+	if end := s.contiguousEnd(offset); end < size {
+		return end
+	}
+	if end := s.contiguousEnd(0); end < size {
+		return end
+	}
+	return size
+}
+
+// covers reports whether the whole range [0, size) is downloaded.
+func (s segments) covers(size int64) bool {
+	return s.contiguousEnd(0) >= size
+}
+
+// total returns the amount of the downloaded bytes.
+func (s segments) total() (n int64) {
+	for _, seg := range s {
+		n += seg.end - seg.start
+	}
+	return
+}
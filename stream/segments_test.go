@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSegmentsAdd(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []segment
+		want   segments
+	}{
+		{"single", []segment{{0, 10}}, segments{{0, 10}}},
+		{"empty range", []segment{{5, 5}}, segments{}},
+		{"disjoint", []segment{{20, 30}, {0, 10}}, segments{{0, 10}, {20, 30}}},
+		{"adjacent", []segment{{0, 10}, {10, 20}}, segments{{0, 20}}},
+		{"overlapping", []segment{{0, 10}, {5, 15}}, segments{{0, 15}}},
+		{"bridging", []segment{{0, 10}, {20, 30}, {10, 20}}, segments{{0, 30}}},
+		{"covering", []segment{{5, 10}, {15, 20}, {0, 30}}, segments{{0, 30}}},
+		{"inside", []segment{{0, 30}, {10, 20}}, segments{{0, 30}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := segments{}
+			for _, r := range tt.ranges {
+				s.add(r.start, r.end)
+			}
+			if !reflect.DeepEqual(s, tt.want) {
+				t.Errorf("segments are %v, want %v", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentsLookup(t *testing.T) {
+	s := segments{{0, 10}, {20, 30}}
+
+	if end := s.contiguousEnd(5); end != 10 {
+		t.Errorf("contiguousEnd(5) = %d, want 10", end)
+	}
+	if end := s.contiguousEnd(15); end != 15 {
+		t.Errorf("contiguousEnd(15) = %d, want 15", end)
+	}
+	if start := s.nextStart(10, 40); start != 20 {
+		t.Errorf("nextStart(10) = %d, want 20", start)
+	}
+	if start := s.nextStart(25, 40); start != 40 {
+		t.Errorf("nextStart(25) = %d, want the limit", start)
+	}
+	if gap := s.firstGap(25, 40); gap != 30 {
+		t.Errorf("firstGap(25) = %d, want 30", gap)
+	}
+	if gap := (segments{{0, 10}, {20, 40}}).firstGap(25, 40); gap != 10 {
+		t.Errorf("firstGap wrapped = %d, want 10", gap)
+	}
+	if s.covers(30) || !(segments{{0, 30}}).covers(30) {
+		t.Error("covers reports the wrong coverage")
+	}
+	if total := s.total(); total != 20 {
+		t.Errorf("total = %d, want 20", total)
+	}
+}
@@ -0,0 +1,77 @@
+package stream
+
+import (
+	"io"
+	"os"
+)
+
+// the streams larger than this are stored in the temporary files, 0 keeps all of them in memory
+var memoryLimit int64
+
+// SetMemoryLimit sets the size of the stream above which its data is stored on disk instead of memory.
+// Zero or a negative limit keeps all the streams in memory.
+func SetMemoryLimit(limit int64) {
+	memoryLimit = limit
+}
+
+// storage keeps the downloaded data of the stream at its offsets
+type storage interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+}
+
+// newStorage creates the storage of the stream data of the size.
+// It falls back to memory if the temporary file can't be created.
+func newStorage(size int64) storage {
+	if memoryLimit > 0 && size > memoryLimit {
+		fs, err := newFileStorage()
+		if err == nil {
+			return fs
+		}
+	}
+	return make(memoryStorage, max(size, 0))
+}
+
+type memoryStorage []byte
+
+func (s memoryStorage) ReadAt(dest []byte, offset int64) (n int, err error) {
+	if offset < 0 || offset > int64(len(s)) {
+		return 0, errOutOfSize
+	}
+	n = copy(dest, s[offset:])
+	if n < len(dest) {
+		err = io.EOF
+	}
+	return
+}
+
+func (s memoryStorage) WriteAt(data []byte, offset int64) (int, error) {
+	if offset < 0 || offset+int64(len(data)) > int64(len(s)) {
+		return 0, errOutOfSize
+	}
+	return copy(s[offset:], data), nil
+}
+
+func (s memoryStorage) Close() error {
+	return nil
+}
+
+// fileStorage keeps the stream data in the temporary file that is removed on close
+type fileStorage struct {
+	*os.File
+}
+
+func newFileStorage() (*fileStorage, error) {
+	file, err := os.CreateTemp("", "yamusic-stream-*")
+	if err != nil {
+		return nil, err
+	}
+	return &fileStorage{file}, nil
+}
+
+func (s *fileStorage) Close() error {
+	err := s.File.Close()
+	os.Remove(s.Name())
+	return err
+}
@@ -6,10 +6,14 @@ import (
 )
 
 type helpKeyMap struct {
-	CursorUp   key.Binding
-	CursorDown key.Binding
-	Rename     key.Binding
-	Renamable  bool
+	CursorUp     key.Binding
+	CursorDown   key.Binding
+	Rename       key.Binding
+	Change       key.Binding
+	Offline      key.Binding
+	Renamable    bool
+	Changeable   bool
+	Downloadable bool
 }
 
 func (k helpKeyMap) ShortHelp() []key.Binding {
@@ -17,20 +21,31 @@ func (k helpKeyMap) ShortHelp() []key.Binding {
 }
 
 func (k helpKeyMap) FullHelp() [][]key.Binding {
-	if k.Renamable {
-		return [][]key.Binding{
-			k.ShortHelp(),
-			{k.Rename},
-		}
-	} else {
+	var extra []key.Binding
+	if k.Changeable {
+		extra = append(extra, k.Change)
+	} else if k.Renamable {
+		extra = append(extra, k.Rename)
+	}
+	if k.Downloadable {
+		extra = append(extra, k.Offline)
+	}
+
+	if len(extra) == 0 {
 		return [][]key.Binding{
 			k.ShortHelp(),
 		}
 	}
+	return [][]key.Binding{
+		k.ShortHelp(),
+		extra,
+	}
 }
 
 var helpMap = helpKeyMap{
 	CursorUp:   key.NewBinding(config.Current.Controls.PlaylistsUp.Binding(), config.Current.Controls.PlaylistsUp.Help("up")),
 	CursorDown: key.NewBinding(config.Current.Controls.PlaylistsDown.Binding(), config.Current.Controls.PlaylistsDown.Help("down")),
 	Rename:     key.NewBinding(config.Current.Controls.PlaylistsRename.Binding(), config.Current.Controls.PlaylistsRename.Help("rename")),
+	Change:     key.NewBinding(config.Current.Controls.PlaylistsChange.Binding(), config.Current.Controls.PlaylistsChange.Help("change")),
+	Offline:    key.NewBinding(config.Current.Controls.PlaylistsOffline.Binding(), config.Current.Controls.PlaylistsOffline.Help("offline")),
 }
@@ -1,6 +1,10 @@
 package playlist
 
-import "github.com/dece2183/yamusic-tui/api"
+import (
+	"math/rand"
+
+	"github.com/dece2183/yamusic-tui/api"
+)
 
 type Item struct {
 	Uid uint64
@@ -13,20 +17,139 @@ type Item struct {
 	Active       bool
 	Subitem      bool
 	Infinite     bool
+	// Name of the station setting that is changed by this item
+	Setting string
 
 	Tracks        []api.Track
 	CurrentTrack  int
 	SelectedTrack int
+	// Play order of the track indexes in the shuffle mode
+	ShuffleOrder []int
+
+	// Tracks are loaded on demand page by page from one of the sources
+	Paginated   bool
+	ArtistId    uint64
+	AlbumId     uint64
+	OwnerUid    uint64
+	PlaylistId  uint64
+	TrackIds    []string
+	TracksTotal int
+	NextPage    int
+	Loading     bool
+
+	// Tracks are downloaded to the cache for the offline playback
+	Offline bool
+	// Progress of the offline download, the total is 0 until the tracks are listed
+	OfflineDone  int
+	OfflineTotal int
 }
 
 func (i *Item) FilterValue() string {
 	return i.Name
 }
 
+// Downloadable reports whether the playlist tracks can be made available offline.
+func (i *Item) Downloadable() bool {
+	return i.Active && !i.Infinite && i.Kind != WAVE_SETTING && i.Kind != LOCAL
+}
+
 func (i *Item) IsSame(other *Item) bool {
 	return i.Kind == other.Kind && i.Name == other.Name
 }
 
+// HasMore reports whether the playlist has tracks that aren't loaded yet.
+func (pl *Item) HasMore() bool {
+	return pl.Paginated && (pl.NextPage == 0 || len(pl.Tracks) < pl.TracksTotal)
+}
+
+// Shuffle generates a new random play order that starts with the specified track.
+// A negative index makes the whole order random.
+func (pl *Item) Shuffle(first int) {
+	pl.ShuffleOrder = rand.Perm(len(pl.Tracks))
+	if first < 0 || first >= len(pl.Tracks) {
+		return
+	}
+	for i, v := range pl.ShuffleOrder {
+		if v == first {
+			pl.ShuffleOrder[0], pl.ShuffleOrder[i] = pl.ShuffleOrder[i], pl.ShuffleOrder[0]
+			break
+		}
+	}
+}
+
+// ShuffledNext returns the index of the track that follows the current one in the shuffled order.
+// Returns -1 if the current track is the last one.
+func (pl *Item) ShuffledNext() int {
+	pos := pl.shufflePosition()
+	if pos < 0 || pos+1 >= len(pl.ShuffleOrder) {
+		return -1
+	}
+	return pl.ShuffleOrder[pos+1]
+}
+
+// ShuffledPrev returns the index of the track that precedes the current one in the shuffled order.
+// Returns -1 if the current track is the first one.
+func (pl *Item) ShuffledPrev() int {
+	pos := pl.shufflePosition()
+	if pos <= 0 {
+		return -1
+	}
+	return pl.ShuffleOrder[pos-1]
+}
+
+// ShuffledFirst returns the index of the track that starts the shuffled order.
+func (pl *Item) ShuffledFirst() int {
+	pl.syncShuffleOrder()
+	if len(pl.ShuffleOrder) == 0 {
+		return -1
+	}
+	return pl.ShuffleOrder[0]
+}
+
+// ShuffledLast returns the index of the track that ends the shuffled order.
+func (pl *Item) ShuffledLast() int {
+	pl.syncShuffleOrder()
+	if len(pl.ShuffleOrder) == 0 {
+		return -1
+	}
+	return pl.ShuffleOrder[len(pl.ShuffleOrder)-1]
+}
+
+func (pl *Item) shufflePosition() int {
+	pl.syncShuffleOrder()
+	for i, v := range pl.ShuffleOrder {
+		if v == pl.CurrentTrack {
+			return i
+		}
+	}
+	return -1
+}
+
+// syncShuffleOrder keeps the order consistent with the tracks:
+// the loaded tracks are shuffled into the rest of the order
+// and the order is regenerated if the tracks were removed.
+func (pl *Item) syncShuffleOrder() {
+	switch {
+	case len(pl.ShuffleOrder) > len(pl.Tracks):
+		pl.Shuffle(pl.CurrentTrack)
+	case len(pl.ShuffleOrder) < len(pl.Tracks):
+		pos := 0
+		for i, v := range pl.ShuffleOrder {
+			if v == pl.CurrentTrack {
+				pos = i + 1
+				break
+			}
+		}
+		for i := len(pl.ShuffleOrder); i < len(pl.Tracks); i++ {
+			pl.ShuffleOrder = append(pl.ShuffleOrder, i)
+			// insert the new track somewhere after the current one
+			j := pos + rand.Intn(len(pl.ShuffleOrder)-pos)
+			last := len(pl.ShuffleOrder) - 1
+			pl.ShuffleOrder[j], pl.ShuffleOrder[last] = pl.ShuffleOrder[last], pl.ShuffleOrder[j]
+		}
+	}
+}
+
 func (pl *Item) AddTrack(track *api.Track) {
 	pl.Tracks = append([]api.Track{*track}, pl.Tracks...)
 }
@@ -47,12 +47,21 @@ func (d ItemDelegate) Render(w io.Writer, m list.Model, index int, listItem list
 		return
 	}
 
+	var offline string
+	if item.Offline {
+		offline = " " + style.IconCached
+		if item.OfflineTotal == 0 || item.OfflineDone < item.OfflineTotal {
+			offline += fmt.Sprintf(" %d/%d", item.OfflineDone, item.OfflineTotal)
+		}
+	}
+
 	name := item.Name
 	nameLen := lipgloss.Width(name)
-	maxLen := m.Width() - 5
+	maxLen := m.Width() - 5 - lipgloss.Width(offline)
 	if nameLen > maxLen {
 		name = lipgloss.NewStyle().MaxWidth(maxLen-1).Render(name) + "…"
 	}
+	name += offline
 
 	if !item.Active {
 		if item.Subitem {
@@ -18,6 +18,8 @@ const (
 	CURSOR_UP Control = iota
 	CURSOR_DOWN
 	RENAME
+	CHANGE
+	OFFLINE
 )
 
 type PlaylistType = uint64
@@ -27,6 +29,8 @@ const (
 	MYWAVE
 	LIKES
 	LOCAL
+	STATION
+	WAVE_SETTING
 	// Should be the last to detect downloaded user playlists
 	USER
 )
@@ -44,8 +48,13 @@ func New(p *tea.Program, title string) *Model {
 		help:    help.New(),
 	}
 
+	myWave := config.Current.MyWave
+
 	playlistItems := []list.Item{
 		&Item{Name: "my wave", Kind: MYWAVE, Active: true, Subitem: false, Infinite: true},
+		&Item{Name: "mood: " + myWave.Mood, Kind: WAVE_SETTING, Setting: "mood", Active: true, Subitem: true},
+		&Item{Name: "diversity: " + myWave.Diversity, Kind: WAVE_SETTING, Setting: "diversity", Active: true, Subitem: true},
+		&Item{Name: "language: " + myWave.Language, Kind: WAVE_SETTING, Setting: "language", Active: true, Subitem: true},
 		&Item{Name: "likes", Kind: LIKES, Active: true, Subitem: false},
 		&Item{Name: "local", Kind: LOCAL, Active: true, Subitem: false},
 
@@ -78,6 +87,8 @@ func (m *Model) View() string {
 	}
 
 	helpMap.Renamable = m.SelectedItem().Kind >= USER
+	helpMap.Changeable = m.SelectedItem().Kind == WAVE_SETTING
+	helpMap.Downloadable = m.SelectedItem().Downloadable()
 	if m.help.ShowAll {
 		m.list.SetHeight(m.height - 3)
 	} else {
@@ -121,6 +132,10 @@ func (m *Model) Update(message tea.Msg) (*Model, tea.Cmd) {
 			cmds = append(cmds, model.Cmd(CURSOR_DOWN))
 		case controls.PlaylistsRename.Contains(keypress):
 			cmds = append(cmds, model.Cmd(RENAME))
+		case controls.PlaylistsChange.Contains(keypress):
+			cmds = append(cmds, model.Cmd(CHANGE))
+		case controls.PlaylistsOffline.Contains(keypress):
+			cmds = append(cmds, model.Cmd(OFFLINE))
 		}
 	}
 
@@ -163,6 +178,66 @@ func (m *Model) InsertItem(index int, item *Item) tea.Cmd {
 	return m.list.InsertItem(index, item)
 }
 
+// SetSection replaces the items of the section with the specified title
+// or appends a new section to the end of the list.
+// Returns the index of the section title.
+func (m *Model) SetSection(title string, items []*Item) (int, tea.Cmd) {
+	oldItems := m.Items()
+	newItems := make([]*Item, 0, len(oldItems)+len(items)+2)
+
+	sectionIndex := -1
+	for i := 0; i < len(oldItems); i++ {
+		pl := oldItems[i]
+		if pl.Active || pl.Subitem || pl.Name != title {
+			newItems = append(newItems, pl)
+			continue
+		}
+
+		// drop the old section items
+		for i+1 < len(oldItems) && oldItems[i+1].Subitem {
+			i++
+		}
+
+		sectionIndex = len(newItems)
+		newItems = append(newItems, pl)
+		newItems = append(newItems, items...)
+	}
+
+	if sectionIndex < 0 {
+		newItems = append(newItems, &Item{Name: "", Kind: NONE, Active: false, Subitem: false})
+		sectionIndex = len(newItems)
+		newItems = append(newItems, &Item{Name: title, Kind: NONE, Active: false, Subitem: false})
+		newItems = append(newItems, items...)
+	}
+
+	return sectionIndex, m.SetItems(newItems)
+}
+
+// RemoveSection removes the section with the specified title and its items.
+func (m *Model) RemoveSection(title string) tea.Cmd {
+	oldItems := m.Items()
+	newItems := make([]*Item, 0, len(oldItems))
+
+	for i := 0; i < len(oldItems); i++ {
+		pl := oldItems[i]
+		if pl.Active || pl.Subitem || pl.Name != title {
+			newItems = append(newItems, pl)
+			continue
+		}
+
+		for i+1 < len(oldItems) && oldItems[i+1].Subitem {
+			i++
+		}
+
+		// drop the empty line that separates the section
+		if last := len(newItems) - 1; last >= 0 && !newItems[last].Active && len(newItems[last].Name) == 0 {
+			newItems = newItems[:last]
+		}
+	}
+
+	return m.SetItems(newItems)
+}
+
 func (m *Model) SetItem(index int, item *Item) tea.Cmd {
 	return m.list.SetItem(index, item)
 }
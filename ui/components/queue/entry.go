@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/ui/components/playlist"
+)
+
+const _HISTORY_LIMIT = 256
+
+type Entry struct {
+	Track api.Track
+	// Playlist the track was taken from
+	Source *playlist.Item
+	// Index of the track in the source playlist, -1 if the track was queued by the user
+	Index int
+}
+
+// Queued reports whether the entry was added to the queue by the user.
+func (e Entry) Queued() bool {
+	return e.Index < 0
+}
+
+// Queue holds the tracks queued by the user that are played before
+// the rest of the current playlist, and the history of the played tracks.
+type Queue struct {
+	history  []Entry
+	upcoming []Entry
+}
+
+// PlayNext puts the entry to the head of the queue.
+func (q *Queue) PlayNext(entry Entry) {
+	q.upcoming = append([]Entry{entry}, q.upcoming...)
+}
+
+// Enqueue puts the entry to the tail of the queue.
+func (q *Queue) Enqueue(entry Entry) {
+	q.upcoming = append(q.upcoming, entry)
+}
+
+// Pop removes the head of the queue and returns it.
+func (q *Queue) Pop() (Entry, bool) {
+	return q.Take(0)
+}
+
+// Take removes the entry with the specified index from the queue and returns it.
+func (q *Queue) Take(index int) (Entry, bool) {
+	if index < 0 || index >= len(q.upcoming) {
+		return Entry{}, false
+	}
+
+	entry := q.upcoming[index]
+	q.upcoming = append(q.upcoming[:index], q.upcoming[index+1:]...)
+	return entry, true
+}
+
+// Move moves the entry to the new position in the queue.
+func (q *Queue) Move(from, to int) bool {
+	if from < 0 || from >= len(q.upcoming) || to < 0 || to >= len(q.upcoming) {
+		return false
+	}
+
+	entry := q.upcoming[from]
+	if from < to {
+		copy(q.upcoming[from:to], q.upcoming[from+1:to+1])
+	} else {
+		copy(q.upcoming[to+1:from+1], q.upcoming[to:from])
+	}
+	q.upcoming[to] = entry
+	return true
+}
+
+// Upcoming returns the queued entries in the play order.
+func (q *Queue) Upcoming() []Entry {
+	return q.upcoming
+}
+
+func (q *Queue) Len() int {
+	return len(q.upcoming)
+}
+
+// PushHistory remembers the played entry.
+// The same track played several times in a row is stored once.
+func (q *Queue) PushHistory(entry Entry) {
+	if len(entry.Track.Id) == 0 {
+		return
+	}
+
+	if len(q.history) > 0 {
+		last := q.history[len(q.history)-1]
+		if last.Track.Id == entry.Track.Id && last.Source == entry.Source && last.Index == entry.Index {
+			return
+		}
+	}
+
+	q.history = append(q.history, entry)
+	if len(q.history) > _HISTORY_LIMIT {
+		q.history = q.history[len(q.history)-_HISTORY_LIMIT:]
+	}
+}
+
+// PopHistory removes the last played entry from the history and returns it.
+func (q *Queue) PopHistory() (Entry, bool) {
+	if len(q.history) == 0 {
+		return Entry{}, false
+	}
+
+	entry := q.history[len(q.history)-1]
+	q.history = q.history[:len(q.history)-1]
+	return entry, true
+}
+
+// History returns the played entries from the oldest to the latest one.
+func (q *Queue) History() []Entry {
+	return q.history
+}
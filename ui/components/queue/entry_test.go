@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/ui/components/playlist"
+)
+
+func entry(id string) Entry {
+	return Entry{Track: api.Track{Id: id}, Index: -1}
+}
+
+func newQueue(ids ...string) *Queue {
+	q := &Queue{}
+	for _, id := range ids {
+		q.Enqueue(entry(id))
+	}
+	return q
+}
+
+func ids(entries []Entry) []string {
+	result := make([]string, len(entries))
+	for i, e := range entries {
+		result[i] = e.Track.Id
+	}
+	return result
+}
+
+func TestQueuePlayNext(t *testing.T) {
+	q := newQueue("a", "b")
+	q.PlayNext(entry("c"))
+	q.Enqueue(entry("d"))
+
+	want := []string{"c", "a", "b", "d"}
+	if got := ids(q.Upcoming()); !reflect.DeepEqual(got, want) {
+		t.Errorf("upcoming is %v, want %v", got, want)
+	}
+
+	for _, id := range want {
+		e, ok := q.Pop()
+		if !ok || e.Track.Id != id {
+			t.Fatalf("popped %q, %v, want %q", e.Track.Id, ok, id)
+		}
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("popped from the empty queue")
+	}
+}
+
+func TestQueueTake(t *testing.T) {
+	tests := []struct {
+		index  int
+		taken  string
+		ok     bool
+		remain []string
+	}{
+		{0, "a", true, []string{"b", "c"}},
+		{1, "b", true, []string{"a", "c"}},
+		{2, "c", true, []string{"a", "b"}},
+		{3, "", false, []string{"a", "b", "c"}},
+		{-1, "", false, []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.index), func(t *testing.T) {
+			q := newQueue("a", "b", "c")
+			e, ok := q.Take(tt.index)
+			if ok != tt.ok || e.Track.Id != tt.taken {
+				t.Errorf("taken %q, %v, want %q, %v", e.Track.Id, ok, tt.taken, tt.ok)
+			}
+			if got := ids(q.Upcoming()); !reflect.DeepEqual(got, tt.remain) {
+				t.Errorf("upcoming is %v, want %v", got, tt.remain)
+			}
+		})
+	}
+}
+
+func TestQueueMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int
+		ok       bool
+		want     []string
+	}{
+		{"down", 0, 2, true, []string{"b", "c", "a", "d"}},
+		{"up", 3, 1, true, []string{"a", "d", "b", "c"}},
+		{"next", 1, 2, true, []string{"a", "c", "b", "d"}},
+		{"in place", 2, 2, true, []string{"a", "b", "c", "d"}},
+		{"from out of bounds", 4, 0, false, []string{"a", "b", "c", "d"}},
+		{"to out of bounds", 0, 4, false, []string{"a", "b", "c", "d"}},
+		{"negative", -1, 0, false, []string{"a", "b", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newQueue("a", "b", "c", "d")
+			if ok := q.Move(tt.from, tt.to); ok != tt.ok {
+				t.Errorf("moved %v, want %v", ok, tt.ok)
+			}
+			if got := ids(q.Upcoming()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("upcoming is %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueHistory(t *testing.T) {
+	source := &playlist.Item{Name: "likes"}
+	other := &playlist.Item{Name: "local"}
+
+	q := &Queue{}
+	q.PushHistory(Entry{})
+	q.PushHistory(Entry{Track: api.Track{Id: "a"}, Source: source, Index: 0})
+	// the same track played again is stored once
+	q.PushHistory(Entry{Track: api.Track{Id: "a"}, Source: source, Index: 0})
+	// the same track from another playlist or position is stored
+	q.PushHistory(Entry{Track: api.Track{Id: "a"}, Source: other, Index: 0})
+	q.PushHistory(Entry{Track: api.Track{Id: "a"}, Source: other, Index: 3})
+	q.PushHistory(entry("b"))
+
+	want := []string{"a", "a", "a", "b"}
+	if got := ids(q.History()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("history is %v, want %v", got, want)
+	}
+
+	e, ok := q.PopHistory()
+	if !ok || e.Track.Id != "b" {
+		t.Errorf("popped %q, %v, want \"b\"", e.Track.Id, ok)
+	}
+	e, ok = q.PopHistory()
+	if !ok || e.Source != other || e.Index != 3 {
+		t.Errorf("popped %+v, %v, want the latest entry of the other playlist", e, ok)
+	}
+	q.PopHistory()
+	q.PopHistory()
+	if _, ok := q.PopHistory(); ok {
+		t.Error("popped from the empty history")
+	}
+}
+
+func TestQueueHistoryLimit(t *testing.T) {
+	q := &Queue{}
+	for i := 0; i < _HISTORY_LIMIT+10; i++ {
+		q.PushHistory(entry(fmt.Sprint(i)))
+	}
+
+	history := q.History()
+	if len(history) != _HISTORY_LIMIT {
+		t.Fatalf("history length is %d, want %d", len(history), _HISTORY_LIMIT)
+	}
+	if history[0].Track.Id != "10" {
+		t.Errorf("the oldest entry is %q, want \"10\"", history[0].Track.Id)
+	}
+	if last, _ := q.PopHistory(); last.Track.Id != fmt.Sprint(_HISTORY_LIMIT+9) {
+		t.Errorf("the latest entry is %q, want %q", last.Track.Id, fmt.Sprint(_HISTORY_LIMIT+9))
+	}
+}
@@ -0,0 +1,36 @@
+package queue
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/dece2183/yamusic-tui/config"
+)
+
+type helpKeyMap struct {
+	CursorUp   key.Binding
+	CursorDown key.Binding
+	Play       key.Binding
+	MoveUp     key.Binding
+	MoveDown   key.Binding
+	Remove     key.Binding
+	Close      key.Binding
+}
+
+func (k helpKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.CursorUp, k.CursorDown, k.Play, k.MoveUp, k.MoveDown, k.Remove, k.Close}
+}
+
+func (k helpKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		k.ShortHelp(),
+	}
+}
+
+var helpMap = helpKeyMap{
+	CursorUp:   key.NewBinding(config.Current.Controls.CursorUp.Binding(), config.Current.Controls.CursorUp.Help("up")),
+	CursorDown: key.NewBinding(config.Current.Controls.CursorDown.Binding(), config.Current.Controls.CursorDown.Help("down")),
+	Play:       key.NewBinding(config.Current.Controls.Apply.Binding(), config.Current.Controls.Apply.Help("play")),
+	MoveUp:     key.NewBinding(config.Current.Controls.QueueMoveUp.Binding(), config.Current.Controls.QueueMoveUp.Help("move up")),
+	MoveDown:   key.NewBinding(config.Current.Controls.QueueMoveDown.Binding(), config.Current.Controls.QueueMoveDown.Help("move down")),
+	Remove:     key.NewBinding(config.Current.Controls.QueueRemove.Binding(), config.Current.Controls.QueueRemove.Help("remove")),
+	Close:      key.NewBinding(config.Current.Controls.Cancel.Binding(), config.Current.Controls.Cancel.Help("close")),
+}
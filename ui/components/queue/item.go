@@ -0,0 +1,19 @@
+package queue
+
+import "github.com/dece2183/yamusic-tui/ui/helpers"
+
+type Item struct {
+	Entry   Entry
+	Artists string
+}
+
+func NewItem(entry Entry) Item {
+	return Item{
+		Entry:   entry,
+		Artists: helpers.ArtistList(entry.Track.Artists),
+	}
+}
+
+func (i Item) FilterValue() string {
+	return i.Entry.Track.Title
+}
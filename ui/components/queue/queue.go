@@ -0,0 +1,125 @@
+package queue
+
+import (
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dece2183/yamusic-tui/config"
+	"github.com/dece2183/yamusic-tui/ui/model"
+	"github.com/dece2183/yamusic-tui/ui/style"
+)
+
+type Control uint
+
+const (
+	PLAY Control = iota
+	MOVE_UP
+	MOVE_DOWN
+	REMOVE
+	CLOSE
+)
+
+type Model struct {
+	list          list.Model
+	help          help.Model
+	width, height int
+
+	Title string
+}
+
+func New() *Model {
+	m := &Model{
+		help:  help.New(),
+		Title: "Queue",
+	}
+
+	controls := config.Current.Controls
+
+	m.list = list.New([]list.Item{}, ItemDelegate{}, 512, 512)
+	m.list.SetShowTitle(false)
+	m.list.SetShowStatusBar(false)
+	m.list.SetShowHelp(false)
+	m.list.DisableQuitKeybindings()
+	m.list.KeyMap = list.KeyMap{
+		CursorUp:   key.NewBinding(controls.CursorUp.Binding(), controls.CursorUp.Help("up")),
+		CursorDown: key.NewBinding(controls.CursorDown.Binding(), controls.CursorDown.Help("down")),
+	}
+
+	return m
+}
+
+func (m *Model) Init() tea.Cmd {
+	return nil
+}
+
+func (m *Model) View() string {
+	var content string
+	if len(m.list.Items()) == 0 {
+		content = style.TrackVersionStyle.Render("queue is empty")
+	} else {
+		content = m.list.View()
+	}
+
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		style.AccentTextStyle.MaxWidth(m.width).MarginBottom(1).Render(m.Title),
+		lipgloss.NewStyle().MaxWidth(m.width).Render(content),
+		style.DialogHelpStyle.MaxWidth(m.width).Render(m.help.View(helpMap)),
+	)
+}
+
+func (m *Model) Update(message tea.Msg) (*Model, tea.Cmd) {
+	var (
+		cmd  tea.Cmd
+		cmds []tea.Cmd
+	)
+
+	switch msg := message.(type) {
+	case tea.KeyMsg:
+		controls := config.Current.Controls
+		keypress := msg.String()
+
+		switch {
+		case controls.Apply.Contains(keypress):
+			cmds = append(cmds, model.Cmd(PLAY))
+		case controls.Cancel.Contains(keypress), controls.Queue.Contains(keypress):
+			cmds = append(cmds, model.Cmd(CLOSE))
+		case controls.QueueMoveUp.Contains(keypress):
+			cmds = append(cmds, model.Cmd(MOVE_UP))
+		case controls.QueueMoveDown.Contains(keypress):
+			cmds = append(cmds, model.Cmd(MOVE_DOWN))
+		case controls.QueueRemove.Contains(keypress):
+			cmds = append(cmds, model.Cmd(REMOVE))
+		default:
+			m.list, cmd = m.list.Update(msg)
+			cmds = append(cmds, cmd)
+		}
+	}
+
+	return m, tea.Batch(cmds...)
+}
+
+// SetEntries shows the queue entries keeping the cursor position.
+func (m *Model) SetEntries(entries []Entry) tea.Cmd {
+	items := make([]list.Item, len(entries))
+	for i := range entries {
+		items[i] = NewItem(entries[i])
+	}
+	return m.list.SetItems(items)
+}
+
+func (m *Model) Index() int {
+	return m.list.Index()
+}
+
+func (m *Model) Select(index int) {
+	m.list.Select(index)
+}
+
+func (m *Model) SetSize(w, h int) {
+	m.width = w
+	m.height = h
+	m.list.SetSize(m.width, m.height-4)
+}
@@ -0,0 +1,281 @@
+package tracker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/dece2183/yamusic-tui/stream"
+)
+
+// path of the ffmpeg that decodes AAC, the codec is supported only if it's found
+var ffmpegPath string
+
+func init() {
+	if path, err := exec.LookPath("ffmpeg"); err == nil {
+		ffmpegPath = path
+		decoders["aac"] = newAACDecoder
+	}
+}
+
+// aacDecoder decodes the AAC frames of the ADTS or MP4 stream by the ffmpeg process.
+// The process is started from the frame before the seek target and the PCM before the target is dropped.
+// The decoder keeps the stream position at the frame being played, the stream is done after the last one.
+type aacDecoder struct {
+	stream  *stream.BufferedStream
+	frames  aacFrames
+	process *aacProcess
+	// the frame the process is started from
+	frame int64
+	// the frame the stream position is at
+	streamFrame int64
+	// PCM bytes to drop before the position
+	skip int64
+	eof  bool
+	// position of the decoded PCM in bytes
+	pos int64
+}
+
+// aacProcess is the ffmpeg process fed with the ADTS frames
+type aacProcess struct {
+	cmd    *exec.Cmd
+	feed   *aacFeed
+	output *os.File
+	stderr bytes.Buffer
+
+	exited  chan struct{}
+	exitErr error
+	fed     chan struct{}
+	feedErr error
+	written int64
+}
+
+// countingWriter counts the bytes written to the writer
+type countingWriter struct {
+	io.Writer
+	n *int64
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	*w.n += int64(n)
+	return n, err
+}
+
+func newAACDecoder(s *stream.BufferedStream) (Decoder, error) {
+	frames, err := newAACFrames(s)
+	if err != nil {
+		return nil, err
+	}
+	return &aacDecoder{stream: s, frames: frames, streamFrame: -1}, nil
+}
+
+func (d *aacDecoder) Read(dest []byte) (n int, err error) {
+	if d.eof {
+		return 0, io.EOF
+	}
+	if d.process == nil {
+		if d.process, err = startAAC(d.stream, d.frames, d.frame); err != nil {
+			return 0, err
+		}
+	}
+
+	if d.skip > 0 {
+		skipped, err := io.CopyN(io.Discard, d.process.output, d.skip)
+		d.skip -= skipped
+		if err != nil {
+			return 0, d.finish(err)
+		}
+	}
+
+	dest = dest[:len(dest)/_PCM_FRAME_SIZE*_PCM_FRAME_SIZE]
+	n, err = d.process.output.Read(dest)
+	// the pipe can return the part of the PCM frame
+	if rest := n % _PCM_FRAME_SIZE; rest != 0 && err == nil {
+		var m int
+		m, err = io.ReadFull(d.process.output, dest[n:n+_PCM_FRAME_SIZE-rest])
+		n += m
+	}
+	n -= n % _PCM_FRAME_SIZE
+	d.pos += int64(n)
+
+	if err != nil {
+		if err = d.finish(err); err == io.EOF && n > 0 {
+			err = nil
+		}
+		return n, err
+	}
+
+	d.seekStream()
+	return n, nil
+}
+
+// seekStream moves the stream position to the frame being played.
+func (d *aacDecoder) seekStream() {
+	frame := d.pos / _PCM_FRAME_SIZE * int64(d.frames.sampleRate()) / (_SAMPLE_RATE * _AAC_FRAME_SAMPLES)
+	if frame == d.streamFrame {
+		return
+	}
+
+	d.streamFrame = frame
+	// the estimated offset must not reach the end before the last frame is played
+	d.stream.Seek(min(d.frames.offset(frame), d.stream.Length()-1), io.SeekStart)
+}
+
+// finish stops the process after the output error, the end of the output is the end of the track
+// if the frames are fed and decoded successfully.
+func (d *aacDecoder) finish(outputErr error) error {
+	p := d.process
+	d.process = nil
+	if outputErr != io.EOF && outputErr != io.ErrUnexpectedEOF {
+		p.stop()
+		return outputErr
+	}
+
+	p.wait()
+	// nothing is left after the position
+	if p.written == 0 {
+		return d.end()
+	}
+	if p.feedErr != nil {
+		return p.feedErr
+	}
+	if p.exitErr != nil {
+		message := strings.TrimSpace(p.stderr.String())
+		return fmt.Errorf("aac: ffmpeg: %w: %s", p.exitErr, message)
+	}
+	return d.end()
+}
+
+func (d *aacDecoder) end() error {
+	d.eof = true
+	d.stream.Seek(0, io.SeekEnd)
+	return io.EOF
+}
+
+// Seek moves to the PCM position in bytes.
+func (d *aacDecoder) Seek(offset int64, whence int) (int64, error) {
+	pos := offset
+	switch whence {
+	case io.SeekCurrent:
+		pos += d.pos
+	case io.SeekEnd:
+		return d.pos, errSeekFromEnd
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	pos -= pos % _PCM_FRAME_SIZE
+
+	if d.process != nil {
+		d.process.stop()
+		d.process = nil
+	}
+
+	rate := int64(d.frames.sampleRate())
+	sample := pos / _PCM_FRAME_SIZE
+	// the frame before the target fills the overlap of the decoder
+	frame := max(sample*rate/(_SAMPLE_RATE*_AAC_FRAME_SAMPLES)-1, 0)
+	if count := d.frames.count(); count > 0 && frame >= count {
+		frame = count
+	}
+
+	d.frame = frame
+	d.skip = (sample - frame*_AAC_FRAME_SAMPLES*_SAMPLE_RATE/rate) * _PCM_FRAME_SIZE
+	d.pos = pos
+	d.eof = false
+	d.streamFrame = -1
+	d.seekStream()
+	return d.pos, nil
+}
+
+func (d *aacDecoder) SampleRate() int {
+	return _SAMPLE_RATE
+}
+
+// startAAC starts the ffmpeg process that decodes the frames from the number.
+func startAAC(s *stream.BufferedStream, frames aacFrames, frame int64) (*aacProcess, error) {
+	inputReader, input, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	output, outputWriter, err := os.Pipe()
+	if err != nil {
+		inputReader.Close()
+		input.Close()
+		return nil, err
+	}
+
+	p := &aacProcess{
+		feed:   &aacFeed{stream: s},
+		output: output,
+		exited: make(chan struct{}),
+		fed:    make(chan struct{}),
+	}
+	p.cmd = exec.Command(ffmpegPath,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "aac", "-i", "pipe:0",
+		"-f", "s16le", "-ac", "2", "-ar", strconv.Itoa(_SAMPLE_RATE), "pipe:1",
+	)
+	p.cmd.Stdin = inputReader
+	p.cmd.Stdout = outputWriter
+	p.cmd.Stderr = &p.stderr
+
+	err = p.cmd.Start()
+	inputReader.Close()
+	outputWriter.Close()
+	if err != nil {
+		input.Close()
+		output.Close()
+		return nil, err
+	}
+
+	go func() {
+		p.exitErr = p.cmd.Wait()
+		close(p.exited)
+	}()
+
+	go func() {
+		w := bufio.NewWriter(countingWriter{input, &p.written})
+		err := frames.write(p.feed, frame, w)
+		if err == nil {
+			err = w.Flush()
+		}
+		input.Close()
+
+		p.feedErr = err
+		// the stream is closed, the frames are never fed to the end
+		if err == stream.ErrClosed {
+			p.cmd.Process.Kill()
+		}
+		close(p.fed)
+	}()
+
+	return p, nil
+}
+
+// wait waits for the process that closed its output and stops the feeding of the frames.
+func (p *aacProcess) wait() {
+	<-p.exited
+	p.feed.stop()
+	<-p.fed
+	p.output.Close()
+}
+
+// stop kills the process and waits for it and for the feeding of the frames.
+func (p *aacProcess) stop() {
+	p.feed.stop()
+	select {
+	case <-p.exited:
+	default:
+		p.cmd.Process.Kill()
+	}
+	<-p.exited
+	<-p.fed
+	p.output.Close()
+}
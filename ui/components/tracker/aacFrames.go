@@ -0,0 +1,722 @@
+package tracker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/dece2183/yamusic-tui/stream"
+)
+
+const (
+	// number of the samples of the AAC core in the frame
+	_AAC_FRAME_SAMPLES = 1024
+	_ADTS_HEADER_SIZE  = 7
+	// the ADTS sync is searched in this much data after the estimated frame offset
+	_ADTS_SYNC_LIMIT = 64 * 1024
+)
+
+var (
+	errAACContainer  = errors.New("aac: neither ADTS nor MP4 stream")
+	errMP4Fragmented = errors.New("aac: fragmented MP4 is not supported")
+	errMP4NoAudio    = errors.New("aac: MP4 has no AAC track")
+)
+
+var aacSampleRates = [...]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// aacFrames locates the AAC frames in the container and writes them in the ADTS format,
+// so the decoder gets the same stream for any container.
+type aacFrames interface {
+	// sampleRate returns the sample rate of the AAC core, the frame has _AAC_FRAME_SAMPLES of it
+	sampleRate() int
+	// count returns the number of the frames, 0 if it's unknown
+	count() int64
+	// offset returns the stream offset of the frame, it's estimated if the frame isn't found yet
+	offset(frame int64) int64
+	// write writes the ADTS frames from the number to the writer until the end of the stream
+	write(feed *aacFeed, frame int64, w io.Writer) error
+}
+
+// aacFeed opens the readers of the stream for the frames and interrupts them when it's stopped
+type aacFeed struct {
+	stream  *stream.BufferedStream
+	mux     sync.Mutex
+	reader  *stream.Reader
+	stopped bool
+}
+
+// open returns the reader of the stream from the offset, the previous one is closed.
+func (f *aacFeed) open(offset int64) (*stream.Reader, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.stopped {
+		return nil, stream.ErrClosed
+	}
+	if f.reader != nil {
+		f.reader.Close()
+	}
+	f.reader = f.stream.NewReader(offset)
+	return f.reader, nil
+}
+
+func (f *aacFeed) stop() {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.stopped = true
+	if f.reader != nil {
+		f.reader.Close()
+	}
+}
+
+// newAACFrames detects the container of the stream that follows the ID3v2 tag.
+func newAACFrames(s *stream.BufferedStream) (aacFrames, error) {
+	start, err := id3Size(s)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(s.NewReader(start), header); err != nil {
+		return nil, err
+	}
+
+	if _, ok := parseADTSHeader(header); ok {
+		return newADTSFrames(s, start)
+	}
+	if string(header[4:8]) == "ftyp" {
+		return newMP4Frames(s, start)
+	}
+	return nil, errAACContainer
+}
+
+// adtsHeader is the header of the ADTS frame
+type adtsHeader struct {
+	profile   int
+	rateIndex int
+	channels  int
+	// size of the frame with the header
+	size int
+}
+
+func parseADTSHeader(data []byte) (h adtsHeader, ok bool) {
+	if len(data) < _ADTS_HEADER_SIZE || data[0] != 0xff || data[1]&0xf6 != 0xf0 {
+		return h, false
+	}
+
+	h.profile = int(data[2] >> 6)
+	h.rateIndex = int(data[2] >> 2 & 0xf)
+	h.channels = int(data[2]&1)<<2 | int(data[3]>>6)
+	h.size = int(data[3]&3)<<11 | int(data[4])<<3 | int(data[5]>>5)
+
+	headerSize := _ADTS_HEADER_SIZE
+	// the header checksum is present
+	if data[1]&1 == 0 {
+		headerSize += 2
+	}
+	return h, h.rateIndex < len(aacSampleRates) && h.size > headerSize
+}
+
+// appendADTSHeader appends the header of the ADTS frame with the raw data of the size.
+func appendADTSHeader(dest []byte, profile, rateIndex, channels, size int) []byte {
+	size += _ADTS_HEADER_SIZE
+	return append(dest,
+		0xff,
+		0xf1,
+		byte(profile<<6|rateIndex<<2|channels>>2),
+		byte(channels&3<<6|size>>11),
+		byte(size>>3),
+		byte(size&7<<5|0x1f),
+		0xfc,
+	)
+}
+
+// adtsFrames are the frames of the ADTS stream. Their offsets are found by the headers of the downloaded
+// and the written frames, the offsets of the frames after them are estimated by the average frame size,
+// so the seek beyond the downloaded data is approximate.
+type adtsFrames struct {
+	stream *stream.BufferedStream
+	rate   int
+	mux    sync.Mutex
+	// offsets of the frames from the first one without the gaps
+	offsets []int64
+}
+
+func newADTSFrames(s *stream.BufferedStream, start int64) (*adtsFrames, error) {
+	header := make([]byte, _ADTS_HEADER_SIZE)
+	if _, err := io.ReadFull(s.NewReader(start), header); err != nil {
+		return nil, err
+	}
+	h, _ := parseADTSHeader(header)
+	// the size of the first frame is the estimation of the average one until more frames are indexed
+	offsets := []int64{start, start + int64(h.size)}
+	return &adtsFrames{stream: s, rate: aacSampleRates[h.rateIndex], offsets: offsets}, nil
+}
+
+func (a *adtsFrames) sampleRate() int {
+	return a.rate
+}
+
+func (a *adtsFrames) count() int64 {
+	return 0
+}
+
+func (a *adtsFrames) offset(frame int64) int64 {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	a.indexBuffered(frame)
+	indexed := int64(len(a.offsets))
+	if frame < indexed {
+		return a.offsets[frame]
+	}
+
+	last := a.offsets[indexed-1]
+	averageSize := float64(last-a.offsets[0]) / float64(indexed-1)
+	return min(last+int64(averageSize*float64(frame-indexed+1)), a.stream.Length())
+}
+
+func (a *adtsFrames) write(feed *aacFeed, frame int64, w io.Writer) error {
+	offset := a.offset(frame)
+	a.mux.Lock()
+	indexed := frame < int64(len(a.offsets))
+	a.mux.Unlock()
+
+	reader, err := feed.open(offset)
+	if err != nil {
+		return err
+	}
+	frames := bufio.NewReaderSize(reader, _ADTS_SYNC_LIMIT)
+
+	if !indexed {
+		// the estimated offset is in the middle of the frame
+		skipped, err := syncADTS(frames)
+		if err != nil {
+			return err
+		}
+		offset += int64(skipped)
+	}
+
+	for ; ; frame++ {
+		header, err := frames.Peek(_ADTS_HEADER_SIZE)
+		if err == io.EOF || err == io.ErrUnexpectedEOF && len(header) < _ADTS_HEADER_SIZE {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		h, ok := parseADTSHeader(header)
+		if !ok {
+			// the garbage after the last frame
+			return nil
+		}
+		if indexed {
+			a.index(frame, offset)
+		}
+
+		if _, err := io.CopyN(w, frames, int64(h.size)); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		offset += int64(h.size)
+	}
+}
+
+// indexBuffered indexes the frames up to the number by the headers of the downloaded data.
+func (a *adtsFrames) indexBuffered(frame int64) {
+	header := make([]byte, _ADTS_HEADER_SIZE)
+	for int64(len(a.offsets)) <= frame {
+		last := a.offsets[len(a.offsets)-1]
+		if _, err := a.stream.ReadAt(header, last); err != nil {
+			return
+		}
+		h, ok := parseADTSHeader(header)
+		if !ok {
+			return
+		}
+		a.offsets = append(a.offsets, last+int64(h.size))
+	}
+}
+
+// index keeps the offset of the frame if the frames before it are indexed.
+func (a *adtsFrames) index(frame, offset int64) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	if frame == int64(len(a.offsets)) {
+		a.offsets = append(a.offsets, offset)
+	}
+}
+
+// syncADTS skips the data before the frame which header is followed by the next one.
+func syncADTS(frames *bufio.Reader) (int, error) {
+	for skipped := 0; skipped < _ADTS_SYNC_LIMIT; skipped++ {
+		header, err := frames.Peek(_ADTS_HEADER_SIZE)
+		if err != nil {
+			return skipped, err
+		}
+
+		if h, ok := parseADTSHeader(header); ok {
+			data, err := frames.Peek(h.size + _ADTS_HEADER_SIZE)
+			if _, next := parseADTSHeader(data[min(h.size, len(data)):]); next || err != nil && len(data) < h.size+_ADTS_HEADER_SIZE {
+				return skipped, nil
+			}
+		}
+		frames.Discard(1)
+	}
+	return _ADTS_SYNC_LIMIT, errors.New("aac: ADTS sync is not found")
+}
+
+// mp4Frame is the offset and the size of the AAC frame in the MP4 stream
+type mp4Frame struct {
+	offset int64
+	size   int
+}
+
+// mp4Frames are the frames of the AAC track of the MP4 stream located by its sample table.
+type mp4Frames struct {
+	rate      int
+	profile   int
+	rateIndex int
+	channels  int
+	frames    []mp4Frame
+	end       int64
+}
+
+// mp4Box is the box of the MP4 stream or its child box
+type mp4Box struct {
+	kind string
+	data []byte
+}
+
+// readMP4Box reads the header of the box at the offset of the stream, the size is up to the end of the stream if it's 0.
+func readMP4Box(s *stream.BufferedStream, offset int64) (kind string, headerSize, size int64, err error) {
+	header := make([]byte, 16)
+	n, err := io.ReadFull(s.NewReader(offset), header[:min(16, s.Length()-offset)])
+	if n < 8 {
+		return "", 0, 0, io.ErrUnexpectedEOF
+	}
+
+	kind = string(header[4:8])
+	size = int64(binary.BigEndian.Uint32(header))
+	headerSize = 8
+	switch size {
+	case 0:
+		size = s.Length() - offset
+	case 1:
+		if n < 16 {
+			return "", 0, 0, io.ErrUnexpectedEOF
+		}
+		size = int64(binary.BigEndian.Uint64(header[8:]))
+		headerSize = 16
+	}
+	if size < headerSize {
+		return "", 0, 0, fmt.Errorf("aac: invalid MP4 box '%s' size %d", kind, size)
+	}
+	return kind, headerSize, size, nil
+}
+
+func newMP4Frames(s *stream.BufferedStream, start int64) (*mp4Frames, error) {
+	// the top level boxes are walked by their headers, so the moov box at the end is read without the media data
+	var moov []byte
+	for offset := start; offset < s.Length() && moov == nil; {
+		kind, headerSize, size, err := readMP4Box(s, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case "moov":
+			moov = make([]byte, size-headerSize)
+			if _, err := io.ReadFull(s.NewReader(offset+headerSize), moov); err != nil {
+				return nil, err
+			}
+		case "moof":
+			return nil, errMP4Fragmented
+		}
+		offset += size
+	}
+	if moov == nil {
+		return nil, errMP4NoAudio
+	}
+
+	for _, box := range mp4Children(moov) {
+		switch box.kind {
+		case "mvex":
+			return nil, errMP4Fragmented
+		case "trak":
+			m, err := readMP4Track(box.data, start)
+			if err == errMP4NoAudio {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			m.end = s.Length()
+			return m, nil
+		}
+	}
+	return nil, errMP4NoAudio
+}
+
+// mp4Children splits the box data into the child boxes, the broken tail is skipped.
+func mp4Children(data []byte) (boxes []mp4Box) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data))
+		headerSize := uint64(8)
+		if size == 1 && len(data) >= 16 {
+			size = binary.BigEndian.Uint64(data[8:])
+			headerSize = 16
+		} else if size == 0 {
+			size = uint64(len(data))
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return
+		}
+		boxes = append(boxes, mp4Box{kind: string(data[4:8]), data: data[headerSize:size]})
+		data = data[size:]
+	}
+	return
+}
+
+// mp4Child returns the data of the box found by the path of the child box types.
+func mp4Child(data []byte, path ...string) ([]byte, bool) {
+	for _, kind := range path {
+		var found bool
+		for _, box := range mp4Children(data) {
+			if box.kind == kind {
+				data, found = box.data, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// readMP4Track reads the AAC config and the sample table of the sound track.
+// The offsets of the MP4 data are counted from the start of the MP4 stream after the ID3v2 tag.
+func readMP4Track(trak []byte, start int64) (*mp4Frames, error) {
+	handler, ok := mp4Child(trak, "mdia", "hdlr")
+	if !ok || len(handler) < 12 || string(handler[8:12]) != "soun" {
+		return nil, errMP4NoAudio
+	}
+	stbl, ok := mp4Child(trak, "mdia", "minf", "stbl")
+	if !ok {
+		return nil, errMP4NoAudio
+	}
+	stsd, ok := mp4Child(stbl, "stsd")
+	if !ok || len(stsd) < 8 {
+		return nil, errMP4NoAudio
+	}
+
+	m := &mp4Frames{}
+	entries := mp4Children(stsd[8:])
+	if len(entries) == 0 || entries[0].kind != "mp4a" {
+		return nil, errMP4NoAudio
+	}
+	config, err := readESDS(entries[0].data)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.readAudioConfig(config); err != nil {
+		return nil, err
+	}
+
+	sizes, err := readSampleSizes(stbl)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := readChunkOffsets(stbl)
+	if err != nil {
+		return nil, err
+	}
+	stsc, ok := mp4Child(stbl, "stsc")
+	if !ok || len(stsc) < 8 {
+		return nil, errors.New("aac: MP4 sample to chunk table is missing")
+	}
+
+	// the samples of the chunk follow each other, the chunks are assigned by the runs of the sample to chunk table
+	count := int(binary.BigEndian.Uint32(stsc[4:]))
+	table := stsc[8:]
+	m.frames = make([]mp4Frame, 0, len(sizes))
+	for i := 0; i < count && len(table) >= 12*(i+1); i++ {
+		first := int(binary.BigEndian.Uint32(table[12*i:])) - 1
+		perChunk := int(binary.BigEndian.Uint32(table[12*i+4:]))
+		last := len(chunks)
+		if i+1 < count && len(table) >= 12*(i+2) {
+			last = int(binary.BigEndian.Uint32(table[12*(i+1):])) - 1
+		}
+
+		for chunk := max(first, 0); chunk < min(last, len(chunks)); chunk++ {
+			offset := start + chunks[chunk]
+			for j := 0; j < perChunk && len(m.frames) < len(sizes); j++ {
+				size := sizes[len(m.frames)]
+				m.frames = append(m.frames, mp4Frame{offset: offset, size: size})
+				offset += int64(size)
+			}
+		}
+	}
+	if len(m.frames) == 0 {
+		return nil, errMP4NoAudio
+	}
+	return m, nil
+}
+
+// readESDS returns the AAC audio specific config of the mp4a sample entry.
+func readESDS(entry []byte) ([]byte, error) {
+	// the fixed part of the sound sample entry depends on its version
+	const entrySize = 28
+	if len(entry) < entrySize {
+		return nil, errMP4NoAudio
+	}
+	size := entrySize
+	switch binary.BigEndian.Uint16(entry[8:]) {
+	case 1:
+		size += 16
+	case 2:
+		size += 36
+	}
+	if len(entry) < size {
+		return nil, errMP4NoAudio
+	}
+
+	esds, ok := mp4Child(entry[size:], "esds")
+	if !ok || len(esds) < 4 {
+		return nil, errMP4NoAudio
+	}
+
+	// ES_Descriptor > DecoderConfigDescriptor > DecoderSpecificInfo
+	data := esds[4:]
+	for _, tag := range []byte{0x03, 0x04, 0x05} {
+		var length int
+		var ok bool
+		data, length, ok = readDescriptor(data, tag)
+		if !ok {
+			return nil, errMP4NoAudio
+		}
+		data = data[:length]
+
+		switch tag {
+		case 0x03:
+			if len(data) < 3 {
+				return nil, errMP4NoAudio
+			}
+			flags := data[2]
+			data = data[3:]
+			if flags&0x80 != 0 {
+				data = data[min(2, len(data)):]
+			}
+			if flags&0x40 != 0 && len(data) > 0 {
+				data = data[min(int(data[0])+1, len(data)):]
+			}
+			if flags&0x20 != 0 {
+				data = data[min(2, len(data)):]
+			}
+		case 0x04:
+			// the object type, the stream type, the buffer size and the bitrates
+			if len(data) < 13 || data[0] != 0x40 {
+				return nil, errMP4NoAudio
+			}
+			data = data[13:]
+		}
+	}
+	return data, nil
+}
+
+// readDescriptor returns the payload of the MPEG-4 descriptor of the tag and its length.
+func readDescriptor(data []byte, tag byte) ([]byte, int, bool) {
+	if len(data) < 2 || data[0] != tag {
+		return nil, 0, false
+	}
+
+	var length int
+	i := 1
+	for ; i < len(data) && i <= 4; i++ {
+		length = length<<7 | int(data[i]&0x7f)
+		if data[i]&0x80 == 0 {
+			break
+		}
+	}
+	i++
+	if i > len(data) || length > len(data)-i {
+		return nil, 0, false
+	}
+	return data[i:], length, true
+}
+
+// readAudioConfig reads the AAC core profile, sample rate and channels of the audio specific config.
+// The HE-AAC config is signaled explicitly or implicitly, its core is decoded with the SBR by the decoder either way.
+func (m *mp4Frames) readAudioConfig(config []byte) error {
+	r := newFLACReader(bytes.NewReader(config), 0)
+	readObjectType := func() (int, error) {
+		objectType, err := r.read(5)
+		if objectType == 31 {
+			var ext uint64
+			ext, err = r.read(6)
+			objectType = 32 + ext
+		}
+		return int(objectType), err
+	}
+	readRate := func() (int, error) {
+		index, err := r.read(4)
+		if err != nil {
+			return 0, err
+		}
+		if index != 0xf {
+			return int(index), nil
+		}
+		rate, err := r.read(24)
+		for i, known := range aacSampleRates {
+			if int(rate) == known {
+				return i, err
+			}
+		}
+		return 0, fmt.Errorf("aac: sample rate %d can't be framed", rate)
+	}
+
+	objectType, err := readObjectType()
+	if err != nil {
+		return err
+	}
+	m.rateIndex, err = readRate()
+	if err != nil {
+		return err
+	}
+	channels, err := r.read(4)
+	if err != nil {
+		return err
+	}
+	m.channels = int(channels)
+
+	// the explicit SBR or PS signaling is followed by the extension sample rate and the core object type
+	if objectType == 5 || objectType == 29 {
+		if _, err := readRate(); err != nil {
+			return err
+		}
+		if objectType, err = readObjectType(); err != nil {
+			return err
+		}
+	}
+
+	if objectType < 1 || objectType > 4 {
+		return fmt.Errorf("aac: audio object type %d is not supported", objectType)
+	}
+	if m.channels == 0 || m.channels > 7 {
+		return fmt.Errorf("aac: channel configuration %d is not supported", m.channels)
+	}
+	m.profile = objectType - 1
+	m.rate = aacSampleRates[m.rateIndex]
+	return nil
+}
+
+// readSampleSizes reads the sizes of the frames from the stsz box.
+func readSampleSizes(stbl []byte) ([]int, error) {
+	stsz, ok := mp4Child(stbl, "stsz")
+	if !ok || len(stsz) < 12 {
+		return nil, errors.New("aac: MP4 sample sizes are missing")
+	}
+
+	size := int(binary.BigEndian.Uint32(stsz[4:]))
+	count := int(binary.BigEndian.Uint32(stsz[8:]))
+	if size == 0 && len(stsz[12:]) < 4*count {
+		return nil, errors.New("aac: MP4 sample sizes are truncated")
+	}
+
+	sizes := make([]int, count)
+	for i := range sizes {
+		if size != 0 {
+			sizes[i] = size
+		} else {
+			sizes[i] = int(binary.BigEndian.Uint32(stsz[12+4*i:]))
+		}
+	}
+	return sizes, nil
+}
+
+// readChunkOffsets reads the offsets of the chunks from the stco or co64 box.
+func readChunkOffsets(stbl []byte) ([]int64, error) {
+	entrySize := 4
+	table, ok := mp4Child(stbl, "stco")
+	if !ok {
+		entrySize = 8
+		table, ok = mp4Child(stbl, "co64")
+	}
+	if !ok || len(table) < 8 {
+		return nil, errors.New("aac: MP4 chunk offsets are missing")
+	}
+
+	count := int(binary.BigEndian.Uint32(table[4:]))
+	if len(table[8:]) < entrySize*count {
+		return nil, errors.New("aac: MP4 chunk offsets are truncated")
+	}
+
+	offsets := make([]int64, count)
+	for i := range offsets {
+		if entrySize == 4 {
+			offsets[i] = int64(binary.BigEndian.Uint32(table[8+4*i:]))
+		} else {
+			offsets[i] = int64(binary.BigEndian.Uint64(table[8+8*i:]))
+		}
+	}
+	return offsets, nil
+}
+
+func (m *mp4Frames) sampleRate() int {
+	return m.rate
+}
+
+func (m *mp4Frames) count() int64 {
+	return int64(len(m.frames))
+}
+
+func (m *mp4Frames) offset(frame int64) int64 {
+	if frame >= int64(len(m.frames)) {
+		return m.end
+	}
+	return m.frames[frame].offset
+}
+
+func (m *mp4Frames) write(feed *aacFeed, frame int64, w io.Writer) error {
+	var (
+		reader *stream.Reader
+		next   int64 = -1
+		buf    []byte
+	)
+
+	for ; frame < int64(len(m.frames)); frame++ {
+		f := m.frames[frame]
+		if f.offset != next {
+			// the frames of the other tracks are between the chunks
+			var err error
+			if reader, err = feed.open(f.offset); err != nil {
+				return err
+			}
+		}
+
+		buf = appendADTSHeader(buf[:0], m.profile, m.rateIndex, m.channels, f.size)
+		buf = append(buf, make([]byte, f.size)...)
+		if _, err := io.ReadFull(reader, buf[_ADTS_HEADER_SIZE:]); err != nil {
+			// the frames of the sample table are beyond the end of the stream
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		next = f.offset + int64(f.size)
+	}
+	return nil
+}
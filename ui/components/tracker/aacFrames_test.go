@@ -0,0 +1,314 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/dece2183/yamusic-tui/stream"
+)
+
+const testAACFrames = 1000
+
+// testAACPayload returns the raw data of the frame without the ADTS sync bytes.
+func testAACPayload(frame int) []byte {
+	payload := make([]byte, 100+frame*37%150)
+	for i := range payload {
+		payload[i] = byte((frame + i) % 200)
+	}
+	return payload
+}
+
+// newTestADTS returns the ADTS stream of the LC profile 44100 Hz stereo frames and their offsets.
+func newTestADTS(id3Size int) ([]byte, []int) {
+	var data []byte
+	if id3Size > 0 {
+		data = append(data, 'I', 'D', '3', 4, 0, 0, 0, 0, byte(id3Size>>7&0x7f), byte(id3Size&0x7f))
+		data = append(data, make([]byte, id3Size)...)
+	}
+
+	offsets := make([]int, testAACFrames)
+	for i := range offsets {
+		offsets[i] = len(data)
+		payload := testAACPayload(i)
+		data = appendADTSHeader(data, 1, 4, 2, len(payload))
+		data = append(data, payload...)
+	}
+	return data, offsets
+}
+
+func testMP4Box(kind string, content ...[]byte) []byte {
+	data := binary.BigEndian.AppendUint32(nil, 0)
+	data = append(data, kind...)
+	for _, c := range content {
+		data = append(data, c...)
+	}
+	binary.BigEndian.PutUint32(data, uint32(len(data)))
+	return data
+}
+
+func testMP4Table(entries ...uint32) []byte {
+	data := make([]byte, 4)
+	for _, e := range entries {
+		data = binary.BigEndian.AppendUint32(data, e)
+	}
+	return data
+}
+
+// newTestMP4 returns the MP4 stream with the video track and the HE-AAC track of the test frames,
+// the frames are interleaved with the video chunks and the moov box is at the end.
+func newTestMP4(id3Size int) []byte {
+	var prefix []byte
+	if id3Size > 0 {
+		prefix = append(prefix, 'I', 'D', '3', 4, 0, 0, 0, 0, byte(id3Size>>7&0x7f), byte(id3Size&0x7f))
+		prefix = append(prefix, make([]byte, id3Size)...)
+	}
+
+	ftyp := testMP4Box("ftyp", []byte("M4A \x00\x00\x00\x00isom"))
+
+	// the audio chunks of 7 frames are separated by the video data
+	var (
+		mdat    []byte
+		sizes   []uint32
+		offsets []uint32
+	)
+	mdatStart := len(ftyp) + 8
+	for frame := 0; frame < testAACFrames; frame++ {
+		if frame%7 == 0 {
+			mdat = append(mdat, bytes.Repeat([]byte{0xee}, 50)...)
+			offsets = append(offsets, uint32(mdatStart+len(mdat)))
+		}
+		payload := testAACPayload(frame)
+		sizes = append(sizes, uint32(len(payload)))
+		mdat = append(mdat, payload...)
+	}
+
+	stsz := testMP4Table(append([]uint32{0, uint32(len(sizes))}, sizes...)...)
+	// the first chunk has 7 frames like the rest, the last one has the remainder
+	lastChunk := uint32(len(offsets))
+	stsc := testMP4Table(3, 1, 7, 1, 2, 7, 1, lastChunk, testAACFrames%7, 1)
+	stco := testMP4Table(append([]uint32{uint32(len(offsets))}, offsets...)...)
+
+	// HE-AAC signaled explicitly: SBR object type, 22050 Hz core rate index 7, stereo, 44100 Hz extension rate index 4, LC core
+	config := []byte{0x2b, 0x92, 0x08, 0x00}
+	decoderConfig := append([]byte{0x40, 0x15}, make([]byte, 11)...)
+	decoderConfig = append(decoderConfig, 0x05, byte(len(config)))
+	decoderConfig = append(decoderConfig, config...)
+	es := append([]byte{0, 1, 0}, 0x04, byte(len(decoderConfig)))
+	es = append(es, decoderConfig...)
+	esds := testMP4Box("esds", []byte{0, 0, 0, 0, 0x03, 0x80, 0x80, 0x80, byte(len(es))}, es)
+
+	entry := make([]byte, 28)
+	binary.BigEndian.PutUint16(entry[6:], 1)
+	mp4a := testMP4Box("mp4a", entry, esds)
+	stsd := testMP4Box("stsd", testMP4Table(1), mp4a)
+
+	stbl := testMP4Box("stbl", stsd, testMP4Box("stts", testMP4Table(0)), testMP4Box("stsc", stsc), testMP4Box("stsz", stsz), testMP4Box("stco", stco))
+	audio := testMP4Box("trak",
+		testMP4Box("tkhd", make([]byte, 84)),
+		testMP4Box("mdia",
+			testMP4Box("mdhd", make([]byte, 24)),
+			testMP4Box("hdlr", make([]byte, 8), []byte("soun"), make([]byte, 13)),
+			testMP4Box("minf", testMP4Box("smhd", make([]byte, 8)), stbl),
+		),
+	)
+	video := testMP4Box("trak",
+		testMP4Box("mdia", testMP4Box("hdlr", make([]byte, 8), []byte("vide"), make([]byte, 13))),
+	)
+	moov := testMP4Box("moov", testMP4Box("mvhd", make([]byte, 100)), video, audio)
+
+	data := append(prefix, ftyp...)
+	data = append(data, testMP4Box("mdat", mdat)...)
+	return append(data, moov...)
+}
+
+// readADTS splits the written ADTS stream into the headers and the payloads.
+func readADTS(t *testing.T, data []byte) (headers []adtsHeader, payloads [][]byte) {
+	for len(data) > 0 {
+		h, ok := parseADTSHeader(data)
+		if !ok || h.size > len(data) {
+			t.Fatalf("invalid ADTS frame %d", len(headers))
+		}
+		headers = append(headers, h)
+		payloads = append(payloads, data[_ADTS_HEADER_SIZE:h.size])
+		data = data[h.size:]
+	}
+	return
+}
+
+func TestADTSFrames(t *testing.T) {
+	const downloaded = 64 * 1024
+	data, offsets := newTestADTS(300)
+	// the stream hangs after the downloaded part, so the frames after it aren't indexed by their headers
+	hang := make(chan struct{})
+	source := io.MultiReader(bytes.NewReader(data[:downloaded]), hangingReader(hang))
+	s := stream.NewBufferedStream(io.NopCloser(source), int64(len(data)))
+	t.Cleanup(func() {
+		close(hang)
+		s.Close()
+	})
+
+	frames, err := newAACFrames(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := frames.(*adtsFrames); !ok {
+		t.Fatalf("ADTS stream is detected as %T", frames)
+	}
+	if frames.sampleRate() != 44100 || frames.count() != 0 {
+		t.Errorf("sample rate is %d, count is %d", frames.sampleRate(), frames.count())
+	}
+
+	for !s.IsBufferedAhead(downloaded) {
+		time.Sleep(time.Millisecond)
+	}
+
+	last := 0
+	for offsets[last+1]+_ADTS_HEADER_SIZE <= downloaded {
+		last++
+	}
+	for _, frame := range []int{0, 1, last / 2, last} {
+		if offset := frames.offset(int64(frame)); offset != int64(offsets[frame]) {
+			t.Errorf("downloaded frame %d offset is %d, want %d", frame, offset, offsets[frame])
+		}
+	}
+	if offset := frames.offset(testAACFrames / 2); offset <= downloaded || offset >= int64(len(data)) {
+		t.Errorf("estimated frame %d offset %d is out of the not downloaded frames", testAACFrames/2, offset)
+	}
+}
+
+func TestADTSFramesWrite(t *testing.T) {
+	data, offsets := newTestADTS(0)
+	s := newTestFLACStream(t, data)
+
+	frames, err := newAACFrames(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(frame int64) []byte {
+		var buf bytes.Buffer
+		if err := frames.write(&aacFeed{stream: s}, frame, &buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	// the estimated offset is synced to the frame
+	written := write(testAACFrames / 2)
+	first := len(offsets) - len(readADTSFrames(t, written))
+	if first <= 0 || !bytes.Equal(written, data[offsets[first]:]) {
+		t.Errorf("writing from the frame %d starts from the middle of the frame", testAACFrames/2)
+	}
+
+	if !bytes.Equal(write(0), data) {
+		t.Error("written frames differ from the stream")
+	}
+	for _, frame := range []int64{0, 50, testAACFrames - 1} {
+		if offset := frames.offset(frame); offset != int64(offsets[frame]) {
+			t.Errorf("indexed frame %d offset is %d, want %d", frame, offset, offsets[frame])
+		}
+	}
+	if !bytes.Equal(write(120), data[offsets[120]:]) {
+		t.Error("written frames from the indexed frame 120 differ from the stream")
+	}
+}
+
+// hangingReader blocks until the channel is closed
+type hangingReader chan struct{}
+
+func (r hangingReader) Read([]byte) (int, error) {
+	<-r
+	return 0, io.ErrClosedPipe
+}
+
+func readADTSFrames(t *testing.T, data []byte) [][]byte {
+	_, payloads := readADTS(t, data)
+	return payloads
+}
+
+func TestMP4Frames(t *testing.T) {
+	s := newTestFLACStream(t, newTestMP4(300))
+
+	frames, err := newAACFrames(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := frames.(*mp4Frames); !ok {
+		t.Fatalf("MP4 stream is detected as %T", frames)
+	}
+	if frames.sampleRate() != 22050 || frames.count() != testAACFrames {
+		t.Errorf("sample rate is %d, count is %d", frames.sampleRate(), frames.count())
+	}
+
+	for _, from := range []int64{0, 6, 7, 100, testAACFrames - 1} {
+		var buf bytes.Buffer
+		if err := frames.write(&aacFeed{stream: s}, from, &buf); err != nil {
+			t.Fatal(err)
+		}
+
+		headers, payloads := readADTS(t, buf.Bytes())
+		if int64(len(payloads)) != testAACFrames-from {
+			t.Fatalf("%d frames written from %d, want %d", len(payloads), from, testAACFrames-from)
+		}
+		for i, payload := range payloads {
+			h := headers[i]
+			if h.profile != 1 || h.rateIndex != 7 || h.channels != 2 {
+				t.Fatalf("frame header is %+v, want LC 22050 Hz stereo", h)
+			}
+			if !bytes.Equal(payload, testAACPayload(int(from)+i)) {
+				t.Fatalf("frame %d written from %d differs from the stream", int(from)+i, from)
+			}
+		}
+	}
+}
+
+func TestAACFramesRejectsOtherStreams(t *testing.T) {
+	if _, err := newAACFrames(newTestFLACStream(t, newTestMP3(0))); err != errAACContainer {
+		t.Errorf("detecting MP3 returned %v, want %v", err, errAACContainer)
+	}
+}
+
+func TestAACDecoder(t *testing.T) {
+	if ffmpegPath == "" {
+		t.Skip("ffmpeg is not found")
+	}
+
+	// 2 seconds of the sine
+	cmd := exec.Command(ffmpegPath, "-hide_banner", "-loglevel", "error", "-f", "lavfi", "-i", "sine=frequency=440:duration=2",
+		"-ac", "2", "-ar", "44100", "-c:a", "aac", "-f", "adts", "pipe:1")
+	data, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const total = 2 * _SAMPLE_RATE * _PCM_FRAME_SIZE
+	// the decoded length differs by the priming and the padding of the encoder
+	const tolerance = 3 * _AAC_FRAME_SAMPLES * _PCM_FRAME_SIZE
+
+	for _, target := range []int64{0, total / 2, total + 1000} {
+		s := newTestFLACStream(t, data)
+		d, err := newAACDecoder(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pos, err := d.Seek(target, io.SeekStart)
+		if err != nil || pos != target {
+			t.Fatalf("seeked to %d, %v; want %d", pos, err, target)
+		}
+
+		pcm, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := max(total-target, 0); int64(len(pcm)) < want-tolerance || int64(len(pcm)) > want+tolerance {
+			t.Errorf("%d bytes decoded from %d, want about %d", len(pcm), target, want)
+		}
+		if !s.IsDone() {
+			t.Errorf("the stream isn't done after decoding from %d", target)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/config"
+)
+
+// size of the 16-bit stereo PCM frame produced by the decoder
+const _PCM_FRAME_SIZE = 4
+
+func crossfadeDuration() time.Duration {
+	return time.Duration(config.Current.CrossfadeMs) * time.Millisecond
+}
+
+// fadePoints are the track positions in seconds where its fade-in and fade-out start and stop
+type fadePoints struct {
+	inStart, inStop   float64
+	outStart, outStop float64
+}
+
+// trackFade returns the fade points provided by the server,
+// or the ones calculated from the crossfade duration if the server has none.
+func trackFade(track *api.Track, crossfade time.Duration) fadePoints {
+	fade := track.Fade
+	if fade.OutStop > 0 && fade.OutStart < fade.OutStop {
+		return fadePoints{
+			inStart:  float64(fade.InStart),
+			inStop:   float64(fade.InStop),
+			outStart: float64(fade.OutStart),
+			outStop:  float64(fade.OutStop),
+		}
+	}
+
+	duration := float64(track.DurationMs) / 1000
+	length := math.Min(crossfade.Seconds(), duration/2)
+	return fadePoints{
+		inStart:  0,
+		inStop:   length,
+		outStart: duration - length,
+		outStop:  duration,
+	}
+}
+
+func (f fadePoints) inGain(t float64) float64 {
+	switch {
+	case t >= f.inStop:
+		return 1
+	case t <= f.inStart:
+		return 0
+	default:
+		return (t - f.inStart) / (f.inStop - f.inStart)
+	}
+}
+
+func (f fadePoints) outGain(t float64) float64 {
+	switch {
+	case t <= f.outStart:
+		return 1
+	case t >= f.outStop:
+		return 0
+	default:
+		return 1 - (t-f.outStart)/(f.outStop-f.outStart)
+	}
+}
+
+// mixPCM applies the gain to the outgoing PCM and adds the incoming one to it.
+// The gain functions receive the offset of the frame in seconds.
+func mixPCM(out, in []byte, sampleRate int, outGain, inGain func(offset float64) float64) {
+	for i := 0; i+_PCM_FRAME_SIZE <= len(out); i += _PCM_FRAME_SIZE {
+		offset := float64(i/_PCM_FRAME_SIZE) / float64(sampleRate)
+		gOut := outGain(offset)
+		var gIn float64
+		if i+_PCM_FRAME_SIZE <= len(in) {
+			gIn = inGain(offset)
+		}
+
+		for ch := i; ch < i+_PCM_FRAME_SIZE; ch += 2 {
+			sample := float64(int16(binary.LittleEndian.Uint16(out[ch:]))) * gOut
+			if gIn > 0 {
+				sample += float64(int16(binary.LittleEndian.Uint16(in[ch:]))) * gIn
+			}
+			sample = math.Max(math.MinInt16, math.Min(math.MaxInt16, sample))
+			binary.LittleEndian.PutUint16(out[ch:], uint16(int16(sample)))
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dece2183/yamusic-tui/stream"
+)
+
+const _ID3_HEADER_SIZE = 10
+
+var errSeekFromEnd = errors.New("seeking from the end is not supported")
+
+// Decoder produces the 16-bit stereo PCM from the encoded track stream.
+// It seeks by the position of the PCM in bytes.
+type Decoder interface {
+	io.ReadSeeker
+	SampleRate() int
+}
+
+type decoderConstructor func(s *stream.BufferedStream) (Decoder, error)
+
+// Decoders of the codecs from api.TrackDownloadInfo
+var decoders = map[string]decoderConstructor{
+	"mp3":  newMP3Decoder,
+	"flac": newFLACDecoder,
+}
+
+// SupportsCodec reports whether the tracks encoded with the codec can be played.
+func SupportsCodec(codec string) bool {
+	_, ok := decoders[codec]
+	return ok
+}
+
+// newDecoder creates the decoder of the codec, its PCM is resampled to the sample rate of the player if it differs.
+func newDecoder(codec string, s *stream.BufferedStream) (Decoder, error) {
+	constructor, ok := decoders[codec]
+	if !ok {
+		return nil, fmt.Errorf("unsupported codec '%s'", codec)
+	}
+
+	decoder, err := constructor(s)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.SampleRate() != _SAMPLE_RATE {
+		decoder = newResampler(decoder, _SAMPLE_RATE)
+	}
+	return decoder, nil
+}
+
+// id3Size returns the size of the ID3v2 tag at the start of the stream, the cached tracks are prefixed with it.
+func id3Size(s *stream.BufferedStream) (int64, error) {
+	header := make([]byte, _ID3_HEADER_SIZE)
+	_, err := io.ReadFull(s.NewReader(0), header)
+	if err != nil || string(header[:3]) != "ID3" {
+		return 0, err
+	}
+
+	size := int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f)
+	size += _ID3_HEADER_SIZE
+	// the tag footer is present
+	if header[5]&0x10 != 0 {
+		size += _ID3_HEADER_SIZE
+	}
+	return size, nil
+}
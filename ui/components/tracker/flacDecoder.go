@@ -0,0 +1,476 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dece2183/yamusic-tui/stream"
+)
+
+const (
+	_FLAC_STREAMINFO = 0
+	_FLAC_SEEKTABLE  = 3
+	// the seek target closer than this to the known frame is reached by decoding the frames before it,
+	// the farther one is searched by probing the frame headers in the stream
+	_FLAC_SEEK_WINDOW = 128 * 1024
+	_FLAC_SEEK_PROBES = 24
+	// the frame header is searched in this much data after the probed offset
+	_FLAC_PROBE_SIZE = 64 * 1024
+	// the broken frames skipped in a row while seeking
+	_FLAC_SEEK_ERRORS = 8
+)
+
+var errFLACStream = errors.New("flac: stream marker is not found")
+
+// flacStreamInfo is the STREAMINFO metadata block
+type flacStreamInfo struct {
+	maxBlockSize  int
+	sampleRate    int
+	channels      int
+	bitsPerSample int
+	// 0 if unknown
+	totalSamples int64
+}
+
+// flacPoint is the offset of the frame in the stream and the number of its first sample
+type flacPoint struct {
+	sample int64
+	offset int64
+}
+
+// flacDecoder decodes the FLAC stream frame by frame. The frames are read ahead of the played PCM by the separate
+// reader, so the decoder keeps the stream position at the frame being played, the stream is done after the last one.
+type flacDecoder struct {
+	stream *stream.BufferedStream
+	info   flacStreamInfo
+	// offset of the first frame
+	framesStart int64
+	// the points of the SEEKTABLE block and of the decoded frames in the increasing order
+	seekPoints []flacPoint
+	frames     []flacPoint
+
+	reader  *flacReader
+	samples [][]int32
+	// PCM of the current frame and the position of its unread part
+	pcm       []byte
+	pcmOffset int
+	// the current frame
+	frame flacPoint
+	eof   bool
+	// position of the decoded PCM in bytes
+	pos int64
+}
+
+func newFLACDecoder(s *stream.BufferedStream) (Decoder, error) {
+	d := &flacDecoder{stream: s}
+	if err := d.readMetadata(); err != nil {
+		return nil, err
+	}
+
+	d.restart(flacPoint{offset: d.framesStart})
+	if _, err := s.Seek(d.framesStart, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// readMetadata reads the metadata blocks that precede the frames.
+func (d *flacDecoder) readMetadata() error {
+	offset, err := id3Size(d.stream)
+	if err != nil {
+		return err
+	}
+
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(d.stream.NewReader(offset), marker); err != nil {
+		return err
+	}
+	if string(marker) != "fLaC" {
+		return errFLACStream
+	}
+	offset += 4
+
+	var hasInfo bool
+	for last := false; !last; {
+		reader := d.stream.NewReader(offset)
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return err
+		}
+		last = header[0]&0x80 != 0
+		kind := header[0] & 0x7f
+		size := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		offset += 4 + size
+
+		switch kind {
+		case _FLAC_STREAMINFO:
+			data := make([]byte, size)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return err
+			}
+			if err := d.readStreamInfo(data); err != nil {
+				return err
+			}
+			hasInfo = true
+		case _FLAC_SEEKTABLE:
+			data := make([]byte, size)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return err
+			}
+			d.readSeekTable(data)
+		}
+	}
+	if !hasInfo {
+		return errors.New("flac: stream info is missing")
+	}
+
+	d.framesStart = offset
+	for i := range d.seekPoints {
+		d.seekPoints[i].offset += offset
+	}
+	return nil
+}
+
+func (d *flacDecoder) readStreamInfo(data []byte) error {
+	if len(data) < 34 {
+		return errors.New("flac: stream info is too short")
+	}
+
+	fields := binary.BigEndian.Uint64(data[10:18])
+	d.info = flacStreamInfo{
+		maxBlockSize:  int(binary.BigEndian.Uint16(data[2:4])),
+		sampleRate:    int(fields >> 44),
+		channels:      int(fields>>41&0x7) + 1,
+		bitsPerSample: int(fields>>36&0x1f) + 1,
+		totalSamples:  int64(fields & (1<<36 - 1)),
+	}
+	if d.info.sampleRate == 0 || d.info.maxBlockSize < 16 {
+		return errors.New("flac: invalid stream info")
+	}
+	if d.info.bitsPerSample > 24 {
+		return fmt.Errorf("flac: %d-bit samples are not supported", d.info.bitsPerSample)
+	}
+	return nil
+}
+
+// readSeekTable keeps the seek points of the frames, the placeholders are skipped.
+func (d *flacDecoder) readSeekTable(data []byte) {
+	for ; len(data) >= 18; data = data[18:] {
+		sample := binary.BigEndian.Uint64(data[0:8])
+		if sample == 1<<64-1 || len(d.seekPoints) > 0 && int64(sample) <= d.seekPoints[len(d.seekPoints)-1].sample {
+			continue
+		}
+		d.seekPoints = append(d.seekPoints, flacPoint{
+			sample: int64(sample),
+			offset: int64(binary.BigEndian.Uint64(data[8:16])),
+		})
+	}
+}
+
+func (d *flacDecoder) Read(dest []byte) (n int, err error) {
+	for n < len(dest) {
+		if d.pcmOffset >= len(d.pcm) {
+			if d.eof {
+				break
+			}
+
+			frameOffset := d.frame.offset
+			err = d.decodeFrame()
+			if err == io.EOF {
+				// all the frames are played
+				d.eof = true
+				d.stream.Seek(0, io.SeekEnd)
+				err = nil
+				break
+			}
+			if err != nil {
+				break
+			}
+			if d.frame.offset != frameOffset {
+				d.stream.Seek(d.frame.offset, io.SeekStart)
+			}
+			continue
+		}
+
+		copied := copy(dest[n:], d.pcm[d.pcmOffset:])
+		d.pcmOffset += copied
+		n += copied
+	}
+
+	d.pos += int64(n)
+	if err != nil {
+		// the broken frame is skipped
+		d.pos = max(d.pos, d.frame.sample*_PCM_FRAME_SIZE)
+	}
+	if n == 0 && d.eof && err == nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Seek moves to the PCM position in bytes.
+func (d *flacDecoder) Seek(offset int64, whence int) (int64, error) {
+	pos := offset
+	switch whence {
+	case io.SeekCurrent:
+		pos += d.pos
+	case io.SeekEnd:
+		return d.pos, errSeekFromEnd
+	}
+
+	if pos < 0 {
+		pos = 0
+	}
+	pos -= pos % _PCM_FRAME_SIZE
+	target := pos / _PCM_FRAME_SIZE
+
+	if d.info.totalSamples > 0 && target >= d.info.totalSamples {
+		// the position is beyond the last frame
+		d.restart(flacPoint{sample: d.info.totalSamples, offset: d.stream.Length()})
+		d.eof = true
+		d.pos = pos
+		d.stream.Seek(0, io.SeekEnd)
+		return pos, nil
+	}
+
+	start := d.knownPoint(target)
+	if target-start.sample > 0 {
+		start = d.probe(start, target)
+	}
+	d.restart(start)
+
+	var errs int
+	for !d.eof && d.frame.sample+int64(len(d.pcm)/_PCM_FRAME_SIZE) <= target {
+		err := d.decodeFrame()
+		if err == io.EOF {
+			d.eof = true
+			break
+		}
+		if err != nil {
+			errs++
+			if errs > _FLAC_SEEK_ERRORS {
+				return d.pos, err
+			}
+		}
+	}
+
+	if d.eof {
+		d.stream.Seek(0, io.SeekEnd)
+	} else {
+		// the target is in the broken frame, so the playback starts from the next one
+		skip := max(target-d.frame.sample, 0)
+		d.pcmOffset = int(skip) * _PCM_FRAME_SIZE
+		pos = (d.frame.sample + skip) * _PCM_FRAME_SIZE
+		d.stream.Seek(d.frame.offset, io.SeekStart)
+	}
+	d.pos = pos
+	return pos, nil
+}
+
+func (d *flacDecoder) SampleRate() int {
+	return d.info.sampleRate
+}
+
+// restart continues the decoding from the frame.
+func (d *flacDecoder) restart(frame flacPoint) {
+	d.reader = newFLACReader(d.stream.NewReader(frame.offset), frame.offset)
+	d.frame = frame
+	d.pcm = d.pcm[:0]
+	d.pcmOffset = 0
+	d.eof = false
+}
+
+// knownPoint returns the last known frame that starts before the sample.
+func (d *flacDecoder) knownPoint(sample int64) flacPoint {
+	point := flacPoint{offset: d.framesStart}
+	for _, points := range [][]flacPoint{d.seekPoints, d.frames} {
+		for i := len(points) - 1; i >= 0; i-- {
+			if points[i].sample <= sample {
+				if points[i].sample > point.sample {
+					point = points[i]
+				}
+				break
+			}
+		}
+	}
+	return point
+}
+
+// probe searches the frame closer before the sample than the known one by the interpolation search
+// over the frame headers, so the far seek doesn't wait for all the data before the target to be downloaded.
+func (d *flacDecoder) probe(known flacPoint, sample int64) flacPoint {
+	end := flacPoint{sample: d.info.totalSamples, offset: d.stream.Length()}
+	for _, points := range [][]flacPoint{d.seekPoints, d.frames} {
+		for _, point := range points {
+			if point.sample > sample && point.offset < end.offset {
+				end = point
+				break
+			}
+		}
+	}
+	if end.sample <= known.sample {
+		return known
+	}
+
+	for i := 0; i < _FLAC_SEEK_PROBES && end.offset-known.offset > _FLAC_SEEK_WINDOW; i++ {
+		guess := known.offset + (end.offset-known.offset)/2
+		if i%2 == 0 {
+			// the interpolated offset is moved back by the window, so the target is likely after it
+			guess = known.offset + (end.offset-known.offset)*(sample-known.sample)/(end.sample-known.sample) - _FLAC_SEEK_WINDOW/2
+			guess = min(max(guess, known.offset+1), end.offset-1)
+		}
+
+		point, ok := d.findFrame(guess, end.offset)
+		switch {
+		case !ok:
+			end.offset = guess
+		case point.sample <= sample:
+			known = point
+		default:
+			end = point
+		}
+	}
+	return known
+}
+
+// findFrame returns the first frame after the offset and before the limit.
+func (d *flacDecoder) findFrame(offset, limit int64) (flacPoint, bool) {
+	size := min(limit-offset, _FLAC_PROBE_SIZE)
+	reader := newFLACReader(io.LimitReader(d.stream.NewReader(offset), size+_FLAC_MAX_HEADER_SIZE), offset)
+	for reader.available(2) && reader.offset() < offset+size {
+		if header, ok := d.syncHeader(reader); ok {
+			return flacPoint{sample: d.firstSample(header), offset: reader.base + int64(reader.mark)}, true
+		}
+	}
+	return flacPoint{}, false
+}
+
+// the longest frame header with the 7 bytes sample number, the 16 bits block size and sample rate and the checksum
+const _FLAC_MAX_HEADER_SIZE = 16
+
+// syncHeader reads the header of the stream frame at the current byte, the reading moves to the next byte if it isn't there.
+func (d *flacDecoder) syncHeader(reader *flacReader) (flacFrameHeader, bool) {
+	pos := reader.bytePos()
+	if reader.buf[pos] == 0xff && reader.buf[pos+1]&0xfe == 0xf8 {
+		header, err := reader.readHeader()
+		if err == nil && d.matches(header) {
+			return header, true
+		}
+	}
+	reader.reset(pos + 1)
+	return flacFrameHeader{}, false
+}
+
+// matches reports whether the frame header is consistent with the stream info.
+func (d *flacDecoder) matches(h flacFrameHeader) bool {
+	return h.channels == d.info.channels && h.blockSize <= d.info.maxBlockSize &&
+		(h.sampleRate == 0 || h.sampleRate == d.info.sampleRate) &&
+		(h.bitsPerSample == 0 || h.bitsPerSample == d.info.bitsPerSample) &&
+		(d.info.totalSamples == 0 || d.firstSample(h) < d.info.totalSamples)
+}
+
+func (d *flacDecoder) firstSample(h flacFrameHeader) int64 {
+	if h.variable {
+		return int64(h.number)
+	}
+	return int64(h.number) * int64(d.info.maxBlockSize)
+}
+
+// decodeFrame decodes the next frame into the PCM. The broken data before it is skipped,
+// the broken frame is skipped too and its error is returned.
+func (d *flacDecoder) decodeFrame() error {
+	d.pcm = d.pcm[:0]
+	d.pcmOffset = 0
+
+	var header flacFrameHeader
+	for {
+		if !d.reader.available(2) {
+			if d.reader.err == io.EOF || d.reader.err == nil {
+				return io.EOF
+			}
+			return d.reader.err
+		}
+
+		var ok bool
+		header, ok = d.syncHeader(d.reader)
+		if ok {
+			break
+		}
+	}
+
+	d.frame = flacPoint{sample: d.firstSample(header), offset: d.reader.base + int64(d.reader.mark)}
+	err := d.decodeSubframes(header)
+	if err != nil {
+		// the decoding continues from the byte after the broken frame header
+		d.reader.reset(d.reader.mark + 1)
+		d.frame.sample += int64(header.blockSize)
+		return err
+	}
+
+	if len(d.frames) == 0 || d.frame.sample > d.frames[len(d.frames)-1].sample {
+		d.frames = append(d.frames, d.frame)
+	}
+	d.writePCM(header)
+	return nil
+}
+
+func (d *flacDecoder) decodeSubframes(header flacFrameHeader) error {
+	if len(d.samples) < header.channels {
+		d.samples = make([][]int32, header.channels)
+	}
+
+	for ch := 0; ch < header.channels; ch++ {
+		if cap(d.samples[ch]) < header.blockSize {
+			d.samples[ch] = make([]int32, d.info.maxBlockSize)
+		}
+		d.samples[ch] = d.samples[ch][:header.blockSize]
+
+		bitsPerSample := d.info.bitsPerSample
+		// the side channel has the extra bit
+		if header.assignment == _FLAC_SIDE_RIGHT && ch == 0 || (header.assignment == _FLAC_LEFT_SIDE || header.assignment == _FLAC_MID_SIDE) && ch == 1 {
+			bitsPerSample++
+		}
+		if err := d.reader.readSubframe(d.samples[ch], bitsPerSample); err != nil {
+			return err
+		}
+	}
+
+	if err := d.reader.readFooter(); err != nil {
+		return err
+	}
+
+	if header.assignment >= _FLAC_LEFT_SIDE {
+		decorrelate(header.assignment, d.samples[0], d.samples[1])
+	}
+	return nil
+}
+
+// writePCM converts the samples of the first two channels to the 16-bit stereo PCM, the mono is played in both.
+func (d *flacDecoder) writePCM(header flacFrameHeader) {
+	left, right := d.samples[0], d.samples[0]
+	if header.channels > 1 {
+		right = d.samples[1]
+	}
+
+	size := header.blockSize * _PCM_FRAME_SIZE
+	if cap(d.pcm) < size {
+		d.pcm = make([]byte, 0, d.info.maxBlockSize*_PCM_FRAME_SIZE)
+	}
+	d.pcm = d.pcm[:size]
+
+	shift := d.info.bitsPerSample - 16
+	for i := 0; i < header.blockSize; i++ {
+		l, r := left[i], right[i]
+		if shift > 0 {
+			l >>= shift
+			r >>= shift
+		} else {
+			l <<= -shift
+			r <<= -shift
+		}
+		binary.LittleEndian.PutUint16(d.pcm[i*_PCM_FRAME_SIZE:], uint16(int16(l)))
+		binary.LittleEndian.PutUint16(d.pcm[i*_PCM_FRAME_SIZE+2:], uint16(int16(r)))
+	}
+}
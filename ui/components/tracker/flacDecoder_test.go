@@ -0,0 +1,503 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"math/rand"
+	"testing"
+
+	"github.com/dece2183/yamusic-tui/stream"
+)
+
+// testFLAC is the FLAC stream encoded by the test with all the subframe types and stereo modes
+type testFLAC struct {
+	sampleRate    int
+	channels      int
+	bitsPerSample int
+	blockSize     int
+	totalSamples  int
+	// the samples are multiples of 1 << wasted
+	wasted    int
+	seekTable bool
+	id3Size   int
+
+	samples [][]int32
+	data    []byte
+	// offsets of the frames in the data
+	frames []int
+}
+
+// testBitWriter writes the bits of the FLAC frames starting from the most significant one
+type testBitWriter struct {
+	data []byte
+	cur  byte
+	n    uint
+}
+
+func (w *testBitWriter) write(value uint64, n uint) {
+	for i := n; i > 0; i-- {
+		w.cur = w.cur<<1 | byte(value>>(i-1)&1)
+		w.n++
+		if w.n == 8 {
+			w.data = append(w.data, w.cur)
+			w.cur, w.n = 0, 0
+		}
+	}
+}
+
+func (w *testBitWriter) writeSigned(value int64, n uint) {
+	w.write(uint64(value)&(1<<n-1), n)
+}
+
+func (w *testBitWriter) writeUnary(value uint64) {
+	for ; value > 0; value-- {
+		w.write(0, 1)
+	}
+	w.write(1, 1)
+}
+
+func (w *testBitWriter) align() {
+	for w.n != 0 {
+		w.write(0, 1)
+	}
+}
+
+// generate makes the noisy sine of each channel, every 5th block is silent to be coded by the constant subframes.
+func (f *testFLAC) generate() {
+	random := rand.New(rand.NewSource(1))
+	amplitude := float64(int64(1) << (f.bitsPerSample - 3 - f.wasted))
+
+	f.samples = make([][]int32, f.channels)
+	for ch := range f.samples {
+		f.samples[ch] = make([]int32, f.totalSamples)
+		for i := range f.samples[ch] {
+			if i/f.blockSize%5 == 4 {
+				f.samples[ch][i] = int32(ch - 1)
+				continue
+			}
+			value := amplitude*math.Sin(float64(i*(ch+1))*0.01) + random.NormFloat64()*amplitude/64
+			f.samples[ch][i] = int32(value) << f.wasted
+		}
+	}
+}
+
+func (f *testFLAC) encode() []byte {
+	if f.samples == nil {
+		f.generate()
+	}
+
+	var data []byte
+	if f.id3Size > 0 {
+		data = append(data, 'I', 'D', '3', 4, 0, 0, 0, 0, byte(f.id3Size>>7&0x7f), byte(f.id3Size&0x7f))
+		data = append(data, make([]byte, f.id3Size)...)
+	}
+	data = append(data, "fLaC"...)
+
+	var frames []byte
+	f.frames = nil
+	for start := 0; start < f.totalSamples; start += f.blockSize {
+		f.frames = append(f.frames, len(frames))
+		frames = append(frames, f.encodeFrame(start/f.blockSize, start, min(f.blockSize, f.totalSamples-start))...)
+	}
+
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint16(info[0:], uint16(f.blockSize))
+	binary.BigEndian.PutUint16(info[2:], uint16(f.blockSize))
+	binary.BigEndian.PutUint64(info[10:], uint64(f.sampleRate)<<44|uint64(f.channels-1)<<41|uint64(f.bitsPerSample-1)<<36|uint64(f.totalSamples))
+
+	infoFlags := byte(_FLAC_STREAMINFO)
+	if !f.seekTable {
+		infoFlags |= 0x80
+	}
+	data = append(data, infoFlags, 0, 0, byte(len(info)))
+	data = append(data, info...)
+
+	if f.seekTable {
+		var table []byte
+		for frame := 0; frame < len(f.frames); frame += 10 {
+			table = binary.BigEndian.AppendUint64(table, uint64(frame*f.blockSize))
+			table = binary.BigEndian.AppendUint64(table, uint64(f.frames[frame]))
+			table = binary.BigEndian.AppendUint16(table, uint16(f.blockSize))
+		}
+		// the placeholder point
+		table = binary.BigEndian.AppendUint64(table, 1<<64-1)
+		table = append(table, make([]byte, 10)...)
+
+		data = append(data, 0x80|_FLAC_SEEKTABLE, byte(len(table)>>16), byte(len(table)>>8), byte(len(table)))
+		data = append(data, table...)
+	}
+
+	for i := range f.frames {
+		f.frames[i] += len(data)
+	}
+	f.data = append(data, frames...)
+	return f.data
+}
+
+func (f *testFLAC) encodeFrame(number, start, size int) []byte {
+	w := &testBitWriter{}
+	w.write(_FLAC_SYNC_CODE, 14)
+	w.write(0, 2)
+
+	blockSizeCode, blockSizeBits := uint64(7), uint(16)
+	switch {
+	case size == 576<<1:
+		blockSizeCode, blockSizeBits = 3, 0
+	case size == 256<<4:
+		blockSizeCode, blockSizeBits = 12, 0
+	case size <= 256:
+		blockSizeCode, blockSizeBits = 6, 8
+	}
+	w.write(blockSizeCode, 4)
+
+	var sampleRateCode uint64
+	for code, rate := range flacSampleRates {
+		if code > 0 && rate == f.sampleRate {
+			sampleRateCode = uint64(code)
+		}
+	}
+	w.write(sampleRateCode, 4)
+
+	assignment := f.channels - 1
+	if f.channels == 2 {
+		assignment = []int{1, _FLAC_LEFT_SIDE, _FLAC_SIDE_RIGHT, _FLAC_MID_SIDE}[number%4]
+	}
+	w.write(uint64(assignment), 4)
+
+	var sampleSizeCode uint64
+	for code, size := range flacSampleSizes {
+		if code > 0 && size == f.bitsPerSample {
+			sampleSizeCode = uint64(code)
+		}
+	}
+	w.write(sampleSizeCode<<1, 4)
+
+	switch {
+	case number < 0x80:
+		w.write(uint64(number), 8)
+	case number < 0x800:
+		w.write(uint64(0xc0|number>>6), 8)
+		w.write(uint64(0x80|number&0x3f), 8)
+	default:
+		w.write(uint64(0xe0|number>>12), 8)
+		w.write(uint64(0x80|number>>6&0x3f), 8)
+		w.write(uint64(0x80|number&0x3f), 8)
+	}
+	if blockSizeBits > 0 {
+		w.write(uint64(size-1), blockSizeBits)
+	}
+	w.write(uint64(crc8(w.data)), 8)
+
+	channels := make([][]int32, f.channels)
+	for ch := range channels {
+		channels[ch] = f.samples[ch][start : start+size]
+	}
+	if f.channels == 2 && assignment >= _FLAC_LEFT_SIDE {
+		left, right := channels[0], channels[1]
+		first, second := make([]int32, size), make([]int32, size)
+		for i := range left {
+			side := left[i] - right[i]
+			switch assignment {
+			case _FLAC_LEFT_SIDE:
+				first[i], second[i] = left[i], side
+			case _FLAC_SIDE_RIGHT:
+				first[i], second[i] = side, right[i]
+			case _FLAC_MID_SIDE:
+				first[i], second[i] = (left[i]+right[i])>>1, side
+			}
+		}
+		channels = [][]int32{first, second}
+	}
+
+	for ch, samples := range channels {
+		bitsPerSample := f.bitsPerSample
+		if assignment == _FLAC_SIDE_RIGHT && ch == 0 || (assignment == _FLAC_LEFT_SIDE || assignment == _FLAC_MID_SIDE) && ch == 1 {
+			bitsPerSample++
+		}
+		f.encodeSubframe(w, number, samples, bitsPerSample)
+	}
+
+	w.align()
+	w.write(uint64(crc16(w.data)), 16)
+	return w.data
+}
+
+// the coefficients of the LPC subframes with the shift of 10
+var testLPCCoefficients = []int64{1843, -1024, 205}
+
+func (f *testFLAC) encodeSubframe(w *testBitWriter, number int, samples []int32, bitsPerSample int) {
+	constant := true
+	var combined int32
+	for _, s := range samples {
+		constant = constant && s == samples[0]
+		combined |= s
+	}
+
+	if constant {
+		w.write(0, 8)
+		w.writeSigned(int64(samples[0]), uint(bitsPerSample))
+		return
+	}
+
+	kind := number % 3
+	wasted := bits.TrailingZeros32(uint32(combined))
+	shifted := make([]int64, len(samples))
+	for i, s := range samples {
+		shifted[i] = int64(s >> wasted)
+	}
+	bitsPerSample -= wasted
+
+	var header uint64
+	order := 0
+	switch kind {
+	case 0:
+		header = 1
+	case 1:
+		order = number % 5
+		header = uint64(8 + order)
+	case 2:
+		order = len(testLPCCoefficients)
+		header = uint64(32 + order - 1)
+	}
+	w.write(header<<1|min(uint64(wasted), 1), 8)
+	if wasted > 0 {
+		w.writeUnary(uint64(wasted - 1))
+	}
+
+	if kind == 0 {
+		for _, s := range shifted {
+			w.writeSigned(s, uint(bitsPerSample))
+		}
+		return
+	}
+
+	for _, s := range shifted[:order] {
+		w.writeSigned(s, uint(bitsPerSample))
+	}
+
+	residual := make([]int64, len(shifted))
+	for i := order; i < len(shifted); i++ {
+		var prediction int64
+		if kind == 1 {
+			coefficients := [][]int64{{}, {1}, {2, -1}, {3, -3, 1}, {4, -6, 4, -1}}[order]
+			for j, c := range coefficients {
+				prediction += c * shifted[i-1-j]
+			}
+		} else {
+			for j, c := range testLPCCoefficients {
+				prediction += c * shifted[i-1-j]
+			}
+			prediction >>= 10
+		}
+		residual[i] = shifted[i] - prediction
+	}
+
+	if kind == 2 {
+		w.write(11, 4)
+		w.writeSigned(10, 5)
+		for _, c := range testLPCCoefficients {
+			w.writeSigned(c, 12)
+		}
+	}
+	f.encodeResidual(w, number, residual, order)
+}
+
+// encodeResidual writes the residual by two partitions if possible, the second one is escaped in every 7th frame.
+func (f *testFLAC) encodeResidual(w *testBitWriter, number int, residual []int64, order int) {
+	partitionOrder := 0
+	if len(residual)%2 == 0 && len(residual)/2 >= order {
+		partitionOrder = 1
+	}
+	partitionSize := len(residual) >> partitionOrder
+
+	method, paramSize := uint64(0), uint(4)
+	var sum uint64
+	for _, r := range residual[order:] {
+		sum += uint64(r<<1 ^ r>>63)
+	}
+	param := uint64(bits.Len64(sum / uint64(max(len(residual)-order, 1))))
+	if param >= 15 {
+		method, paramSize = 1, 5
+	}
+	w.write(method, 2)
+	w.write(uint64(partitionOrder), 4)
+
+	for p := 0; p < 1<<partitionOrder; p++ {
+		partition := residual[max(p*partitionSize, order):(p+1)*partitionSize]
+
+		if p == 1 && number%7 == 3 {
+			size := uint(1)
+			for _, r := range partition {
+				size = max(size, uint(bits.Len64(uint64(max(r, -r-1))))+1)
+			}
+			w.write(1<<paramSize-1, paramSize)
+			w.write(uint64(size), 5)
+			for _, r := range partition {
+				w.writeSigned(r, size)
+			}
+			continue
+		}
+
+		w.write(param, paramSize)
+		for _, r := range partition {
+			value := uint64(r<<1 ^ r>>63)
+			w.writeUnary(value >> param)
+			w.write(value&(1<<param-1), uint(param))
+		}
+	}
+}
+
+// pcm returns the 16-bit stereo PCM of the samples from the sample.
+func (f *testFLAC) pcm(from int) []byte {
+	var pcm []byte
+	shift := f.bitsPerSample - 16
+	for i := from; i < f.totalSamples; i++ {
+		for ch := 0; ch < 2; ch++ {
+			s := f.samples[min(ch, f.channels-1)][i]
+			if shift > 0 {
+				s >>= shift
+			} else {
+				s <<= -shift
+			}
+			pcm = binary.LittleEndian.AppendUint16(pcm, uint16(int16(s)))
+		}
+	}
+	return pcm
+}
+
+func newTestFLACStream(t *testing.T, data []byte) *stream.BufferedStream {
+	s := stream.NewBufferedStream(io.NopCloser(bytes.NewReader(data)), int64(len(data)))
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+var testFLACStreams = []struct {
+	name string
+	flac testFLAC
+}{
+	{"16-bit stereo", testFLAC{sampleRate: 44100, channels: 2, bitsPerSample: 16, blockSize: 1152, totalSamples: 100*1152 + 300}},
+	{"24-bit stereo with seek table", testFLAC{sampleRate: 48000, channels: 2, bitsPerSample: 24, blockSize: 4096, totalSamples: 40*4096 + 1000, seekTable: true}},
+	{"16-bit mono with stream info rate", testFLAC{sampleRate: 11025, channels: 1, bitsPerSample: 16, blockSize: 200, totalSamples: 100 * 200}},
+	{"wasted bits with id3", testFLAC{sampleRate: 44100, channels: 2, bitsPerSample: 16, blockSize: 1152, totalSamples: 30 * 1152, wasted: 2, id3Size: 300}},
+}
+
+func TestFLACDecoderDecodes(t *testing.T) {
+	for _, tt := range testFLACStreams {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.flac
+			s := newTestFLACStream(t, f.encode())
+
+			d, err := newFLACDecoder(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.SampleRate() != f.sampleRate {
+				t.Errorf("sample rate is %d, want %d", d.SampleRate(), f.sampleRate)
+			}
+
+			pcm, err := io.ReadAll(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(pcm, f.pcm(0)) {
+				t.Errorf("decoded %d bytes of PCM differ from %d bytes of the source", len(pcm), len(f.pcm(0)))
+			}
+			if !s.IsDone() {
+				t.Error("the stream isn't done after the last frame")
+			}
+		})
+	}
+}
+
+func TestFLACDecoderSeek(t *testing.T) {
+	for _, tt := range testFLACStreams {
+		f := tt.flac
+		data := f.encode()
+		expected := f.pcm(0)
+		total := int64(f.totalSamples) * _PCM_FRAME_SIZE
+
+		targets := []int64{0, 1, 700 * _PCM_FRAME_SIZE, total / 3, total/2 + 3, total - 4*_PCM_FRAME_SIZE, total, total + 400}
+		for _, target := range targets {
+			t.Run(fmt.Sprintf("%s to %d", tt.name, target), func(t *testing.T) {
+				s := newTestFLACStream(t, data)
+				d, err := newFLACDecoder(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				pos, err := d.Seek(target, io.SeekStart)
+				want := target - target%_PCM_FRAME_SIZE
+				if err != nil || pos != want {
+					t.Fatalf("seeked to %d, %v; want %d", pos, err, want)
+				}
+				if s.IsDone() != (want >= total) {
+					t.Errorf("the stream is done %t after the seek", s.IsDone())
+				}
+
+				rest, err := io.ReadAll(d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(rest, expected[min(want, total):]) {
+					t.Errorf("%d bytes decoded after the seek differ from %d bytes of the source", len(rest), total-min(want, total))
+				}
+				if !s.IsDone() {
+					t.Error("the stream isn't done after the last frame")
+				}
+			})
+		}
+	}
+}
+
+func TestFLACDecoderSkipsBrokenFrame(t *testing.T) {
+	f := testFLACStreams[0].flac
+	data := f.encode()
+	// damage the subframes of the 10th frame
+	data[f.frames[10]+100] ^= 0xff
+
+	s := newTestFLACStream(t, data)
+	d, err := newFLACDecoder(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		pcm  []byte
+		errs int
+		buf  = make([]byte, 4096)
+	)
+	for {
+		n, err := d.Read(buf)
+		pcm = append(pcm, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs++
+			if errs > 1 {
+				t.Fatalf("more than one error: %s", err)
+			}
+		}
+	}
+
+	expected := f.pcm(0)
+	frameSize := f.blockSize * _PCM_FRAME_SIZE
+	expected = append(expected[:10*frameSize:10*frameSize], expected[11*frameSize:]...)
+	if errs != 1 {
+		t.Errorf("%d errors returned for the broken frame, want 1", errs)
+	}
+	if !bytes.Equal(pcm, expected) {
+		t.Errorf("%d bytes decoded around the broken frame differ from %d bytes of the source", len(pcm), len(expected))
+	}
+}
+
+func TestFLACDecoderRejectsOtherStreams(t *testing.T) {
+	data := newTestMP3(0)
+	if _, err := newFLACDecoder(newTestFLACStream(t, data)); err != errFLACStream {
+		t.Errorf("decoding MP3 returned %v, want %v", err, errFLACStream)
+	}
+}
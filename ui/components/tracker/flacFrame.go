@@ -0,0 +1,614 @@
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+const (
+	// the stream data is read by the chunks of this size
+	_FLAC_READ_CHUNK = 16 * 1024
+	_FLAC_SYNC_CODE  = 0x3ffe
+)
+
+var (
+	errFLACSync      = errors.New("flac: frame sync code is not found")
+	errFLACHeaderCRC = errors.New("flac: frame header checksum mismatch")
+	errFLACFrameCRC  = errors.New("flac: frame checksum mismatch")
+)
+
+// flacReader reads the bits of the FLAC frames from the stream. The data of the current frame
+// is kept until the next one is started, so the frame checksums are calculated over it.
+type flacReader struct {
+	src io.Reader
+	err error
+	buf []byte
+	// offset of buf[0] in the stream
+	base int64
+	// position of the next byte to load into the bit cache
+	pos int
+	// start of the current frame in buf
+	mark int
+	// the unread bits are aligned to the most significant bit of the cache
+	cache uint64
+	bits  uint
+}
+
+func newFLACReader(src io.Reader, offset int64) *flacReader {
+	return &flacReader{src: src, base: offset}
+}
+
+// offset returns the stream offset of the next unread byte, the bits of the partially read byte are skipped.
+func (r *flacReader) offset() int64 {
+	return r.base + int64(r.bytePos())
+}
+
+func (r *flacReader) bytePos() int {
+	return r.pos - int(r.bits/8)
+}
+
+// reset moves the reading to the byte of the buffer dropping the bit cache.
+func (r *flacReader) reset(pos int) {
+	r.pos = pos
+	r.cache = 0
+	r.bits = 0
+}
+
+// startFrame marks the current byte as the start of the frame, the data before it is dropped.
+func (r *flacReader) startFrame() {
+	r.reset(r.bytePos())
+	r.mark = r.pos
+}
+
+// frameData returns the data from the start of the frame to the current byte.
+func (r *flacReader) frameData() []byte {
+	return r.buf[r.mark:r.bytePos()]
+}
+
+// fill reads more data from the source, reports false if there is no more.
+func (r *flacReader) fill() bool {
+	if r.err != nil {
+		return false
+	}
+
+	if r.mark > 0 && r.mark >= len(r.buf)/2 {
+		n := copy(r.buf, r.buf[r.mark:])
+		r.buf = r.buf[:n]
+		r.base += int64(r.mark)
+		r.pos -= r.mark
+		r.mark = 0
+	}
+
+	start := len(r.buf)
+	if cap(r.buf)-start < _FLAC_READ_CHUNK {
+		buf := make([]byte, start, 2*cap(r.buf)+_FLAC_READ_CHUNK)
+		copy(buf, r.buf)
+		r.buf = buf
+	}
+
+	var n int
+	n, r.err = r.src.Read(r.buf[start : start+_FLAC_READ_CHUNK])
+	r.buf = r.buf[:start+n]
+	if n == 0 && r.err == nil {
+		r.err = io.ErrNoProgress
+	}
+	return n > 0
+}
+
+// available makes the size bytes after the current one available in the buffer if the stream has them.
+func (r *flacReader) available(size int) bool {
+	for r.bytePos()+size > len(r.buf) {
+		if !r.fill() {
+			return false
+		}
+	}
+	return true
+}
+
+// load fills the bit cache with the buffered bytes.
+func (r *flacReader) load(n uint) error {
+	for r.bits < n {
+		if r.pos >= len(r.buf) && !r.fill() {
+			if r.err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return r.err
+		}
+		for r.bits <= 56 && r.pos < len(r.buf) {
+			r.cache |= uint64(r.buf[r.pos]) << (56 - r.bits)
+			r.pos++
+			r.bits += 8
+		}
+	}
+	return nil
+}
+
+// read returns the n bits, n is up to 56.
+func (r *flacReader) read(n uint) (uint64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if err := r.load(n); err != nil {
+		return 0, err
+	}
+
+	value := r.cache >> (64 - n)
+	r.cache <<= n
+	r.bits -= n
+	return value, nil
+}
+
+// readSigned returns the n bits two's complement number.
+func (r *flacReader) readSigned(n uint) (int32, error) {
+	value, err := r.read(n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	return int32(int64(value<<(64-n)) >> (64 - n)), nil
+}
+
+// readUnary returns the number of the zero bits before the one bit.
+func (r *flacReader) readUnary() (uint64, error) {
+	var count uint64
+	for {
+		if r.bits == 0 {
+			if err := r.load(8); err != nil {
+				return 0, err
+			}
+		}
+
+		zeros := uint(bits.LeadingZeros64(r.cache))
+		if zeros < r.bits {
+			r.cache <<= zeros + 1
+			r.bits -= zeros + 1
+			return count + uint64(zeros), nil
+		}
+		count += uint64(r.bits)
+		r.cache = 0
+		r.bits = 0
+	}
+}
+
+// align skips the bits to the byte boundary.
+func (r *flacReader) align() {
+	skip := r.bits % 8
+	r.cache <<= skip
+	r.bits -= skip
+}
+
+// flacFrameHeader is the header of the FLAC frame
+type flacFrameHeader struct {
+	// the number of the frame for the fixed block size stream or of its first sample for the variable one
+	number     uint64
+	variable   bool
+	blockSize  int
+	sampleRate int
+	channels   int
+	// channel assignment, the independent channels or one of the stereo decorrelation modes
+	assignment    int
+	bitsPerSample int
+}
+
+const (
+	_FLAC_LEFT_SIDE  = 8
+	_FLAC_SIDE_RIGHT = 9
+	_FLAC_MID_SIDE   = 10
+)
+
+var flacSampleRates = [...]int{0, 88200, 176400, 192000, 8000, 16000, 22050, 24000, 32000, 44100, 48000, 96000}
+
+var flacSampleSizes = [...]int{0, 8, 12, 0, 16, 20, 24, 0}
+
+// readHeader reads the frame header from the current byte and checks its checksum.
+// The zero sample rate and sample size mean the values of the stream info.
+func (r *flacReader) readHeader() (h flacFrameHeader, err error) {
+	r.startFrame()
+
+	sync, err := r.read(14)
+	if err != nil {
+		return h, err
+	}
+	reserved, err := r.read(1)
+	if err != nil {
+		return h, err
+	}
+	if sync != _FLAC_SYNC_CODE || reserved != 0 {
+		return h, errFLACSync
+	}
+
+	fields, err := r.read(17)
+	if err != nil {
+		return h, err
+	}
+	h.variable = fields>>16 == 1
+	blockSizeCode := fields >> 12 & 0xf
+	sampleRateCode := fields >> 8 & 0xf
+	h.assignment = int(fields >> 4 & 0xf)
+	sampleSizeCode := fields >> 1 & 0x7
+	if blockSizeCode == 0 || sampleRateCode == 0xf || h.assignment > _FLAC_MID_SIDE || flacSampleSizes[sampleSizeCode] == 0 && sampleSizeCode != 0 || fields&1 != 0 {
+		return h, errFLACSync
+	}
+
+	h.number, err = r.readUTF8()
+	if err != nil {
+		return h, err
+	}
+
+	switch {
+	case blockSizeCode == 1:
+		h.blockSize = 192
+	case blockSizeCode <= 5:
+		h.blockSize = 576 << (blockSizeCode - 2)
+	case blockSizeCode == 6:
+		size, err := r.read(8)
+		if err != nil {
+			return h, err
+		}
+		h.blockSize = int(size) + 1
+	case blockSizeCode == 7:
+		size, err := r.read(16)
+		if err != nil {
+			return h, err
+		}
+		h.blockSize = int(size) + 1
+	default:
+		h.blockSize = 256 << (blockSizeCode - 8)
+	}
+
+	switch {
+	case sampleRateCode < 12:
+		h.sampleRate = flacSampleRates[sampleRateCode]
+	case sampleRateCode == 12:
+		rate, err := r.read(8)
+		if err != nil {
+			return h, err
+		}
+		h.sampleRate = int(rate) * 1000
+	case sampleRateCode == 13:
+		rate, err := r.read(16)
+		if err != nil {
+			return h, err
+		}
+		h.sampleRate = int(rate)
+	default:
+		rate, err := r.read(16)
+		if err != nil {
+			return h, err
+		}
+		h.sampleRate = int(rate) * 10
+	}
+
+	h.channels = h.assignment + 1
+	if h.assignment >= _FLAC_LEFT_SIDE {
+		h.channels = 2
+	}
+	h.bitsPerSample = flacSampleSizes[sampleSizeCode]
+
+	crc := crc8(r.frameData())
+	headerCRC, err := r.read(8)
+	if err != nil {
+		return h, err
+	}
+	if byte(headerCRC) != crc {
+		return h, errFLACHeaderCRC
+	}
+	return h, nil
+}
+
+// readUTF8 reads the frame or sample number coded like the UTF-8 character.
+func (r *flacReader) readUTF8() (uint64, error) {
+	first, err := r.read(8)
+	if err != nil {
+		return 0, err
+	}
+
+	length := bits.LeadingZeros8(^uint8(first))
+	if length == 0 {
+		return first, nil
+	}
+	if length == 1 || length > 7 {
+		return 0, errFLACSync
+	}
+
+	value := first & (0x7f >> length)
+	for i := 1; i < length; i++ {
+		next, err := r.read(8)
+		if err != nil {
+			return 0, err
+		}
+		if next&0xc0 != 0x80 {
+			return 0, errFLACSync
+		}
+		value = value<<6 | next&0x3f
+	}
+	return value, nil
+}
+
+// readSubframe decodes the samples of the channel coded with the sample size.
+func (r *flacReader) readSubframe(samples []int32, bitsPerSample int) error {
+	header, err := r.read(8)
+	if err != nil {
+		return err
+	}
+	if header&0x80 != 0 {
+		return errors.New("flac: invalid subframe padding")
+	}
+
+	kind := header >> 1 & 0x3f
+	var wasted int
+	if header&1 != 0 {
+		count, err := r.readUnary()
+		if err != nil {
+			return err
+		}
+		wasted = int(count) + 1
+	}
+	bitsPerSample -= wasted
+	if bitsPerSample <= 0 {
+		return errors.New("flac: invalid wasted bits")
+	}
+
+	switch {
+	case kind == 0:
+		value, err := r.readSigned(uint(bitsPerSample))
+		if err != nil {
+			return err
+		}
+		for i := range samples {
+			samples[i] = value
+		}
+	case kind == 1:
+		for i := range samples {
+			samples[i], err = r.readSigned(uint(bitsPerSample))
+			if err != nil {
+				return err
+			}
+		}
+	case kind >= 8 && kind <= 12:
+		err = r.readFixed(samples, int(kind-8), bitsPerSample)
+	case kind >= 32:
+		err = r.readLPC(samples, int(kind-31), bitsPerSample)
+	default:
+		return fmt.Errorf("flac: reserved subframe type %d", kind)
+	}
+	if err != nil {
+		return err
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+func (r *flacReader) readWarmup(samples []int32, order, bitsPerSample int) error {
+	if order > len(samples) {
+		return errors.New("flac: predictor order exceeds the block size")
+	}
+
+	var err error
+	for i := 0; i < order; i++ {
+		samples[i], err = r.readSigned(uint(bitsPerSample))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFixed decodes the subframe of the fixed polynomial predictor.
+func (r *flacReader) readFixed(samples []int32, order, bitsPerSample int) error {
+	if err := r.readWarmup(samples, order, bitsPerSample); err != nil {
+		return err
+	}
+	if err := r.readResidual(samples, order); err != nil {
+		return err
+	}
+
+	switch order {
+	case 1:
+		for i := 1; i < len(samples); i++ {
+			samples[i] += samples[i-1]
+		}
+	case 2:
+		for i := 2; i < len(samples); i++ {
+			samples[i] += 2*samples[i-1] - samples[i-2]
+		}
+	case 3:
+		for i := 3; i < len(samples); i++ {
+			samples[i] += 3*samples[i-1] - 3*samples[i-2] + samples[i-3]
+		}
+	case 4:
+		for i := 4; i < len(samples); i++ {
+			samples[i] += 4*samples[i-1] - 6*samples[i-2] + 4*samples[i-3] - samples[i-4]
+		}
+	}
+	return nil
+}
+
+// readLPC decodes the subframe of the linear predictor.
+func (r *flacReader) readLPC(samples []int32, order, bitsPerSample int) error {
+	if err := r.readWarmup(samples, order, bitsPerSample); err != nil {
+		return err
+	}
+
+	precision, err := r.read(4)
+	if err != nil {
+		return err
+	}
+	if precision == 0xf {
+		return errors.New("flac: invalid predictor precision")
+	}
+	shift, err := r.readSigned(5)
+	if err != nil {
+		return err
+	}
+	if shift < 0 {
+		return errors.New("flac: negative predictor shift")
+	}
+
+	coefficients := make([]int32, order)
+	for i := range coefficients {
+		coefficients[i], err = r.readSigned(uint(precision) + 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := r.readResidual(samples, order); err != nil {
+		return err
+	}
+
+	for i := order; i < len(samples); i++ {
+		var prediction int64
+		for j, c := range coefficients {
+			prediction += int64(c) * int64(samples[i-1-j])
+		}
+		samples[i] += int32(prediction >> shift)
+	}
+	return nil
+}
+
+// readResidual decodes the Rice coded residual of the predictor into the samples after the warmup ones.
+func (r *flacReader) readResidual(samples []int32, order int) error {
+	method, err := r.read(2)
+	if err != nil {
+		return err
+	}
+	if method > 1 {
+		return errors.New("flac: reserved residual coding method")
+	}
+	paramSize := uint(4 + method)
+	escape := uint64(1)<<paramSize - 1
+
+	partitionOrder, err := r.read(4)
+	if err != nil {
+		return err
+	}
+	partitionSize := len(samples) >> partitionOrder
+	if partitionSize<<partitionOrder != len(samples) || partitionSize < order {
+		return errors.New("flac: invalid residual partition order")
+	}
+
+	i := order
+	for p := 0; p < 1<<partitionOrder; p++ {
+		end := (p + 1) * partitionSize
+
+		param, err := r.read(paramSize)
+		if err != nil {
+			return err
+		}
+
+		if param == escape {
+			size, err := r.read(5)
+			if err != nil {
+				return err
+			}
+			for ; i < end; i++ {
+				samples[i], err = r.readSigned(uint(size))
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		for ; i < end; i++ {
+			high, err := r.readUnary()
+			if err != nil {
+				return err
+			}
+			low, err := r.read(uint(param))
+			if err != nil {
+				return err
+			}
+			value := high<<param | low
+			samples[i] = int32(value>>1) ^ -int32(value&1)
+		}
+	}
+	return nil
+}
+
+// readFooter checks the checksum of the frame after its subframes.
+func (r *flacReader) readFooter() error {
+	r.align()
+	crc := crc16(r.frameData())
+	frameCRC, err := r.read(16)
+	if err != nil {
+		return err
+	}
+	if uint16(frameCRC) != crc {
+		return errFLACFrameCRC
+	}
+	return nil
+}
+
+// decorrelate restores the left and right channels of the stereo decorrelation modes.
+func decorrelate(assignment int, first, second []int32) {
+	switch assignment {
+	case _FLAC_LEFT_SIDE:
+		for i := range first {
+			second[i] = first[i] - second[i]
+		}
+	case _FLAC_SIDE_RIGHT:
+		for i := range first {
+			first[i] += second[i]
+		}
+	case _FLAC_MID_SIDE:
+		for i := range first {
+			side := second[i]
+			mid := first[i]<<1 | side&1
+			first[i] = (mid + side) >> 1
+			second[i] = (mid - side) >> 1
+		}
+	}
+}
+
+var (
+	crc8Table  [256]byte
+	crc16Table [256]uint16
+)
+
+func init() {
+	for i := range crc8Table {
+		crc := byte(i)
+		for j := 0; j < 8; j++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+		crc8Table[i] = crc
+	}
+
+	for i := range crc16Table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+		crc16Table[i] = crc
+	}
+}
+
+func crc8(data []byte) (crc byte) {
+	for _, b := range data {
+		crc = crc8Table[crc^b]
+	}
+	return
+}
+
+func crc16(data []byte) (crc uint16) {
+	for _, b := range data {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+	}
+	return
+}
@@ -18,6 +18,8 @@ type helpKeyMap struct {
 	VolUp        key.Binding
 	VolDown      key.Binding
 	ToggleLyrics key.Binding
+	Repeat       key.Binding
+	StopAfter    key.Binding
 }
 
 var helpMap = helpKeyMap{
@@ -61,6 +63,14 @@ var helpMap = helpKeyMap{
 		config.Current.Controls.PlayerToggleLyrics.Binding(),
 		config.Current.Controls.PlayerToggleLyrics.Help("show/hide lyrics"),
 	),
+	Repeat: key.NewBinding(
+		config.Current.Controls.PlayerRepeat.Binding(),
+		config.Current.Controls.PlayerRepeat.Help("repeat mode"),
+	),
+	StopAfter: key.NewBinding(
+		config.Current.Controls.PlayerStopAfter.Binding(),
+		config.Current.Controls.PlayerStopAfter.Help("stop after current"),
+	),
 }
 
 func (k helpKeyMap) ShortHelp() []key.Binding {
@@ -73,5 +83,6 @@ func (k helpKeyMap) FullHelp() [][]key.Binding {
 		{k.NextTrack, k.PrevTrack, k.ToggleLyrics},
 		{k.Forward, k.Backward},
 		{k.VolUp, k.VolDown},
+		{k.Repeat, k.StopAfter},
 	}
 }
@@ -0,0 +1,73 @@
+package tracker
+
+import (
+	"math"
+
+	"github.com/dece2183/yamusic-tui/api"
+)
+
+// Loudness is the ReplayGain-style normalization of the track
+type Loudness struct {
+	// Gain in dB
+	Gain float64
+	// Linear sample peak, 0 if unknown
+	Peak float64
+}
+
+// TrackLoudness returns the normalization provided by the server for the track.
+func TrackLoudness(track *api.Track) Loudness {
+	return Loudness{
+		Gain: float64(track.Normalization.Gain),
+		Peak: float64(track.Normalization.Peak) / api.NORMALIZATION_PEAK_SCALE,
+	}
+}
+
+// AlbumLoudness returns the normalization of the track album, ok is false if it's unknown.
+func AlbumLoudness(track *api.Track) (loudness Loudness, ok bool) {
+	if track.Normalization.AlbumGain == 0 && track.Normalization.AlbumPeak == 0 {
+		return Loudness{}, false
+	}
+	return Loudness{
+		Gain: float64(track.Normalization.AlbumGain),
+		Peak: float64(track.Normalization.AlbumPeak) / api.NORMALIZATION_PEAK_SCALE,
+	}, true
+}
+
+// CombinedLoudness returns the normalization of the tracks played as a whole, e.g. as an album.
+// The gain matches the average energy of the tracks weighted by their durations and the peak is the highest one.
+// The tracks without the normalization are skipped, ok is false if none of them has it.
+func CombinedLoudness(tracks []*api.Track) (loudness Loudness, ok bool) {
+	var energy, duration float64
+	for _, track := range tracks {
+		if track.Normalization.Gain == 0 && track.Normalization.Peak == 0 {
+			continue
+		}
+
+		trackLoudness := TrackLoudness(track)
+		// the tracks of the unknown duration are counted as the minute long ones
+		weight := float64(track.DurationMs)
+		if weight <= 0 {
+			weight = 60000
+		}
+		// the track gain is the difference between the reference and the track loudness
+		energy += weight * math.Pow(10, -trackLoudness.Gain/10)
+		duration += weight
+		loudness.Peak = max(loudness.Peak, trackLoudness.Peak)
+		ok = true
+	}
+
+	if !ok {
+		return Loudness{}, false
+	}
+	loudness.Gain = -10 * math.Log10(energy/duration)
+	return loudness, true
+}
+
+// factor returns the linear gain limited so the track peak doesn't clip.
+func (l Loudness) factor() float64 {
+	gain := math.Pow(10, l.Gain/20)
+	if l.Peak > 0 && gain*l.Peak > 1 {
+		gain = 1 / l.Peak
+	}
+	return gain
+}
@@ -0,0 +1,64 @@
+package tracker
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dece2183/yamusic-tui/api"
+)
+
+func TestCombinedLoudness(t *testing.T) {
+	track := func(gain, peak float32, durationMs int) *api.Track {
+		track := &api.Track{DurationMs: durationMs}
+		track.Normalization.Gain = gain
+		track.Normalization.Peak = peak
+		return track
+	}
+
+	tests := []struct {
+		name   string
+		tracks []*api.Track
+		want   Loudness
+		ok     bool
+	}{
+		{"none", nil, Loudness{}, false},
+		{"unknown", []*api.Track{track(0, 0, 1000)}, Loudness{}, false},
+		{"single", []*api.Track{track(-6, 16384, 1000)}, Loudness{Gain: -6, Peak: 0.5}, true},
+		{"same gain", []*api.Track{track(-6, 16384, 1000), track(-6, 8192, 3000)}, Loudness{Gain: -6, Peak: 0.5}, true},
+		// the louder track outweighs the quieter one
+		{"energy average", []*api.Track{track(-3, 8192, 1000), track(-9, 16384, 1000)}, Loudness{Gain: -6.963, Peak: 0.5}, true},
+		{"duration weighted", []*api.Track{track(-3, 8192, 3000), track(-9, 8192, 1000)}, Loudness{Gain: -5.419, Peak: 0.25}, true},
+		{"unknown skipped", []*api.Track{track(-6, 16384, 1000), track(0, 0, 1000)}, Loudness{Gain: -6, Peak: 0.5}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := CombinedLoudness(tt.tracks)
+			if ok != tt.ok || math.Abs(got.Gain-tt.want.Gain) > 0.001 || got.Peak != tt.want.Peak {
+				t.Errorf("loudness is %+v, %v; want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLoudnessFactor(t *testing.T) {
+	tests := []struct {
+		name     string
+		loudness Loudness
+		want     float64
+	}{
+		{"unity", Loudness{}, 1},
+		{"attenuated", Loudness{Gain: -20, Peak: 1}, 0.1},
+		{"amplified", Loudness{Gain: 20, Peak: 0.05}, 10},
+		{"peak limited", Loudness{Gain: 20, Peak: 0.5}, 2},
+		{"unknown peak", Loudness{Gain: 20}, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.loudness.factor(); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("factor is %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
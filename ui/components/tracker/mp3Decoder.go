@@ -0,0 +1,113 @@
+package tracker
+
+import (
+	"io"
+
+	mp3 "github.com/dece2183/go-stream-mp3"
+	"github.com/dece2183/yamusic-tui/stream"
+)
+
+// number of frames decoded and dropped before the seek target to fill the bit reservoir of the decoder
+const _MP3_PRIMING_FRAMES = 2
+
+// mp3Decoder seeks the MP3 stream by the PCM position using the frame index of the stream,
+// so the position is exact for the VBR tracks and the decoding starts from the frame boundary.
+type mp3Decoder struct {
+	stream  *stream.BufferedStream
+	index   *stream.MP3Index
+	decoder *mp3.Decoder
+	// position of the decoded PCM in bytes
+	pos int64
+}
+
+// sequentialReader hides the seeking of the stream from the mp3 decoder, so it doesn't rewind it
+type sequentialReader struct {
+	io.Reader
+}
+
+func newMP3Decoder(s *stream.BufferedStream) (Decoder, error) {
+	decoder, err := mp3.NewDecoder(sequentialReader{s})
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := stream.NewMP3Index(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mp3Decoder{stream: s, index: index, decoder: decoder}, nil
+}
+
+func (d *mp3Decoder) Read(dest []byte) (int, error) {
+	if d.decoder == nil {
+		return 0, io.EOF
+	}
+
+	n, err := d.decoder.Read(dest)
+	d.pos += int64(n)
+	return n, err
+}
+
+// Seek moves to the PCM position in bytes.
+func (d *mp3Decoder) Seek(offset int64, whence int) (int64, error) {
+	pos := offset
+	switch whence {
+	case io.SeekCurrent:
+		pos += d.pos
+	case io.SeekEnd:
+		return d.pos, errSeekFromEnd
+	}
+
+	if pos < 0 {
+		pos = 0
+	}
+	pos -= pos % _PCM_FRAME_SIZE
+
+	frameSize := int64(d.index.SamplesPerFrame() * _PCM_FRAME_SIZE)
+	frame := pos / frameSize
+	start := max(frame-_MP3_PRIMING_FRAMES, 0)
+
+	err := d.decodeFrom(start, pos-start*frameSize)
+	if err != nil && start < frame {
+		// the priming frames are broken, so start right from the target one
+		err = d.decodeFrom(frame, pos-frame*frameSize)
+	}
+	if err != nil {
+		return d.pos, err
+	}
+
+	d.pos = pos
+	return pos, nil
+}
+
+func (d *mp3Decoder) SampleRate() int {
+	return d.index.SampleRate()
+}
+
+// decodeFrom restarts the decoding from the frame and drops the PCM bytes before the target position.
+func (d *mp3Decoder) decodeFrom(frame, skip int64) error {
+	offset, _ := d.index.FrameOffset(frame)
+	if _, err := d.stream.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	if offset >= d.stream.Length() {
+		// the position is beyond the last frame
+		d.decoder = nil
+		return nil
+	}
+
+	decoder, err := mp3.NewDecoder(sequentialReader{d.stream})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(io.Discard, decoder, skip)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	d.decoder = decoder
+	return nil
+}
@@ -0,0 +1,95 @@
+package tracker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/dece2183/yamusic-tui/stream"
+)
+
+const (
+	testFrames    = 50
+	testFramePCM  = 1152 * _PCM_FRAME_SIZE
+	testStreamPCM = testFrames * testFramePCM
+)
+
+// newTestMP3 returns the silent MPEG-1 Layer III 128 kbps 44100 Hz stream prefixed with the ID3v2 tag of the size.
+func newTestMP3(id3Size int) []byte {
+	var data []byte
+	if id3Size > 0 {
+		data = append(data, 'I', 'D', '3', 4, 0, 0, 0, 0, byte(id3Size>>7&0x7f), byte(id3Size&0x7f))
+		data = append(data, make([]byte, id3Size)...)
+	}
+	for i := 0; i < testFrames; i++ {
+		frame := make([]byte, 417)
+		copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+		data = append(data, frame...)
+	}
+	return data
+}
+
+func TestMP3DecoderSeek(t *testing.T) {
+	tests := []struct {
+		offset int64
+		whence int
+		want   int64
+	}{
+		{0, io.SeekStart, 0},
+		{20 * testFramePCM, io.SeekStart, 20 * testFramePCM},
+		{20*testFramePCM + 100, io.SeekStart, 20*testFramePCM + 100},
+		{20*testFramePCM + 101, io.SeekStart, 20*testFramePCM + 100},
+		{1, io.SeekStart, 0},
+		{(testFrames - 1) * testFramePCM, io.SeekStart, (testFrames - 1) * testFramePCM},
+		{testStreamPCM, io.SeekStart, testStreamPCM},
+		{-testFramePCM, io.SeekStart, 0},
+		{testFramePCM, io.SeekCurrent, 11 * testFramePCM},
+		{-testFramePCM, io.SeekCurrent, 9 * testFramePCM},
+	}
+
+	for _, id3Size := range []int{0, 300} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("id3 %d, offset %d, whence %d", id3Size, tt.offset, tt.whence), func(t *testing.T) {
+				data := newTestMP3(id3Size)
+				s := stream.NewBufferedStream(io.NopCloser(bytes.NewReader(data)), int64(len(data)))
+				t.Cleanup(func() { s.Close() })
+
+				d, err := newMP3Decoder(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err = io.CopyN(io.Discard, d, 10*testFramePCM); err != nil {
+					t.Fatal(err)
+				}
+
+				pos, err := d.Seek(tt.offset, tt.whence)
+				if pos != tt.want || err != nil {
+					t.Fatalf("seeked to %d, %v; want %d", pos, err, tt.want)
+				}
+
+				rest, err := io.ReadAll(d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if int64(len(rest)) != testStreamPCM-tt.want {
+					t.Errorf("%d bytes decoded after the seek, want %d", len(rest), testStreamPCM-tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestMP3DecoderSeekFromEnd(t *testing.T) {
+	data := newTestMP3(0)
+	s := stream.NewBufferedStream(io.NopCloser(bytes.NewReader(data)), int64(len(data)))
+	t.Cleanup(func() { s.Close() })
+
+	d, err := newMP3Decoder(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Seek(0, io.SeekEnd); err != errSeekFromEnd {
+		t.Errorf("seeking from the end returned %v, want %v", err, errSeekFromEnd)
+	}
+}
@@ -2,41 +2,104 @@ package tracker
 
 import (
 	"io"
+	"sync"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
-	mp3 "github.com/dece2183/go-stream-mp3"
 	"github.com/dece2183/yamusic-tui/log"
 	"github.com/dece2183/yamusic-tui/stream"
 )
 
 const (
 	_PROGRESS_UPDATE_PERIOD = 33 * time.Millisecond
+	// the next track is mixed only if this much of its stream is downloaded ahead,
+	// so the decoding never waits for the network on the audio thread
+	_MIX_READAHEAD = 64 * 1024
+	// the PCM skipped after the broken frame, the length of the MPEG-1 Layer III frame
+	_BROKEN_FRAME_SKIP = 1152 * _PCM_FRAME_SIZE
+	// the playback is stopped if the decoding fails this many times in a row
+	_DECODING_ERRORS_LIMIT = 8
 )
 
 type readWrapper struct {
 	program        *tea.Program
-	decoder        *mp3.Decoder
+	codec          string
+	decoder        Decoder
 	trackBuffer    *stream.BufferedStream
 	trackBuffered  bool
 	lastUpdateTime time.Time
+	decodingError  error
+	decodingErrors int
+
+	// length, fade points, normalization gain and the PCM position of the current track
+	length time.Duration
+	fade   fadePoints
+	gain   float64
+	pos    int64
+	// the current track was started by the crossfade and its fade-in isn't finished
+	fadingIn  bool
+	crossfade bool
+	mixBuffer []byte
+
+	// the decoder of the next track that continues the playback without a gap
+	nextMux  sync.Mutex
+	next     *trackDecoder
+	switched bool
+}
+
+type trackDecoder struct {
+	buffer  *stream.BufferedStream
+	codec   string
+	decoder Decoder
+	length  time.Duration
+	fade    fadePoints
+	gain    float64
+	pos     int64
+}
+
+// newTrackDecoder creates the decoder of the track stream.
+// It reads the stream header, so the call can block until it's downloaded.
+func newTrackDecoder(reader *stream.BufferedStream, codec string, length time.Duration, fade fadePoints, loudness Loudness) (*trackDecoder, error) {
+	decoder, err := newDecoder(codec, reader)
+	if err != nil {
+		return nil, err
+	}
+	return &trackDecoder{buffer: reader, codec: codec, decoder: decoder, length: length, fade: fade, gain: loudness.factor()}, nil
 }
 
-func (w *readWrapper) NewReader(reader *stream.BufferedStream) {
+func (w *readWrapper) NewReader(reader *stream.BufferedStream, codec string, length time.Duration, fade fadePoints, loudness Loudness) error {
 	var err error
 
-	w.trackBuffered = false
-	w.trackBuffer = reader
-	w.decoder, err = mp3.NewDecoder(w.trackBuffer)
+	w.decoder, err = newDecoder(codec, reader)
 	if err != nil {
-		log.Print(log.LVL_ERROR, "failed to create mp3 decoder: %s", err)
-		return
+		log.Print(log.LVL_ERROR, "failed to create %s decoder: %s", codec, err)
+		w.trackBuffer = nil
+		return err
 	}
 
+	w.trackBuffered = false
+	w.trackBuffer = reader
+	w.trackBuffer.OnReconnect(w.reconnectHandler)
+	w.codec = codec
+	w.decodingError = nil
+	w.decodingErrors = 0
+	w.length = length
+	w.fade = fade
+	w.gain = loudness.factor()
+	w.pos = 0
+	w.fadingIn = false
+	w.crossfade = crossfadeDuration() > 0
 	w.lastUpdateTime = time.Now()
+	return nil
 }
 
 func (w *readWrapper) Close() {
+	w.setNext(nil)
+
+	w.nextMux.Lock()
+	w.switched = false
+	w.nextMux.Unlock()
+
 	if w.decoder != nil {
 		w.decoder.Seek(0, io.SeekStart)
 	}
@@ -52,6 +115,7 @@ func (w *readWrapper) Read(dest []byte) (n int, err error) {
 		return
 	}
 
+	var broken bool
 	n, err = w.decoder.Read(dest)
 	if err != nil && err != io.EOF {
 		if w.trackBuffer.Error() != nil {
@@ -60,12 +124,38 @@ func (w *readWrapper) Read(dest []byte) (n int, err error) {
 			go w.program.Send(STOP)
 			return
 		}
-		// bypass mp3 decoding error after rewinding
-		log.Print(log.LVL_WARNIGN, "mp3 decoding error: %s", err)
-		err = nil
+		if !w.trackBuffer.IsDone() {
+			w.decodingErrors++
+			if w.decodingErrors > _DECODING_ERRORS_LIMIT {
+				w.decodingError = err
+				log.Print(log.LVL_ERROR, "%s decoding error: %s", w.codec, err)
+				go w.program.Send(STOP)
+				return
+			}
+			log.Print(log.LVL_WARNIGN, "%s decoding error, the broken frame is skipped: %s", w.codec, err)
+			broken = true
+			err = nil
+		} else {
+			// the garbage after the last frame
+			err = io.EOF
+		}
+	} else if n > 0 {
+		w.decodingErrors = 0
 	}
 
-	if w.trackBuffer.IsBuffered() && !w.trackBuffered {
+	w.applyGain(dest[:n])
+
+	if broken {
+		if seekErr := w.skipBrokenFrame(); seekErr != nil {
+			w.decodingError = seekErr
+			log.Print(log.LVL_ERROR, "%s decoding error: %s", w.codec, seekErr)
+			go w.program.Send(STOP)
+			return
+		}
+	}
+
+	// the switched track is reported as buffered only after it becomes current in the tracker
+	if w.trackBuffer.IsBuffered() && !w.trackBuffered && !w.isSwitched() {
 		w.trackBuffered = true
 		go w.program.Send(BUFFERING_COMPLETE)
 	}
@@ -73,10 +163,20 @@ func (w *readWrapper) Read(dest []byte) (n int, err error) {
 	if w.trackBuffer.IsDone() {
 		w.decoder.Seek(0, io.SeekStart)
 		w.trackBuffer.Close()
-		go w.program.Send(NEXT)
+		if w.switchToNext() {
+			// fill the rest of the destination with the next track to avoid the gap
+			if n < len(dest) {
+				var nextN int
+				nextN, _ = w.decoder.Read(dest[n:])
+				w.applyGain(dest[n : n+nextN])
+				n += nextN
+			}
+			err = nil
+		}
+		go w.program.Send(ENDED)
 	} else if time.Since(w.lastUpdateTime) > _PROGRESS_UPDATE_PERIOD {
 		w.lastUpdateTime = time.Now()
-		fraction := ProgressControl(w.trackBuffer.Progress())
+		fraction := ProgressControl(w.Progress())
 		go w.program.Send(fraction)
 	}
 
@@ -85,13 +185,168 @@ func (w *readWrapper) Read(dest []byte) (n int, err error) {
 
 func (w *readWrapper) Seek(offset int64, whence int) (int64, error) {
 	w.lastUpdateTime = time.Now()
-	return w.decoder.Seek(offset, whence)
+	pos, err := w.decoder.Seek(offset, whence)
+	if err == nil {
+		w.pos = pos
+		w.fadingIn = false
+	}
+
+	// the crossfade starts over from the beginning of the next track
+	w.nextMux.Lock()
+	if w.next != nil && w.next.pos > 0 {
+		w.next.decoder.Seek(0, io.SeekStart)
+		w.next.pos = 0
+	}
+	w.nextMux.Unlock()
+
+	return pos, err
+}
+
+// skipBrokenFrame restarts the decoding from the frame that follows the broken one.
+func (w *readWrapper) skipBrokenFrame() error {
+	pos, err := w.decoder.Seek(_BROKEN_FRAME_SKIP, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	w.pos = pos
+	return nil
+}
+
+// Position returns the time of the decoded PCM position.
+func (w *readWrapper) Position() time.Duration {
+	if w.decoder == nil {
+		return 0
+	}
+	return time.Duration(w.pos) * time.Second / time.Duration(w.decoder.SampleRate()*_PCM_FRAME_SIZE)
+}
+
+// PCMOffset returns the PCM position in bytes of the time aligned to the PCM frame.
+func (w *readWrapper) PCMOffset(pos time.Duration) int64 {
+	if w.decoder == nil {
+		return 0
+	}
+	return int64(pos.Seconds()*float64(w.decoder.SampleRate())) * _PCM_FRAME_SIZE
 }
 
-func (w *readWrapper) Length() int64 {
-	return w.trackBuffer.Length()
+func (w *readWrapper) Length() time.Duration {
+	return w.length
 }
 
 func (w *readWrapper) Progress() float64 {
-	return w.trackBuffer.Progress()
+	if w.length <= 0 {
+		return 0
+	}
+	return min(w.Position().Seconds()/w.length.Seconds(), 1)
+}
+
+// reconnectHandler makes the tracker show the reconnecting state of the current track stream.
+func (w *readWrapper) reconnectHandler(bool) {
+	go w.program.Send(RECONNECTING)
+}
+
+// setNext sets the decoder to switch to when the current track ends, nil drops the previous one.
+func (w *readWrapper) setNext(next *trackDecoder) {
+	w.nextMux.Lock()
+	defer w.nextMux.Unlock()
+
+	if w.next != nil {
+		w.next.buffer.Close()
+	}
+	w.next = next
+}
+
+func (w *readWrapper) switchToNext() bool {
+	w.nextMux.Lock()
+	defer w.nextMux.Unlock()
+
+	if w.next == nil {
+		return false
+	}
+
+	w.trackBuffer = w.next.buffer
+	w.trackBuffer.OnReconnect(w.reconnectHandler)
+	w.codec = w.next.codec
+	w.decoder = w.next.decoder
+	w.length = w.next.length
+	w.fade = w.next.fade
+	w.gain = w.next.gain
+	w.fadingIn = w.next.pos > 0
+	w.pos = w.next.pos
+	w.trackBuffered = false
+	w.lastUpdateTime = time.Now()
+	w.next = nil
+	w.switched = true
+	return true
+}
+
+func (w *readWrapper) isSwitched() bool {
+	w.nextMux.Lock()
+	defer w.nextMux.Unlock()
+	return w.switched
+}
+
+// takeSwitched reports whether the wrapper has switched to the next track since the last call.
+func (w *readWrapper) takeSwitched() bool {
+	w.nextMux.Lock()
+	defer w.nextMux.Unlock()
+
+	switched := w.switched
+	w.switched = false
+	return switched
+}
+
+// applyGain normalizes the loudness of the current track, finishes its fade-in and mixes
+// the head of the next track into the tail of the current one when the crossfade is on.
+func (w *readWrapper) applyGain(pcm []byte) {
+	sampleRate := w.decoder.SampleRate()
+	bytesPerSecond := float64(sampleRate * _PCM_FRAME_SIZE)
+	start := float64(w.pos) / bytesPerSecond
+	end := float64(w.pos+int64(len(pcm))) / bytesPerSecond
+	w.pos += int64(len(pcm))
+
+	w.nextMux.Lock()
+	defer w.nextMux.Unlock()
+
+	fadeIn := w.fadingIn && start < w.fade.inStop
+	fadeOut := w.crossfade && w.next != nil && end > w.fade.outStart
+	// the plain fade-out is used while the head of the next track isn't downloaded
+	mix := fadeOut && w.next.buffer.IsBufferedAhead(_MIX_READAHEAD)
+	if !fadeIn {
+		w.fadingIn = false
+	}
+	if !fadeIn && !fadeOut {
+		if w.gain != 1 {
+			mixPCM(pcm, nil, sampleRate, func(float64) float64 { return w.gain }, nil)
+		}
+		return
+	}
+
+	var in []byte
+	var inStart float64
+	if mix {
+		if cap(w.mixBuffer) < len(pcm) {
+			w.mixBuffer = make([]byte, len(pcm))
+		}
+		in = w.mixBuffer[:len(pcm)]
+		inStart = float64(w.next.pos) / bytesPerSecond
+		n, _ := w.next.decoder.Read(in)
+		in = in[:n]
+		w.next.pos += int64(n)
+	}
+
+	outGain := func(offset float64) float64 {
+		gain := w.gain
+		if fadeIn {
+			gain *= w.fade.inGain(start + offset)
+		}
+		if fadeOut {
+			gain *= w.fade.outGain(start + offset)
+		}
+		return gain
+	}
+	inGain := func(offset float64) float64 {
+		return w.next.gain * w.next.fade.inGain(inStart+offset)
+	}
+
+	mixPCM(pcm, in, sampleRate, outGain, inGain)
 }
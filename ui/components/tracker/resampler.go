@@ -0,0 +1,121 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// the decoded PCM is read by the chunks of this size
+const _RESAMPLER_READ_CHUNK = 16 * 1024
+
+// resampler converts the PCM of the decoder to the other sample rate by the linear interpolation.
+// It seeks by the position of the converted PCM.
+type resampler struct {
+	decoder Decoder
+	inRate  int64
+	outRate int64
+	// the decoded PCM starting from the frame of the number
+	in      []byte
+	inFrame int64
+	eof     bool
+	// position of the converted PCM in frames
+	pos int64
+}
+
+func newResampler(decoder Decoder, sampleRate int) *resampler {
+	return &resampler{decoder: decoder, inRate: int64(decoder.SampleRate()), outRate: int64(sampleRate)}
+}
+
+func (r *resampler) Read(dest []byte) (n int, err error) {
+	for n+_PCM_FRAME_SIZE <= len(dest) {
+		// the converted frame is between the decoded frames
+		frame := r.pos * r.inRate / r.outRate
+		weight := r.pos * r.inRate % r.outRate
+
+		available := r.inFrame + int64(len(r.in)/_PCM_FRAME_SIZE)
+		if frame+1 >= available && !r.eof {
+			if err = r.fill(frame); err != nil {
+				break
+			}
+			continue
+		}
+		if frame >= available {
+			break
+		}
+
+		current := r.in[(frame-r.inFrame)*_PCM_FRAME_SIZE:]
+		next := current
+		if frame+1 < available {
+			next = current[_PCM_FRAME_SIZE:]
+		}
+		for ch := 0; ch < _PCM_FRAME_SIZE; ch += 2 {
+			a := int64(int16(binary.LittleEndian.Uint16(current[ch:])))
+			b := int64(int16(binary.LittleEndian.Uint16(next[ch:])))
+			binary.LittleEndian.PutUint16(dest[n+ch:], uint16(int16(a+(b-a)*weight/r.outRate)))
+		}
+		n += _PCM_FRAME_SIZE
+		r.pos++
+	}
+
+	if n == 0 && r.eof && err == nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// fill drops the decoded PCM before the frame and decodes more.
+func (r *resampler) fill(frame int64) error {
+	if drop := min(frame-r.inFrame, int64(len(r.in)/_PCM_FRAME_SIZE)); drop > 0 {
+		r.in = r.in[:copy(r.in, r.in[drop*_PCM_FRAME_SIZE:])]
+		r.inFrame += drop
+	}
+
+	start := len(r.in)
+	if cap(r.in)-start < _RESAMPLER_READ_CHUNK {
+		in := make([]byte, start, start+_RESAMPLER_READ_CHUNK)
+		copy(in, r.in)
+		r.in = in
+	}
+
+	n, err := r.decoder.Read(r.in[start : start+_RESAMPLER_READ_CHUNK])
+	r.in = r.in[:start+n]
+	if err == io.EOF {
+		r.eof = true
+		return nil
+	}
+	return err
+}
+
+// Seek moves to the position of the converted PCM in bytes.
+func (r *resampler) Seek(offset int64, whence int) (int64, error) {
+	pos := offset
+	switch whence {
+	case io.SeekCurrent:
+		pos += r.pos * _PCM_FRAME_SIZE
+	case io.SeekEnd:
+		return r.pos * _PCM_FRAME_SIZE, errSeekFromEnd
+	}
+	if pos < 0 {
+		pos = 0
+	}
+
+	frame := pos / _PCM_FRAME_SIZE
+	inPos, err := r.decoder.Seek(frame*r.inRate/r.outRate*_PCM_FRAME_SIZE, io.SeekStart)
+	if err != nil {
+		return r.pos * _PCM_FRAME_SIZE, err
+	}
+
+	r.in = r.in[:0]
+	r.inFrame = inPos / _PCM_FRAME_SIZE
+	r.eof = false
+	// the decoder can start from the other frame, e.g. after the broken one
+	if r.inFrame != frame*r.inRate/r.outRate {
+		frame = (r.inFrame*r.outRate + r.inRate - 1) / r.inRate
+	}
+	r.pos = frame
+	return r.pos * _PCM_FRAME_SIZE, nil
+}
+
+func (r *resampler) SampleRate() int {
+	return int(r.outRate)
+}
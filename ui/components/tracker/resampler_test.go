@@ -0,0 +1,87 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// rampDecoder decodes the frames of the ramp, the left channel of the frame is its number multiplied by the step
+type rampDecoder struct {
+	rate   int
+	frames int64
+	step   int64
+	pos    int64
+}
+
+func (d *rampDecoder) Read(dest []byte) (n int, err error) {
+	for ; n+_PCM_FRAME_SIZE <= len(dest) && d.pos < d.frames; d.pos++ {
+		binary.LittleEndian.PutUint16(dest[n:], uint16(int16(d.pos*d.step)))
+		binary.LittleEndian.PutUint16(dest[n+2:], uint16(int16(-d.pos*d.step)))
+		n += _PCM_FRAME_SIZE
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (d *rampDecoder) Seek(offset int64, whence int) (int64, error) {
+	d.pos = min(offset/_PCM_FRAME_SIZE, d.frames)
+	return d.pos * _PCM_FRAME_SIZE, nil
+}
+
+func (d *rampDecoder) SampleRate() int {
+	return d.rate
+}
+
+func TestResampler(t *testing.T) {
+	const frames = 10000
+
+	tests := []struct {
+		inRate, outRate int
+		seek            int64
+	}{
+		{22050, 44100, 0},
+		{22050, 44100, 1001},
+		{48000, 44100, 0},
+		{48000, 44100, 7777},
+		{96000, 44100, 3000},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d to %d from %d", tt.inRate, tt.outRate, tt.seek), func(t *testing.T) {
+			r := newResampler(&rampDecoder{rate: tt.inRate, frames: frames, step: 3}, tt.outRate)
+			if r.SampleRate() != tt.outRate {
+				t.Errorf("sample rate is %d, want %d", r.SampleRate(), tt.outRate)
+			}
+
+			pos, err := r.Seek(tt.seek*_PCM_FRAME_SIZE, io.SeekStart)
+			if err != nil || pos != tt.seek*_PCM_FRAME_SIZE {
+				t.Fatalf("seeked to %d, %v; want %d", pos, err, tt.seek*_PCM_FRAME_SIZE)
+			}
+
+			pcm, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			total := (frames*int64(tt.outRate) + int64(tt.inRate) - 1) / int64(tt.inRate)
+			if got := int64(len(pcm) / _PCM_FRAME_SIZE); got != total-tt.seek {
+				t.Fatalf("%d frames resampled, want %d", got, total-tt.seek)
+			}
+
+			for i := 0; i < len(pcm); i += _PCM_FRAME_SIZE {
+				frame := tt.seek + int64(i/_PCM_FRAME_SIZE)
+				// the position of the frame in the ramp, the last one is repeated
+				want := min(frame*int64(tt.inRate)*3/int64(tt.outRate), (frames-1)*3)
+				left := int64(int16(binary.LittleEndian.Uint16(pcm[i:])))
+				right := int64(int16(binary.LittleEndian.Uint16(pcm[i+2:])))
+				if left != want || right != -want {
+					t.Fatalf("frame %d is %d %d, want %d %d", frame, left, right, want, -want)
+				}
+			}
+		})
+	}
+}
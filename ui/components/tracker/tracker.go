@@ -3,7 +3,6 @@ package tracker
 import (
 	"fmt"
 	"io"
-	"math"
 	"strings"
 	"time"
 
@@ -36,6 +35,12 @@ const (
 	CACHE_TRACK
 	BUFFERING_COMPLETE
 	TOGGLE_LYRICS
+	REPEAT
+	STOP_AFTER
+	// Sent when the track is played to the end
+	ENDED
+	// Sent when the track stream starts or stops reconnecting to the source
+	RECONNECTING
 )
 
 type ProgressControl float64
@@ -60,6 +65,16 @@ type Model struct {
 	showError  bool
 	errorText  string
 
+	source Source
+	// the track that is played right after the current one without a gap
+	next *Preloaded
+
+	repeat           config.RepeatType
+	shuffle          bool
+	stopAfterCurrent bool
+	// the server is unreachable and only the cached tracks are played
+	offline bool
+
 	volume         float64
 	volumeIncremet float64
 	playerContext  *oto.Context
@@ -78,6 +93,8 @@ func New(p *tea.Program, likesMap *map[string]bool) *Model {
 		help:       help.New(),
 		volume:     config.Current.Volume,
 		showLyrics: config.Current.ShowLyrics,
+		repeat:     config.Current.Repeat,
+		shuffle:    config.Current.Shuffle,
 	}
 
 	m.volumeIncremet = m.volume / _VOLUME_FADE_STEPS
@@ -90,8 +107,23 @@ func New(p *tea.Program, likesMap *map[string]bool) *Model {
 
 	m.trackWrapper = &readWrapper{program: m.program}
 
+	m.playerContext = newPlayerContext()
+	return m
+}
+
+// sample rate of the player, the PCM of the other rates is resampled to it
+const _SAMPLE_RATE = 44100
+
+// oto allows only one context per process, so it's shared between the tracker instances
+var sharedPlayerContext *oto.Context
+
+func newPlayerContext() *oto.Context {
+	if sharedPlayerContext != nil {
+		return sharedPlayerContext
+	}
+
 	op := &oto.NewContextOptions{
-		SampleRate:   44100,
+		SampleRate:   _SAMPLE_RATE,
 		ChannelCount: 2,
 		BufferSize:   time.Millisecond * time.Duration(config.Current.BufferSize),
 		Format:       oto.FormatSignedInt16LE,
@@ -99,14 +131,14 @@ func New(p *tea.Program, likesMap *map[string]bool) *Model {
 
 	var err error
 	var readyChan chan struct{}
-	m.playerContext, readyChan, err = oto.NewContext(op)
+	sharedPlayerContext, readyChan, err = oto.NewContext(op)
 	if err != nil {
 		log.Print(log.LVL_PANIC, "failed to create player context: %s", err)
 		model.PrettyExit(err, 12)
 	}
 	<-readyChan
 
-	return m
+	return sharedPlayerContext
 }
 
 func (m *Model) Init() tea.Cmd {
@@ -150,7 +182,39 @@ func (m *Model) View() string {
 			trackLike = style.IconNotLiked + " "
 		}
 
-		trackAddInfo := style.TrackAddInfoStyle.Render(trackLike + trackTime)
+		var playMode string
+		if m.offline {
+			playMode += style.IconOffline + " offline "
+		}
+		if m.stopAfterCurrent {
+			playMode += style.IconStopAfter + " "
+		}
+		if m.shuffle {
+			playMode += style.IconShuffle + " "
+		}
+		switch m.repeat {
+		case config.REPEAT_ALL:
+			playMode += style.IconRepeatAll + " "
+		case config.REPEAT_ONE:
+			playMode += style.IconRepeatOne + " "
+		}
+
+		var quality string
+		if len(m.source.Codec) > 0 {
+			quality = m.source.Codec
+			if m.source.BitrateKbps > 0 {
+				quality += fmt.Sprintf(" %dk", m.source.BitrateKbps)
+			}
+			if m.source.Metered {
+				quality = style.IconMetered + " " + quality
+			}
+			quality += " "
+		}
+		if !m.IsStoped() && m.trackWrapper.trackBuffer.IsReconnecting() {
+			quality = style.IconReconnect + " reconnecting… "
+		}
+
+		trackAddInfo := style.TrackAddInfoStyle.Render(playMode + quality + trackLike + trackTime)
 		addInfoLen := lipgloss.Width(trackAddInfo)
 		maxLen := m.Width() - addInfoLen - 4
 		stl := lipgloss.NewStyle().MaxWidth(maxLen - 1)
@@ -256,6 +320,14 @@ func (m *Model) Update(message tea.Msg) (*Model, tea.Cmd) {
 		case controls.PlayerToggleLyrics.Contains(keypress):
 			m.SetLirycs(!m.showLyrics)
 			cmds = append(cmds, model.Cmd(TOGGLE_LYRICS))
+
+		case controls.PlayerRepeat.Contains(keypress):
+			m.SetRepeat((m.repeat + 1) % (config.REPEAT_ONE + 1))
+			cmds = append(cmds, model.Cmd(REPEAT))
+
+		case controls.PlayerStopAfter.Contains(keypress):
+			m.SetStopAfterCurrent(!m.stopAfterCurrent)
+			cmds = append(cmds, model.Cmd(STOP_AFTER))
 		}
 
 	// player control update
@@ -311,7 +383,10 @@ func (m *Model) Progress() float64 {
 }
 
 func (m *Model) Position() time.Duration {
-	return time.Duration(float64(m.track.DurationMs)*m.trackWrapper.Progress()) * time.Millisecond
+	if m.IsStoped() {
+		return 0
+	}
+	return m.trackWrapper.Position()
 }
 
 func (m *Model) SetVolume(v float64) {
@@ -332,11 +407,63 @@ func (m *Model) SetLirycs(show bool) {
 	config.Save()
 }
 
+func (m *Model) SetRepeat(repeat config.RepeatType) {
+	m.repeat = repeat
+	if m.repeat == config.REPEAT_ONE {
+		m.SetNext(nil)
+	}
+	config.Current.Repeat = m.repeat
+	config.Save()
+}
+
+func (m *Model) Repeat() config.RepeatType {
+	return m.repeat
+}
+
+func (m *Model) SetShuffle(shuffle bool) {
+	m.shuffle = shuffle
+	config.Current.Shuffle = m.shuffle
+	config.Save()
+}
+
+func (m *Model) Shuffle() bool {
+	return m.shuffle
+}
+
+// SetOffline shows whether the server is unreachable.
+func (m *Model) SetOffline(offline bool) {
+	m.offline = offline
+}
+
+// SetStopAfterCurrent makes the player stop when the current track ends.
+// The mode is reset after the stop.
+func (m *Model) SetStopAfterCurrent(stop bool) {
+	m.stopAfterCurrent = stop
+	if m.stopAfterCurrent {
+		m.SetNext(nil)
+	}
+}
+
+func (m *Model) StopAfterCurrent() bool {
+	return m.stopAfterCurrent
+}
+
 func (m *Model) Volume() float64 {
 	return m.volume
 }
 
-func (m *Model) StartTrack(track *api.Track, reader *stream.BufferedStream, lyrics []api.LyricPair) {
+// Source is the encoded stream of the track
+type Source struct {
+	Stream      *stream.BufferedStream
+	Codec       string
+	BitrateKbps int
+	// The stream is read from the cache
+	Cached bool
+	// The bitrate is lowered because of the slow downloads
+	Metered bool
+}
+
+func (m *Model) StartTrack(track *api.Track, source Source, lyrics []api.LyricPair, loudness Loudness) {
 	m.showError = false
 	m.volume = config.Current.Volume
 
@@ -345,14 +472,88 @@ func (m *Model) StartTrack(track *api.Track, reader *stream.BufferedStream, lyri
 	}
 
 	m.track = *track
-	m.trackWrapper.NewReader(reader)
+	m.source = source
+	length := time.Duration(track.DurationMs) * time.Millisecond
+	err := m.trackWrapper.NewReader(source.Stream, source.Codec, length, trackFade(track, crossfadeDuration()), loudness)
+	if err != nil {
+		source.Stream.Close()
+		m.ShowError("track decoding")
+		return
+	}
+
 	m.player = m.playerContext.NewPlayer(m.trackWrapper)
 	m.player.SetVolume(0)
 	m.player.Play()
 	m.lyrics = lyrics
 }
 
+// Preloaded is the track prepared to continue the playback right after the current one.
+type Preloaded struct {
+	track   api.Track
+	source  Source
+	lyrics  []api.LyricPair
+	decoder *trackDecoder
+}
+
+// Preload creates the decoder of the track stream in advance.
+// It reads the stream header, so it should be called in the background.
+func Preload(track *api.Track, source Source, lyrics []api.LyricPair, loudness Loudness) (*Preloaded, error) {
+	length := time.Duration(track.DurationMs) * time.Millisecond
+	decoder, err := newTrackDecoder(source.Stream, source.Codec, length, trackFade(track, crossfadeDuration()), loudness)
+	if err != nil {
+		return nil, err
+	}
+	return &Preloaded{track: *track, source: source, lyrics: lyrics, decoder: decoder}, nil
+}
+
+// Close releases the stream of the preloaded track that won't be played.
+func (p *Preloaded) Close() {
+	p.decoder.buffer.Close()
+}
+
+// SetNext queues the preloaded track to be played without a gap when the current one ends.
+// Nil drops the queued track.
+func (m *Model) SetNext(next *Preloaded) {
+	if next != nil && (m.player == nil || m.stopAfterCurrent || m.repeat == config.REPEAT_ONE) {
+		next.Close()
+		return
+	}
+
+	m.next = next
+	if next != nil {
+		m.trackWrapper.setNext(next.decoder)
+	} else {
+		m.trackWrapper.setNext(nil)
+	}
+}
+
+// HasNext reports whether the next track is preloaded.
+func (m *Model) HasNext() bool {
+	return m.next != nil
+}
+
+// ContinueWith makes the track current if the player has already switched to it without a gap.
+func (m *Model) ContinueWith(track *api.Track) bool {
+	next := m.next
+	if next == nil || !m.trackWrapper.takeSwitched() {
+		return false
+	}
+
+	m.next = nil
+	if next.track.Id != track.Id {
+		return false
+	}
+
+	m.showError = false
+	m.track = next.track
+	m.source = next.source
+	m.lyrics = next.lyrics
+	return true
+}
+
 func (m *Model) Stop() {
+	m.next = nil
+
 	if m.player == nil {
 		return
 	}
@@ -364,6 +565,8 @@ func (m *Model) Stop() {
 
 	if m.trackWrapper.trackBuffer.Error() != nil {
 		m.ShowError("track buffering")
+	} else if m.trackWrapper.decodingError != nil {
+		m.ShowError("track decoding")
 	}
 
 	m.trackWrapper.Close()
@@ -412,23 +615,7 @@ func (m *Model) Rewind(amount time.Duration) tea.Cmd {
 	}
 
 	m.player.SetVolume(0)
-
-	amountMs := float64(amount.Milliseconds())
-	currentPos := int64(float64(m.trackWrapper.Length()) * m.trackWrapper.Progress())
-	byteOffset := int64(math.Round((float64(m.trackWrapper.Length()) / float64(m.track.DurationMs)) * amountMs))
-
-	// align position by 4 bytes
-	currentPos += byteOffset
-	currentPos += currentPos % 4
-
-	if currentPos <= 0 {
-		m.player.Seek(0, io.SeekStart)
-	} else if currentPos >= m.trackWrapper.Length() {
-		m.player.Seek(0, io.SeekEnd)
-	} else {
-		m.player.Seek(currentPos, io.SeekStart)
-	}
-
+	m.seek(m.trackWrapper.Position() + amount)
 	return m.progress.SetPercent(m.trackWrapper.Progress())
 }
 
@@ -438,18 +625,28 @@ func (m *Model) SetPos(pos time.Duration) {
 		return
 	}
 
-	posMs := pos.Milliseconds()
-	byteOffset := int64(math.Round((float64(m.trackWrapper.Length()) / float64(m.track.DurationMs)) * float64(posMs)))
+	m.seek(pos)
+}
+
+// seek moves the player to the PCM frame of the position within the track.
+func (m *Model) seek(pos time.Duration) {
+	pos = max(0, min(pos, m.trackWrapper.Length()))
 
-	// align position by 4 bytes
-	byteOffset += byteOffset % 4
-	m.player.Seek(byteOffset, io.SeekStart)
+	_, err := m.player.Seek(m.trackWrapper.PCMOffset(pos), io.SeekStart)
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to seek the track to %s: %s", pos, err)
+	}
 }
 
 func (m *Model) TrackBuffer() *stream.BufferedStream {
 	return m.trackWrapper.trackBuffer
 }
 
+// Source returns the stream description of the current track.
+func (m *Model) Source() Source {
+	return m.source
+}
+
 func (m *Model) ShowError(text string) {
 	m.showError = true
 	m.errorText = text
@@ -15,10 +15,16 @@ type helpKeyMap struct {
 	Search             key.Binding
 	Share              key.Binding
 	Shuffle            key.Binding
+	Artist             key.Binding
+	Album              key.Binding
+	LikeAlbum          key.Binding
+	PlayNext           key.Binding
+	Enqueue            key.Binding
+	Queue              key.Binding
 	ShowHelp           key.Binding
 	CloseHelp          key.Binding
 
-	Shafflable bool
+	Editable bool
 }
 
 func (k helpKeyMap) ShortHelp() []key.Binding {
@@ -26,18 +32,22 @@ func (k helpKeyMap) ShortHelp() []key.Binding {
 }
 
 func (k helpKeyMap) FullHelp() [][]key.Binding {
-	if k.Shafflable {
+	if k.Editable {
 		return [][]key.Binding{
 			{k.CursorUp, k.CursorDown, k.Play},
 			{k.LikeUnlike, k.AddToPlaylist, k.RemoveFromPlaylist},
 			{k.Search, k.Share, k.Shuffle},
+			{k.Artist, k.Album, k.LikeAlbum},
+			{k.PlayNext, k.Enqueue, k.Queue},
 			{k.CloseHelp},
 		}
 	} else {
 		return [][]key.Binding{
 			{k.CursorUp, k.CursorDown, k.Play},
 			{k.LikeUnlike, k.AddToPlaylist},
-			{k.Search, k.Share},
+			{k.Search, k.Share, k.Shuffle},
+			{k.Artist, k.Album, k.LikeAlbum},
+			{k.PlayNext, k.Enqueue, k.Queue},
 			{k.CloseHelp},
 		}
 	}
@@ -53,6 +63,12 @@ var helpMap = helpKeyMap{
 	Search:             key.NewBinding(config.Current.Controls.TracksSearch.Binding(), config.Current.Controls.TracksSearch.Help("search")),
 	Share:              key.NewBinding(config.Current.Controls.TracksShare.Binding(), config.Current.Controls.TracksShare.Help("share")),
 	Shuffle:            key.NewBinding(config.Current.Controls.TracksShuffle.Binding(), config.Current.Controls.TracksShuffle.Help("shuffle")),
+	Artist:             key.NewBinding(config.Current.Controls.TracksArtist.Binding(), config.Current.Controls.TracksArtist.Help("artist")),
+	Album:              key.NewBinding(config.Current.Controls.TracksAlbum.Binding(), config.Current.Controls.TracksAlbum.Help("album")),
+	LikeAlbum:          key.NewBinding(config.Current.Controls.TracksLikeAlbum.Binding(), config.Current.Controls.TracksLikeAlbum.Help("like album")),
+	PlayNext:           key.NewBinding(config.Current.Controls.TracksPlayNext.Binding(), config.Current.Controls.TracksPlayNext.Help("play next")),
+	Enqueue:            key.NewBinding(config.Current.Controls.TracksEnqueue.Binding(), config.Current.Controls.TracksEnqueue.Help("enqueue")),
+	Queue:              key.NewBinding(config.Current.Controls.Queue.Binding(), config.Current.Controls.Queue.Help("queue")),
 	ShowHelp:           key.NewBinding(config.Current.Controls.ShowAllKeys.Binding(), config.Current.Controls.ShowAllKeys.Help("show keys")),
 	CloseHelp:          key.NewBinding(config.Current.Controls.ShowAllKeys.Binding(), config.Current.Controls.ShowAllKeys.Help("hide")),
 }
@@ -26,16 +26,26 @@ const (
 	LIKE
 	ADD_TO_PLAYLIST
 	REMOVE_FROM_PLAYLIST
+	OPEN_ARTIST
+	OPEN_ALBUM
+	LIKE_ALBUM
+	PLAY_NEXT
+	ENQUEUE
+	LOAD_MORE
 )
 
+// the distance from the end of the list at which the next page is requested
+const _LOAD_MORE_DISTANCE = 5
+
 type Model struct {
 	program       *tea.Program
 	list          list.Model
 	help          help.Model
 	width, height int
 
-	Title      string
-	Shufflable bool
+	Title     string
+	Editable  bool
+	Paginated bool
 }
 
 func New(p *tea.Program, likesMap *map[string]bool, cacheMap *map[string]bool) *Model {
@@ -70,7 +80,7 @@ func (m *Model) View() string {
 		m.list.Title = m.Title
 	}
 
-	helpMap.Shafflable = m.Shufflable
+	helpMap.Editable = m.Editable
 	listHeight := m.height
 
 	if m.help.ShowAll {
@@ -116,6 +126,9 @@ func (m *Model) Update(message tea.Msg) (*Model, tea.Cmd) {
 			cmds = append(cmds, model.Cmd(CURSOR_UP))
 		case controls.CursorDown.Contains(keypress):
 			cmds = append(cmds, model.Cmd(CURSOR_DOWN))
+			if m.Paginated && m.list.Index() >= len(m.list.Items())-_LOAD_MORE_DISTANCE {
+				cmds = append(cmds, model.Cmd(LOAD_MORE))
+			}
 		case controls.TracksSearch.Contains(keypress):
 			cmds = append(cmds, model.Cmd(SEARCH))
 		case controls.TracksShuffle.Contains(keypress):
@@ -128,6 +141,16 @@ func (m *Model) Update(message tea.Msg) (*Model, tea.Cmd) {
 			cmds = append(cmds, model.Cmd(ADD_TO_PLAYLIST))
 		case controls.TracksRemoveFromPlaylist.Contains(keypress):
 			cmds = append(cmds, model.Cmd(REMOVE_FROM_PLAYLIST))
+		case controls.TracksArtist.Contains(keypress):
+			cmds = append(cmds, model.Cmd(OPEN_ARTIST))
+		case controls.TracksAlbum.Contains(keypress):
+			cmds = append(cmds, model.Cmd(OPEN_ALBUM))
+		case controls.TracksLikeAlbum.Contains(keypress):
+			cmds = append(cmds, model.Cmd(LIKE_ALBUM))
+		case controls.TracksPlayNext.Contains(keypress):
+			cmds = append(cmds, model.Cmd(PLAY_NEXT))
+		case controls.TracksEnqueue.Contains(keypress):
+			cmds = append(cmds, model.Cmd(ENQUEUE))
 		}
 	}
 
@@ -0,0 +1,295 @@
+package mainpage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/log"
+	"github.com/dece2183/yamusic-tui/ui/components/playlist"
+	"github.com/dece2183/yamusic-tui/ui/components/tracker"
+)
+
+const (
+	_TRACKS_PAGE_SIZE = 50
+	_ALBUMS_PAGE_SIZE = 100
+)
+
+type tracksPage struct {
+	playlist *playlist.Item
+	tracks   []api.Track
+	total    int
+	err      error
+	// the page is requested by the end of the playing playlist, so the playback continues with it
+	playNext bool
+}
+
+type browseResults struct {
+	title string
+	items []*playlist.Item
+}
+
+// displaySection shows the items in the side panel section and selects the first of them.
+func (m *Model) displaySection(title string, items []*playlist.Item) tea.Cmd {
+	sectionIndex, cmd := m.setSection(title, items)
+	m.playlists.Select(sectionIndex + 1)
+	m.Send(playlist.CURSOR_DOWN)
+	return cmd
+}
+
+// setSection replaces the side panel section items keeping the playing and the selected playlists.
+func (m *Model) setSection(title string, items []*playlist.Item) (sectionIndex int, cmd tea.Cmd) {
+	m.markOfflinePlaylists(items)
+	m.keepPositions(func() {
+		sectionIndex, cmd = m.playlists.SetSection(title, items)
+	})
+	return sectionIndex, cmd
+}
+
+// keepPositions makes the side panel change keeping the playing and the selected playlists,
+// the playing playlist could be moved or replaced by the change.
+func (m *Model) keepPositions(change func()) {
+	var currentPlaylist *playlist.Item
+	if m.currentPlaylistIndex >= 0 {
+		currentPlaylist = m.playlists.Items()[m.currentPlaylistIndex]
+	}
+	selectedPlaylist := m.playlists.SelectedItem()
+
+	change()
+
+	m.currentPlaylistIndex = -1
+	for i, pl := range m.playlists.Items() {
+		if pl == currentPlaylist {
+			m.currentPlaylistIndex = i
+		}
+		if pl == selectedPlaylist {
+			m.playlists.Select(i)
+		}
+	}
+}
+
+// loadMoreTracks requests the next page of the paginated playlist in the background.
+func (m *Model) loadMoreTracks(pl *playlist.Item) tea.Cmd {
+	return m.loadTracksPage(pl, false)
+}
+
+// loadTracksPage requests the next page of the playlist, the playback continues with it if playNext is set.
+func (m *Model) loadTracksPage(pl *playlist.Item, playNext bool) tea.Cmd {
+	if !pl.HasMore() || pl.Loading {
+		return nil
+	}
+
+	pl.Loading = true
+	src := *pl
+
+	return func() tea.Msg {
+		tracks, total, err := m.requestTracksPage(m.ctx, &src)
+		return tracksPage{playlist: pl, tracks: tracks, total: total, err: err, playNext: playNext}
+	}
+}
+
+// requestTracksPage loads the next page of the playlist tracks from its source.
+// Returns the page tracks and the total count of the playlist tracks.
+func (m *Model) requestTracksPage(ctx context.Context, pl *playlist.Item) ([]api.Track, int, error) {
+	switch {
+	case pl.ArtistId != 0:
+		page, err := m.client.ArtistTracksContext(ctx, pl.ArtistId, pl.NextPage, _TRACKS_PAGE_SIZE)
+		return page.Tracks, page.Pager.Total, err
+	case pl.PlaylistId != 0:
+		tracks, err := m.client.PlaylistTracksContext(ctx, pl.PlaylistId, pl.OwnerUid, false)
+		return tracks, len(tracks), err
+	case pl.AlbumId != 0:
+		album, err := m.client.AlbumContext(ctx, pl.AlbumId, true)
+		var tracks []api.Track
+		for _, volume := range album.Volumes {
+			tracks = append(tracks, volume...)
+		}
+		return tracks, len(tracks), err
+	default:
+		from := len(pl.Tracks)
+		if from >= len(pl.TrackIds) {
+			return nil, len(pl.TrackIds), nil
+		}
+		to := min(from+_TRACKS_PAGE_SIZE, len(pl.TrackIds))
+		tracks, err := m.client.TracksContext(ctx, pl.TrackIds[from:to])
+		return tracks, len(pl.TrackIds), err
+	}
+}
+
+// appendTracksPage adds the loaded page to the playlist and to the track list if it's displayed.
+func (m *Model) appendTracksPage(page tracksPage) tea.Cmd {
+	pl := page.playlist
+	pl.Loading = false
+
+	if page.err != nil {
+		if !errors.Is(page.err, context.Canceled) {
+			log.Print(log.LVL_ERROR, "failed to obtain playlist [%s] tracks page %d: %s", pl.Name, pl.NextPage, page.err)
+			m.tracker.ShowError("playlist tracks page")
+			m.checkAuthExpired(page.err)
+		}
+		if page.playNext {
+			m.Send(tracker.STOP)
+		}
+		return nil
+	}
+
+	m.addTracksPage(pl, page.tracks, page.total)
+
+	if pl == m.playlists.SelectedItem() {
+		m.displayPlaylist(pl)
+		if m.tracker.IsPlaying() {
+			m.indicateCurrentTrackPlaying(true)
+		}
+	}
+
+	// nothing else is played while the page was loading
+	if page.playNext && m.currentPlaylistIndex >= 0 && m.playlists.Items()[m.currentPlaylistIndex] == pl && m.playingEntry.Source == pl {
+		m.continuePlaylist(pl)
+	}
+
+	return nil
+}
+
+func (m *Model) addTracksPage(pl *playlist.Item, tracks []api.Track, total int) {
+	pl.Tracks = append(pl.Tracks, tracks...)
+	pl.NextPage++
+	pl.TracksTotal = total
+	if len(tracks) == 0 {
+		// prevent endless loading if the server reports the wrong total count
+		pl.TracksTotal = len(pl.Tracks)
+	}
+}
+
+// openArtist shows the artist discography in the side panel.
+func (m *Model) openArtist(artist api.Artist) tea.Cmd {
+	if artist.Id == 0 {
+		return nil
+	}
+
+	ctx := m.requestContext(&m.browseCancel)
+	return func() tea.Msg {
+		popular, err := m.client.ArtistPopularTracksContext(ctx, artist.Id)
+		if err == nil {
+			var albums, alsoAlbums api.ArtistAlbumsPage
+			albums, err = m.client.ArtistAlbumsContext(ctx, artist.Id, 0, _ALBUMS_PAGE_SIZE)
+			if err == nil {
+				alsoAlbums, err = m.client.ArtistAlsoAlbumsContext(ctx, artist.Id, 0, _ALBUMS_PAGE_SIZE)
+			}
+			if err == nil {
+				return browseResults{title: "artist:", items: artistItems(artist, popular.Tracks, albums.Albums, alsoAlbums.Albums)}
+			}
+		}
+
+		if !errors.Is(err, context.Canceled) {
+			log.Print(log.LVL_ERROR, "failed to obtain artist [%s] discography: %s", artist.Name, err)
+			m.tracker.ShowError("artist discography")
+			m.checkAuthExpired(err)
+		}
+		return nil
+	}
+}
+
+func artistItems(artist api.Artist, popularTrackIds []string, albums, alsoAlbums []api.Album) []*playlist.Item {
+	var singles, compilations []api.Album
+	var fullAlbums []api.Album
+	for _, album := range albums {
+		switch album.Type {
+		case api.ALBUM_SINGLE:
+			singles = append(singles, album)
+		case api.ALBUM_COMPILATION:
+			compilations = append(compilations, album)
+		default:
+			fullAlbums = append(fullAlbums, album)
+		}
+	}
+	compilations = append(compilations, alsoAlbums...)
+
+	items := []*playlist.Item{
+		{
+			Name:        artist.Name,
+			Active:      true,
+			Subitem:     true,
+			Paginated:   true,
+			TrackIds:    popularTrackIds,
+			TracksTotal: len(popularTrackIds),
+		},
+		{
+			Name:      "all tracks",
+			Active:    true,
+			Subitem:   true,
+			Paginated: true,
+			ArtistId:  artist.Id,
+		},
+	}
+
+	for _, group := range []struct {
+		name   string
+		albums []api.Album
+	}{
+		{"albums", fullAlbums},
+		{"singles", singles},
+		{"compilations", compilations},
+	} {
+		if len(group.albums) == 0 {
+			continue
+		}
+		items = append(items, &playlist.Item{Name: group.name, Kind: playlist.NONE, Active: false, Subitem: true})
+		for _, album := range group.albums {
+			items = append(items, albumItem(album))
+		}
+	}
+
+	return items
+}
+
+func albumItem(album api.Album) *playlist.Item {
+	name := album.Title
+	if album.Year > 0 {
+		name = fmt.Sprintf("%s (%d)", album.Title, album.Year)
+	}
+	return &playlist.Item{
+		Name:      name,
+		Active:    true,
+		Subitem:   true,
+		Paginated: true,
+		AlbumId:   album.Id,
+	}
+}
+
+// openAlbum shows the album volumes in the side panel.
+func (m *Model) openAlbum(album api.Album) tea.Cmd {
+	if album.Id == 0 {
+		return nil
+	}
+
+	ctx := m.requestContext(&m.browseCancel)
+	return func() tea.Msg {
+		albumWithTracks, err := m.client.AlbumContext(ctx, album.Id, true)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Print(log.LVL_ERROR, "failed to obtain album [%s] tracks: %s", album.Title, err)
+				m.tracker.ShowError("album tracks")
+				m.checkAuthExpired(err)
+			}
+			return nil
+		}
+
+		items := make([]*playlist.Item, 0, len(albumWithTracks.Volumes))
+		for i, volume := range albumWithTracks.Volumes {
+			name := albumWithTracks.Title
+			if len(albumWithTracks.Volumes) > 1 {
+				name = fmt.Sprintf("%s vol.%d", albumWithTracks.Title, i+1)
+			}
+			items = append(items, &playlist.Item{
+				Name:    name,
+				Active:  true,
+				Subitem: true,
+				Tracks:  volume,
+			})
+		}
+
+		return browseResults{title: "album:", items: items}
+	}
+}
@@ -1,49 +1,172 @@
 package mainpage
 
 import (
+	"bytes"
+	"errors"
 	"os"
 
 	"github.com/bogem/id3v2/v2"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/dece2183/yamusic-tui/api"
 	"github.com/dece2183/yamusic-tui/cache"
+	"github.com/dece2183/yamusic-tui/config"
 	"github.com/dece2183/yamusic-tui/log"
+	"github.com/dece2183/yamusic-tui/stream"
 	"github.com/dece2183/yamusic-tui/ui/components/playlist"
 )
 
-func (m *Model) cacheCurrentTrack() tea.Cmd {
-	currentTrack := m.tracker.CurrentTrack()
-	if m.tracker.IsStoped() || m.cachedTracksMap[currentTrack.Id] {
+// trackCached is the result of the background caching of the track
+type trackCached struct {
+	track api.Track
+	// the track is cached by the cache-tracks policy rather than by the user
+	auto bool
+	err  error
+}
+
+// trackUncached is the result of the background removal of the track from the cache
+type trackUncached struct {
+	trackId string
+	err     error
+}
+
+// loadCachedTracks evicts the tracks beyond the cache limits and shows the rest in the local playlist.
+func (m *Model) loadCachedTracks() {
+	_, err := cache.Evict()
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to evict cached tracks: %s", err)
+	}
+
+	local, index := m.playlists.GetFirst(playlist.LOCAL)
+	local.Tracks, err = cache.ListTracks()
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to list cached tracks: %s", err)
+		m.tracker.ShowError("cache list")
+		return
+	}
+
+	for i := range local.Tracks {
+		m.cachedTracksMap[local.Tracks[i].Id] = true
+	}
+	m.playlists.SetItem(index, local)
+}
+
+// cacheCurrentTrack writes the buffered stream of the current track to the cache in the background.
+func (m *Model) cacheCurrentTrack(auto bool) tea.Cmd {
+	currentTrack := withAlbumNormalization(m.tracker.CurrentTrack(), m.playingTracks())
+	if m.tracker.IsStoped() || m.cachedTracksMap[currentTrack.Id] || m.cachingTracksMap[currentTrack.Id] {
 		return nil
 	}
 
-	metadataFile, err := os.OpenFile(m.metadataFilePath(), os.O_RDONLY, 0755)
+	metadata, err := os.ReadFile(m.metadataFilePath())
 	if err != nil {
 		log.Print(log.LVL_ERROR, "failed to open cache file: %s", err)
 		m.tracker.ShowError("cache open")
 		return nil
 	}
 
-	defer metadataFile.Close()
+	codec := m.tracker.Source().Codec
+	trackBuffer := m.tracker.TrackBuffer()
+	m.cachingTracksMap[currentTrack.Id] = true
 
-	cacheFile, err := cache.Write(currentTrack.Id)
-	if err != nil {
-		log.Print(log.LVL_ERROR, "failed to write cache file: %s", err)
+	return func() tea.Msg {
+		cacheFile, err := cache.Write(currentTrack, codec)
+		if err != nil {
+			return trackCached{track: currentTrack, auto: auto, err: err}
+		}
+
+		tag := id3v2.NewEmptyTag()
+		tag.Reset(bytes.NewReader(metadata), id3v2.Options{Parse: true})
+		_, err = tag.WriteTo(cacheFile)
+		if err == nil {
+			_, err = trackBuffer.WriteTo(cacheFile)
+		}
+		if err != nil {
+			cacheFile.Discard()
+			return trackCached{track: currentTrack, auto: auto, err: err}
+		}
+
+		return trackCached{track: currentTrack, auto: auto, err: cacheFile.Close()}
+	}
+}
+
+// autoCacheCurrentTrack caches the fully buffered current track if the cache-tracks policy allows it.
+func (m *Model) autoCacheCurrentTrack() tea.Cmd {
+	switch config.Current.CacheTracks {
+	case config.CACHE_ALL:
+		return m.cacheCurrentTrack(true)
+	case config.CACHE_LIKED_ONLY:
+		if m.likedTracksMap[m.tracker.CurrentTrack().Id] {
+			return m.cacheCurrentTrack(true)
+		}
+	}
+	return nil
+}
+
+// setCachedTrack adds the cached track to the local playlist and evicts the tracks beyond the cache limits.
+func (m *Model) setCachedTrack(cached trackCached) tea.Cmd {
+	delete(m.cachingTracksMap, cached.track.Id)
+	if errors.Is(cached.err, stream.ErrClosed) {
+		// the track was stopped or skipped before it was written, it's cached the next time it's played
+		return nil
+	}
+	if cached.err != nil {
+		log.Print(log.LVL_ERROR, "failed to write cache file: %s", cached.err)
 		m.tracker.ShowError("cache write")
 		return nil
 	}
 
-	defer cacheFile.Close()
+	m.cachedTracksMap[cached.track.Id] = true
+	cachePlaylist, index := m.playlists.GetFirst(playlist.LOCAL)
+	cachePlaylist.AddTrack(&cached.track)
+	cmd := m.playlists.SetItem(index, cachePlaylist)
 
-	tag := id3v2.NewEmptyTag()
-	tag.Reset(metadataFile, id3v2.Options{Parse: true})
-	tag.WriteTo(cacheFile)
-	m.tracker.TrackBuffer().WriteTo(cacheFile)
+	if cached.auto && config.Current.CacheTracks == config.CACHE_LIKED_ONLY && !m.likedTracksMap[cached.track.Id] {
+		// the track was unliked while it was being cached
+		return tea.Batch(cmd, m.uncacheTrack(cached.track.Id))
+	}
 
-	m.cachedTracksMap[currentTrack.Id] = true
-	cachePlaylist, index := m.playlists.GetFirst(playlist.LOCAL)
-	cachePlaylist.AddTrack(currentTrack)
-	return m.playlists.SetItem(index, cachePlaylist)
+	return tea.Batch(cmd, m.evictCache())
+}
+
+// uncacheTrack removes the track from the cache in the background.
+// The tracks of the offline playlists are kept.
+func (m *Model) uncacheTrack(trackId string) tea.Cmd {
+	if cache.Pinned(trackId) {
+		return nil
+	}
+
+	return func() tea.Msg {
+		return trackUncached{trackId: trackId, err: cache.Remove(trackId)}
+	}
+}
+
+func (m *Model) setUncachedTrack(uncached trackUncached) tea.Cmd {
+	if uncached.err != nil {
+		log.Print(log.LVL_ERROR, "failed to remove cached file: %s", uncached.err)
+		m.tracker.ShowError("cache remove")
+		return nil
+	}
+	return m.forgetCachedTrack(uncached.trackId)
+}
+
+// evictCache removes the tracks that exceed the cache limits, except the current and the preloaded ones.
+func (m *Model) evictCache() tea.Cmd {
+	keep := []string{m.tracker.CurrentTrack().Id}
+	if m.preloaded.track != nil {
+		keep = append(keep, m.preloaded.track.Id)
+	}
+
+	evicted, err := cache.Evict(keep...)
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to evict cached tracks: %s", err)
+		m.tracker.ShowError("cache evict")
+	}
+
+	cmds := make([]tea.Cmd, len(evicted))
+	for i, trackId := range evicted {
+		cmds[i] = m.forgetCachedTrack(trackId)
+	}
+	return tea.Batch(cmds...)
 }
 
 func (m *Model) removeCache(track *api.Track) tea.Cmd {
@@ -54,13 +177,18 @@ func (m *Model) removeCache(track *api.Track) tea.Cmd {
 		return nil
 	}
 
+	return m.forgetCachedTrack(track.Id)
+}
+
+// forgetCachedTrack removes the track that is no longer cached from the local playlist.
+func (m *Model) forgetCachedTrack(trackId string) tea.Cmd {
 	cachePlaylist, index := m.playlists.GetFirst(playlist.LOCAL)
-	trackIndex := cachePlaylist.RemoveTrack(track.Id)
+	trackIndex := cachePlaylist.RemoveTrack(trackId)
 	if m.playlists.SelectedItem().Kind == playlist.LOCAL && trackIndex >= 0 {
 		m.tracklist.RemoveItem(trackIndex)
 		m.tracklist.Select(cachePlaylist.SelectedTrack)
 	}
 
-	delete(m.cachedTracksMap, track.Id)
+	delete(m.cachedTracksMap, trackId)
 	return m.playlists.SetItem(index, cachePlaylist)
 }
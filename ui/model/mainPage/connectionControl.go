@@ -0,0 +1,346 @@
+package mainpage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/cache"
+	"github.com/dece2183/yamusic-tui/config"
+	"github.com/dece2183/yamusic-tui/log"
+	"github.com/dece2183/yamusic-tui/ui/components/playlist"
+)
+
+const (
+	// the period of the server availability checks in the offline mode
+	_RECONNECT_PERIOD = 30 * time.Second
+	// the section of the offline playlists that aren't shown in the other sections
+	_OFFLINE_SECTION = "offline:"
+)
+
+// connectionRestored is sent when the server is reachable again in the offline mode
+type connectionRestored struct {
+	client *api.YaMusicClient
+	err    error
+}
+
+// offlineLoad fills the side panel from the cache when the server is unreachable.
+// The likes and the user playlists are restored from the snapshots with the cached tracks only.
+func (m *Model) offlineLoad() {
+	m.offline = true
+	m.tracker.SetOffline(true)
+
+	local, _ := m.playlists.GetFirst(playlist.LOCAL)
+	cached := make(map[string]*api.Track, len(local.Tracks))
+	for i := range local.Tracks {
+		cached[local.Tracks[i].Id] = &local.Tracks[i]
+	}
+	cachedTracks := func(trackIds []string) []api.Track {
+		tracks := make([]api.Track, 0, len(trackIds))
+		for _, id := range trackIds {
+			if track, ok := cached[id]; ok {
+				tracks = append(tracks, *track)
+			}
+		}
+		return tracks
+	}
+
+	snapshots, err := cache.Snapshots()
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to read library snapshots: %s", err)
+		m.tracker.ShowError("library snapshots")
+	}
+
+	pending, err := cache.Pending()
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to read offline changes: %s", err)
+		m.tracker.ShowError("offline changes")
+	}
+
+	var userPlaylists []*playlist.Item
+	for _, snapshot := range snapshots {
+		trackIds := pendingTrackIds(snapshot, pending)
+
+		if snapshot.Kind == playlist.LIKES {
+			for _, id := range trackIds {
+				m.likedTracksMap[id] = true
+			}
+			likes, index := m.playlists.GetFirst(playlist.LIKES)
+			likes.Tracks = cachedTracks(trackIds)
+			m.playlists.SetItem(index, likes)
+			continue
+		}
+
+		userPlaylists = append(userPlaylists, &playlist.Item{
+			Name:     snapshot.Name,
+			Kind:     snapshot.Kind,
+			Revision: snapshot.Revision,
+			Active:   true,
+			Subitem:  true,
+			Tracks:   cachedTracks(trackIds),
+		})
+	}
+	m.setUserPlaylists(userPlaylists)
+
+	offlinePlaylists, err := cache.OfflinePlaylists()
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to list offline playlists: %s", err)
+		m.tracker.ShowError("offline playlists")
+	}
+
+	shown := make(map[string]bool)
+	for _, item := range m.playlists.Items() {
+		shown[offlineKey(item)] = true
+	}
+
+	var items []*playlist.Item
+	for _, pl := range offlinePlaylists {
+		item := offlineItem(pl)
+		if shown[offlineKey(item)] {
+			continue
+		}
+		item.Tracks = cachedTracks(pl.TrackIds)
+		items = append(items, item)
+	}
+	if len(items) > 0 {
+		m.setSection(_OFFLINE_SECTION, items)
+	}
+
+	m.markOfflinePlaylists(m.playlists.Items())
+
+	go m.watchConnection()
+}
+
+// pendingTrackIds returns the snapshot tracks with the queued changes applied.
+func pendingTrackIds(snapshot cache.Snapshot, pending []cache.Mutation) []string {
+	trackIds := slices.Clone(snapshot.TrackIds)
+	likes := snapshot.Kind == playlist.LIKES
+
+	for _, mutation := range pending {
+		index := slices.Index(trackIds, mutation.TrackId)
+
+		switch mutation.Action {
+		case cache.ACTION_LIKE:
+			if likes && index < 0 {
+				trackIds = append([]string{mutation.TrackId}, trackIds...)
+			}
+		case cache.ACTION_UNLIKE:
+			if likes && index >= 0 {
+				trackIds = slices.Delete(trackIds, index, index+1)
+			}
+		case cache.ACTION_PLAYLIST_ADD:
+			if !likes && mutation.PlaylistKind == snapshot.Kind {
+				trackIds = append(trackIds, mutation.TrackId)
+			}
+		case cache.ACTION_PLAYLIST_REMOVE:
+			if !likes && mutation.PlaylistKind == snapshot.Kind && index >= 0 {
+				trackIds = slices.Delete(trackIds, index, index+1)
+			}
+		}
+	}
+
+	return trackIds
+}
+
+// offlineItem creates the side panel item of the offline playlist that is identified by its key, see offlineKey.
+func offlineItem(pl cache.OfflinePlaylist) *playlist.Item {
+	item := &playlist.Item{Name: pl.Name, Active: true, Subitem: true}
+
+	scan := func(format string, ids ...any) bool {
+		n, _ := fmt.Sscanf(pl.Key, format, ids...)
+		return n == len(ids)
+	}
+
+	var first, second uint64
+	switch {
+	case pl.Key == "likes":
+		item.Kind = playlist.LIKES
+	case scan("playlist:%d:%d", &first, &second):
+		item.OwnerUid, item.PlaylistId = first, second
+	case scan("playlist:%d", &first):
+		item.Kind = first
+	case scan("album:%d", &first):
+		item.AlbumId = first
+	case scan("artist:%d", &first):
+		item.ArtistId = first
+	}
+
+	return item
+}
+
+// watchConnection checks the server availability in the offline mode
+// and sends the new client when the server is reachable again.
+func (m *Model) watchConnection() {
+	ticker := time.NewTicker(_RECONNECT_PERIOD)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		client, err := api.NewClientContext(m.ctx, config.Current.Token, api.ClientOptions{})
+		if err != nil && !errors.Is(err, api.ErrAuthExpired) {
+			if !errors.Is(err, api.ErrNetwork) && !errors.Is(err, context.Canceled) {
+				log.Print(log.LVL_WARNIGN, "unable to reconnect to the Yandex server: %s", err)
+			}
+			continue
+		}
+
+		m.program.Send(connectionRestored{client: client, err: err})
+		return
+	}
+}
+
+// restoreConnection switches to the new client and loads the user collection in the background.
+func (m *Model) restoreConnection(restored connectionRestored) tea.Cmd {
+	if restored.err != nil {
+		m.checkAuthExpired(restored.err)
+		return nil
+	}
+
+	m.client = restored.client
+	return m.reloadLibrary()
+}
+
+// setLibraryLoaded leaves the offline mode showing the user collection loaded from the server.
+// The offline mode goes on if the connection is lost again while the changes are sent.
+func (m *Model) setLibraryLoaded(loaded libraryLoaded) tea.Cmd {
+	if loaded.err != nil {
+		log.Print(log.LVL_WARNIGN, "unable to send offline changes: %s", loaded.err)
+		if !m.checkAuthExpired(loaded.err) {
+			go m.watchConnection()
+		}
+		return nil
+	}
+
+	m.offline = false
+	m.tracker.SetOffline(false)
+
+	selectedPlaylist := m.playlists.SelectedItem()
+	m.keepPositions(func() {
+		m.playlists.RemoveSection(_OFFLINE_SECTION)
+	})
+	m.applyLibrary(loaded.library)
+	if !slices.Contains(m.playlists.Items(), selectedPlaylist) {
+		m.playlists.Select(0)
+	}
+	m.Send(playlist.CURSOR_UP)
+
+	// the changes made while the collection was loading
+	return func() tea.Msg {
+		err := m.sendPending(m.ctx)
+		if err != nil {
+			log.Print(log.LVL_WARNIGN, "unable to send offline changes: %s", err)
+		}
+		return nil
+	}
+}
+
+// queueChange saves the library change made in the offline mode to send it when the connection is restored.
+func (m *Model) queueChange(mutation cache.Mutation) error {
+	err := cache.AddPending(mutation)
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to queue offline change %s [%s]: %s", mutation.Action, mutation.TrackId, err)
+	}
+	return err
+}
+
+// sendPending sends the library changes made offline to the server in the order they were made.
+// The changes rejected by the server are dropped, the rest stay queued if the connection is lost again.
+func (m *Model) sendPending(ctx context.Context) error {
+	pending, err := cache.Pending()
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to read offline changes: %s", err)
+		return nil
+	}
+
+	sent, err := sendMutations(pending, func(mutation cache.Mutation) error {
+		return m.sendChange(ctx, mutation)
+	})
+	if sent > 0 {
+		dropErr := cache.DropPending(sent)
+		if dropErr != nil {
+			log.Print(log.LVL_ERROR, "failed to drop sent offline changes: %s", dropErr)
+		}
+	}
+
+	return err
+}
+
+// sendMutations sends the changes in order until one of them fails temporarily.
+// Returns the number of the first changes that are done with, including the rejected ones, and the temporary error.
+func sendMutations(pending []cache.Mutation, send func(cache.Mutation) error) (int, error) {
+	for i, mutation := range pending {
+		err := send(mutation)
+		if keepPending(err) {
+			return i, err
+		}
+		if err != nil {
+			log.Print(log.LVL_ERROR, "failed to send offline change %s [%s]: %s", mutation.Action, mutation.TrackId, err)
+		}
+	}
+	return len(pending), nil
+}
+
+// keepPending reports whether the change failed temporarily and has to be sent later.
+func keepPending(err error) bool {
+	return errors.Is(err, api.ErrNetwork) ||
+		errors.Is(err, api.ErrServer) ||
+		errors.Is(err, api.ErrRateLimited) ||
+		errors.Is(err, api.ErrAuthExpired) ||
+		errors.Is(err, context.Canceled)
+}
+
+// sendChange applies the library change made offline to the current state of the library on the server.
+func (m *Model) sendChange(ctx context.Context, mutation cache.Mutation) error {
+	switch mutation.Action {
+	case cache.ACTION_LIKE:
+		return m.client.LikeTrackContext(ctx, mutation.TrackId)
+	case cache.ACTION_UNLIKE:
+		return m.client.UnlikeTrackContext(ctx, mutation.TrackId)
+	}
+
+	playlists, err := m.client.ListPlaylistsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	index := slices.IndexFunc(playlists, func(pl api.Playlist) bool {
+		return pl.Kind == mutation.PlaylistKind
+	})
+	if index < 0 {
+		return fmt.Errorf("playlist %d not found", mutation.PlaylistKind)
+	}
+	pl := playlists[index]
+
+	switch mutation.Action {
+	case cache.ACTION_PLAYLIST_ADD:
+		_, err = m.client.AddToPlaylistContext(ctx, pl.Kind, pl.Revision, pl.TrackCount, mutation.TrackId)
+		return err
+	case cache.ACTION_PLAYLIST_REMOVE:
+		tracks, err := m.client.PlaylistTracksContext(ctx, pl.Kind, pl.Owner.Uid, false)
+		if err != nil {
+			return err
+		}
+
+		trackIndex := slices.IndexFunc(tracks, func(track api.Track) bool {
+			return track.Id == mutation.TrackId
+		})
+		if trackIndex < 0 {
+			// the track is already removed
+			return nil
+		}
+
+		_, err = m.client.RemoveFromPlaylistContext(ctx, pl.Kind, pl.Revision, trackIndex)
+		return err
+	default:
+		return fmt.Errorf("unknown offline change '%s'", mutation.Action)
+	}
+}
@@ -0,0 +1,114 @@
+package mainpage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/cache"
+	"github.com/dece2183/yamusic-tui/ui/components/playlist"
+)
+
+func TestPendingTrackIds(t *testing.T) {
+	const (
+		userKind  = playlist.USER + 1000
+		otherKind = playlist.USER + 1001
+	)
+
+	like := func(id string) cache.Mutation { return cache.Mutation{Action: cache.ACTION_LIKE, TrackId: id} }
+	unlike := func(id string) cache.Mutation { return cache.Mutation{Action: cache.ACTION_UNLIKE, TrackId: id} }
+	add := func(kind uint64, id string) cache.Mutation {
+		return cache.Mutation{Action: cache.ACTION_PLAYLIST_ADD, TrackId: id, PlaylistKind: kind}
+	}
+	remove := func(kind uint64, id string) cache.Mutation {
+		return cache.Mutation{Action: cache.ACTION_PLAYLIST_REMOVE, TrackId: id, PlaylistKind: kind}
+	}
+
+	tests := []struct {
+		name    string
+		kind    uint64
+		pending []cache.Mutation
+		want    []string
+	}{
+		{"likes unchanged", playlist.LIKES, nil, []string{"a", "b", "c"}},
+		{"like", playlist.LIKES, []cache.Mutation{like("d")}, []string{"d", "a", "b", "c"}},
+		{"like liked", playlist.LIKES, []cache.Mutation{like("b")}, []string{"a", "b", "c"}},
+		{"unlike", playlist.LIKES, []cache.Mutation{unlike("b")}, []string{"a", "c"}},
+		{"unlike not liked", playlist.LIKES, []cache.Mutation{unlike("d")}, []string{"a", "b", "c"}},
+		{"like and unlike", playlist.LIKES, []cache.Mutation{like("d"), unlike("d")}, []string{"a", "b", "c"}},
+		{"unlike and like", playlist.LIKES, []cache.Mutation{unlike("c"), like("c")}, []string{"c", "a", "b"}},
+		{"likes ignore playlists", playlist.LIKES, []cache.Mutation{add(playlist.LIKES, "d"), remove(userKind, "a")}, []string{"a", "b", "c"}},
+		{"add", userKind, []cache.Mutation{add(userKind, "d")}, []string{"a", "b", "c", "d"}},
+		{"add duplicate", userKind, []cache.Mutation{add(userKind, "a")}, []string{"a", "b", "c", "a"}},
+		{"add to other", userKind, []cache.Mutation{add(otherKind, "d")}, []string{"a", "b", "c"}},
+		{"remove", userKind, []cache.Mutation{remove(userKind, "a")}, []string{"b", "c"}},
+		{"remove missing", userKind, []cache.Mutation{remove(userKind, "d")}, []string{"a", "b", "c"}},
+		{"remove from other", userKind, []cache.Mutation{remove(otherKind, "a")}, []string{"a", "b", "c"}},
+		{"add and remove", userKind, []cache.Mutation{add(userKind, "d"), remove(userKind, "d"), remove(userKind, "b")}, []string{"a", "c"}},
+		{"playlist ignores likes", userKind, []cache.Mutation{like("d"), unlike("a")}, []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot := cache.Snapshot{Kind: tt.kind, TrackIds: []string{"a", "b", "c"}}
+
+			got := pendingTrackIds(snapshot, tt.pending)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("track ids are %v, want %v", got, tt.want)
+			}
+			if want := []string{"a", "b", "c"}; !reflect.DeepEqual(snapshot.TrackIds, want) {
+				t.Errorf("snapshot is changed to %v", snapshot.TrackIds)
+			}
+		})
+	}
+}
+
+func TestSendMutations(t *testing.T) {
+	networkErr := fmt.Errorf("like: %w", api.ErrNetwork)
+	rejectedErr := fmt.Errorf("like: %w", api.ErrNotFound)
+
+	tests := []struct {
+		name     string
+		results  []error
+		wantSent int
+		wantErr  error
+	}{
+		{"nothing pending", nil, 0, nil},
+		{"all sent", []error{nil, nil, nil}, 3, nil},
+		{"rejected are dropped", []error{nil, rejectedErr, nil}, 3, nil},
+		{"connection lost", []error{nil, networkErr, nil}, 1, api.ErrNetwork},
+		{"connection lost first", []error{networkErr, nil}, 0, api.ErrNetwork},
+		{"rejected before lost", []error{rejectedErr, networkErr}, 1, api.ErrNetwork},
+		{"server error", []error{nil, api.ErrServer}, 1, api.ErrServer},
+		{"rate limited", []error{api.ErrRateLimited}, 0, api.ErrRateLimited},
+		{"auth expired", []error{nil, nil, api.ErrAuthExpired}, 2, api.ErrAuthExpired},
+		{"canceled", []error{context.Canceled}, 0, context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending := make([]cache.Mutation, len(tt.results))
+			for i := range pending {
+				pending[i] = cache.Mutation{Action: cache.ACTION_LIKE, TrackId: fmt.Sprint(i)}
+			}
+
+			var sentIds []string
+			sent, err := sendMutations(pending, func(mutation cache.Mutation) error {
+				sentIds = append(sentIds, mutation.TrackId)
+				var id int
+				fmt.Sscan(mutation.TrackId, &id)
+				return tt.results[id]
+			})
+			if sent != tt.wantSent || !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("sent %d, %v; want %d, %v", sent, err, tt.wantSent, tt.wantErr)
+			}
+			// nothing is sent after the change that has to be sent later
+			if err != nil && len(sentIds) != sent+1 {
+				t.Errorf("%d changes are sent, want %d", len(sentIds), sent+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package mainpage
+
+import (
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/log"
+	"github.com/dece2183/yamusic-tui/ui/components/playlist"
+)
+
+var landingBlocks = []string{
+	api.LANDING_PERSONAL_PLAYLISTS,
+	api.LANDING_NEW_RELEASES,
+	api.LANDING_CHART,
+	api.LANDING_NEW_PLAYLISTS,
+	api.LANDING_PLAYLISTS,
+	api.LANDING_ALBUMS,
+}
+
+// landingItems builds the side panel items of the landing blocks.
+// The chart block is collected to a single playlist, the other entities become separate items.
+func landingItems(landing api.Landing) []*playlist.Item {
+	var items []*playlist.Item
+
+	for _, block := range landing.Blocks {
+		var blockItems []*playlist.Item
+		var chart []api.Track
+
+		for _, entity := range block.Entities {
+			switch entity.Type {
+			case api.ENTITY_PLAYLIST, api.ENTITY_PERSONAL_PLAYLIST:
+				pl, err := entity.Playlist()
+				if err != nil {
+					log.Print(log.LVL_WARNIGN, "failed to decode landing playlist: %s", err)
+					continue
+				}
+				blockItems = append(blockItems, &playlist.Item{
+					Name:       pl.Title,
+					Active:     true,
+					Subitem:    true,
+					Paginated:  true,
+					OwnerUid:   pl.Owner.Uid,
+					PlaylistId: pl.Kind,
+				})
+			case api.ENTITY_ALBUM:
+				album, err := entity.Album()
+				if err != nil {
+					log.Print(log.LVL_WARNIGN, "failed to decode landing album: %s", err)
+					continue
+				}
+				blockItems = append(blockItems, albumItem(album))
+			case api.ENTITY_CHART_ITEM:
+				track, err := entity.Track()
+				if err != nil {
+					log.Print(log.LVL_WARNIGN, "failed to decode landing chart item: %s", err)
+					continue
+				}
+				chart = append(chart, track)
+			}
+		}
+
+		if len(chart) > 0 {
+			blockItems = append(blockItems, &playlist.Item{
+				Name:    block.Title,
+				Active:  true,
+				Subitem: true,
+				Tracks:  chart,
+			})
+		}
+
+		if len(blockItems) == 0 {
+			continue
+		}
+
+		items = append(items, &playlist.Item{Name: block.Title, Kind: playlist.NONE, Active: false, Subitem: true})
+		items = append(items, blockItems...)
+	}
+
+	return items
+}
@@ -0,0 +1,319 @@
+package mainpage
+
+import (
+	"context"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/cache"
+	"github.com/dece2183/yamusic-tui/log"
+	"github.com/dece2183/yamusic-tui/ui/components/playlist"
+)
+
+// library is the user collection loaded from the server on startup or when the connection is restored.
+// The part that failed to load keeps its error and isn't applied.
+type library struct {
+	waveSettings    api.StationSettings
+	waveSettingsErr error
+
+	wave    api.StationTracks
+	waveErr error
+
+	likedIds []string
+	likes    []api.Track
+	likesErr error
+
+	// the user playlists with their tracks
+	playlists    []*playlist.Item
+	playlistsErr error
+	// the user playlists which tracks failed to load
+	failedPlaylists int
+
+	likedAlbums       []api.Album
+	likedAlbumsErr    error
+	likedArtists      []api.Artist
+	likedArtistsErr   error
+	likedPlaylists    []api.Playlist
+	likedPlaylistsErr error
+
+	landing    api.Landing
+	landingErr error
+
+	stations    []api.StationDesc
+	stationsErr error
+}
+
+// libraryLoaded is the result of the library loading after the connection is restored
+type libraryLoaded struct {
+	library library
+	err     error
+}
+
+// fetchLibrary loads the user collection from the server
+// and saves the snapshots of the likes and playlists for the offline startup.
+func (m *Model) fetchLibrary(ctx context.Context) library {
+	var lib library
+
+	station, err := m.client.StationInfoContext(ctx, api.MyWaveId)
+	if err == nil {
+		lib.waveSettings = station.Settings2
+	} else {
+		lib.waveSettingsErr = err
+		log.Print(log.LVL_ERROR, "failed to obtain my wave settings: %s", err)
+	}
+
+	lib.wave, lib.waveErr = m.client.StationTracksContext(ctx, api.MyWaveId, nil)
+	if lib.waveErr != nil {
+		log.Print(log.LVL_ERROR, "failed to obtain station tracks for the first time: %s", lib.waveErr)
+	}
+
+	likes, err := m.client.LikedTracksContext(ctx)
+	if err == nil {
+		lib.likedIds = make([]string, len(likes))
+		for l, track := range likes {
+			lib.likedIds[l] = track.Id
+		}
+
+		lib.likes, lib.likesErr = m.client.TracksContext(ctx, lib.likedIds)
+		if lib.likesErr != nil {
+			log.Print(log.LVL_ERROR, "failed to obtain liked tracks full info: %s", lib.likesErr)
+		}
+	} else {
+		lib.likesErr = err
+		log.Print(log.LVL_ERROR, "failed to obtain liked tracks for the first time: %s", err)
+	}
+
+	playlists, err := m.client.ListPlaylistsContext(ctx)
+	if err == nil {
+		for _, pl := range playlists {
+			playlistTracks, err := m.client.PlaylistTracksContext(ctx, pl.Kind, pl.Owner.Uid, false)
+			if err != nil {
+				log.Print(log.LVL_ERROR, "failed to obtain playlist [%s] tracks: %s", pl.Title, err)
+				lib.failedPlaylists++
+				continue
+			}
+
+			lib.playlists = append(lib.playlists, &playlist.Item{
+				Name:     pl.Title,
+				Kind:     pl.Kind,
+				Revision: pl.Revision,
+				Active:   true,
+				Subitem:  true,
+				Tracks:   playlistTracks,
+			})
+		}
+	} else {
+		lib.playlistsErr = err
+		log.Print(log.LVL_ERROR, "failed to obtain user playlists: %s", err)
+	}
+
+	lib.likedAlbums, lib.likedAlbumsErr = m.client.LikedAlbumsContext(ctx)
+	if lib.likedAlbumsErr != nil {
+		log.Print(log.LVL_ERROR, "failed to obtain liked albums: %s", lib.likedAlbumsErr)
+	}
+
+	lib.likedArtists, lib.likedArtistsErr = m.client.LikedArtistsContext(ctx)
+	if lib.likedArtistsErr != nil {
+		log.Print(log.LVL_ERROR, "failed to obtain liked artists: %s", lib.likedArtistsErr)
+	}
+
+	lib.likedPlaylists, lib.likedPlaylistsErr = m.client.LikedPlaylistsContext(ctx)
+	if lib.likedPlaylistsErr != nil {
+		log.Print(log.LVL_ERROR, "failed to obtain liked playlists: %s", lib.likedPlaylistsErr)
+	}
+
+	lib.landing, lib.landingErr = m.client.LandingContext(ctx, landingBlocks...)
+	if lib.landingErr != nil {
+		log.Print(log.LVL_ERROR, "failed to obtain landing: %s", lib.landingErr)
+	}
+
+	lib.stations, lib.stationsErr = m.client.StationsContext(ctx, _STATIONS_LANGUAGE)
+	if lib.stationsErr != nil {
+		log.Print(log.LVL_ERROR, "failed to obtain stations list: %s", lib.stationsErr)
+	}
+
+	saveSnapshots(lib)
+	return lib
+}
+
+// saveSnapshots saves the track lists of the likes and the user playlists that are loaded completely.
+func saveSnapshots(lib library) {
+	if lib.likesErr != nil || lib.playlistsErr != nil || lib.failedPlaylists > 0 {
+		return
+	}
+
+	snapshots := make([]cache.Snapshot, 0, len(lib.playlists)+1)
+	snapshots = append(snapshots, cache.Snapshot{Name: "likes", Kind: playlist.LIKES, TrackIds: lib.likedIds})
+	for _, pl := range lib.playlists {
+		trackIds := make([]string, len(pl.Tracks))
+		for i := range pl.Tracks {
+			trackIds[i] = pl.Tracks[i].Id
+		}
+		snapshots = append(snapshots, cache.Snapshot{Name: pl.Name, Kind: pl.Kind, Revision: pl.Revision, TrackIds: trackIds})
+	}
+
+	err := cache.SaveSnapshots(snapshots)
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to save library snapshots: %s", err)
+	}
+}
+
+// applyLibrary shows the loaded user collection in the side panel.
+// The playlists that are already shown get the new tracks.
+func (m *Model) applyLibrary(lib library) {
+	if lib.waveSettingsErr == nil {
+		m.adoptWaveSettings(lib.waveSettings)
+	} else {
+		m.tracker.ShowError("my wave settings")
+	}
+
+	if lib.waveErr == nil {
+		station, index := m.playlists.GetFirst(playlist.MYWAVE)
+		if len(station.Tracks) == 0 {
+			station.StationId = lib.wave.Id
+			station.StationBatch = lib.wave.BatchId
+			for _, t := range lib.wave.Sequence {
+				station.Tracks = append(station.Tracks, t.Track)
+			}
+			m.playlists.SetItem(index, station)
+		}
+	} else {
+		m.tracker.ShowError("station tracks")
+	}
+
+	if lib.likedIds != nil {
+		clear(m.likedTracksMap)
+		for _, id := range lib.likedIds {
+			m.likedTracksMap[id] = true
+		}
+	}
+	if lib.likesErr == nil {
+		likes, index := m.playlists.GetFirst(playlist.LIKES)
+		m.replaceTracks(likes, lib.likes)
+		m.playlists.SetItem(index, likes)
+	} else {
+		m.tracker.ShowError("liked tracks")
+	}
+
+	if lib.playlistsErr == nil {
+		m.setUserPlaylists(lib.playlists)
+	} else {
+		m.tracker.ShowError("playlists")
+	}
+	if lib.failedPlaylists > 0 {
+		m.tracker.ShowError("playlist tracks")
+	}
+
+	if lib.likedAlbumsErr == nil {
+		m.likedAlbums = lib.likedAlbums
+		m.setSection("liked albums:", likedAlbumItems(m.likedAlbums))
+	} else {
+		m.tracker.ShowError("liked albums")
+	}
+
+	if lib.likedArtistsErr == nil {
+		m.setSection("liked artists:", likedArtistItems(lib.likedArtists))
+	} else {
+		m.tracker.ShowError("liked artists")
+	}
+
+	if lib.likedPlaylistsErr == nil {
+		m.setSection("liked playlists:", likedPlaylistItems(lib.likedPlaylists))
+	} else {
+		m.tracker.ShowError("liked playlists")
+	}
+
+	if lib.landingErr == nil {
+		m.setSection("landing:", landingItems(lib.landing))
+	} else {
+		m.tracker.ShowError("landing")
+	}
+
+	if lib.stationsErr == nil {
+		m.setSection("stations:", stationItems(lib.stations))
+	} else {
+		m.tracker.ShowError("stations")
+	}
+
+	m.markOfflinePlaylists(m.playlists.Items())
+}
+
+// setUserPlaylists shows the user playlists after the "playlists:" title.
+// The playlists that are already shown are updated in place, the ones that no longer exist are removed.
+func (m *Model) setUserPlaylists(playlists []*playlist.Item) {
+	shown := make(map[uint64]*playlist.Item)
+	items := make([]*playlist.Item, 0, len(m.playlists.Items())+len(playlists))
+	insertIndex := -1
+	for _, pl := range m.playlists.Items() {
+		if pl.Kind >= playlist.USER {
+			shown[pl.Kind] = pl
+			continue
+		}
+		items = append(items, pl)
+		if !pl.Active && pl.Name == "playlists:" {
+			insertIndex = len(items)
+		}
+	}
+	if insertIndex < 0 {
+		insertIndex = len(items)
+	}
+
+	userItems := make([]*playlist.Item, 0, len(playlists))
+	for _, pl := range playlists {
+		if item, ok := shown[pl.Kind]; ok {
+			item.Name = pl.Name
+			item.Revision = pl.Revision
+			m.replaceTracks(item, pl.Tracks)
+			pl = item
+		}
+		userItems = append(userItems, pl)
+	}
+
+	m.keepPositions(func() {
+		m.playlists.SetItems(slices.Insert(items, insertIndex, userItems...))
+	})
+}
+
+// replaceTracks sets the new tracks of the playlist keeping the playing and the selected tracks if they're still there.
+func (m *Model) replaceTracks(pl *playlist.Item, tracks []api.Track) {
+	trackIndex := func(index int) int {
+		if index >= len(pl.Tracks) {
+			return -1
+		}
+		id := pl.Tracks[index].Id
+		return slices.IndexFunc(tracks, func(track api.Track) bool {
+			return track.Id == id
+		})
+	}
+
+	current := trackIndex(pl.CurrentTrack)
+	selected := trackIndex(pl.SelectedTrack)
+
+	pl.Tracks = tracks
+	pl.CurrentTrack = max(current, 0)
+	if selected >= 0 {
+		pl.SelectedTrack = selected
+	} else {
+		pl.SelectedTrack = max(min(pl.SelectedTrack, len(tracks)-1), 0)
+	}
+	if len(pl.ShuffleOrder) > 0 {
+		pl.Shuffle(pl.CurrentTrack)
+	}
+
+	if m.playingEntry.Source == pl && !m.playingEntry.Queued() {
+		m.playingEntry.Index = pl.CurrentTrack
+	}
+}
+
+// reloadLibrary loads the user collection in the background when the connection is restored.
+// The changes made offline are sent first, so the loaded collection includes them.
+func (m *Model) reloadLibrary() tea.Cmd {
+	return func() tea.Msg {
+		err := m.sendPending(m.ctx)
+		if err != nil {
+			return libraryLoaded{err: err}
+		}
+		return libraryLoaded{library: m.fetchLibrary(m.ctx)}
+	}
+}
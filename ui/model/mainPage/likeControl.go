@@ -3,6 +3,9 @@ package mainpage
 import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/cache"
+	"github.com/dece2183/yamusic-tui/config"
+	"github.com/dece2183/yamusic-tui/log"
 	"github.com/dece2183/yamusic-tui/ui/components/playlist"
 )
 
@@ -27,7 +30,7 @@ func (m *Model) likeSelectedTrack() tea.Cmd {
 
 func (m *Model) likeTrack(track *api.Track) tea.Cmd {
 	if m.likedTracksMap[track.Id] {
-		if m.client.UnlikeTrack(track.Id) != nil {
+		if m.sendLike(track.Id, false) != nil {
 			return nil
 		}
 
@@ -40,9 +43,13 @@ func (m *Model) likeTrack(track *api.Track) tea.Cmd {
 			m.tracklist.Select(likedPlaylist.SelectedTrack)
 		}
 
-		return m.playlists.SetItem(index, likedPlaylist)
+		cmd := m.playlists.SetItem(index, likedPlaylist)
+		if config.Current.CacheTracks == config.CACHE_LIKED_ONLY && m.cachedTracksMap[track.Id] {
+			return tea.Batch(cmd, m.uncacheTrack(track.Id))
+		}
+		return cmd
 	} else {
-		if m.client.LikeTrack(track.Id) != nil {
+		if m.sendLike(track.Id, true) != nil {
 			return nil
 		}
 
@@ -53,3 +60,99 @@ func (m *Model) likeTrack(track *api.Track) tea.Cmd {
 		return m.playlists.SetItem(index, likedPlaylist)
 	}
 }
+
+// sendLike likes or unlikes the track on the server, the change is queued in the offline mode.
+func (m *Model) sendLike(trackId string, like bool) error {
+	if m.offline {
+		action := cache.ACTION_UNLIKE
+		if like {
+			action = cache.ACTION_LIKE
+		}
+		return m.queueChange(cache.Mutation{Action: action, TrackId: trackId})
+	}
+
+	if like {
+		return m.client.LikeTrackContext(m.ctx, trackId)
+	}
+	return m.client.UnlikeTrackContext(m.ctx, trackId)
+}
+
+func (m *Model) likeSelectedAlbum() tea.Cmd {
+	if len(m.tracklist.Items()) == 0 {
+		return nil
+	}
+
+	track := m.tracklist.SelectedItem().Track
+	if len(track.Albums) == 0 {
+		return nil
+	}
+
+	return m.likeAlbum(&track.Albums[0])
+}
+
+func (m *Model) likeAlbum(album *api.Album) tea.Cmd {
+	for i := range m.likedAlbums {
+		if m.likedAlbums[i].Id != album.Id {
+			continue
+		}
+
+		err := m.client.UnlikeAlbumContext(m.ctx, album.Id)
+		if err != nil {
+			log.Print(log.LVL_ERROR, "failed to unlike album [%s]: %s", album.Title, err)
+			m.tracker.ShowError("album unlike")
+			return nil
+		}
+
+		m.likedAlbums = append(m.likedAlbums[:i], m.likedAlbums[i+1:]...)
+		_, cmd := m.setSection("liked albums:", likedAlbumItems(m.likedAlbums))
+		return cmd
+	}
+
+	err := m.client.LikeAlbumContext(m.ctx, album.Id)
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to like album [%s]: %s", album.Title, err)
+		m.tracker.ShowError("album like")
+		return nil
+	}
+
+	m.likedAlbums = append([]api.Album{*album}, m.likedAlbums...)
+	_, cmd := m.setSection("liked albums:", likedAlbumItems(m.likedAlbums))
+	return cmd
+}
+
+func likedAlbumItems(albums []api.Album) []*playlist.Item {
+	items := make([]*playlist.Item, 0, len(albums))
+	for _, album := range albums {
+		items = append(items, albumItem(album))
+	}
+	return items
+}
+
+func likedArtistItems(artists []api.Artist) []*playlist.Item {
+	items := make([]*playlist.Item, 0, len(artists))
+	for _, artist := range artists {
+		items = append(items, &playlist.Item{
+			Name:      artist.Name,
+			Active:    true,
+			Subitem:   true,
+			Paginated: true,
+			ArtistId:  artist.Id,
+		})
+	}
+	return items
+}
+
+func likedPlaylistItems(playlists []api.Playlist) []*playlist.Item {
+	items := make([]*playlist.Item, 0, len(playlists))
+	for _, pl := range playlists {
+		items = append(items, &playlist.Item{
+			Name:       pl.Title + " by " + pl.Owner.Name,
+			Active:     true,
+			Subitem:    true,
+			Paginated:  true,
+			OwnerUid:   pl.Owner.Uid,
+			PlaylistId: pl.Kind,
+		})
+	}
+	return items
+}
@@ -1,20 +1,21 @@
 package mainpage
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net/url"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/dece2183/yamusic-tui/api"
-	"github.com/dece2183/yamusic-tui/cache"
 	"github.com/dece2183/yamusic-tui/config"
 	"github.com/dece2183/yamusic-tui/log"
 	"github.com/dece2183/yamusic-tui/media"
 	"github.com/dece2183/yamusic-tui/media/handler"
 	"github.com/dece2183/yamusic-tui/ui/components/input"
 	"github.com/dece2183/yamusic-tui/ui/components/playlist"
+	"github.com/dece2183/yamusic-tui/ui/components/queue"
 	"github.com/dece2183/yamusic-tui/ui/components/search"
 	"github.com/dece2183/yamusic-tui/ui/components/tracker"
 	"github.com/dece2183/yamusic-tui/ui/components/tracklist"
@@ -27,6 +28,8 @@ import (
 )
 
 type Model struct {
+	ctx           context.Context
+	cancel        context.CancelFunc
 	program       *tea.Program
 	client        *api.YaMusicClient
 	clipboard     *clipboard.Clipboard
@@ -38,19 +41,46 @@ type Model struct {
 	tracker      *tracker.Model
 	searchDialog *search.Model
 	inputDialog  *input.Model
+	queueDialog  *queue.Model
 
 	isSearchActive         bool
 	isAddPlaylistActive    bool
 	isRenamePlaylistActive bool
+	isQueueActive          bool
 
 	currentPlaylistIndex int
 	likedTracksMap       map[string]bool
 	cachedTracksMap      map[string]bool
+	// the tracks that are being written to the cache
+	cachingTracksMap map[string]bool
+	// the downloads of the offline playlists by their keys
+	offlineDownloads map[string]*offlineDownload
+	likedAlbums      []api.Album
+
+	queue        queue.Queue
+	playingEntry queue.Entry
+	// the track that is preloaded to be played without a gap
+	preloaded loadedTrack
+	// the last measured download speed
+	networkKbps int
+	// the server is unreachable, the library changes are queued until the connection is restored
+	offline bool
+
+	// cancel functions of the requests that are superseded by the next ones
+	searchCancel  context.CancelFunc
+	suggestCancel context.CancelFunc
+	browseCancel  context.CancelFunc
+	waveCancel    context.CancelFunc
+	trackCancel   context.CancelFunc
+	preloadCancel context.CancelFunc
+
+	err error
 }
 
 // mainpage.Model constructor.
 func New() *Model {
 	m := &Model{}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
 
 	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
 	m.program = p
@@ -58,12 +88,15 @@ func New() *Model {
 	m.mediaHandler = media.NewHandler(config.ConfigPath, "Yandex music terminal client")
 	m.likedTracksMap = make(map[string]bool)
 	m.cachedTracksMap = make(map[string]bool)
+	m.cachingTracksMap = make(map[string]bool)
+	m.offlineDownloads = make(map[string]*offlineDownload)
 
 	m.playlists = playlist.New(m.program, "YaMusic")
 	m.tracklist = tracklist.New(m.program, &m.likedTracksMap, &m.cachedTracksMap)
 	m.tracker = tracker.New(m.program, &m.likedTracksMap)
 	m.searchDialog = search.New()
 	m.inputDialog = input.New()
+	m.queueDialog = queue.New()
 	return m
 }
 
@@ -84,8 +117,14 @@ func (m *Model) Run() error {
 
 	_, err = m.program.Run()
 
+	// abort all requests in flight
+	m.cancel()
 	m.tracker.Stop()
 	m.mediaHandler.Disable()
+
+	if err == nil {
+		err = m.err
+	}
 	return err
 }
 
@@ -125,6 +164,13 @@ func (m *Model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		case m.isRenamePlaylistActive:
 			m.inputDialog, cmd = m.inputDialog.Update(message)
 			cmds = append(cmds, cmd)
+		case m.isQueueActive:
+			m.queueDialog, cmd = m.queueDialog.Update(message)
+			cmds = append(cmds, cmd)
+		case controls.Queue.Contains(keypress):
+			m.isQueueActive = true
+			cmd = m.queueDialog.SetEntries(m.queue.Upcoming())
+			cmds = append(cmds, cmd)
 		default:
 			m.playlists, cmd = m.playlists.Update(message)
 			cmds = append(cmds, cmd)
@@ -154,7 +200,16 @@ func (m *Model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 				m.indicateCurrentTrackPlaying(true)
 			}
 
-			m.tracklist.Shufflable = (selectedPlaylist.Kind != playlist.NONE && selectedPlaylist.Kind != playlist.MYWAVE && len(selectedPlaylist.Tracks) > 0)
+			if len(selectedPlaylist.Tracks) == 0 && !m.offline {
+				if selectedPlaylist.Infinite {
+					cmd = m.loadStationTracks(selectedPlaylist)
+				} else {
+					cmd = m.loadMoreTracks(selectedPlaylist)
+				}
+				cmds = append(cmds, cmd)
+			}
+
+			m.tracklist.Editable = (selectedPlaylist.Kind != playlist.NONE && !selectedPlaylist.Infinite && len(selectedPlaylist.Tracks) > 0)
 		case playlist.RENAME:
 			selectedPlaylist := m.playlists.SelectedItem()
 			if selectedPlaylist.Kind < playlist.USER {
@@ -163,6 +218,16 @@ func (m *Model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			m.inputDialog.Title = "Rename playlist " + selectedPlaylist.Name
 			m.inputDialog.SetValue(selectedPlaylist.Name)
 			m.isRenamePlaylistActive = true
+		case playlist.CHANGE:
+			selectedPlaylist := m.playlists.SelectedItem()
+			if selectedPlaylist.Kind != playlist.WAVE_SETTING {
+				break
+			}
+			cmd = m.changeWaveSetting(selectedPlaylist)
+			cmds = append(cmds, cmd)
+		case playlist.OFFLINE:
+			cmd = m.toggleOffline(m.playlists.SelectedItem())
+			cmds = append(cmds, cmd)
 		}
 
 	// tracklist control update
@@ -199,20 +264,47 @@ func (m *Model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			m.isSearchActive = true
 			m.Send(search.UPDATE_SUGGESTIONS)
 		case tracklist.SHUFFLE:
-			cmd = m.shufflePlaylist(m.playlists.SelectedItem())
-			cmds = append(cmds, cmd)
+			m.setShuffle(!m.tracker.Shuffle())
 		case tracklist.SHARE:
 			link := api.ShareTrackLink(m.tracklist.SelectedItem().Track)
 			if link != "" {
 				m.clipboard.CopyText(link)
 			}
+		case tracklist.PLAY_NEXT:
+			cmd = m.queueSelectedTrack(true)
+			cmds = append(cmds, cmd)
+		case tracklist.ENQUEUE:
+			cmd = m.queueSelectedTrack(false)
+			cmds = append(cmds, cmd)
+		case tracklist.LIKE_ALBUM:
+			cmd = m.likeSelectedAlbum()
+			cmds = append(cmds, cmd)
+		case tracklist.LOAD_MORE:
+			cmd = m.loadMoreTracks(m.playlists.SelectedItem())
+			cmds = append(cmds, cmd)
+		case tracklist.OPEN_ARTIST:
+			selectedTrack := m.tracklist.SelectedItem().Track
+			if len(selectedTrack.Artists) > 0 {
+				cmd = m.openArtist(selectedTrack.Artists[0])
+				cmds = append(cmds, cmd)
+			}
+		case tracklist.OPEN_ALBUM:
+			selectedTrack := m.tracklist.SelectedItem().Track
+			if len(selectedTrack.Albums) > 0 {
+				cmd = m.openAlbum(selectedTrack.Albums[0])
+				cmds = append(cmds, cmd)
+			}
 		}
 
 	// player control update
 	case tracker.Control:
 		switch msg {
 		case tracker.NEXT:
-			m.nextTrack()
+			cmd = m.nextTrack()
+			cmds = append(cmds, cmd)
+		case tracker.ENDED:
+			cmd = m.trackEnded()
+			cmds = append(cmds, cmd)
 		case tracker.PREV:
 			m.prevTrack()
 		case tracker.LIKE:
@@ -226,19 +318,47 @@ func (m *Model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			m.mediaHandler.OnSeek(m.tracker.Position())
 		case tracker.VOLUME:
 			m.mediaHandler.OnVolume()
+		case tracker.REPEAT:
+			m.mediaHandler.OnOptions()
+			cmd = m.resetPreload()
+			cmds = append(cmds, cmd)
 		case tracker.CACHE_TRACK:
-			cmd = m.cacheCurrentTrack()
+			cmd = m.cacheCurrentTrack(false)
 			cmds = append(cmds, cmd)
 		case tracker.BUFFERING_COMPLETE:
-			cacheMode := config.Current.CacheTracks
-			if cacheMode == config.CACHE_ALL || (cacheMode == config.CACHE_LIKED_ONLY && m.likedTracksMap[m.tracker.CurrentTrack().Id]) {
-				cmd = m.cacheCurrentTrack()
-				cmds = append(cmds, cmd)
-			}
+			cmd = m.autoCacheCurrentTrack()
+			cmds = append(cmds, cmd)
+			cmd = m.preloadNextTrack()
+			cmds = append(cmds, cmd)
 		}
 
 		m.tracker, cmd = m.tracker.Update(message)
 		cmds = append(cmds, cmd)
+	case shuffleMode:
+		cmd = m.setShuffle(bool(msg))
+		cmds = append(cmds, cmd)
+	case loopMode:
+		cmd = m.setRepeat(config.RepeatType(msg))
+		cmds = append(cmds, cmd)
+	case preloadedTrack:
+		m.setPreloadedTrack(msg)
+	case trackCached:
+		cmd = m.setCachedTrack(msg)
+		cmds = append(cmds, cmd)
+	case trackUncached:
+		cmd = m.setUncachedTrack(msg)
+		cmds = append(cmds, cmd)
+	case offlineTracks:
+		m.startOfflineDownload(msg)
+	case offlineProgress:
+		cmd = m.setOfflineProgress(msg)
+		cmds = append(cmds, cmd)
+	case connectionRestored:
+		cmd = m.restoreConnection(msg)
+		cmds = append(cmds, cmd)
+	case libraryLoaded:
+		cmd = m.setLibraryLoaded(msg)
+		cmds = append(cmds, cmd)
 
 	// search control update
 	case search.Control:
@@ -250,6 +370,29 @@ func (m *Model) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			cmds = append(cmds, cmd)
 		}
 
+	// browsing results update
+	case tracksPage:
+		cmd = m.appendTracksPage(msg)
+		cmds = append(cmds, cmd)
+	case browseResults:
+		cmd = m.displaySection(msg.title, msg.items)
+		cmds = append(cmds, cmd)
+	case stationTracks:
+		cmd = m.appendStationTracks(msg)
+		cmds = append(cmds, cmd)
+
+	// search results update
+	case searchResults:
+		cmd = m.displaySearchResults(msg)
+		cmds = append(cmds, cmd)
+	case searchSuggestions:
+		m.setSearchSuggestions(msg)
+
+	// queue dialog control update
+	case queue.Control:
+		cmd = m.queueControl(msg)
+		cmds = append(cmds, cmd)
+
 	// input dialog control update
 	case input.Control:
 		m.isRenamePlaylistActive = false
@@ -281,6 +424,8 @@ func (m *Model) View() string {
 		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, m.searchDialog.View())
 	} else if m.isRenamePlaylistActive {
 		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, m.inputDialog.View())
+	} else if m.isQueueActive {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, m.queueDialog.View())
 	}
 
 	var sidePanel string
@@ -315,6 +460,7 @@ func (m *Model) resize(width, height int) {
 
 	m.searchDialog.SetSize(searchWidth, height-4)
 	m.inputDialog.SetWidth(searchWidth)
+	m.queueDialog.SetSize(searchWidth, height-4)
 }
 
 func (m *Model) initialLoad() error {
@@ -322,93 +468,25 @@ func (m *Model) initialLoad() error {
 	if len(config.Current.Token) == 0 {
 		return fmt.Errorf("wrong token")
 	}
-	m.client, err = api.NewClient(config.Current.Token)
-	if err != nil {
-		if _, ok := err.(*url.Error); ok {
-			return fmt.Errorf("unable to connect to the Yandex server")
-		} else {
-			return err
-		}
+	m.client, err = api.NewClientContext(m.ctx, config.Current.Token, api.ClientOptions{})
+	if err != nil && !errors.Is(err, api.ErrNetwork) {
+		return err
 	}
 
 	//m.client = &api.YaMusicClient{}
 
-	for i, station := range m.playlists.Items() {
-		switch station.Kind {
-		case playlist.MYWAVE:
-			tracks, err := m.client.StationTracks(api.MyWaveId, nil)
-			if err != nil {
-				log.Print(log.LVL_ERROR, "failed to obtain station tracks for the first time: %s", err)
-				m.tracker.ShowError("station tracks")
-				continue
-			}
-
-			station.StationId = tracks.Id
-			station.StationBatch = tracks.BatchId
-			for _, t := range tracks.Sequence {
-				station.Tracks = append(station.Tracks, t.Track)
-			}
-			m.playlists.SetItem(i, station)
-		case playlist.LIKES:
-			likes, err := m.client.LikedTracks()
-			if err != nil {
-				log.Print(log.LVL_ERROR, "failed to obtain liked tracks for the first time: %s", err)
-				m.tracker.ShowError("liked tracks")
-				continue
-			}
-
-			likedTracksId := make([]string, len(likes))
-			for l, track := range likes {
-				m.likedTracksMap[track.Id] = true
-				likedTracksId[l] = track.Id
-			}
-
-			likedTracks, err := m.client.Tracks(likedTracksId)
-			if err != nil {
-				log.Print(log.LVL_ERROR, "failed to obtain liked tracks full info: %s", err)
-				m.tracker.ShowError("liked tracks info")
-				continue
-			}
-
-			station.Tracks = likedTracks
-			m.playlists.SetItem(i, station)
-		case playlist.LOCAL:
-			station.Tracks, err = cache.ListTracks()
-			if err != nil {
-				log.Print(log.LVL_ERROR, "failed to list cached tracks: %s", err)
-				m.tracker.ShowError("cache list")
-				continue
-			}
-			for i := range station.Tracks {
-				m.cachedTracksMap[station.Tracks[i].Id] = true
-			}
-			m.playlists.SetItem(i, station)
-		default:
-		}
-	}
-
-	playlists, err := m.client.ListPlaylists()
-	if err == nil {
-		for _, pl := range playlists {
-			playlistTracks, err := m.client.PlaylistTracks(pl.Kind, pl.Owner.Uid, false)
-			if err != nil {
-				log.Print(log.LVL_ERROR, "failed to obtain playlist [%s] tracks: %s", pl.Title, err)
-				m.tracker.ShowError("playlist tracks")
-				continue
-			}
+	m.loadCachedTracks()
 
-			m.playlists.InsertItem(-1, &playlist.Item{
-				Name:     pl.Title,
-				Kind:     pl.Kind,
-				Revision: pl.Revision,
-				Active:   true,
-				Subitem:  true,
-				Tracks:   playlistTracks,
-			})
-		}
+	if err != nil {
+		log.Print(log.LVL_WARNIGN, "unable to connect to the Yandex server, starting offline: %s", err)
+		m.offlineLoad()
 	} else {
-		log.Print(log.LVL_ERROR, "failed to obtain user playlists: %s", err)
-		m.tracker.ShowError("playlists")
+		// the changes made offline in the previous session
+		err = m.sendPending(m.ctx)
+		if err != nil {
+			log.Print(log.LVL_WARNIGN, "unable to send offline changes: %s", err)
+		}
+		m.applyLibrary(m.fetchLibrary(m.ctx))
 	}
 
 	m.playlists.Select(0)
@@ -453,24 +531,27 @@ func (m *Model) mediaHandle() {
 
 		case handler.MSG_SET_SHUFFLE:
 			val, ok := msg.Arg.(bool)
-			if !ok || !val {
-				break
-			}
-			currentPlaylist := m.playlists.Items()[m.currentPlaylistIndex]
-			if len(currentPlaylist.Tracks) == 0 {
-				break
-			}
-			if currentPlaylist.Kind >= playlist.LIKES {
-				cmd := m.shufflePlaylist(currentPlaylist)
-				m.Send(func() tea.Cmd {
-					return cmd
-				})
+			if ok {
+				m.Send(shuffleMode(val))
 			}
 		case handler.MSG_SET_VOLUME:
 			vol, ok := msg.Arg.(float64)
 			if ok {
 				m.tracker.SetVolume(vol)
 			}
+		case handler.MSG_SET_LOOP:
+			loop, ok := msg.Arg.(handler.LoopStatus)
+			if !ok {
+				break
+			}
+			switch loop {
+			case handler.LOOP_TRACK:
+				m.Send(loopMode(config.REPEAT_ONE))
+			case handler.LOOP_PLAYLIST:
+				m.Send(loopMode(config.REPEAT_ALL))
+			default:
+				m.Send(loopMode(config.REPEAT_OFF))
+			}
 
 		case handler.MSG_GET_PLAYBACKSTATUS:
 			var state handler.PlaybackState
@@ -485,7 +566,16 @@ func (m *Model) mediaHandle() {
 			}
 			m.mediaHandler.SendAnswer(state)
 		case handler.MSG_GET_SHUFFLE:
-			m.mediaHandler.SendAnswer(false)
+			m.mediaHandler.SendAnswer(m.tracker.Shuffle())
+		case handler.MSG_GET_LOOP:
+			switch m.tracker.Repeat() {
+			case config.REPEAT_ONE:
+				m.mediaHandler.SendAnswer(handler.LOOP_TRACK)
+			case config.REPEAT_ALL:
+				m.mediaHandler.SendAnswer(handler.LOOP_PLAYLIST)
+			default:
+				m.mediaHandler.SendAnswer(handler.LOOP_NONE)
+			}
 		case handler.MSG_GET_METADATA:
 			if m.tracker.IsStoped() {
 				m.mediaHandler.SendAnswer(handler.TrackMetadata{})
@@ -527,6 +617,28 @@ func (m *Model) mediaHandle() {
 	}
 }
 
+// checkAuthExpired closes the page if the token is no longer valid,
+// so the user can enter a new one.
+func (m *Model) checkAuthExpired(err error) bool {
+	if !errors.Is(err, api.ErrAuthExpired) {
+		return false
+	}
+	m.err = err
+	go m.program.Quit()
+	return true
+}
+
+// requestContext cancels the request tracked by the cancel func
+// and returns a new context for the request that supersedes it.
+func (m *Model) requestContext(cancel *context.CancelFunc) context.Context {
+	if *cancel != nil {
+		(*cancel)()
+	}
+	ctx, newCancel := context.WithCancel(m.ctx)
+	*cancel = newCancel
+	return ctx
+}
+
 func (m *Model) coverFilePath(track *api.Track) string {
 	tempDir := filepath.Join(os.TempDir(), config.ConfigPath)
 	if os.MkdirAll(tempDir, 0755) != nil {
@@ -0,0 +1,315 @@
+package mainpage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/cache"
+	"github.com/dece2183/yamusic-tui/log"
+	"github.com/dece2183/yamusic-tui/ui/components/playlist"
+)
+
+// the number of the offline playlist tracks that are downloaded at once
+const _OFFLINE_DOWNLOADS = 3
+
+// offlineDownload is the state of the offline playlist download
+type offlineDownload struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// the tracks that aren't downloaded or failed yet
+	remaining int
+}
+
+// offlineTracks is the full track list of the playlist that is made available offline.
+// The playlist is identified by its offline key, since its side panel item may be replaced while the tracks are listed.
+type offlineTracks struct {
+	key    string
+	name   string
+	tracks []api.Track
+	err    error
+}
+
+// offlineProgress is the result of the offline playlist track download
+type offlineProgress struct {
+	key   string
+	track api.Track
+	err   error
+}
+
+// offlineKey identifies the playlist among the offline playlists in the cache.
+func offlineKey(pl *playlist.Item) string {
+	switch {
+	case pl.Kind == playlist.LIKES:
+		return "likes"
+	case pl.Kind >= playlist.USER:
+		return fmt.Sprintf("playlist:%d", pl.Kind)
+	case pl.PlaylistId != 0:
+		return fmt.Sprintf("playlist:%d:%d", pl.OwnerUid, pl.PlaylistId)
+	case pl.AlbumId != 0:
+		return fmt.Sprintf("album:%d", pl.AlbumId)
+	case pl.ArtistId != 0:
+		return fmt.Sprintf("artist:%d", pl.ArtistId)
+	default:
+		return "tracks:" + pl.Name
+	}
+}
+
+// findOfflineItem returns the side panel item of the playlist by its offline key, nil if it isn't shown.
+func (m *Model) findOfflineItem(key string) *playlist.Item {
+	for _, item := range m.playlists.Items() {
+		if item.Downloadable() && offlineKey(item) == key {
+			return item
+		}
+	}
+	return nil
+}
+
+// markOfflinePlaylists restores the offline state of the playlists that were made available offline earlier.
+func (m *Model) markOfflinePlaylists(items []*playlist.Item) {
+	offline, err := cache.OfflinePlaylists()
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to list offline playlists: %s", err)
+		return
+	}
+
+	offlineIds := make(map[string][]string, len(offline))
+	for _, pl := range offline {
+		offlineIds[pl.Key] = pl.TrackIds
+	}
+
+	for _, item := range items {
+		trackIds, ok := offlineIds[offlineKey(item)]
+		if !ok || !item.Downloadable() || item.Offline {
+			continue
+		}
+
+		item.Offline = true
+		item.OfflineTotal = len(trackIds)
+		item.OfflineDone = 0
+		for _, id := range trackIds {
+			if m.cachedTracksMap[id] {
+				item.OfflineDone++
+			}
+		}
+	}
+}
+
+// toggleOffline starts the download of all the playlist tracks to the cache
+// or releases them if the playlist is already available offline.
+func (m *Model) toggleOffline(pl *playlist.Item) tea.Cmd {
+	if !pl.Downloadable() {
+		return nil
+	}
+
+	key := offlineKey(pl)
+	if pl.Offline {
+		if download, ok := m.offlineDownloads[key]; ok {
+			download.cancel()
+			delete(m.offlineDownloads, key)
+		}
+
+		err := cache.RemoveOfflinePlaylist(key)
+		if err != nil {
+			log.Print(log.LVL_ERROR, "failed to remove offline playlist [%s]: %s", pl.Name, err)
+			m.tracker.ShowError("offline remove")
+			return nil
+		}
+
+		pl.Offline = false
+		pl.OfflineDone, pl.OfflineTotal = 0, 0
+		// the released tracks could exceed the cache limits
+		return m.evictCache()
+	}
+
+	if m.offline {
+		log.Print(log.LVL_WARNIGN, "unable to download playlist [%s] offline", pl.Name)
+		m.tracker.ShowError("offline download")
+		return nil
+	}
+
+	if download, ok := m.offlineDownloads[key]; ok {
+		// the playlist item was replaced while its tracks were downloaded
+		download.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.offlineDownloads[key] = &offlineDownload{ctx: ctx, cancel: cancel}
+	pl.Offline = true
+	pl.OfflineDone, pl.OfflineTotal = 0, 0
+
+	src := *pl
+	src.Tracks = slices.Clone(pl.Tracks)
+
+	return func() tea.Msg {
+		for src.HasMore() {
+			tracks, total, err := m.requestTracksPage(ctx, &src)
+			if err != nil {
+				return offlineTracks{key: key, name: src.Name, err: err}
+			}
+			m.addTracksPage(&src, tracks, total)
+		}
+		return offlineTracks{key: key, name: src.Name, tracks: src.Tracks}
+	}
+}
+
+// startOfflineDownload saves the offline playlist and downloads its tracks that aren't cached yet.
+func (m *Model) startOfflineDownload(listed offlineTracks) {
+	key := listed.key
+	download, ok := m.offlineDownloads[key]
+	if !ok {
+		// the offline mode was disabled while the tracks were listed
+		return
+	}
+
+	pl := m.findOfflineItem(key)
+	if listed.err != nil {
+		if !errors.Is(listed.err, context.Canceled) {
+			log.Print(log.LVL_ERROR, "failed to obtain offline playlist [%s] tracks: %s", listed.name, listed.err)
+			m.tracker.ShowError("offline tracks")
+			m.checkAuthExpired(listed.err)
+		}
+		download.cancel()
+		delete(m.offlineDownloads, key)
+		if pl != nil {
+			pl.Offline = false
+		}
+		return
+	}
+
+	var (
+		trackIds []string
+		pending  []api.Track
+	)
+	for _, track := range listed.tracks {
+		if !track.Available {
+			continue
+		}
+		trackIds = append(trackIds, track.Id)
+		if !m.cachedTracksMap[track.Id] {
+			pending = append(pending, track)
+		}
+	}
+
+	err := cache.SetOfflinePlaylist(cache.OfflinePlaylist{Key: key, Name: listed.name, TrackIds: trackIds})
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to save offline playlist [%s]: %s", listed.name, err)
+		m.tracker.ShowError("offline save")
+		download.cancel()
+		delete(m.offlineDownloads, key)
+		if pl != nil {
+			pl.Offline = false
+		}
+		return
+	}
+
+	if pl != nil {
+		pl.Offline = true
+		pl.OfflineTotal = len(trackIds)
+		pl.OfflineDone = len(trackIds) - len(pending)
+	}
+	download.remaining = len(pending)
+	if download.remaining == 0 {
+		download.cancel()
+		delete(m.offlineDownloads, key)
+		return
+	}
+
+	go m.downloadOfflineTracks(download.ctx, m.client, key, pending)
+}
+
+// downloadOfflineTracks downloads the tracks to the cache keeping the limited number of downloads at once.
+func (m *Model) downloadOfflineTracks(ctx context.Context, client *api.YaMusicClient, key string, tracks []api.Track) {
+	slots := make(chan bool, _OFFLINE_DOWNLOADS)
+	for i := range tracks {
+		select {
+		case slots <- true:
+		case <-ctx.Done():
+			return
+		}
+
+		go func(track *api.Track) {
+			normalized := withAlbumNormalization(track, tracks)
+			err := m.downloadOfflineTrack(ctx, client, &normalized)
+			<-slots
+			if ctx.Err() == nil {
+				m.program.Send(offlineProgress{key: key, track: *track, err: err})
+			}
+		}(&tracks[i])
+	}
+}
+
+// downloadOfflineTrack downloads the whole track with its cover to the cache.
+func (m *Model) downloadOfflineTrack(ctx context.Context, client *api.YaMusicClient, track *api.Track) error {
+	var cover bytes.Buffer
+	coverType, err := client.DownloadTrackCoverContext(ctx, &cover, track, 200)
+	if err != nil {
+		log.Print(log.LVL_WARNIGN, "unable to download track [%s] cover: %s", track.Id, err)
+		cover.Reset()
+	}
+
+	source, err := m.downloadTrack(ctx, client, track, 0)
+	if err != nil {
+		return err
+	}
+
+	defer source.Stream.Close()
+	stop := context.AfterFunc(ctx, func() {
+		source.Stream.Close()
+	})
+	defer stop()
+
+	source.Stream.BufferAll()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if source.Stream.Error() != nil {
+		return source.Stream.Error()
+	}
+
+	cacheFile, err := cache.Write(*track, source.Codec)
+	if err != nil {
+		return err
+	}
+
+	_, err = trackTag(track, coverType, cover.Bytes()).WriteTo(cacheFile)
+	if err == nil {
+		_, err = source.Stream.WriteTo(cacheFile)
+	}
+	if err != nil {
+		cacheFile.Discard()
+		return err
+	}
+
+	return cacheFile.Close()
+}
+
+// setOfflineProgress adds the downloaded track to the local playlist and updates the playlist progress.
+func (m *Model) setOfflineProgress(progress offlineProgress) tea.Cmd {
+	key := progress.key
+	download, ok := m.offlineDownloads[key]
+	if !ok {
+		return nil
+	}
+
+	download.remaining--
+	if download.remaining <= 0 {
+		download.cancel()
+		delete(m.offlineDownloads, key)
+	}
+
+	if progress.err != nil {
+		log.Print(log.LVL_ERROR, "failed to download offline track [%s]: %s", progress.track.Id, progress.err)
+		m.tracker.ShowError("offline download")
+		return nil
+	}
+
+	if pl := m.findOfflineItem(key); pl != nil {
+		pl.OfflineDone++
+	}
+	return m.setCachedTrack(trackCached{track: progress.track})
+}
@@ -1,6 +1,9 @@
 package mainpage
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -9,33 +12,57 @@ import (
 	_ "image/png"
 
 	"github.com/bogem/id3v2/v2"
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/dece2183/yamusic-tui/api"
 	"github.com/dece2183/yamusic-tui/cache"
+	"github.com/dece2183/yamusic-tui/config"
 	"github.com/dece2183/yamusic-tui/log"
 	"github.com/dece2183/yamusic-tui/stream"
+	"github.com/dece2183/yamusic-tui/ui/components/playlist"
+	"github.com/dece2183/yamusic-tui/ui/components/queue"
 	"github.com/dece2183/yamusic-tui/ui/components/tracker"
 	"github.com/dece2183/yamusic-tui/ui/components/tracklist"
 	"github.com/dece2183/yamusic-tui/ui/helpers"
 )
 
-const (
-	_TRACK_DOWNLOAD_TRIES = 3
-)
+// shuffleMode is sent by the media handler to switch the shuffle mode
+type shuffleMode bool
+
+// loopMode is sent by the media handler to switch the repeat mode
+type loopMode config.RepeatType
 
 func (m *Model) prevTrack() {
+	if m.playHistory() {
+		return
+	}
+
 	if m.currentPlaylistIndex < 0 {
 		return
 	}
 
 	currentPlaylist := m.playlists.Items()[m.currentPlaylistIndex]
-	if len(currentPlaylist.Tracks) == 0 || currentPlaylist.CurrentTrack == 0 {
+	if len(currentPlaylist.Tracks) == 0 || !hasAvailableTracks(currentPlaylist.Tracks) {
 		m.Send(tracker.STOP)
 		return
 	}
 
+	prev := m.prevTrackIndex(currentPlaylist)
+	if prev < 0 {
+		if currentPlaylist.Infinite || m.tracker.Repeat() != config.REPEAT_ALL || currentPlaylist.HasMore() {
+			m.Send(tracker.STOP)
+			return
+		}
+		// wrap to the end of the playlist
+		prev = len(currentPlaylist.Tracks) - 1
+		if m.shuffled(currentPlaylist) {
+			prev = currentPlaylist.ShuffledLast()
+		}
+	}
+
 	m.indicateCurrentTrackPlaying(false)
 
-	currentPlaylist.CurrentTrack--
+	lastTrack := currentPlaylist.CurrentTrack
+	currentPlaylist.CurrentTrack = prev
 	m.playlists.SetItem(m.currentPlaylistIndex, currentPlaylist)
 
 	track := &currentPlaylist.Tracks[currentPlaylist.CurrentTrack]
@@ -44,22 +71,30 @@ func (m *Model) prevTrack() {
 		return
 	}
 
+	m.playingEntry = queue.Entry{Track: *track, Source: currentPlaylist, Index: currentPlaylist.CurrentTrack}
 	m.playTrack(track)
 	selectedPlaylist := m.playlists.SelectedItem()
-	if currentPlaylist.IsSame(selectedPlaylist) && m.tracklist.Index() == currentPlaylist.CurrentTrack+1 {
+	if currentPlaylist.IsSame(selectedPlaylist) && m.tracklist.Index() == lastTrack {
 		m.tracklist.Select(currentPlaylist.CurrentTrack)
 	}
 }
 
-func (m *Model) nextTrack() {
+func (m *Model) nextTrack() tea.Cmd {
+	wasQueued := m.playingEntry.Queued()
+	m.queue.PushHistory(m.playingEntry)
+
+	if m.playQueued() {
+		return nil
+	}
+
 	if m.currentPlaylistIndex < 0 {
-		return
+		return nil
 	}
 
 	currentPlaylist := m.playlists.Items()[m.currentPlaylistIndex]
 	if len(currentPlaylist.Tracks) == 0 {
 		m.Send(tracker.STOP)
-		return
+		return nil
 	}
 
 	m.indicateCurrentTrackPlaying(false)
@@ -67,33 +102,39 @@ func (m *Model) nextTrack() {
 	if currentPlaylist.Infinite {
 		currTrack := currentPlaylist.Tracks[currentPlaylist.CurrentTrack]
 
-		if m.tracker.Progress() == 1 {
-			go m.client.StationFeedback(
-				api.ROTOR_TRACK_FINISHED,
-				currentPlaylist.StationId,
-				currentPlaylist.StationBatch,
-				currTrack.Id,
-				currTrack.DurationMs*1000,
-			)
-		} else {
-			go m.client.StationFeedback(
-				api.ROTOR_SKIP,
-				currentPlaylist.StationId,
-				currentPlaylist.StationBatch,
-				currTrack.Id,
-				int(float64(currTrack.DurationMs*1000)*m.tracker.Progress()),
-			)
+		// the queued track isn't related to the station
+		if !wasQueued && !m.offline {
+			if m.tracker.Progress() == 1 {
+				go m.client.StationFeedbackContext(
+					m.ctx,
+					api.ROTOR_TRACK_FINISHED,
+					currentPlaylist.StationId,
+					currentPlaylist.StationBatch,
+					currTrack.Id,
+					currTrack.DurationMs*1000,
+				)
+			} else {
+				go m.client.StationFeedbackContext(
+					m.ctx,
+					api.ROTOR_SKIP,
+					currentPlaylist.StationId,
+					currentPlaylist.StationBatch,
+					currTrack.Id,
+					int(float64(currTrack.DurationMs*1000)*m.tracker.Progress()),
+				)
+			}
 		}
 
 		if currentPlaylist.CurrentTrack+2 >= len(currentPlaylist.Tracks) {
-			tracks, err := m.client.StationTracks(api.MyWaveId, &currTrack)
+			tracks, err := m.client.StationTracksContext(m.ctx, currentPlaylist.StationId, &currTrack)
 			if err != nil {
 				log.Print(log.LVL_ERROR, "failed to obtain more station tracks: %s", err)
 				m.tracker.ShowError("station tracks")
 				m.Send(tracker.STOP)
-				return
+				return nil
 			}
 
+			currentPlaylist.StationBatch = tracks.BatchId
 			for _, tr := range tracks.Sequence {
 				// automatic append new tracks to the track list if this playlist is selected
 				currentPlaylist.Tracks = append(currentPlaylist.Tracks, tr.Track)
@@ -103,14 +144,35 @@ func (m *Model) nextTrack() {
 				}
 			}
 		}
-	} else if currentPlaylist.CurrentTrack+1 >= len(currentPlaylist.Tracks) {
-		currentPlaylist.CurrentTrack = 0
-		m.playlists.SetItem(m.currentPlaylistIndex, currentPlaylist)
-		m.Send(tracker.STOP)
-		return
+	} else if m.nextTrackIndex(currentPlaylist) < 0 && currentPlaylist.HasMore() && !currentPlaylist.Loading {
+		// the playback continues when the page is loaded
+		return m.loadTracksPage(currentPlaylist, true)
 	}
 
-	currentPlaylist.CurrentTrack++
+	m.continuePlaylist(currentPlaylist)
+	return nil
+}
+
+// continuePlaylist plays the track that follows the current one in the playing playlist.
+func (m *Model) continuePlaylist(currentPlaylist *playlist.Item) {
+	next := m.nextTrackIndex(currentPlaylist)
+	if next < 0 {
+		if currentPlaylist.Infinite || m.tracker.Repeat() != config.REPEAT_ALL || !hasAvailableTracks(currentPlaylist.Tracks) {
+			currentPlaylist.CurrentTrack = 0
+			m.playlists.SetItem(m.currentPlaylistIndex, currentPlaylist)
+			m.Send(tracker.STOP)
+			return
+		}
+		// wrap to the beginning of the playlist
+		next = 0
+		if m.shuffled(currentPlaylist) {
+			currentPlaylist.Shuffle(-1)
+			next = currentPlaylist.ShuffledFirst()
+		}
+	}
+
+	lastTrack := currentPlaylist.CurrentTrack
+	currentPlaylist.CurrentTrack = next
 	m.playlists.SetItem(m.currentPlaylistIndex, currentPlaylist)
 
 	track := &currentPlaylist.Tracks[currentPlaylist.CurrentTrack]
@@ -119,16 +181,149 @@ func (m *Model) nextTrack() {
 		return
 	}
 
+	m.playingEntry = queue.Entry{Track: *track, Source: currentPlaylist, Index: currentPlaylist.CurrentTrack}
 	m.playTrack(track)
 	selectedPlaylist := m.playlists.SelectedItem()
-	if currentPlaylist.IsSame(selectedPlaylist) && m.tracklist.Index() == currentPlaylist.CurrentTrack-1 {
+	if currentPlaylist.IsSame(selectedPlaylist) && m.tracklist.Index() == lastTrack {
 		m.tracklist.Select(currentPlaylist.CurrentTrack)
 	}
 }
 
+// trackEnded switches to the next track according to the playback mode.
+func (m *Model) trackEnded() tea.Cmd {
+	if m.tracker.StopAfterCurrent() {
+		m.tracker.SetStopAfterCurrent(false)
+		m.indicateCurrentTrackPlaying(false)
+		m.Send(tracker.STOP)
+		return nil
+	}
+
+	if m.tracker.Repeat() == config.REPEAT_ONE && len(m.playingEntry.Track.Id) > 0 {
+		track := m.playingEntry.Track
+		m.playTrack(&track)
+		return nil
+	}
+
+	return m.nextTrack()
+}
+
+// shuffled reports whether the playlist is played in the shuffled order.
+func (m *Model) shuffled(pl *playlist.Item) bool {
+	return m.tracker.Shuffle() && !pl.Infinite
+}
+
+// nextTrackIndex returns the index of the track that follows the current one
+// according to the playback order, -1 if there are no more loaded tracks.
+func (m *Model) nextTrackIndex(pl *playlist.Item) int {
+	if m.shuffled(pl) {
+		return pl.ShuffledNext()
+	}
+	if pl.CurrentTrack+1 < len(pl.Tracks) {
+		return pl.CurrentTrack + 1
+	}
+	return -1
+}
+
+// prevTrackIndex returns the index of the track that precedes the current one
+// according to the playback order, -1 if the current track is the first one.
+func (m *Model) prevTrackIndex(pl *playlist.Item) int {
+	if m.shuffled(pl) {
+		return pl.ShuffledPrev()
+	}
+	return pl.CurrentTrack - 1
+}
+
+// setShuffle switches the shuffle mode. The playing track stays the first one
+// in the new shuffled order, and turning the mode off continues the original order from it.
+func (m *Model) setShuffle(shuffle bool) tea.Cmd {
+	if m.tracker.Shuffle() == shuffle {
+		return nil
+	}
+
+	m.tracker.SetShuffle(shuffle)
+	if shuffle && m.currentPlaylistIndex >= 0 {
+		currentPlaylist := m.playlists.Items()[m.currentPlaylistIndex]
+		currentPlaylist.Shuffle(currentPlaylist.CurrentTrack)
+	}
+
+	m.mediaHandler.OnOptions()
+	return m.resetPreload()
+}
+
+// setRepeat switches the repeat mode and preloads the track that follows in the new mode.
+func (m *Model) setRepeat(repeat config.RepeatType) tea.Cmd {
+	if m.tracker.Repeat() == repeat {
+		return nil
+	}
+
+	m.tracker.SetRepeat(repeat)
+	m.mediaHandler.OnOptions()
+	return m.resetPreload()
+}
+
+func hasAvailableTracks(tracks []api.Track) bool {
+	for i := range tracks {
+		if tracks[i].Available {
+			return true
+		}
+	}
+	return false
+}
+
+// loadedTrack is the track prepared for the playback
+type loadedTrack struct {
+	track  *api.Track
+	source tracker.Source
+	lyrics []api.LyricPair
+	// the lyrics failed to load, the track is played without them
+	lyricsErr error
+	// ID3 tag and the head of the track stream that are written to the metadata file
+	metadata []byte
+}
+
 func (m *Model) playTrack(track *api.Track) {
+	if m.tracker.ContinueWith(track) {
+		// the player has already switched to the preloaded track without a gap
+		m.writeMetadata(m.preloaded.metadata)
+		m.preloaded = loadedTrack{}
+		m.trackStarted(track)
+		return
+	}
+
+	m.measureNetwork()
 	m.tracker.Stop()
+	m.preloaded = loadedTrack{}
+
+	// abort loading of the previous track if it's still in progress
+	ctx := m.requestContext(&m.trackCancel)
 
+	// the album normalization is kept in the tags of the cached track
+	normalized := withAlbumNormalization(track, m.playingTracks())
+	loaded, err := m.loadTrack(ctx, m.client, &normalized, m.networkKbps, m.offline)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			m.tracker.ShowError("track download")
+			m.checkAuthExpired(err)
+		}
+		return
+	}
+
+	m.writeMetadata(loaded.metadata)
+	m.tracker.StartTrack(track, loaded.source, loaded.lyrics, m.trackLoudness(track))
+	if m.tracker.IsStoped() {
+		return
+	}
+	if loaded.lyricsErr != nil {
+		m.tracker.ShowError("track lyrics")
+	}
+	m.trackStarted(track)
+}
+
+// loadTrack downloads the track cover and lyrics and opens the track stream from the cache or the server.
+// The download speed in kbps is used to lower the bitrate in the metered mode, 0 if it's unknown.
+// The cover and lyrics aren't requested in the offline mode. The client is passed by the caller,
+// since it's replaced on the UI goroutine when the connection is restored.
+func (m *Model) loadTrack(ctx context.Context, client *api.YaMusicClient, track *api.Track, networkKbps int, offline bool) (loadedTrack, error) {
 	var (
 		coverFile  *os.File
 		coverStat  os.FileInfo
@@ -147,8 +342,8 @@ func (m *Model) playTrack(track *api.Track) {
 	defer coverFile.Close()
 
 	coverStat, err = coverFile.Stat()
-	if err != nil || coverStat.Size() == 0 {
-		coverType, err = api.DownloadTrackCover(coverFile, track, 200)
+	if (err != nil || coverStat.Size() == 0) && !offline {
+		coverType, err = client.DownloadTrackCoverContext(ctx, coverFile, track, 200)
 		if err != nil {
 			log.Print(log.LVL_WARNIGN, "unable to download track [%s] cover: %s", track.Id, err)
 			goto skipcover
@@ -162,92 +357,161 @@ func (m *Model) playTrack(track *api.Track) {
 
 skipcover:
 	var trackFromCache bool
-	var trackBuffer *stream.BufferedStream
-	var trackReader io.ReadCloser
-	var trackSize int64
-	var lyrics []api.LyricPair
-	if track.LyricsInfo.HasAvailableSyncLyrics {
-		lyrics, err = m.client.TrackLyricsRequest(track.Id)
-		if err != nil {
-			log.Print(log.LVL_WARNIGN, "failed to obtain track [%s] lyrics: %s", track.Id, err)
-			m.tracker.ShowError("track lyrics")
+	loaded := loadedTrack{track: track}
+	if track.LyricsInfo.HasAvailableSyncLyrics && !offline {
+		loaded.lyrics, loaded.lyricsErr = client.TrackLyricsRequestContext(ctx, track.Id)
+		if loaded.lyricsErr != nil {
+			log.Print(log.LVL_WARNIGN, "failed to obtain track [%s] lyrics: %s", track.Id, loaded.lyricsErr)
 		}
 	}
-	trackReader, trackSize, err = cache.Read(track.Id)
+	trackReader, trackSize, codec, err := cache.Read(track.Id)
 	if err == nil {
 		trackFromCache = true
+		loaded.source = tracker.Source{
+			Stream: stream.NewFileStream(trackReader, trackSize),
+			Codec:  codec,
+			Cached: true,
+		}
+		if track.DurationMs > 0 {
+			loaded.source.BitrateKbps = int(trackSize * 8 / int64(track.DurationMs))
+		}
 	} else {
-		var trackInfos []api.TrackDownloadInfo
-		var bestTrackInfo api.TrackDownloadInfo
+		loaded.source, err = m.downloadTrack(ctx, client, track, networkKbps)
+		if err != nil {
+			return loaded, err
+		}
+	}
 
-		for i := 0; i < _TRACK_DOWNLOAD_TRIES; i++ {
-			trackInfos, err = m.client.TrackDownloadInfo(track.Id)
-			if err != nil {
-				log.Print(log.LVL_ERROR, "failed to obtain track [%s] info: %s", track.Id, err)
-				continue
-			}
+	var metadata bytes.Buffer
+	var tag *id3v2.Tag
+	if trackFromCache {
+		tag = id3v2.NewEmptyTag()
+		tag.Reset(loaded.source.Stream, id3v2.Options{Parse: true})
+	} else {
+		tag = trackTag(track, coverType, coverBytes)
+	}
+	tag.WriteTo(&metadata)
+	io.CopyN(&metadata, loaded.source.Stream, 32*1024)
+	loaded.source.Stream.Seek(0, io.SeekStart)
+	loaded.metadata = metadata.Bytes()
 
-			var bestBitrate int
-			for _, t := range trackInfos {
-				if t.BbitrateInKbps > bestBitrate {
-					bestBitrate = t.BbitrateInKbps
-					bestTrackInfo = t
-				}
-			}
+	return loaded, nil
+}
 
-			trackReader, trackSize, err = m.client.DownloadTrack(bestTrackInfo)
-			if err != nil {
-				log.Print(log.LVL_ERROR, "failed to download track [%s]: %s", track.Id, err)
-				continue
-			}
+// trackTag creates the ID3 tag of the track that is written to the cached file.
+func trackTag(track *api.Track, coverType string, coverBytes []byte) *id3v2.Tag {
+	tag := id3v2.NewEmptyTag()
+	tag.SetDefaultEncoding(id3v2.EncodingUTF8)
+	tag.SetTitle(track.Title)
+	if len(track.Albums) != 0 {
+		tag.SetAlbum(track.Albums[0].Title)
+		tag.SetGenre(track.Albums[0].Genre)
+		tag.SetYear(fmt.Sprint(track.Albums[0].Year))
+	}
+	tag.SetArtist(helpers.ArtistList(track.Artists))
+	tag.AddAttachedPicture(id3v2.PictureFrame{
+		MimeType:    coverType,
+		PictureType: id3v2.PTFrontCover,
+		Encoding:    id3v2.EncodingUTF16BE,
+		Picture:     coverBytes,
+	})
+	tag.AddFrame("TLEN", id3v2.TextFrame{
+		Encoding: id3v2.EncodingUTF8,
+		Text:     fmt.Sprint(track.DurationMs),
+	})
+	if track.Normalization.Gain != 0 || track.Normalization.Peak != 0 {
+		tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			Description: cache.TAG_TRACK_GAIN,
+			Value:       fmt.Sprintf("%.2f dB", track.Normalization.Gain),
+		})
+		tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			Description: cache.TAG_TRACK_PEAK,
+			Value:       fmt.Sprintf("%.6f", track.Normalization.Peak/api.NORMALIZATION_PEAK_SCALE),
+		})
+	}
+	if track.Normalization.AlbumGain != 0 || track.Normalization.AlbumPeak != 0 {
+		tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			Description: cache.TAG_ALBUM_GAIN,
+			Value:       fmt.Sprintf("%.2f dB", track.Normalization.AlbumGain),
+		})
+		tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			Description: cache.TAG_ALBUM_PEAK,
+			Value:       fmt.Sprintf("%.6f", track.Normalization.AlbumPeak/api.NORMALIZATION_PEAK_SCALE),
+		})
+	}
+	return tag
+}
 
-			break
+// trackLoudness returns the normalization of the track according to the configured mode.
+// The album mode falls back to the track normalization if the album one is unknown.
+func (m *Model) trackLoudness(track *api.Track) tracker.Loudness {
+	switch config.Current.Normalization {
+	case config.NORMALIZATION_TRACK:
+		return tracker.TrackLoudness(track)
+	case config.NORMALIZATION_ALBUM:
+		normalized := withAlbumNormalization(track, m.playingTracks())
+		if loudness, ok := tracker.AlbumLoudness(&normalized); ok {
+			return loudness
 		}
+		return tracker.TrackLoudness(track)
+	default:
+		return tracker.Loudness{}
+	}
+}
 
-		if err != nil {
-			m.tracker.ShowError("track download")
-			return
-		}
+// playingTracks returns the tracks of the playing playlist.
+func (m *Model) playingTracks() []api.Track {
+	if m.currentPlaylistIndex < 0 {
+		return nil
 	}
+	return m.playlists.Items()[m.currentPlaylistIndex].Tracks
+}
 
-	trackBuffer = stream.NewBufferedStream(trackReader, trackSize)
-	metadataFile, err := os.OpenFile(m.metadataFilePath(), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
-	if err == nil {
-		tag := id3v2.NewEmptyTag()
-		if trackFromCache {
-			tag.Reset(trackBuffer, id3v2.Options{Parse: true})
-		} else {
-			tag.SetDefaultEncoding(id3v2.EncodingUTF8)
-			tag.SetTitle(track.Title)
-			if len(track.Albums) != 0 {
-				tag.SetAlbum(track.Albums[0].Title)
-				tag.SetGenre(track.Albums[0].Genre)
-				tag.SetYear(fmt.Sprint(track.Albums[0].Year))
-			}
-			tag.SetArtist(helpers.ArtistList(track.Artists))
-			tag.AddAttachedPicture(id3v2.PictureFrame{
-				MimeType:    coverType,
-				PictureType: id3v2.PTFrontCover,
-				Encoding:    id3v2.EncodingUTF16BE,
-				Picture:     coverBytes,
-			})
-			tag.AddFrame("TLEN", id3v2.TextFrame{
-				Encoding: id3v2.EncodingUTF8,
-				Text:     fmt.Sprint(track.DurationMs),
-			})
+// withAlbumNormalization returns the copy of the track with the album normalization.
+// Unless the server provides it, it's calculated from the tracks of the same album among the tracks.
+func withAlbumNormalization(track *api.Track, tracks []api.Track) api.Track {
+	normalized := *track
+	if _, ok := tracker.AlbumLoudness(track); ok || len(track.Albums) == 0 || track.Albums[0].Id == 0 {
+		return normalized
+	}
+
+	album := []*api.Track{track}
+	albumId := track.Albums[0].Id
+	for i := range tracks {
+		t := &tracks[i]
+		if t.Id == track.Id || len(t.Albums) == 0 || t.Albums[0].Id != albumId {
+			continue
 		}
-		tag.WriteTo(metadataFile)
-		io.CopyN(metadataFile, trackBuffer, 32*1024)
-		trackBuffer.Seek(0, io.SeekStart)
-		metadataFile.Close()
-	} else {
+		album = append(album, t)
+	}
+
+	loudness, ok := tracker.CombinedLoudness(album)
+	if ok {
+		normalized.Normalization.AlbumGain = float32(loudness.Gain)
+		normalized.Normalization.AlbumPeak = float32(loudness.Peak * api.NORMALIZATION_PEAK_SCALE)
+	}
+	return normalized
+}
+
+func (m *Model) writeMetadata(metadata []byte) {
+	err := os.WriteFile(m.metadataFilePath(), metadata, 0755)
+	if err != nil {
 		log.Print(log.LVL_WARNIGN, "failed to create metadata file: %s", err)
 	}
+}
 
-	if m.currentPlaylistIndex >= 0 {
+// trackStarted notifies the station, the server and the media handler that the track playback has started.
+// The server isn't notified in the offline mode.
+func (m *Model) trackStarted(track *api.Track) {
+	if m.currentPlaylistIndex >= 0 && !m.playingEntry.Queued() && !m.offline {
 		currentPlaylist := m.playlists.Items()[m.currentPlaylistIndex]
 		if currentPlaylist.Infinite {
-			go m.client.StationFeedback(
+			go m.client.StationFeedbackContext(
+				m.ctx,
 				api.ROTOR_TRACK_STARTED,
 				currentPlaylist.StationId,
 				currentPlaylist.StationBatch,
@@ -257,10 +521,61 @@ skipcover:
 		}
 	}
 
-	m.tracker.StartTrack(track, trackBuffer, lyrics)
+	if m.cachedTracksMap[track.Id] {
+		go cache.Touch(track.Id)
+	}
+
 	m.indicateCurrentTrackPlaying(true)
 	m.mediaHandler.OnPlayback()
-	go m.client.PlayTrack(track, false)
+	if !m.offline {
+		go m.client.PlayTrackContext(m.ctx, track, false)
+	}
+}
+
+// downloadTrack opens the download stream of the track variant that fits the quality settings.
+// The stream requests the track file by ranges when it's seeked beyond the downloaded data.
+func (m *Model) downloadTrack(ctx context.Context, client *api.YaMusicClient, track *api.Track, networkKbps int) (tracker.Source, error) {
+	var source tracker.Source
+
+	trackInfos, err := client.TrackDownloadInfoContext(ctx, track.Id)
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to obtain track [%s] info: %s", track.Id, err)
+		return source, err
+	}
+
+	trackInfo, metered, ok := selectDownloadInfo(trackInfos, networkKbps)
+	if !ok {
+		err = fmt.Errorf("no supported codec among %d variants", len(trackInfos))
+		log.Print(log.LVL_ERROR, "failed to download track [%s]: %s", track.Id, err)
+		return source, err
+	}
+
+	trackUrl, err := client.TrackUrlContext(ctx, trackInfo)
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to obtain track [%s] link: %s", track.Id, err)
+		return source, err
+	}
+
+	trackReader, trackSize, err := client.DownloadTrackRangeContext(ctx, trackInfo, trackUrl, 0)
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to download track [%s]: %s", track.Id, err)
+		return source, err
+	}
+
+	// the ranges are requested while the track is playing, so they outlive the loading context
+	openRange := func(offset int64) (io.ReadCloser, error) {
+		rangeReader, _, err := client.DownloadTrackRangeContext(m.ctx, trackInfo, trackUrl, offset)
+		if err != nil {
+			log.Print(log.LVL_ERROR, "failed to download track [%s] from %d: %s", track.Id, offset, err)
+		}
+		return rangeReader, err
+	}
+
+	source.Stream = stream.NewRangeStream(trackReader, trackSize, openRange)
+	source.Codec = trackInfo.Codec
+	source.BitrateKbps = trackInfo.BbitrateInKbps
+	source.Metered = metered
+	return source, nil
 }
 
 func (m *Model) playSelectedPlaylist(trackIndex int) {
@@ -274,7 +589,7 @@ func (m *Model) playSelectedPlaylist(trackIndex int) {
 
 	if m.currentPlaylistIndex >= 0 {
 		currentPlaylist := m.playlists.Items()[m.currentPlaylistIndex]
-		if currentPlaylist.IsSame(selectedPlaylist) && selectedPlaylist.CurrentTrack == trackIndex && m.tracker.CurrentTrack().Id == trackToPlay.Id {
+		if currentPlaylist.IsSame(selectedPlaylist) && !m.playingEntry.Queued() && selectedPlaylist.CurrentTrack == trackIndex && m.tracker.CurrentTrack().Id == trackToPlay.Id {
 			if m.tracker.IsPlaying() {
 				m.tracker.Pause()
 				return
@@ -288,17 +603,19 @@ func (m *Model) playSelectedPlaylist(trackIndex int) {
 	m.indicateCurrentTrackPlaying(false)
 	selectedPlaylist.CurrentTrack = trackIndex
 
-	if selectedPlaylist.Infinite {
+	if selectedPlaylist.Infinite && !m.offline {
 		if m.tracker.IsPlaying() {
 			currentTrack := m.tracker.CurrentTrack()
-			go m.client.StationFeedback(
+			go m.client.StationFeedbackContext(
+				m.ctx,
 				api.ROTOR_SKIP,
 				selectedPlaylist.StationId,
 				selectedPlaylist.StationBatch,
 				currentTrack.Id,
 				int(float64(currentTrack.DurationMs*1000)*m.tracker.Progress()),
 			)
-			go m.client.StationFeedback(
+			go m.client.StationFeedbackContext(
+				m.ctx,
 				api.ROTOR_TRACK_STARTED,
 				selectedPlaylist.StationId,
 				selectedPlaylist.StationBatch,
@@ -306,7 +623,8 @@ func (m *Model) playSelectedPlaylist(trackIndex int) {
 				0,
 			)
 		} else {
-			go m.client.StationFeedback(
+			go m.client.StationFeedbackContext(
+				m.ctx,
 				api.ROTOR_RADIO_STARTED,
 				selectedPlaylist.StationId,
 				"",
@@ -316,7 +634,13 @@ func (m *Model) playSelectedPlaylist(trackIndex int) {
 		}
 	}
 
+	if m.shuffled(selectedPlaylist) {
+		selectedPlaylist.Shuffle(trackIndex)
+	}
+
 	m.currentPlaylistIndex = m.playlists.Index()
 	m.playlists.SetItem(m.currentPlaylistIndex, selectedPlaylist)
+	m.queue.PushHistory(m.playingEntry)
+	m.playingEntry = queue.Entry{Track: *trackToPlay, Source: selectedPlaylist, Index: trackIndex}
 	m.playTrack(trackToPlay)
 }
@@ -0,0 +1,53 @@
+package mainpage
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dece2183/yamusic-tui/api"
+)
+
+func TestWithAlbumNormalization(t *testing.T) {
+	track := func(id string, albumId uint64, gain, peak float32) api.Track {
+		track := api.Track{Id: id, DurationMs: 1000}
+		if albumId != 0 {
+			track.Albums = []api.Album{{Id: albumId}}
+		}
+		track.Normalization.Gain = gain
+		track.Normalization.Peak = peak
+		return track
+	}
+	withAlbum := func(track api.Track, gain, peak float32) api.Track {
+		track.Normalization.AlbumGain = gain
+		track.Normalization.AlbumPeak = peak
+		return track
+	}
+
+	tests := []struct {
+		name     string
+		track    api.Track
+		tracks   []api.Track
+		wantGain float32
+		wantPeak float32
+	}{
+		{"provided by server", withAlbum(track("a", 1, -3, 8192), -5, 32767), []api.Track{track("b", 1, -9, 16384)}, -5, 32767},
+		{"no album", track("a", 0, -3, 8192), []api.Track{track("b", 0, -9, 16384)}, 0, 0},
+		{"single track", track("a", 1, -3, 8192), nil, -3, 8192},
+		{"album tracks", track("a", 1, -3, 8192), []api.Track{track("a", 1, -3, 8192), track("b", 1, -9, 16384)}, -6.963, 16384},
+		{"other albums ignored", track("a", 1, -3, 8192), []api.Track{track("b", 2, -9, 16384)}, -3, 8192},
+		{"unknown", track("a", 1, 0, 0), []api.Track{track("b", 1, 0, 0)}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := withAlbumNormalization(&tt.track, tt.tracks)
+			if math.Abs(float64(got.Normalization.AlbumGain-tt.wantGain)) > 0.001 || got.Normalization.AlbumPeak != tt.wantPeak {
+				t.Errorf("album normalization is %.3f dB, %.0f; want %.3f dB, %.0f",
+					got.Normalization.AlbumGain, got.Normalization.AlbumPeak, tt.wantGain, tt.wantPeak)
+			}
+			if got.Normalization.Gain != tt.track.Normalization.Gain || got.Normalization.Peak != tt.track.Normalization.Peak {
+				t.Errorf("track normalization is changed")
+			}
+		})
+	}
+}
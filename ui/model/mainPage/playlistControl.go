@@ -1,12 +1,11 @@
 package mainpage
 
 import (
-	"math/rand"
 	"slices"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/cache"
 	"github.com/dece2183/yamusic-tui/log"
 	"github.com/dece2183/yamusic-tui/ui/components/input"
 	"github.com/dece2183/yamusic-tui/ui/components/playlist"
@@ -47,7 +46,13 @@ func (m *Model) addPlaylistControl(msg search.Control) tea.Cmd {
 		}
 
 		if foundPlaylist == nil {
-			pl, err := m.client.CreatePlaylist(inputVal, true)
+			if m.offline {
+				log.Print(log.LVL_WARNIGN, "unable to create playlist [%s] offline", inputVal)
+				m.tracker.ShowError("playlist create offline")
+				return nil
+			}
+
+			pl, err := m.client.CreatePlaylistContext(m.ctx, inputVal, true)
 			if err != nil {
 				log.Print(log.LVL_ERROR, "failed to create playlist [%s]: %s", inputVal, err)
 				m.tracker.ShowError("playlist create")
@@ -76,14 +81,22 @@ func (m *Model) addPlaylistControl(msg search.Control) tea.Cmd {
 		}
 
 		selectedTrack := &selectedPlaylist.Tracks[m.tracklist.Index()]
-		pl, err := m.client.AddToPlaylist(foundPlaylist.Kind, foundPlaylist.Revision, len(foundPlaylist.Tracks), selectedTrack.Id)
-		if err != nil {
-			log.Print(log.LVL_ERROR, "failed to add track [%s] to playlist [%s]: %s", selectedTrack.Id, foundPlaylist.Name, err)
-			m.tracker.ShowError("playlist add")
-			return nil
+		if m.offline {
+			err := m.queueChange(cache.Mutation{Action: cache.ACTION_PLAYLIST_ADD, TrackId: selectedTrack.Id, PlaylistKind: foundPlaylist.Kind})
+			if err != nil {
+				m.tracker.ShowError("playlist add")
+				return nil
+			}
+		} else {
+			pl, err := m.client.AddToPlaylistContext(m.ctx, foundPlaylist.Kind, foundPlaylist.Revision, len(foundPlaylist.Tracks), selectedTrack.Id)
+			if err != nil {
+				log.Print(log.LVL_ERROR, "failed to add track [%s] to playlist [%s]: %s", selectedTrack.Id, foundPlaylist.Name, err)
+				m.tracker.ShowError("playlist add")
+				return nil
+			}
+			foundPlaylist.Revision = pl.Revision
 		}
 
-		foundPlaylist.Revision = pl.Revision
 		foundPlaylist.Tracks = append(foundPlaylist.Tracks, *selectedTrack)
 		cmd = m.playlists.SetItem(foundPlaylistIndex, foundPlaylist)
 
@@ -119,7 +132,7 @@ func (m *Model) renamePlaylistControl(msg input.Control) tea.Cmd {
 	}
 
 	selectedPlaylist := m.playlists.SelectedItem()
-	pl, err := m.client.RenamePlaylist(selectedPlaylist.Kind, newName)
+	pl, err := m.client.RenamePlaylistContext(m.ctx, selectedPlaylist.Kind, newName)
 	if err != nil {
 		log.Print(log.LVL_ERROR, "failed to rename playlist [%s] to '%s': %s", selectedPlaylist.Name, newName, err)
 		m.tracker.ShowError("playlist rename")
@@ -139,7 +152,7 @@ func (m *Model) removeFromPlaylist(pl *playlist.Item, index int) tea.Cmd {
 	}
 
 	switch pl.Kind {
-	case playlist.NONE, playlist.MYWAVE:
+	case playlist.NONE, playlist.MYWAVE, playlist.STATION, playlist.WAVE_SETTING:
 		return nil
 	case playlist.LIKES:
 		selectedTrack := pl.Tracks[index]
@@ -150,8 +163,9 @@ func (m *Model) removeFromPlaylist(pl *playlist.Item, index int) tea.Cmd {
 	default:
 		var cmd tea.Cmd
 
-		if len(pl.Tracks) < 2 {
-			err := m.client.RemovePlaylist(pl.Kind)
+		// only the cached tracks of the playlist are shown offline, so the playlist isn't removed with the last one
+		if len(pl.Tracks) < 2 && !m.offline {
+			err := m.client.RemovePlaylistContext(m.ctx, pl.Kind)
 			if err != nil {
 				log.Print(log.LVL_ERROR, "failed to remove playlist [%s]: %s", pl.Name, err)
 				m.tracker.ShowError("playlist remove")
@@ -168,14 +182,22 @@ func (m *Model) removeFromPlaylist(pl *playlist.Item, index int) tea.Cmd {
 			return nil
 		}
 
-		newpl, err := m.client.RemoveFromPlaylist(pl.Kind, pl.Revision, index)
-		if err != nil {
-			log.Print(log.LVL_ERROR, "failed to remove track [%s] from playlist [%s]: %s", pl.Tracks[index].Id, pl.Name, err)
-			m.tracker.ShowError("playlist remove track")
-			return nil
+		if m.offline {
+			err := m.queueChange(cache.Mutation{Action: cache.ACTION_PLAYLIST_REMOVE, TrackId: pl.Tracks[index].Id, PlaylistKind: pl.Kind})
+			if err != nil {
+				m.tracker.ShowError("playlist remove track")
+				return nil
+			}
+		} else {
+			newpl, err := m.client.RemoveFromPlaylistContext(m.ctx, pl.Kind, pl.Revision, index)
+			if err != nil {
+				log.Print(log.LVL_ERROR, "failed to remove track [%s] from playlist [%s]: %s", pl.Tracks[index].Id, pl.Name, err)
+				m.tracker.ShowError("playlist remove track")
+				return nil
+			}
+			pl.Revision = newpl.Revision
 		}
 
-		pl.Revision = newpl.Revision
 		pl.Tracks = slices.Delete(pl.Tracks, index, index+1)
 		if index >= len(pl.Tracks) {
 			pl.SelectedTrack = len(pl.Tracks) - 1
@@ -202,49 +224,6 @@ func (m *Model) removeFromPlaylist(pl *playlist.Item, index int) tea.Cmd {
 	}
 }
 
-func (m *Model) shufflePlaylist(pl *playlist.Item) tea.Cmd {
-	var cmds []tea.Cmd
-	if pl.Kind == playlist.NONE || pl.Kind == playlist.MYWAVE || len(pl.Tracks) == 0 {
-		return nil
-	}
-
-	currentTrackIndex := pl.CurrentTrack
-	selectedTrackIndex := pl.SelectedTrack
-	currentTrack := pl.Tracks[currentTrackIndex]
-	selectedTrack := pl.Tracks[selectedTrackIndex]
-
-	tracks := make([]api.Track, len(pl.Tracks))
-	trackList := make([]tracklist.Item, len(pl.Tracks))
-	perm := rand.Perm(len(tracks))
-
-	for i, v := range perm {
-		tracks[v] = pl.Tracks[i]
-		trackList[v] = tracklist.NewItem(&tracks[v])
-		if currentTrack.Id == tracks[v].Id {
-			currentTrackIndex = v
-		}
-		if selectedTrackIndex > 0 && selectedTrack.Id == tracks[v].Id {
-			selectedTrackIndex = v
-		}
-	}
-
-	pl.Tracks = tracks
-	pl.SelectedTrack = selectedTrackIndex
-	pl.CurrentTrack = currentTrackIndex
-	cmds = append(cmds, m.playlists.SetItem(m.playlists.Index(), pl))
-	cmds = append(cmds, m.tracklist.SetItems(trackList))
-	m.tracklist.Select(selectedTrackIndex)
-
-	if m.currentPlaylistIndex >= 0 {
-		currentPlaylist := m.playlists.Items()[m.currentPlaylistIndex]
-		if pl.IsSame(currentPlaylist) && m.tracker.IsPlaying() {
-			m.indicateCurrentTrackPlaying(true)
-		}
-	}
-
-	return tea.Batch(cmds...)
-}
-
 func (m *Model) displayPlaylist(pl *playlist.Item) {
 	trackList := make([]tracklist.Item, len(pl.Tracks))
 	for i := range pl.Tracks {
@@ -252,6 +231,7 @@ func (m *Model) displayPlaylist(pl *playlist.Item) {
 	}
 	m.tracklist.SetItems(trackList)
 	m.tracklist.Select(pl.SelectedTrack)
+	m.tracklist.Paginated = pl.HasMore()
 	switch pl.Kind {
 	case playlist.MYWAVE:
 		m.tracklist.Title = "My wave"
@@ -259,13 +239,17 @@ func (m *Model) displayPlaylist(pl *playlist.Item) {
 		m.tracklist.Title = "Liked tracks"
 	case playlist.LOCAL:
 		m.tracklist.Title = "Cached tracks"
+	case playlist.STATION:
+		m.tracklist.Title = "Station " + pl.Name
+	case playlist.WAVE_SETTING:
+		m.tracklist.Title = "My wave settings"
 	default:
 		m.tracklist.Title = "Tracks from " + pl.Name
 	}
 }
 
 func (m *Model) indicateCurrentTrackPlaying(playing bool) {
-	if m.currentPlaylistIndex < 0 {
+	if m.currentPlaylistIndex < 0 || (playing && m.playingEntry.Queued()) {
 		return
 	}
 	currentPlaylist := m.playlists.Items()[m.currentPlaylistIndex]
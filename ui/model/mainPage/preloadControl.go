@@ -0,0 +1,139 @@
+package mainpage
+
+import (
+	"context"
+	"errors"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/config"
+	"github.com/dece2183/yamusic-tui/log"
+	"github.com/dece2183/yamusic-tui/ui/components/tracker"
+)
+
+type preloadedTrack struct {
+	// the track that was playing when the preloading has started
+	currentId string
+	loaded    loadedTrack
+	next      *tracker.Preloaded
+	err       error
+}
+
+// upcomingTrack returns the track that will be played after the current one
+// if it can be determined in advance, otherwise nil.
+func (m *Model) upcomingTrack() *api.Track {
+	if m.tracker.StopAfterCurrent() || m.tracker.Repeat() == config.REPEAT_ONE {
+		return nil
+	}
+
+	if upcoming := m.queue.Upcoming(); len(upcoming) > 0 {
+		if !upcoming[0].Track.Available {
+			return nil
+		}
+		return &upcoming[0].Track
+	}
+
+	if m.currentPlaylistIndex < 0 {
+		return nil
+	}
+
+	currentPlaylist := m.playlists.Items()[m.currentPlaylistIndex]
+	next := m.nextTrackIndex(currentPlaylist)
+	if next < 0 {
+		// the shuffled order is regenerated on the wrap, so the first track isn't known yet
+		if currentPlaylist.Infinite || currentPlaylist.HasMore() || m.tracker.Repeat() != config.REPEAT_ALL || m.shuffled(currentPlaylist) {
+			return nil
+		}
+		next = 0
+	}
+
+	track := &currentPlaylist.Tracks[next]
+	if !track.Available {
+		return nil
+	}
+	return track
+}
+
+// preloadNextTrack opens the stream of the upcoming track in the background,
+// so the player can continue with it without a gap.
+func (m *Model) preloadNextTrack() tea.Cmd {
+	if m.tracker.IsStoped() || m.tracker.HasNext() {
+		return nil
+	}
+
+	track := m.upcomingTrack()
+	if track == nil {
+		return nil
+	}
+
+	upcoming := withAlbumNormalization(track, m.playingTracks())
+	loudness := m.trackLoudness(track)
+	m.measureNetwork()
+	networkKbps := m.networkKbps
+	offline := m.offline
+	client := m.client
+	currentId := m.tracker.CurrentTrack().Id
+	ctx := m.requestContext(&m.preloadCancel)
+
+	return func() tea.Msg {
+		loaded, err := m.loadTrack(ctx, client, &upcoming, networkKbps, offline)
+		if err != nil {
+			return preloadedTrack{currentId: currentId, err: err}
+		}
+
+		next, err := tracker.Preload(&upcoming, loaded.source, loaded.lyrics, loudness)
+		if err != nil {
+			loaded.source.Stream.Close()
+			return preloadedTrack{currentId: currentId, err: err}
+		}
+
+		return preloadedTrack{currentId: currentId, loaded: loaded, next: next}
+	}
+}
+
+// setPreloadedTrack passes the preloaded track to the player if it's still the upcoming one.
+func (m *Model) setPreloadedTrack(preloaded preloadedTrack) {
+	if preloaded.err != nil {
+		if !errors.Is(preloaded.err, context.Canceled) {
+			log.Print(log.LVL_WARNIGN, "failed to preload the next track: %s", preloaded.err)
+		}
+		return
+	}
+
+	upcoming := m.upcomingTrack()
+	if m.tracker.IsStoped() || m.tracker.HasNext() || preloaded.currentId != m.tracker.CurrentTrack().Id ||
+		upcoming == nil || upcoming.Id != preloaded.loaded.track.Id {
+		preloaded.next.Close()
+		return
+	}
+
+	m.preloaded = preloaded.loaded
+	m.tracker.SetNext(preloaded.next)
+	if preloaded.loaded.lyricsErr != nil {
+		m.tracker.ShowError("track lyrics")
+	}
+}
+
+// resetPreload drops the preloaded track when the upcoming order has changed
+// and preloads the new upcoming one if the current track is already buffered.
+func (m *Model) resetPreload() tea.Cmd {
+	upcoming := m.upcomingTrack()
+	if m.tracker.HasNext() && m.preloaded.track != nil && upcoming != nil && upcoming.Id == m.preloaded.track.Id {
+		return nil
+	}
+
+	if m.preloadCancel != nil {
+		m.preloadCancel()
+		m.preloadCancel = nil
+	}
+	if m.tracker.HasNext() {
+		m.tracker.SetNext(nil)
+	}
+	m.preloaded = loadedTrack{}
+
+	if !m.tracker.Source().Stream.IsBuffered() {
+		// the preloading starts when the buffering is complete
+		return nil
+	}
+	return m.preloadNextTrack()
+}
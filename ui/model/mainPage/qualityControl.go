@@ -0,0 +1,94 @@
+package mainpage
+
+import (
+	"math"
+
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/config"
+	"github.com/dece2183/yamusic-tui/ui/components/tracker"
+)
+
+// the download speed has to exceed the bitrate this many times to keep the quality in the metered mode
+const _METERED_MARGIN = 2
+
+// upper bitrate limits of the quality levels in kbps
+var qualityBitrates = map[config.QualityType]int{
+	config.QUALITY_LOW:      64,
+	config.QUALITY_NORMAL:   192,
+	config.QUALITY_HIGH:     320,
+	config.QUALITY_LOSSLESS: math.MaxInt,
+}
+
+// selectDownloadInfo picks the track variant that fits the quality settings and the download speed.
+// Reports whether the bitrate was lowered because of the slow downloads
+// and whether there is a variant that can be played at all.
+func selectDownloadInfo(infos []api.TrackDownloadInfo, networkKbps int) (info api.TrackDownloadInfo, metered bool, ok bool) {
+	quality := config.Current.Quality
+
+	var candidates, preferred []api.TrackDownloadInfo
+	for _, info := range infos {
+		if !tracker.SupportsCodec(info.Codec) {
+			continue
+		}
+		candidates = append(candidates, info)
+		if info.Codec == quality.Codec {
+			preferred = append(preferred, info)
+		}
+	}
+
+	if len(preferred) > 0 {
+		candidates = preferred
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	limit := qualityBitrates[quality.Level]
+	info = pickBitrate(candidates, limit)
+	ok = true
+
+	if quality.AutoMetered && networkKbps > 0 && networkKbps/_METERED_MARGIN < limit {
+		meteredInfo := pickBitrate(candidates, networkKbps/_METERED_MARGIN)
+		if meteredInfo.BbitrateInKbps < info.BbitrateInKbps {
+			info = meteredInfo
+			metered = true
+		}
+	}
+
+	return
+}
+
+// pickBitrate returns the variant with the highest bitrate within the limit,
+// or the one with the lowest bitrate if all of them exceed it.
+func pickBitrate(infos []api.TrackDownloadInfo, limit int) api.TrackDownloadInfo {
+	var best api.TrackDownloadInfo
+	var found bool
+	lowest := infos[0]
+
+	for _, info := range infos {
+		if info.BbitrateInKbps < lowest.BbitrateInKbps {
+			lowest = info
+		}
+		if info.BbitrateInKbps <= limit && (!found || info.BbitrateInKbps > best.BbitrateInKbps) {
+			best = info
+			found = true
+		}
+	}
+
+	if !found {
+		return lowest
+	}
+	return best
+}
+
+// measureNetwork remembers the download speed of the current track for the automatic metered mode.
+func (m *Model) measureNetwork() {
+	source := m.tracker.Source()
+	if source.Cached || source.Stream == nil {
+		return
+	}
+
+	if throughput := source.Stream.Throughput(); throughput > 0 {
+		m.networkKbps = int(throughput * 8 / 1000)
+	}
+}
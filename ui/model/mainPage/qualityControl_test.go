@@ -0,0 +1,64 @@
+package mainpage
+
+import (
+	"testing"
+
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/config"
+)
+
+func TestSelectDownloadInfo(t *testing.T) {
+	mp3 := func(kbps int) api.TrackDownloadInfo {
+		return api.TrackDownloadInfo{Codec: "mp3", BbitrateInKbps: kbps}
+	}
+	flac := func(kbps int) api.TrackDownloadInfo {
+		return api.TrackDownloadInfo{Codec: "flac", BbitrateInKbps: kbps}
+	}
+	opus := func(kbps int) api.TrackDownloadInfo {
+		return api.TrackDownloadInfo{Codec: "opus", BbitrateInKbps: kbps}
+	}
+
+	tests := []struct {
+		name        string
+		infos       []api.TrackDownloadInfo
+		level       config.QualityType
+		codec       string
+		autoMetered bool
+		networkKbps int
+		want        api.TrackDownloadInfo
+		metered     bool
+		ok          bool
+	}{
+		{"highest within level", []api.TrackDownloadInfo{mp3(128), mp3(320), mp3(192)}, config.QUALITY_HIGH, "", false, 0, mp3(320), false, true},
+		{"normal level limit", []api.TrackDownloadInfo{mp3(128), mp3(320), mp3(192)}, config.QUALITY_NORMAL, "", false, 0, mp3(192), false, true},
+		{"low level limit", []api.TrackDownloadInfo{mp3(64), mp3(320), mp3(192)}, config.QUALITY_LOW, "", false, 0, mp3(64), false, true},
+		{"lossless level", []api.TrackDownloadInfo{mp3(320), flac(1411), mp3(192)}, config.QUALITY_LOSSLESS, "", false, 0, flac(1411), false, true},
+		{"lossless above high level", []api.TrackDownloadInfo{mp3(320), flac(1411), mp3(192)}, config.QUALITY_HIGH, "", false, 0, mp3(320), false, true},
+		{"all above limit", []api.TrackDownloadInfo{mp3(320), mp3(128), mp3(192)}, config.QUALITY_LOW, "", false, 0, mp3(128), false, true},
+		{"unsupported codec skipped", []api.TrackDownloadInfo{opus(256), mp3(192)}, config.QUALITY_HIGH, "", false, 0, mp3(192), false, true},
+		{"preferred codec fallback", []api.TrackDownloadInfo{opus(256), mp3(128), mp3(320)}, config.QUALITY_HIGH, "opus", false, 0, mp3(320), false, true},
+		{"preferred codec", []api.TrackDownloadInfo{opus(256), mp3(128), mp3(320)}, config.QUALITY_HIGH, "mp3", false, 0, mp3(320), false, true},
+		{"nothing playable", []api.TrackDownloadInfo{opus(256)}, config.QUALITY_HIGH, "", false, 0, api.TrackDownloadInfo{}, false, false},
+		{"no variants", nil, config.QUALITY_HIGH, "", true, 100, api.TrackDownloadInfo{}, false, false},
+		{"metered downgrade", []api.TrackDownloadInfo{mp3(128), mp3(320), mp3(192)}, config.QUALITY_HIGH, "", true, 400, mp3(192), true, true},
+		{"metered lowest", []api.TrackDownloadInfo{mp3(128), mp3(320), mp3(192)}, config.QUALITY_HIGH, "", true, 100, mp3(128), true, true},
+		{"fast network", []api.TrackDownloadInfo{mp3(128), mp3(320), mp3(192)}, config.QUALITY_HIGH, "", true, 1000, mp3(320), false, true},
+		{"unknown speed", []api.TrackDownloadInfo{mp3(128), mp3(320), mp3(192)}, config.QUALITY_HIGH, "", true, 0, mp3(320), false, true},
+		{"metered off", []api.TrackDownloadInfo{mp3(128), mp3(320), mp3(192)}, config.QUALITY_HIGH, "", false, 100, mp3(320), false, true},
+		{"metered above level", []api.TrackDownloadInfo{mp3(128), mp3(320), mp3(192)}, config.QUALITY_NORMAL, "", true, 500, mp3(192), false, true},
+	}
+
+	quality := config.Current.Quality
+	t.Cleanup(func() { config.Current.Quality = quality })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Current.Quality = &config.Quality{Level: tt.level, Codec: tt.codec, AutoMetered: tt.autoMetered}
+
+			info, metered, ok := selectDownloadInfo(tt.infos, tt.networkKbps)
+			if info != tt.want || metered != tt.metered || ok != tt.ok {
+				t.Errorf("selected %+v, metered %v, ok %v; want %+v, %v, %v", info, metered, ok, tt.want, tt.metered, tt.ok)
+			}
+		})
+	}
+}
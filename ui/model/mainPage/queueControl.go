@@ -0,0 +1,129 @@
+package mainpage
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dece2183/yamusic-tui/ui/components/queue"
+)
+
+// queueSelectedTrack adds the selected track to the head or to the tail of the play queue.
+func (m *Model) queueSelectedTrack(next bool) tea.Cmd {
+	if len(m.tracklist.Items()) == 0 {
+		return nil
+	}
+
+	entry := queue.Entry{
+		Track:  *m.tracklist.SelectedItem().Track,
+		Source: m.playlists.SelectedItem(),
+		Index:  -1,
+	}
+
+	if next {
+		m.queue.PlayNext(entry)
+	} else {
+		m.queue.Enqueue(entry)
+	}
+
+	return tea.Batch(m.queueDialog.SetEntries(m.queue.Upcoming()), m.resetPreload())
+}
+
+// playQueued starts the next queued track.
+// Returns false if the queue is empty.
+func (m *Model) playQueued() bool {
+	entry, ok := m.queue.Pop()
+	if !ok {
+		return false
+	}
+
+	m.playEntry(entry)
+	return true
+}
+
+// playHistory starts the previous played track and returns the playing one back to the queue.
+// Returns false if the history is empty.
+func (m *Model) playHistory() bool {
+	entry, ok := m.queue.PopHistory()
+	if !ok {
+		return false
+	}
+
+	if m.playingEntry.Queued() {
+		m.queue.PlayNext(m.playingEntry)
+	}
+
+	if !entry.Queued() {
+		for i, pl := range m.playlists.Items() {
+			if pl != entry.Source || entry.Index >= len(pl.Tracks) || pl.Tracks[entry.Index].Id != entry.Track.Id {
+				continue
+			}
+
+			m.indicateCurrentTrackPlaying(false)
+			m.currentPlaylistIndex = i
+			pl.CurrentTrack = entry.Index
+			m.playlists.SetItem(i, pl)
+
+			m.playingEntry = entry
+			m.queueDialog.SetEntries(m.queue.Upcoming())
+			m.playTrack(&pl.Tracks[entry.Index])
+			if pl.IsSame(m.playlists.SelectedItem()) {
+				m.tracklist.Select(pl.CurrentTrack)
+			}
+			return true
+		}
+
+		// the source playlist is gone, so play the track out of it
+		entry.Index = -1
+	}
+
+	m.playEntry(entry)
+	return true
+}
+
+func (m *Model) playEntry(entry queue.Entry) {
+	m.indicateCurrentTrackPlaying(false)
+	m.playingEntry = entry
+	m.queueDialog.SetEntries(m.queue.Upcoming())
+
+	track := entry.Track
+	m.playTrack(&track)
+}
+
+func (m *Model) queueControl(msg queue.Control) tea.Cmd {
+	var cmd tea.Cmd
+	index := m.queueDialog.Index()
+
+	switch msg {
+	case queue.PLAY:
+		entry, ok := m.queue.Take(index)
+		if !ok {
+			break
+		}
+		m.isQueueActive = false
+		m.queue.PushHistory(m.playingEntry)
+		m.playEntry(entry)
+	case queue.MOVE_UP:
+		if m.queue.Move(index, index-1) {
+			cmd = m.queueDialog.SetEntries(m.queue.Upcoming())
+			m.queueDialog.Select(index - 1)
+		}
+	case queue.MOVE_DOWN:
+		if m.queue.Move(index, index+1) {
+			cmd = m.queueDialog.SetEntries(m.queue.Upcoming())
+			m.queueDialog.Select(index + 1)
+		}
+	case queue.REMOVE:
+		if _, ok := m.queue.Take(index); ok {
+			cmd = m.queueDialog.SetEntries(m.queue.Upcoming())
+			if index >= m.queue.Len() && index > 0 {
+				m.queueDialog.Select(index - 1)
+			}
+		}
+	case queue.CLOSE:
+		m.isQueueActive = false
+	}
+
+	if msg == queue.MOVE_UP || msg == queue.MOVE_DOWN || msg == queue.REMOVE {
+		cmd = tea.Batch(cmd, m.resetPreload())
+	}
+
+	return cmd
+}
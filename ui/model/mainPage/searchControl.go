@@ -1,6 +1,8 @@
 package mainpage
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -13,6 +15,20 @@ import (
 	"github.com/dece2183/yamusic-tui/ui/helpers"
 )
 
+// searchResults is the result of the background search
+type searchResults struct {
+	items []*playlist.Item
+	err   error
+	// the short description of the last failed request, shown to the user
+	errorText string
+}
+
+// searchSuggestions is the result of the background suggestions request
+type searchSuggestions struct {
+	suggestions []string
+	err         error
+}
+
 func (m *Model) searchControl(msg search.Control) tea.Cmd {
 	var cmd tea.Cmd
 
@@ -24,48 +40,70 @@ func (m *Model) searchControl(msg search.Control) tea.Cmd {
 		if !ok {
 			return nil
 		}
-
-		searchRes, err := m.client.Search(req, api.SEARCH_ALL)
-		if err != nil {
-			log.Print(log.LVL_ERROR, "failed to search [%s]: %s", req, err)
-			m.tracker.ShowError("search")
+		if m.offline {
+			log.Print(log.LVL_WARNIGN, "unable to search [%s] offline", req)
+			m.tracker.ShowError("search offline")
 			return nil
 		}
 
-		cmd = m.displaySearchResults(searchRes)
+		// a new search supersedes the one still in progress
+		ctx := m.requestContext(&m.searchCancel)
+		cmd = func() tea.Msg {
+			return m.searchRequest(ctx, req)
+		}
 	case search.CANCEL:
 		m.isSearchActive = false
+		if m.suggestCancel != nil {
+			m.suggestCancel()
+		}
 	case search.UPDATE_SUGGESTIONS:
-		suggestions, err := m.client.SearchSuggest(m.searchDialog.InputValue())
-		if err != nil {
-			log.Print(log.LVL_ERROR, "failed to obtain search [%s] suggestions: %s", m.searchDialog.InputValue(), err)
-			m.tracker.ShowError("search seggestion")
+		if m.offline {
 			return nil
 		}
-		m.searchDialog.SetSuggestions(suggestions.Suggestions)
+		// the suggestions are superseded by the next ones, but not the search in progress
+		ctx := m.requestContext(&m.suggestCancel)
+		part := m.searchDialog.InputValue()
+		cmd = func() tea.Msg {
+			suggestions, err := m.client.SearchSuggestContext(ctx, part)
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					return nil
+				}
+				log.Print(log.LVL_ERROR, "failed to obtain search [%s] suggestions: %s", part, err)
+				return searchSuggestions{err: err}
+			}
+			return searchSuggestions{suggestions: suggestions.Suggestions}
+		}
 	}
 
 	return cmd
 }
 
-func (m *Model) displaySearchResults(res api.SearchResult) tea.Cmd {
-	playlists := m.playlists.Items()
-	searchResIndex := len(playlists) + 2
-	for i, pl := range playlists {
-		if !pl.Active && !pl.Subitem && pl.Name == "search results:" {
-			playlists = playlists[:i-1]
-			searchResIndex = i + 1
-			break
+// setSearchSuggestions shows the suggestions in the search dialog if it's still open.
+func (m *Model) setSearchSuggestions(suggestions searchSuggestions) {
+	if suggestions.err != nil {
+		m.tracker.ShowError("search seggestion")
+		return
+	}
+	if m.isSearchActive {
+		m.searchDialog.SetSuggestions(suggestions.suggestions)
+	}
+}
+
+func (m *Model) searchRequest(ctx context.Context, req string) tea.Msg {
+	res, err := m.client.SearchContext(ctx, req, api.SEARCH_ALL)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil
 		}
+		log.Print(log.LVL_ERROR, "failed to search [%s]: %s", req, err)
+		return searchResults{err: err, errorText: "search"}
 	}
 
-	playlists = append(playlists,
-		&playlist.Item{Name: "", Kind: playlist.NONE, Active: false, Subitem: false},
-		&playlist.Item{Name: "search results:", Kind: playlist.NONE, Active: false, Subitem: false},
-	)
+	var results searchResults
 
 	if len(res.Tracks.Results) > 0 {
-		playlists = append(playlists, &playlist.Item{
+		results.items = append(results.items, &playlist.Item{
 			Name:    "search \"" + res.Text + "\"",
 			Active:  true,
 			Subitem: true,
@@ -74,29 +112,32 @@ func (m *Model) displaySearchResults(res api.SearchResult) tea.Cmd {
 	}
 
 	if config.Current.Search.Artists && len(res.Artists.Results) > 0 {
-		// playlists = append(playlists, playlist.Item{Name: "", Kind: playlist.NONE, Active: false, Subitem: false})
 		for _, artist := range res.Artists.Results {
 			if !strings.Contains(strings.ToLower(artist.Name), strings.ToLower(res.Text)) {
 				continue
 			}
 
-			artistTracks, err := m.client.ArtistPopularTracks(artist.Id)
+			artistTracks, err := m.client.ArtistPopularTracksContext(ctx, artist.Id)
 			if err != nil {
-				sval, _ := m.searchDialog.SuggestionValue()
-				log.Print(log.LVL_ERROR, "failed to obtain search [%s] artist [%s] tracks: %s", sval, artist.Name, err)
-				m.tracker.ShowError("search artist tracks")
+				if errors.Is(err, context.Canceled) {
+					return nil
+				}
+				log.Print(log.LVL_ERROR, "failed to obtain search [%s] artist [%s] tracks: %s", req, artist.Name, err)
+				results.errorText = "search artist tracks"
 				continue
 			}
 
-			tracks, err := m.client.Tracks(artistTracks.Tracks)
+			tracks, err := m.client.TracksContext(ctx, artistTracks.Tracks)
 			if err != nil {
-				sval, _ := m.searchDialog.SuggestionValue()
-				log.Print(log.LVL_ERROR, "failed to obtain search [%s] artist [%s] tracks full info: %s", sval, artist.Name, err)
-				m.tracker.ShowError("search artist tracks info")
+				if errors.Is(err, context.Canceled) {
+					return nil
+				}
+				log.Print(log.LVL_ERROR, "failed to obtain search [%s] artist [%s] tracks full info: %s", req, artist.Name, err)
+				results.errorText = "search artist tracks info"
 				continue
 			}
 
-			playlists = append(playlists, &playlist.Item{
+			results.items = append(results.items, &playlist.Item{
 				Name:    artist.Name,
 				Active:  true,
 				Subitem: true,
@@ -106,24 +147,25 @@ func (m *Model) displaySearchResults(res api.SearchResult) tea.Cmd {
 	}
 
 	if config.Current.Search.Albums && len(res.Albums.Results) > 0 {
-		// playlists = append(playlists, playlist.Item{Name: "", Kind: playlist.NONE, Active: false, Subitem: false})
 		for _, album := range res.Albums.Results {
 			if !strings.Contains(strings.ToLower(album.Title), strings.ToLower(res.Text)) {
 				continue
 			}
 
-			albumWithTracks, err := m.client.Album(album.Id, true)
+			albumWithTracks, err := m.client.AlbumContext(ctx, album.Id, true)
 			if err != nil {
-				sval, _ := m.searchDialog.SuggestionValue()
-				log.Print(log.LVL_ERROR, "failed to obtain search [%s] album [%s] tracks: %s", sval, album.Title, err)
-				m.tracker.ShowError("search album tracks")
+				if errors.Is(err, context.Canceled) {
+					return nil
+				}
+				log.Print(log.LVL_ERROR, "failed to obtain search [%s] album [%s] tracks: %s", req, album.Title, err)
+				results.errorText = "search album tracks"
 				continue
 			}
 
 			albumArtists := helpers.ArtistList(albumWithTracks.Artists)
 			if len(albumWithTracks.Volumes) > 1 {
 				for i := range albumWithTracks.Volumes {
-					playlists = append(playlists, &playlist.Item{
+					results.items = append(results.items, &playlist.Item{
 						Name:    fmt.Sprintf("%s vol.%d (%s)", albumWithTracks.Title, i, albumArtists),
 						Active:  true,
 						Subitem: true,
@@ -131,7 +173,7 @@ func (m *Model) displaySearchResults(res api.SearchResult) tea.Cmd {
 					})
 				}
 			} else {
-				playlists = append(playlists, &playlist.Item{
+				results.items = append(results.items, &playlist.Item{
 					Name:    fmt.Sprintf("%s (%s)", albumWithTracks.Title, albumArtists),
 					Active:  true,
 					Subitem: true,
@@ -142,32 +184,42 @@ func (m *Model) displaySearchResults(res api.SearchResult) tea.Cmd {
 	}
 
 	if config.Current.Search.Playlists && len(res.Playlists.Results) > 0 {
-		// playlists = append(playlists, playlist.Item{Name: "", Kind: playlist.NONE, Active: false, Subitem: false})
 		for _, pl := range res.Playlists.Results {
 			if !strings.Contains(strings.ToLower(pl.Title), strings.ToLower(res.Text)) {
 				continue
 			}
 
-			playlistTracks, err := m.client.PlaylistTracks(pl.Kind, pl.Owner.Uid, false)
+			trackIds, err := m.client.PlaylistTrackIdsContext(ctx, pl.Kind, pl.Owner.Uid)
 			if err != nil {
-				sval, _ := m.searchDialog.SuggestionValue()
-				log.Print(log.LVL_ERROR, "failed to obtain search [%s] playlist [%s] tracks: %s", sval, pl.Title, err)
-				m.tracker.ShowError("search playlist tracks")
+				if errors.Is(err, context.Canceled) {
+					return nil
+				}
+				log.Print(log.LVL_ERROR, "failed to obtain search [%s] playlist [%s] tracks: %s", req, pl.Title, err)
+				results.errorText = "search playlist tracks"
 				continue
 			}
 
-			playlists = append(playlists, &playlist.Item{
-				Name:    pl.Title + " by " + pl.Owner.Name,
-				Active:  true,
-				Subitem: true,
-				Tracks:  playlistTracks,
+			results.items = append(results.items, &playlist.Item{
+				Name:        pl.Title + " by " + pl.Owner.Name,
+				Active:      true,
+				Subitem:     true,
+				Paginated:   true,
+				TrackIds:    trackIds,
+				TracksTotal: len(trackIds),
 			})
 		}
 	}
 
-	cmd := m.playlists.SetItems(playlists)
-	m.playlists.Select(searchResIndex)
-	m.Send(playlist.CURSOR_DOWN)
+	return results
+}
 
-	return cmd
+func (m *Model) displaySearchResults(res searchResults) tea.Cmd {
+	if len(res.errorText) > 0 {
+		m.tracker.ShowError(res.errorText)
+	}
+	if res.err != nil {
+		m.checkAuthExpired(res.err)
+		return nil
+	}
+	return m.displaySection("search results:", res.items)
 }
@@ -0,0 +1,245 @@
+package mainpage
+
+import (
+	"context"
+	"errors"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dece2183/yamusic-tui/api"
+	"github.com/dece2183/yamusic-tui/config"
+	"github.com/dece2183/yamusic-tui/log"
+	"github.com/dece2183/yamusic-tui/ui/components/playlist"
+)
+
+const _STATIONS_LANGUAGE = "en"
+
+var waveSettingValues = map[string][]string{
+	"mood": {
+		api.STATION_MOOD_ALL,
+		api.STATION_MOOD_ACTIVE,
+		api.STATION_MOOD_FUN,
+		api.STATION_MOOD_CALM,
+		api.STATION_MOOD_SAD,
+	},
+	"diversity": {
+		api.STATION_DIVERSITY_DEFAULT,
+		api.STATION_DIVERSITY_FAVORITE,
+		api.STATION_DIVERSITY_POPULAR,
+		api.STATION_DIVERSITY_DISCOVER,
+	},
+	"language": {
+		api.STATION_LANGUAGE_ANY,
+		api.STATION_LANGUAGE_RUSSIAN,
+		api.STATION_LANGUAGE_NOT_RUSSIAN,
+	},
+}
+
+type stationTracks struct {
+	playlist *playlist.Item
+	tracks   api.StationTracks
+	// drop the tracks that are not played yet
+	reset bool
+	err   error
+}
+
+func waveSettings() api.StationSettings {
+	return api.StationSettings{
+		MoodEnergy: config.Current.MyWave.Mood,
+		Diversity:  config.Current.MyWave.Diversity,
+		Language:   config.Current.MyWave.Language,
+	}
+}
+
+// adoptWaveSettings saves the My Wave settings made on the server, e.g. in the other client, to the config
+// and shows them in the side panel.
+func (m *Model) adoptWaveSettings(settings api.StationSettings) {
+	myWave := config.Current.MyWave
+	values := map[string]*string{
+		"mood":      &myWave.Mood,
+		"diversity": &myWave.Diversity,
+		"language":  &myWave.Language,
+	}
+	server := map[string]string{
+		"mood":      settings.MoodEnergy,
+		"diversity": settings.Diversity,
+		"language":  settings.Language,
+	}
+
+	changed := false
+	for setting, value := range values {
+		if len(server[setting]) == 0 || server[setting] == *value {
+			continue
+		}
+		*value = server[setting]
+		changed = true
+	}
+	if !changed {
+		return
+	}
+
+	for i, item := range m.playlists.Items() {
+		if item.Kind != playlist.WAVE_SETTING {
+			continue
+		}
+		item.Name = item.Setting + ": " + *values[item.Setting]
+		m.playlists.SetItem(i, item)
+	}
+
+	err := config.Save()
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to save config: %s", err)
+	}
+}
+
+// stationItems builds the side panel items of the top-level stations grouped by their type.
+func stationItems(stations []api.StationDesc) []*playlist.Item {
+	groups := []struct {
+		stationType string
+		name        string
+		items       []*playlist.Item
+	}{
+		{stationType: api.STATION_GENRE, name: "genres"},
+		{stationType: api.STATION_MOOD, name: "moods"},
+		{stationType: api.STATION_ACTIVITY, name: "activities"},
+		{stationType: api.STATION_EPOCH, name: "eras"},
+	}
+
+	for _, desc := range stations {
+		station := desc.Station
+		if len(station.ParentId.Tag) > 0 {
+			continue
+		}
+		for i := range groups {
+			if groups[i].stationType != station.Id.Type {
+				continue
+			}
+			groups[i].items = append(groups[i].items, &playlist.Item{
+				Name:      station.Name,
+				Kind:      playlist.STATION,
+				StationId: station.Id,
+				Active:    true,
+				Subitem:   true,
+				Infinite:  true,
+			})
+			break
+		}
+	}
+
+	var items []*playlist.Item
+	for _, group := range groups {
+		if len(group.items) == 0 {
+			continue
+		}
+		items = append(items, &playlist.Item{Name: group.name, Kind: playlist.NONE, Active: false, Subitem: true})
+		items = append(items, group.items...)
+	}
+
+	return items
+}
+
+// loadStationTracks requests the first batch of the station tracks in the background.
+func (m *Model) loadStationTracks(pl *playlist.Item) tea.Cmd {
+	if pl.Loading {
+		return nil
+	}
+
+	pl.Loading = true
+	stationId := pl.StationId
+
+	return func() tea.Msg {
+		tracks, err := m.client.StationTracksContext(m.ctx, stationId, nil)
+		return stationTracks{playlist: pl, tracks: tracks, err: err}
+	}
+}
+
+// appendStationTracks adds the loaded station tracks to the playlist and to the track list if it's displayed.
+func (m *Model) appendStationTracks(batch stationTracks) tea.Cmd {
+	pl := batch.playlist
+	pl.Loading = false
+
+	if batch.err != nil {
+		if !errors.Is(batch.err, context.Canceled) {
+			log.Print(log.LVL_ERROR, "failed to obtain station [%s] tracks: %s", pl.Name, batch.err)
+			m.tracker.ShowError("station tracks")
+			m.checkAuthExpired(batch.err)
+		}
+		return nil
+	}
+
+	if batch.reset {
+		keep := 0
+		if m.currentPlaylistIndex >= 0 && m.playlists.Items()[m.currentPlaylistIndex] == pl && !m.tracker.IsStoped() {
+			keep = pl.CurrentTrack + 1
+		}
+		pl.Tracks = pl.Tracks[:min(keep, len(pl.Tracks))]
+		pl.SelectedTrack = min(pl.SelectedTrack, max(len(pl.Tracks)-1, 0))
+	}
+
+	pl.StationId = batch.tracks.Id
+	pl.StationBatch = batch.tracks.BatchId
+	for _, t := range batch.tracks.Sequence {
+		pl.Tracks = append(pl.Tracks, t.Track)
+	}
+
+	if pl == m.playlists.SelectedItem() {
+		m.displayPlaylist(pl)
+		if m.tracker.IsPlaying() {
+			m.indicateCurrentTrackPlaying(true)
+		}
+	}
+
+	return nil
+}
+
+// changeWaveSetting switches the selected My Wave setting to the next value,
+// saves it to the config and reloads the upcoming My Wave tracks.
+func (m *Model) changeWaveSetting(item *playlist.Item) tea.Cmd {
+	values, ok := waveSettingValues[item.Setting]
+	if !ok {
+		return nil
+	}
+
+	myWave := config.Current.MyWave
+	var value *string
+	switch item.Setting {
+	case "mood":
+		value = &myWave.Mood
+	case "diversity":
+		value = &myWave.Diversity
+	case "language":
+		value = &myWave.Language
+	}
+
+	next := 0
+	for i, v := range values {
+		if v == *value {
+			next = (i + 1) % len(values)
+			break
+		}
+	}
+	*value = values[next]
+
+	item.Name = item.Setting + ": " + *value
+	m.playlists.SetItem(m.playlists.Index(), item)
+
+	err := config.Save()
+	if err != nil {
+		log.Print(log.LVL_ERROR, "failed to save config: %s", err)
+	}
+
+	myWavePlaylist, _ := m.playlists.GetFirst(playlist.MYWAVE)
+	if myWavePlaylist == nil {
+		return nil
+	}
+
+	settings := waveSettings()
+	ctx := m.requestContext(&m.waveCancel)
+	return func() tea.Msg {
+		err := m.client.SetStationSettingsContext(ctx, api.MyWaveId, settings)
+		if err != nil {
+			return stationTracks{playlist: myWavePlaylist, err: err}
+		}
+		tracks, err := m.client.StationTracksContext(ctx, api.MyWaveId, nil)
+		return stationTracks{playlist: myWavePlaylist, tracks: tracks, reset: true, err: err}
+	}
+}
@@ -22,13 +22,20 @@ var (
 )
 
 var (
-	IconPlay     = "▶"
-	IconStop     = "■"
-	IconLiked    = "💛"
-	IconNotLiked = "🤍"
-	IconCached   = "💿"
-	IconDotLight = lipgloss.NewStyle().Foreground(LyricsCurrentTextColor).Render("•")
-	IconDotDark  = lipgloss.NewStyle().Foreground(LyricsPreviosTextColor).Render("•")
+	IconPlay      = "▶"
+	IconStop      = "■"
+	IconLiked     = "💛"
+	IconNotLiked  = "🤍"
+	IconCached    = "💿"
+	IconRepeatAll = "🔁"
+	IconRepeatOne = "🔂"
+	IconStopAfter = "⏏"
+	IconShuffle   = "🔀"
+	IconMetered   = "📶"
+	IconReconnect = "🔌"
+	IconOffline   = "✈"
+	IconDotLight  = lipgloss.NewStyle().Foreground(LyricsCurrentTextColor).Render("•")
+	IconDotDark   = lipgloss.NewStyle().Foreground(LyricsPreviosTextColor).Render("•")
 )
 
 var (
@@ -1,8 +1,12 @@
 package ui
 
 import (
+	"errors"
+
+	"github.com/dece2183/yamusic-tui/api"
 	"github.com/dece2183/yamusic-tui/config"
 	"github.com/dece2183/yamusic-tui/log"
+	"github.com/dece2183/yamusic-tui/stream"
 	"github.com/dece2183/yamusic-tui/ui/model"
 	loginpage "github.com/dece2183/yamusic-tui/ui/model/loginPage"
 	mainpage "github.com/dece2183/yamusic-tui/ui/model/mainPage"
@@ -11,17 +15,29 @@ import (
 func Run() {
 	var err error
 
-	if config.Current.Token == "" {
-		err = loginpage.New().Run()
+	stream.SetMemoryLimit(int64(config.Current.StreamMemory * 1024 * 1024))
+
+	for {
+		if config.Current.Token == "" {
+			err = loginpage.New().Run()
+			if err != nil {
+				log.Print(log.LVL_PANIC, err.Error())
+				model.PrettyExit(err, 4)
+			}
+		}
+
+		err = mainpage.New().Run()
+		if errors.Is(err, api.ErrAuthExpired) {
+			// ask for a new token
+			log.Print(log.LVL_WARNIGN, err.Error())
+			config.Current.Token = ""
+			continue
+		}
 		if err != nil {
 			log.Print(log.LVL_PANIC, err.Error())
-			model.PrettyExit(err, 4)
+			model.PrettyExit(err, 6)
 		}
-	}
 
-	err = mainpage.New().Run()
-	if err != nil {
-		log.Print(log.LVL_PANIC, err.Error())
-		model.PrettyExit(err, 6)
+		return
 	}
 }